@@ -1,4 +1,4 @@
-import { ClientStatus, ServerMessageDetails, ServerMessageType, Status } from './types';
+import { ClientStatus, Room, RoomDelta, ServerMessageDetails, ServerMessageType, Status } from './types';
 
 import { getState } from './state';
 import { triggerClientMessage, triggerCoreAction } from './events';
@@ -14,6 +14,7 @@ const actionList = new Map<ServerMessageType, (action: ServerMessageDetails[Serv
 	['HostRoom', onConnectionResponseHostRoom],
 	['JoinRoom', onConnectionResponseJoinRoom],
 	['UpdateRoom', onConnectionResponseUpdateRoom],
+	['ResyncRoom', onConnectionResponseResyncRoom],
 	['DisconnectRoom', onConnectionResponseDisconnectRoom],
 	['ReflectRoom', onConnectionResponseReflectRoom],
 	['ReflectVideoDetails', onConnectionResponseReflectVideoDetails],
@@ -75,7 +76,16 @@ function onConnectionResponseJoinRoom(action: ServerMessageDetails['JoinRoom'])
 
 function onConnectionResponseUpdateRoom(action: ServerMessageDetails['UpdateRoom']) {
 	if(getState().clientStatus === 'innactive') return;
-	getState().room = { ...action };
+
+	const room = getState().room;
+	if(action.revision <= room.revision) return;
+
+	if(action.revision !== room.revision + 1) {
+		getState().connection!.send(JSON.stringify({ version: SERVER_VERSION, actionType: 'ResyncRoom', action: JSON.stringify({ revision: room.revision }) }));
+		return;
+	}
+
+	getState().room = applyRoomDelta(room, action);
 
 	triggerCoreAction('SendRoomUIUpdateRoom', { room: getState().room, status: getState().clientStatus });
 	triggerCoreAction('SendPlayerInterceptorClientStatus', {
@@ -86,6 +96,34 @@ function onConnectionResponseUpdateRoom(action: ServerMessageDetails['UpdateRoom
 	});
 }
 
+function onConnectionResponseResyncRoom(action: ServerMessageDetails['ResyncRoom']) {
+	if(getState().clientStatus === 'innactive') return;
+
+	if(action.room != null) {
+		getState().room = { ...action.room };
+	} else {
+		for(const delta of action.deltas ?? []) {
+			if(delta.revision !== getState().room.revision + 1) continue;
+			getState().room = applyRoomDelta(getState().room, delta);
+		}
+	}
+
+	triggerCoreAction('SendRoomUIUpdateRoom', { room: getState().room, status: getState().clientStatus });
+}
+
+function applyRoomDelta(room: Room, delta: RoomDelta): Room {
+	switch(delta.type) {
+		case 'ViewerJoined':
+			return { ...room, revision: delta.revision, viewers: [...room.viewers, delta.client] };
+		case 'ViewerLeft':
+			return { ...room, revision: delta.revision, viewers: room.viewers.filter(viewer => viewer.publicToken !== delta.client.publicToken) };
+		case 'HostChanged':
+			return { ...room, revision: delta.revision, host: delta.client };
+		case 'SettingsChanged':
+			return { ...room, revision: delta.revision, settings: delta.settings };
+	}
+}
+
 function onConnectionResponseDisconnectRoom() {
 	getState().clientStatus = 'innactive';
 	getState().room = {
@@ -96,6 +134,7 @@ function onConnectionResponseDisconnectRoom() {
 			name: '',
 		},
 		createdAt: -1,
+		revision: 0,
 	};
 	getState().isShowingTruePage = true;
 
@@ -126,6 +126,7 @@ function ClientContextProvider({ children }) {
 		viewers: [],
 		settings: { name: '' },
 		createdAt: -1,
+		revision: 0,
 	});
 	const [hidden, setHidden] = useState(true);
 
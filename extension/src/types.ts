@@ -53,6 +53,16 @@ export type Room = {
 	viewers: Client[],
 	settings: RoomSettings,
 	createdAt: Timestamp,
+	revision: number,
+};
+
+export type RoomDeltaType = 'ViewerJoined' | 'ViewerLeft' | 'HostChanged' | 'SettingsChanged';
+
+export type RoomDelta = {
+	revision: number,
+	type: RoomDeltaType,
+	client?: Client,
+	settings?: RoomSettings,
 };
 
 export type RoomSettings = {
@@ -146,7 +156,11 @@ export type ServerMessageDetails = {
 		room: Room,
 		clientType: number,
 	},
-	'UpdateRoom': Room,
+	'UpdateRoom': RoomDelta,
+	'ResyncRoom': {
+		deltas?: RoomDelta[],
+		room?: Room,
+	},
 	'DisconnectRoom': {},
 	'ReflectRoom': ReflectionSnapshot,
 	'ReflectVideoDetails': VideoDetails,
@@ -0,0 +1,328 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cowatch/logger"
+)
+
+const EndpointAdminRooms = "/admin/rooms"
+const EndpointAdminRoom = "/admin/rooms/{roomID}"
+const EndpointAdminClients = "/admin/clients"
+const EndpointAdminClient = "/admin/clients/{publicToken}"
+const EndpointAdminAnnouncements = "/admin/announcements"
+const EndpointAdminLogLevel = "/admin/log-level"
+const EndpointAdminMaintenance = "/admin/maintenance"
+
+var ErrEmptyAdminToken = errors.New("The admin api requires a token")
+
+// AdminAPI lets operators inspect and act on the rooms and clients of this node.
+//
+// Every request must carry the configured token as a bearer token. The API only reaches the
+// rooms and connections held by this node, in a cluster every node has to be asked separately.
+type AdminAPI struct {
+	manager *Manager
+	token   string
+}
+
+func NewAdminAPI(manager *Manager, token string) (*AdminAPI, error) {
+	if token == "" {
+		return nil, ErrEmptyAdminToken
+	}
+
+	return &AdminAPI{manager: manager, token: token}, nil
+}
+
+// RegisterRoutes adds every admin endpoint to the router behind the token check.
+func (admin *AdminAPI) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("GET "+EndpointAdminRooms, admin.authorize(admin.HandleListRooms))
+	router.HandleFunc("DELETE "+EndpointAdminRoom, admin.authorize(admin.HandleCloseRoom))
+	router.HandleFunc("GET "+EndpointAdminClients, admin.authorize(admin.HandleListClients))
+	router.HandleFunc("DELETE "+EndpointAdminClient, admin.authorize(admin.HandleDisconnectClient))
+	router.HandleFunc("POST "+EndpointAdminAnnouncements, admin.authorize(admin.HandleAnnounce))
+	router.HandleFunc("GET "+EndpointAdminLogLevel, admin.authorize(admin.HandleGetLogLevel))
+	router.HandleFunc("PUT "+EndpointAdminLogLevel, admin.authorize(admin.HandleSetLogLevel))
+	router.HandleFunc("GET "+EndpointAdminMaintenance, admin.authorize(admin.HandleGetMaintenance))
+	router.HandleFunc("PUT "+EndpointAdminMaintenance, admin.authorize(admin.HandleSetMaintenance))
+}
+
+// RegisterDownloadMetrics serves the download counts of the releases behind the token check.
+func (admin *AdminAPI) RegisterDownloadMetrics(router *http.ServeMux, counter *DownloadCounter) {
+	router.HandleFunc("GET "+EndpointDownloadMetrics, admin.authorize(counter.HandleDownloadMetrics))
+}
+
+// Rejects every request that doesn't carry the admin token.
+func (admin *AdminAPI) authorize(handler http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, hasBearerToken := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !hasBearerToken || subtle.ConstantTimeCompare([]byte(token), []byte(admin.token)) != 1 {
+			logger.Warn("[%s] [Admin] Rejected unauthorized request to %s %s\n", r.RemoteAddr, r.Method, r.URL.Path)
+			w.Header().Set("WWW-Authenticate", `Bearer realm="cowatch-admin"`)
+			http.Error(w, "Unauthorized.", http.StatusUnauthorized)
+			return
+		}
+
+		w.Header().Set("Cache-Control", "no-store")
+		handler(w, r)
+	}
+}
+
+// AdminRoomRecord describes a room hosted on this node.
+type AdminRoomRecord struct {
+	RoomID       RoomID         `json:"roomID"`
+	Settings     RoomSettings   `json:"settings"`
+	Host         ClientRecord   `json:"host"`
+	Viewers      []ClientRecord `json:"viewers"`
+	VideoDetails VideoDetails   `json:"videoDetails"`
+	CreatedAt    Timestamp      `json:"createdAt"`
+	AgeSeconds   int64          `json:"ageSeconds"`
+}
+
+// AdminClientRecord describes a client registered on this node.
+// The address is only known for clients connected directly to this node.
+type AdminClientRecord struct {
+	PublicToken Token     `json:"publicToken"`
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	RoomID      RoomID    `json:"roomID,omitempty"`
+	NodeID      NodeID    `json:"nodeID,omitempty"`
+	Address     string    `json:"address,omitempty"`
+	LatestReply time.Time `json:"latestReply"`
+}
+
+type AdminRequestAnnounce struct {
+	Message string   `json:"message"`
+	RoomIDs []RoomID `json:"roomIDs,omitempty"` // Announces to every connected client if empty
+}
+
+type AdminResponseAnnounce struct {
+	Recipients int `json:"recipients"`
+}
+
+type AdminLogLevel struct {
+	Level logger.LogLevel `json:"level"`
+}
+
+type AdminMaintenance struct {
+	Enabled bool   `json:"enabled"`
+	Message string `json:"message,omitempty"` // Announced to every connected client when entering maintenance mode
+}
+
+var adminClientTypeNames = map[ClientType]string{
+	ClientTypeInnactive: "inactive",
+	ClientTypeHost:      "host",
+	ClientTypeViewer:    "viewer",
+	ClientTypeCoHost:    "co-host",
+}
+
+// HandleListRooms responds with every room hosted on this node, the oldest first.
+func (admin *AdminAPI) HandleListRooms(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, admin.manager.GetAdminRooms())
+}
+
+// HandleListClients responds with every client registered on this node, the least recently active first.
+func (admin *AdminAPI) HandleListClients(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, admin.manager.GetAdminClients())
+}
+
+// HandleCloseRoom disconnects every member of a room, closing it.
+func (admin *AdminAPI) HandleCloseRoom(w http.ResponseWriter, r *http.Request) {
+	roomID := RoomID(r.PathValue("roomID"))
+	logger.Info("[%s] [Admin] Closing room %q\n", r.RemoteAddr, roomID)
+
+	if !admin.manager.CloseRoom(roomID) {
+		http.Error(w, "Room not found.", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleDisconnectClient removes a client from their room and closes their connection.
+func (admin *AdminAPI) HandleDisconnectClient(w http.ResponseWriter, r *http.Request) {
+	publicToken := Token(r.PathValue("publicToken"))
+	logger.Info("[%s] [Admin] Disconnecting client %q\n", r.RemoteAddr, publicToken)
+
+	if !admin.manager.DisconnectClient(publicToken) {
+		http.Error(w, "Client not found.", http.StatusNotFound)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// HandleAnnounce sends an announcement to the members of the requested rooms or to every client connected to this node.
+func (admin *AdminAPI) HandleAnnounce(w http.ResponseWriter, r *http.Request) {
+	var request AdminRequestAnnounce
+	if errorParsing := json.NewDecoder(r.Body).Decode(&request); errorParsing != nil || request.Message == "" {
+		http.Error(w, "Expected a json object with a message.", http.StatusBadRequest)
+		return
+	}
+
+	logger.Info("[%s] [Admin] Announcing %q to rooms %v\n", r.RemoteAddr, request.Message, request.RoomIDs)
+	recipients := admin.manager.BroadcastAnnouncement(ServerAnnouncement{Message: request.Message}, request.RoomIDs)
+
+	writeJSONResponse(w, AdminResponseAnnounce{Recipients: recipients})
+}
+
+// HandleGetLogLevel responds with the level below which messages are dropped.
+func (admin *AdminAPI) HandleGetLogLevel(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, AdminLogLevel{Level: logger.GetLevel()})
+}
+
+// HandleSetLogLevel changes the level below which messages are dropped.
+func (admin *AdminAPI) HandleSetLogLevel(w http.ResponseWriter, r *http.Request) {
+	var request AdminLogLevel
+	if errorParsing := json.NewDecoder(r.Body).Decode(&request); errorParsing != nil {
+		http.Error(w, "Expected a json object with a level.", http.StatusBadRequest)
+		return
+	}
+
+	request.Level = logger.LogLevel(strings.ToUpper(string(request.Level)))
+	if !logger.SetLevel(request.Level) {
+		http.Error(w, "Level must be one of DEBUG, INFO, WARN or ERROR.", http.StatusBadRequest)
+		return
+	}
+
+	logger.Warn("[%s] [Admin] Changed log level to %s\n", r.RemoteAddr, request.Level)
+	writeJSONResponse(w, AdminLogLevel{Level: request.Level})
+}
+
+// HandleGetMaintenance responds with whether the node accepts new rooms.
+func (admin *AdminAPI) HandleGetMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSONResponse(w, AdminMaintenance{Enabled: admin.manager.IsInMaintenanceMode()})
+}
+
+// HandleSetMaintenance enters or leaves maintenance mode.
+func (admin *AdminAPI) HandleSetMaintenance(w http.ResponseWriter, r *http.Request) {
+	var request AdminMaintenance
+	if errorParsing := json.NewDecoder(r.Body).Decode(&request); errorParsing != nil {
+		http.Error(w, "Expected a json object with enabled.", http.StatusBadRequest)
+		return
+	}
+
+	logger.Info("[%s] [Admin] Setting maintenance mode to %t\n", r.RemoteAddr, request.Enabled)
+	admin.manager.SetMaintenanceMode(request.Enabled, request.Message)
+
+	writeJSONResponse(w, AdminMaintenance{Enabled: admin.manager.IsInMaintenanceMode()})
+}
+
+// GetAdminRooms describes every room hosted on this node, the oldest first.
+func (manager *Manager) GetAdminRooms() []AdminRoomRecord {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	now := manager.clock.Now().Unix()
+	rooms := make([]AdminRoomRecord, 0, len(manager.activeRooms))
+	for _, room := range manager.activeRooms {
+		roomRecord := room.GetFilteredRoom()
+		rooms = append(rooms, AdminRoomRecord{
+			RoomID:       roomRecord.RoomID,
+			Settings:     roomRecord.Settings,
+			Host:         roomRecord.Host,
+			Viewers:      roomRecord.Viewers,
+			VideoDetails: room.VideoDetails,
+			CreatedAt:    roomRecord.CreatedAt,
+			AgeSeconds:   now - int64(roomRecord.CreatedAt),
+		})
+	}
+
+	slices.SortFunc(rooms, func(a, b AdminRoomRecord) int {
+		if a.CreatedAt != b.CreatedAt {
+			return int(a.CreatedAt - b.CreatedAt)
+		}
+
+		return strings.Compare(string(a.RoomID), string(b.RoomID))
+	})
+
+	return rooms
+}
+
+// GetAdminClients describes every client registered on this node, the least recently active first.
+func (manager *Manager) GetAdminClients() []AdminClientRecord {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	clients := make([]AdminClientRecord, 0, len(manager.clients))
+	for _, client := range manager.clients {
+		clientRecord := AdminClientRecord{
+			PublicToken: client.PublicToken,
+			Name:        client.Name,
+			Type:        adminClientTypeNames[client.Type],
+			RoomID:      client.RoomID,
+			NodeID:      client.NodeID,
+			LatestReply: client.LatestReply,
+		}
+
+		if connection, exists := manager.connectionManager.GetConnection(client.PrivateToken); exists {
+			clientRecord.Address = (*connection).GetAddr()
+		}
+
+		clients = append(clients, clientRecord)
+	}
+
+	slices.SortFunc(clients, func(a, b AdminClientRecord) int {
+		if comparison := a.LatestReply.Compare(b.LatestReply); comparison != 0 {
+			return comparison
+		}
+
+		return strings.Compare(string(a.PublicToken), string(b.PublicToken))
+	})
+
+	return clients
+}
+
+// CloseRoom disconnects the host and every viewer of a room hosted on this node.
+func (manager *Manager) CloseRoom(roomID RoomID) bool {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	room, exists := manager.GetRegisteredRoom(roomID)
+	if !exists {
+		return false
+	}
+
+	manager.sendDirectedMessages(manager.disconnectClientFromRoom(room.Host))
+	return true
+}
+
+// DisconnectClient removes a client from their room, unregisters them and closes their connection.
+// Clients connected to another node are only removed from this node's rooms.
+func (manager *Manager) DisconnectClient(publicToken Token) bool {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	privateToken, exists := manager.GetPrivateToken(publicToken)
+	if !exists {
+		return false
+	}
+
+	client, exists := manager.GetClient(privateToken)
+	if !exists {
+		return false
+	}
+
+	if ownerNode, isForwarded := manager.forwardedClients[client.PrivateToken]; isForwarded {
+		manager.forwardClientMessage(ownerNode, client, ClientMessage{ServerVersion: manager.serverVersion, MessageType: ClientMessageTypeDisconnectRoom})
+		delete(manager.forwardedClients, client.PrivateToken)
+	}
+
+	manager.sendDirectedMessages(manager.disconnectClientFromRoom(client))
+
+	if connection, isConnected := manager.connectionManager.GetConnection(client.PrivateToken); isConnected {
+		if errorClosing := (*connection).Close(); errorClosing != nil {
+			logger.Warn("[%s] Failed to close connection: %s\n", client.PrivateToken, errorClosing)
+		}
+
+		manager.connectionManager.UnregisterClientConnection(client.PrivateToken)
+	}
+
+	manager.UnregisterClient(client)
+	return true
+}
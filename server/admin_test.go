@@ -0,0 +1,287 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cowatch/logger"
+	"github.com/gorilla/websocket"
+)
+
+func TestAdminAPI(t *testing.T) {
+	t.Run("rejecting requests without the admin token", func(t *testing.T) {
+		mockServer, _ := newTestServer(t, testServerOptions{isAdmin: true})
+
+		for _, authorization := range []string{"", "Bearer wrong", testAdminToken} {
+			response, _ := requestAdminEndpoint(t, mockServer, http.MethodGet, EndpointAdminRooms, "", authorization)
+			if response.StatusCode != http.StatusUnauthorized || response.Header.Get("WWW-Authenticate") == "" {
+				t.Errorf("Expected %q to be unauthorized but got %d\n", authorization, response.StatusCode)
+			}
+		}
+	})
+
+	t.Run("refusing to create the api without a token", func(t *testing.T) {
+		_, err := NewAdminAPI(NewManager(serverVersion, NewGorillaConnectionManager()), "")
+		if err != ErrEmptyAdminToken {
+			t.Errorf("Expected %v but got %v\n", ErrEmptyAdminToken, err)
+		}
+	})
+
+	t.Run("listing rooms and clients", func(t *testing.T) {
+		mockServer, manager := newTestServer(t, testServerOptions{isAdmin: true})
+		wsHost, hostDetails := authorizeAdminTestClient(t, mockServer, "Host")
+		roomRecord := hostTestRoom(t, manager, hostDetails.PrivateToken)
+		wsViewer, viewerDetails := joinAdminTestRoom(t, mockServer, roomRecord.RoomID)
+
+		sendClientMessage(t, wsHost, ClientMessageTypeSendVideoDetails, VideoDetails{
+			Title: "Video", Author: "Author", AuthorImage: "https://example.com/image", SubscriberCount: "5", LikeCount: "100",
+		})
+		readServerMessage(t, wsViewer, ServerMessageTypeReflectVideoDetails, ServerMessageStatusOk)
+
+		_, body := requestAdminEndpoint(t, mockServer, http.MethodGet, EndpointAdminRooms, "", "Bearer "+testAdminToken)
+
+		var rooms []AdminRoomRecord
+		json.Unmarshal(body, &rooms)
+		if len(rooms) != 1 ||
+			rooms[0].RoomID != roomRecord.RoomID ||
+			rooms[0].Host.PublicToken != hostDetails.PublicToken ||
+			len(rooms[0].Viewers) != 1 ||
+			rooms[0].VideoDetails.Title != "Video" {
+
+			t.Errorf("Got rooms %s\n", body)
+		}
+
+		_, body = requestAdminEndpoint(t, mockServer, http.MethodGet, EndpointAdminClients, "", "Bearer "+testAdminToken)
+
+		var clients []AdminClientRecord
+		json.Unmarshal(body, &clients)
+
+		clientTypes := make(map[Token]string)
+		for _, client := range clients {
+			clientTypes[client.PublicToken] = client.Type
+			if client.Address == "" || client.RoomID != roomRecord.RoomID || client.LatestReply.IsZero() {
+				t.Errorf("Got incomplete client %+v\n", client)
+			}
+		}
+
+		if clientTypes[hostDetails.PublicToken] != "host" || clientTypes[viewerDetails.PublicToken] != "viewer" {
+			t.Errorf("Got clients %s\n", body)
+		}
+	})
+
+	t.Run("closing a room", func(t *testing.T) {
+		mockServer, manager := newTestServer(t, testServerOptions{isAdmin: true})
+		wsHost, hostDetails := authorizeAdminTestClient(t, mockServer, "Host")
+		roomRecord := hostTestRoom(t, manager, hostDetails.PrivateToken)
+		wsViewer, _ := joinAdminTestRoom(t, mockServer, roomRecord.RoomID)
+
+		response, _ := requestAdminEndpoint(t, mockServer, http.MethodDelete, "/admin/rooms/"+string(roomRecord.RoomID), "", "Bearer "+testAdminToken)
+		if response.StatusCode != http.StatusNoContent {
+			t.Fatalf("Expected %d but got %d\n", http.StatusNoContent, response.StatusCode)
+		}
+
+		readServerMessage(t, wsHost, ServerMessageTypeDisconnectRoom, ServerMessageStatusOk)
+		readServerMessage(t, wsViewer, ServerMessageTypeDisconnectRoom, ServerMessageStatusOk)
+
+		if len(manager.GetAdminRooms()) != 0 {
+			t.Errorf("Expected the room to be closed\n")
+		}
+
+		response, _ = requestAdminEndpoint(t, mockServer, http.MethodDelete, "/admin/rooms/"+string(roomRecord.RoomID), "", "Bearer "+testAdminToken)
+		if response.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected closing a missing room to be %d but got %d\n", http.StatusNotFound, response.StatusCode)
+		}
+	})
+
+	t.Run("disconnecting a client", func(t *testing.T) {
+		mockServer, manager := newTestServer(t, testServerOptions{isAdmin: true})
+		wsHost, hostDetails := authorizeAdminTestClient(t, mockServer, "Host")
+		roomRecord := hostTestRoom(t, manager, hostDetails.PrivateToken)
+		wsViewer, viewerDetails := joinAdminTestRoom(t, mockServer, roomRecord.RoomID)
+
+		response, _ := requestAdminEndpoint(t, mockServer, http.MethodDelete, "/admin/clients/"+string(viewerDetails.PublicToken), "", "Bearer "+testAdminToken)
+		if response.StatusCode != http.StatusNoContent {
+			t.Fatalf("Expected %d but got %d\n", http.StatusNoContent, response.StatusCode)
+		}
+
+		readServerMessage(t, wsHost, ServerMessageTypeUpdateRoom, ServerMessageStatusOk)
+		assertConnectionClosed(t, wsViewer)
+
+		if len(manager.GetAdminClients()) != 1 {
+			t.Errorf("Expected only the host to remain but got %+v\n", manager.GetAdminClients())
+		}
+	})
+
+	t.Run("announcing to every client", func(t *testing.T) {
+		mockServer, manager := newTestServer(t, testServerOptions{isAdmin: true})
+		wsHost, hostDetails := authorizeAdminTestClient(t, mockServer, "Host")
+		roomRecord := hostTestRoom(t, manager, hostDetails.PrivateToken)
+		wsViewer, _ := joinAdminTestRoom(t, mockServer, roomRecord.RoomID)
+
+		response, body := requestAdminEndpoint(t, mockServer, http.MethodPost, EndpointAdminAnnouncements, `{"message":"Restarting soon"}`, "Bearer "+testAdminToken)
+
+		var announceResponse AdminResponseAnnounce
+		json.Unmarshal(body, &announceResponse)
+		if response.StatusCode != http.StatusOK || announceResponse.Recipients != 2 {
+			t.Errorf("Got %d %s\n", response.StatusCode, body)
+		}
+
+		for _, ws := range []*websocket.Conn{wsHost, wsViewer} {
+			var announcement ServerAnnouncement
+			json.Unmarshal(readServerMessage(t, ws, ServerMessageTypeServerAnnouncement, ServerMessageStatusOk).MessageDetails, &announcement)
+			if announcement.Message != "Restarting soon" {
+				t.Errorf("Got announcement %+v\n", announcement)
+			}
+		}
+
+		response, _ = requestAdminEndpoint(t, mockServer, http.MethodPost, EndpointAdminAnnouncements, `{}`, "Bearer "+testAdminToken)
+		if response.StatusCode != http.StatusBadRequest {
+			t.Errorf("Expected an empty announcement to be %d but got %d\n", http.StatusBadRequest, response.StatusCode)
+		}
+	})
+
+	t.Run("announcing to the members of a room", func(t *testing.T) {
+		mockServer, manager := newTestServer(t, testServerOptions{isAdmin: true})
+		wsHost, hostDetails := authorizeAdminTestClient(t, mockServer, "Host")
+		roomRecord := hostTestRoom(t, manager, hostDetails.PrivateToken)
+		wsViewer, _ := joinAdminTestRoom(t, mockServer, roomRecord.RoomID)
+		wsOtherHost, otherHostDetails := authorizeAdminTestClient(t, mockServer, "Host")
+		hostTestRoom(t, manager, otherHostDetails.PrivateToken)
+
+		request := `{"message":"Room only","roomIDs":["` + string(roomRecord.RoomID) + `","missing"]}`
+		_, body := requestAdminEndpoint(t, mockServer, http.MethodPost, EndpointAdminAnnouncements, request, "Bearer "+testAdminToken)
+
+		var announceResponse AdminResponseAnnounce
+		json.Unmarshal(body, &announceResponse)
+		if announceResponse.Recipients != 2 {
+			t.Errorf("Expected 2 recipients but got %s\n", body)
+		}
+
+		readServerMessage(t, wsHost, ServerMessageTypeServerAnnouncement, ServerMessageStatusOk)
+		readServerMessage(t, wsViewer, ServerMessageTypeServerAnnouncement, ServerMessageStatusOk)
+
+		sendClientMessage(t, wsOtherHost, ClientMessageTypePing, PingPong{})
+		if serverMessage := readServerMessage(t, wsOtherHost, "", ServerMessageStatusOk); serverMessage.MessageType != ServerMessageTypePong {
+			t.Errorf("Expected the other room to not be announced to but got %q\n", serverMessage.MessageType)
+		}
+	})
+
+	t.Run("entering maintenance mode", func(t *testing.T) {
+		mockServer, manager := newTestServer(t, testServerOptions{isAdmin: true})
+		wsHost, hostDetails := authorizeAdminTestClient(t, mockServer, "Host")
+		roomRecord := hostTestRoom(t, manager, hostDetails.PrivateToken)
+
+		response, body := requestAdminEndpoint(t, mockServer, http.MethodPut, EndpointAdminMaintenance, `{"enabled":true,"message":"Restarting soon"}`, "Bearer "+testAdminToken)
+		if response.StatusCode != http.StatusOK || !strings.Contains(string(body), `"enabled":true`) {
+			t.Fatalf("Got %d %s\n", response.StatusCode, body)
+		}
+
+		var announcement ServerAnnouncement
+		json.Unmarshal(readServerMessage(t, wsHost, ServerMessageTypeServerAnnouncement, ServerMessageStatusOk).MessageDetails, &announcement)
+		if announcement != (ServerAnnouncement{Message: "Restarting soon", Maintenance: true}) {
+			t.Errorf("Got announcement %+v\n", announcement)
+		}
+
+		wsNewHost, _ := authorizeAdminTestClient(t, mockServer, "Host")
+		sendClientMessage(t, wsNewHost, ClientMessageTypeHostRoom, RoomSettings{Name: "Admin"})
+		if response := readServerMessage(t, wsNewHost, ServerMessageTypeHostRoom, ServerMessageStatusError); response.ErrorCode != ServerErrorCodeMaintenance {
+			t.Errorf("Expected %q but got %q\n", ServerErrorCodeMaintenance, response.ErrorCode)
+		}
+
+		joinAdminTestRoom(t, mockServer, roomRecord.RoomID)
+
+		requestAdminEndpoint(t, mockServer, http.MethodPut, EndpointAdminMaintenance, `{"enabled":false}`, "Bearer "+testAdminToken)
+		_, body = requestAdminEndpoint(t, mockServer, http.MethodGet, EndpointAdminMaintenance, "", "Bearer "+testAdminToken)
+		if !strings.Contains(string(body), `"enabled":false`) {
+			t.Errorf("Expected maintenance mode to be disabled but got %s\n", body)
+		}
+	})
+
+	t.Run("changing the log level", func(t *testing.T) {
+		mockServer, _ := newTestServer(t, testServerOptions{isAdmin: true})
+		previousLevel := logger.GetLevel()
+		t.Cleanup(func() { logger.SetLevel(previousLevel) })
+
+		response, body := requestAdminEndpoint(t, mockServer, http.MethodPut, EndpointAdminLogLevel, `{"level":"warn"}`, "Bearer "+testAdminToken)
+		if response.StatusCode != http.StatusOK || logger.GetLevel() != logger.LogLevelWarn {
+			t.Errorf("Got %d %s with level %q\n", response.StatusCode, body, logger.GetLevel())
+		}
+
+		_, body = requestAdminEndpoint(t, mockServer, http.MethodGet, EndpointAdminLogLevel, "", "Bearer "+testAdminToken)
+		var got AdminLogLevel
+		json.Unmarshal(body, &got)
+		if got.Level != logger.LogLevelWarn {
+			t.Errorf("Got %s\n", body)
+		}
+
+		response, _ = requestAdminEndpoint(t, mockServer, http.MethodPut, EndpointAdminLogLevel, `{"level":"LOUD"}`, "Bearer "+testAdminToken)
+		if response.StatusCode != http.StatusBadRequest || logger.GetLevel() != logger.LogLevelWarn {
+			t.Errorf("Expected an unknown level to be rejected but got %d\n", response.StatusCode)
+		}
+	})
+}
+
+func requestAdminEndpoint(t *testing.T, mockServer *httptest.Server, method string, path string, body string, authorization string) (*http.Response, []byte) {
+	t.Helper()
+
+	request, _ := http.NewRequest(method, mockServer.URL+path, strings.NewReader(body))
+	if authorization != "" {
+		request.Header.Set("Authorization", authorization)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Failed to request %s %q: %v\n", method, path, err)
+	}
+	defer response.Body.Close()
+
+	responseBody, _ := io.ReadAll(response.Body)
+	return response, responseBody
+}
+
+func authorizeAdminTestClient(t *testing.T, mockServer *httptest.Server, name string) (*websocket.Conn, ServerResponseAuthorizeRoom) {
+	t.Helper()
+
+	ws, err := connectToServer(mockServer)
+	if err != nil {
+		t.Fatalf("Failed to connect: %v\n", err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	sendClientMessage(t, ws, ClientMessageTypeAuthorize, ClientRequestAuthorizeRoom{Name: name})
+
+	var details ServerResponseAuthorizeRoom
+	json.Unmarshal(readServerMessage(t, ws, ServerMessageTypeAuthorize, ServerMessageStatusOk).MessageDetails, &details)
+
+	return ws, details
+}
+
+func joinAdminTestRoom(t *testing.T, mockServer *httptest.Server, roomID RoomID) (*websocket.Conn, ServerResponseAuthorizeRoom) {
+	t.Helper()
+
+	ws, details := authorizeAdminTestClient(t, mockServer, "Viewer")
+	sendClientMessage(t, ws, ClientMessageTypeJoinRoom, ClientRequestJoinRoom{RoomID: roomID})
+	readServerMessage(t, ws, ServerMessageTypeJoinRoom, ServerMessageStatusOk)
+
+	return ws, details
+}
+
+func assertConnectionClosed(t *testing.T, ws *websocket.Conn) {
+	t.Helper()
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	for {
+		if _, _, err := ws.ReadMessage(); err != nil {
+			if netErr, isTimeout := err.(interface{ Timeout() bool }); isTimeout && netErr.Timeout() {
+				t.Fatalf("Expected the connection to be closed\n")
+			}
+
+			return
+		}
+	}
+}
@@ -0,0 +1,308 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cowatch/logger"
+	"github.com/cowatch/protocol"
+)
+
+// NodeID identifies a server instance connected to a [Backplane].
+type NodeID = protocol.NodeID
+
+// StandaloneNodeID is the id of a node that doesn't share it's rooms with other nodes.
+const StandaloneNodeID NodeID = "standalone"
+
+var ErrUnknownNode = errors.New("Node is not connected to the backplane")
+var ErrBackplaneClosed = errors.New("Backplane is closed")
+var ErrBackplaneNotSubscribed = errors.New("Backplane isn't delivering messages to the node")
+var ErrRoomOwnedElsewhere = errors.New("Room is owned by another node")
+
+// The longest a health check waits for the backplane to respond.
+const BackplanePingTimeout = 2 * time.Second
+
+// Backplane connects multiple server instances so that clients connected to different nodes
+// can share a room.
+//
+// Every room is owned by exactly one node which holds its state and handles every message
+// sent in it. Clients connected elsewhere have their messages forwarded to the owner and
+// the owner routes the resulting messages back to the node holding their connection.
+type Backplane interface {
+
+	// GetNodeID returns the identifier of the node the backplane was created for.
+	GetNodeID() NodeID
+
+	// ClaimRoom attempts to make the node the owner of a room.
+	// Claiming a room the node already owns succeeds and renews the claim if it expires.
+	ClaimRoom(roomID RoomID) (bool, error)
+
+	// ReleaseRoom gives up the ownership of a room if the node owns it.
+	ReleaseRoom(roomID RoomID) error
+
+	// GetRoomOwner returns the node that owns the room.
+	GetRoomOwner(roomID RoomID) (NodeID, bool, error)
+
+	// SendEnvelope delivers an envelope to a single node.
+	SendEnvelope(nodeID NodeID, envelope BackplaneEnvelope) error
+
+	// PublishRoomEvent broadcasts a room event to every other node.
+	PublishRoomEvent(event RoomEvent) error
+
+	// Subscribe starts delivering the envelopes sent to the node and the room events published
+	// by other nodes. Handlers are called one at a time in the order they were received.
+	Subscribe(onEnvelope func(BackplaneEnvelope), onRoomEvent func(RoomEvent)) error
+
+	// PingStore reports whether the shared room ownership can be reached.
+	PingStore() error
+
+	// PingSubscription reports whether messages are still being delivered to the node.
+	PingSubscription() error
+
+	// Close stops the delivery of messages and releases the backplane's resources.
+	Close() error
+}
+
+type BackplaneEnvelopeType string
+
+const (
+	// A message of a client that should be handled by the node owning the client's room.
+	BackplaneEnvelopeTypeClientMessage = "ClientMessage"
+
+	// A message that should be sent to a client connected to the receiving node.
+	BackplaneEnvelopeTypeServerMessage = "ServerMessage"
+)
+
+type BackplaneEnvelope struct {
+	Type          BackplaneEnvelopeType `json:"type"`
+	SourceNode    NodeID                `json:"sourceNode"`
+	PrivateToken  Token                 `json:"privateToken"`
+	Client        *RemoteClientDetails  `json:"client,omitempty"`
+	ClientMessage *ClientMessage        `json:"clientMessage,omitempty"`
+	ServerMessage *ServerMessage        `json:"serverMessage,omitempty"`
+}
+
+// RemoteClientDetails are the details of a client that the owner of a room needs
+// to represent a client connected to another node.
+type RemoteClientDetails struct {
+	PublicToken Token  `json:"publicToken"`
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	Locale      Locale `json:"locale"`
+}
+
+type RoomEventType string
+
+const (
+	RoomEventTypeCreated = "RoomCreated"
+	RoomEventTypeClosed  = "RoomClosed"
+)
+
+type RoomEvent struct {
+	Type   RoomEventType `json:"type"`
+	RoomID RoomID        `json:"roomID"`
+	NodeID NodeID        `json:"nodeID"`
+}
+
+// Handles a message of a client connected to this node.
+// Messages of clients that belong to a room owned by another node are forwarded to that node,
+// every other message is handled locally.
+func (manager *Manager) processClientMessage(client *Client, clientMessage ClientMessage) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	client.LatestReply = manager.clock.Now()
+
+	ownerNode, isRemote := manager.getClientMessageOwner(client, clientMessage)
+	if isRemote {
+		manager.forwardClientMessage(ownerNode, client, clientMessage)
+		return
+	}
+
+	manager.sendDirectedMessages(manager.handleClientMessage(client, clientMessage))
+}
+
+// Finds the node that should handle the client's message.
+// A JoinRoom is sent to the owner of the requested room, while any other message follows
+// the client to the node owning the room they are currently in.
+func (manager *Manager) getClientMessageOwner(client *Client, clientMessage ClientMessage) (NodeID, bool) {
+	if clientMessage.MessageType == ClientMessageTypeAuthorize || !manager.IsClientRegistered(client) {
+		return "", false
+	}
+
+	currentOwner, isForwarded := manager.forwardedClients[client.PrivateToken]
+	if clientMessage.MessageType != ClientMessageTypeJoinRoom {
+		return currentOwner, isForwarded
+	}
+
+	var requestJoinRoom ClientRequestJoinRoom
+	if json.Unmarshal([]byte(clientMessage.Message), &requestJoinRoom) != nil {
+		return "", false
+	}
+
+	requestedOwner, isRemoteRoom := manager.getRemoteRoomOwner(requestJoinRoom.RoomID)
+
+	if isForwarded && (!isRemoteRoom || requestedOwner != currentOwner) {
+		logger.Info("[%s] [Backplane] Leaving room owned by %q\n", client.PrivateToken, currentOwner)
+		manager.forwardClientMessage(currentOwner, client, ClientMessage{ServerVersion: manager.serverVersion, MessageType: ClientMessageTypeDisconnectRoom})
+		delete(manager.forwardedClients, client.PrivateToken)
+	}
+
+	if isRemoteRoom && client.RoomID != "" {
+		manager.sendDirectedMessages(manager.disconnectClientFromRoom(client))
+	}
+
+	return requestedOwner, isRemoteRoom
+}
+
+// Returns the owner of a room that isn't hosted on this node.
+func (manager *Manager) getRemoteRoomOwner(roomID RoomID) (NodeID, bool) {
+	if _, isLocal := manager.activeRooms[roomID]; isLocal {
+		return "", false
+	}
+
+	if ownerNode, isKnown := manager.remoteRooms[roomID]; isKnown {
+		return ownerNode, true
+	}
+
+	ownerNode, exists, errorGettingOwner := manager.backplane.GetRoomOwner(roomID)
+	if errorGettingOwner != nil {
+		logger.Error("[%s] [Backplane] Failed to get room owner: %s\n", roomID, errorGettingOwner)
+		return "", false
+	}
+
+	if !exists || ownerNode == manager.backplane.GetNodeID() {
+		return "", false
+	}
+
+	return ownerNode, true
+}
+
+func (manager *Manager) forwardClientMessage(ownerNode NodeID, client *Client, clientMessage ClientMessage) {
+	logger.Info("[%s] [%s] Forwarding message to %q\n", client.PrivateToken, clientMessage.MessageType, ownerNode)
+
+	errorSending := manager.backplane.SendEnvelope(ownerNode, BackplaneEnvelope{
+		Type:         BackplaneEnvelopeTypeClientMessage,
+		SourceNode:   manager.backplane.GetNodeID(),
+		PrivateToken: client.PrivateToken,
+		Client: &RemoteClientDetails{
+			PublicToken: client.PublicToken,
+			Name:        client.Name,
+			Image:       client.Image,
+			Locale:      client.Locale,
+		},
+		ClientMessage: &clientMessage,
+	})
+
+	if errorSending != nil {
+		logger.Error("[%s] [%s] Failed to forward message to %q: %s\n", client.PrivateToken, clientMessage.MessageType, ownerNode, errorSending)
+	}
+}
+
+// Sends a message to a client whose connection lives on another node.
+func (manager *Manager) sendRemoteDirectedMessage(nodeID NodeID, directedMessage DirectedServerMessage) {
+	errorSending := manager.backplane.SendEnvelope(nodeID, BackplaneEnvelope{
+		Type:          BackplaneEnvelopeTypeServerMessage,
+		SourceNode:    manager.backplane.GetNodeID(),
+		PrivateToken:  directedMessage.token,
+		ServerMessage: &directedMessage.message,
+	})
+
+	if errorSending != nil {
+		logger.Error("[%s] [%s] Failed to send message to %q: %s\n", directedMessage.token, directedMessage.message.MessageType, nodeID, errorSending)
+	}
+}
+
+func (manager *Manager) handleBackplaneEnvelope(envelope BackplaneEnvelope) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	switch envelope.Type {
+	case BackplaneEnvelopeTypeClientMessage:
+		if envelope.Client == nil || envelope.ClientMessage == nil {
+			logger.Warn("[%s] [Backplane] Received incomplete client message from %q\n", envelope.PrivateToken, envelope.SourceNode)
+			return
+		}
+
+		client := manager.getRemoteClient(envelope.SourceNode, envelope.PrivateToken, *envelope.Client)
+		manager.sendDirectedMessages(manager.handleClientMessage(client, *envelope.ClientMessage))
+	case BackplaneEnvelopeTypeServerMessage:
+		if envelope.ServerMessage == nil {
+			logger.Warn("[%s] [Backplane] Received incomplete server message from %q\n", envelope.PrivateToken, envelope.SourceNode)
+			return
+		}
+
+		manager.trackForwardedClient(envelope.SourceNode, envelope.PrivateToken, *envelope.ServerMessage)
+		manager.sendDirectedMessages([]DirectedServerMessage{{token: envelope.PrivateToken, message: *envelope.ServerMessage}})
+	default:
+		logger.Warn("[%s] [Backplane] Unknown envelope type %q from %q\n", envelope.PrivateToken, envelope.Type, envelope.SourceNode)
+	}
+}
+
+// Collects the representation of a client connected to another node, registering it
+// the first time one of it's messages is received.
+func (manager *Manager) getRemoteClient(sourceNode NodeID, privateToken Token, details RemoteClientDetails) *Client {
+	client, exists := manager.GetClient(privateToken)
+	if !exists {
+		client = NewClient(privateToken)
+	}
+
+	if client.PublicToken != details.PublicToken {
+		manager.UnregisterClient(client)
+	}
+
+	client.NodeID = sourceNode
+	client.PublicToken = details.PublicToken
+	client.Name = details.Name
+	client.Image = details.Image
+	client.Locale = details.Locale
+	client.LatestReply = manager.clock.Now()
+
+	manager.RegisterClient(client)
+	return client
+}
+
+// Keeps track of the node owning the room a local client is in, based on the replies it sends.
+func (manager *Manager) trackForwardedClient(sourceNode NodeID, privateToken Token, serverMessage ServerMessage) {
+	if serverMessage.Status != ServerMessageStatusOk {
+		return
+	}
+
+	switch serverMessage.MessageType {
+	case ServerMessageTypeHostRoom, ServerMessageTypeJoinRoom:
+		manager.forwardedClients[privateToken] = sourceNode
+	case ServerMessageTypeDisconnectRoom:
+		if manager.forwardedClients[privateToken] == sourceNode {
+			delete(manager.forwardedClients, privateToken)
+		}
+	}
+}
+
+func (manager *Manager) handleRoomEvent(event RoomEvent) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	logger.Debug("[%s] [Backplane] Received %q from %q\n", event.RoomID, event.Type, event.NodeID)
+
+	switch event.Type {
+	case RoomEventTypeCreated:
+		manager.remoteRooms[event.RoomID] = event.NodeID
+	case RoomEventTypeClosed:
+		if manager.remoteRooms[event.RoomID] == event.NodeID {
+			delete(manager.remoteRooms, event.RoomID)
+		}
+	}
+}
+
+func (manager *Manager) publishRoomEvent(eventType RoomEventType, roomID RoomID) {
+	errorPublishing := manager.backplane.PublishRoomEvent(RoomEvent{
+		Type:   eventType,
+		RoomID: roomID,
+		NodeID: manager.backplane.GetNodeID(),
+	})
+
+	if errorPublishing != nil {
+		logger.Error("[%s] [Backplane] Failed to publish %q: %s\n", roomID, eventType, errorPublishing)
+	}
+}
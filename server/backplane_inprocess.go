@@ -0,0 +1,214 @@
+package main
+
+import (
+	"sync"
+)
+
+// InProcessBackplaneHub connects the [InProcessBackplane]s of nodes running in the same process.
+//
+// A hub with a single node is what a standalone server uses, while multiple nodes are mostly
+// useful to exercise the clustering logic without any external services.
+type InProcessBackplaneHub struct {
+	mutex      sync.Mutex
+	nodes      map[NodeID]*InProcessBackplane
+	roomOwners map[RoomID]NodeID
+}
+
+func NewInProcessBackplaneHub() *InProcessBackplaneHub {
+	return &InProcessBackplaneHub{
+		nodes:      make(map[NodeID]*InProcessBackplane),
+		roomOwners: make(map[RoomID]NodeID),
+	}
+}
+
+// InProcessBackplane is a [Backplane] that delivers messages through a shared [InProcessBackplaneHub].
+type InProcessBackplane struct {
+	hub    *InProcessBackplaneHub
+	nodeID NodeID
+
+	mutex    sync.Mutex
+	signal   *sync.Cond
+	queue    []func()
+	isClosed bool
+
+	onEnvelope  func(BackplaneEnvelope)
+	onRoomEvent func(RoomEvent)
+}
+
+// NewInProcessBackplane connects a node to the hub.
+// Connecting a node with an existing id replaces the previous node.
+func NewInProcessBackplane(hub *InProcessBackplaneHub, nodeID NodeID) *InProcessBackplane {
+	backplane := &InProcessBackplane{
+		hub:    hub,
+		nodeID: nodeID,
+		queue:  make([]func(), 0, 64),
+	}
+	backplane.signal = sync.NewCond(&backplane.mutex)
+
+	hub.mutex.Lock()
+	hub.nodes[nodeID] = backplane
+	hub.mutex.Unlock()
+
+	return backplane
+}
+
+func (backplane *InProcessBackplane) GetNodeID() NodeID {
+	return backplane.nodeID
+}
+
+func (backplane *InProcessBackplane) ClaimRoom(roomID RoomID) (bool, error) {
+	backplane.hub.mutex.Lock()
+	defer backplane.hub.mutex.Unlock()
+
+	ownerNode, isOwned := backplane.hub.roomOwners[roomID]
+	if isOwned {
+		return ownerNode == backplane.nodeID, nil
+	}
+
+	backplane.hub.roomOwners[roomID] = backplane.nodeID
+	return true, nil
+}
+
+func (backplane *InProcessBackplane) ReleaseRoom(roomID RoomID) error {
+	backplane.hub.mutex.Lock()
+	defer backplane.hub.mutex.Unlock()
+
+	if backplane.hub.roomOwners[roomID] == backplane.nodeID {
+		delete(backplane.hub.roomOwners, roomID)
+	}
+
+	return nil
+}
+
+func (backplane *InProcessBackplane) GetRoomOwner(roomID RoomID) (NodeID, bool, error) {
+	backplane.hub.mutex.Lock()
+	defer backplane.hub.mutex.Unlock()
+
+	ownerNode, isOwned := backplane.hub.roomOwners[roomID]
+	return ownerNode, isOwned, nil
+}
+
+func (backplane *InProcessBackplane) SendEnvelope(nodeID NodeID, envelope BackplaneEnvelope) error {
+	backplane.hub.mutex.Lock()
+	receiver, exists := backplane.hub.nodes[nodeID]
+	backplane.hub.mutex.Unlock()
+
+	if !exists {
+		return ErrUnknownNode
+	}
+
+	receiver.enqueue(func() {
+		if receiver.onEnvelope != nil {
+			receiver.onEnvelope(envelope)
+		}
+	})
+
+	return nil
+}
+
+func (backplane *InProcessBackplane) PublishRoomEvent(event RoomEvent) error {
+	backplane.hub.mutex.Lock()
+	receivers := make([]*InProcessBackplane, 0, len(backplane.hub.nodes))
+	for nodeID, receiver := range backplane.hub.nodes {
+		if nodeID != backplane.nodeID {
+			receivers = append(receivers, receiver)
+		}
+	}
+	backplane.hub.mutex.Unlock()
+
+	for _, receiver := range receivers {
+		receiver.enqueue(func() {
+			if receiver.onRoomEvent != nil {
+				receiver.onRoomEvent(event)
+			}
+		})
+	}
+
+	return nil
+}
+
+func (backplane *InProcessBackplane) Subscribe(onEnvelope func(BackplaneEnvelope), onRoomEvent func(RoomEvent)) error {
+	backplane.mutex.Lock()
+	backplane.onEnvelope = onEnvelope
+	backplane.onRoomEvent = onRoomEvent
+	backplane.mutex.Unlock()
+
+	go backplane.deliver()
+	return nil
+}
+
+func (backplane *InProcessBackplane) PingStore() error {
+	backplane.mutex.Lock()
+	defer backplane.mutex.Unlock()
+
+	if backplane.isClosed {
+		return ErrBackplaneClosed
+	}
+
+	return nil
+}
+
+func (backplane *InProcessBackplane) PingSubscription() error {
+	backplane.mutex.Lock()
+	defer backplane.mutex.Unlock()
+
+	if backplane.isClosed {
+		return ErrBackplaneClosed
+	}
+
+	if backplane.onEnvelope == nil {
+		return ErrBackplaneNotSubscribed
+	}
+
+	return nil
+}
+
+func (backplane *InProcessBackplane) Close() error {
+	backplane.hub.mutex.Lock()
+	if backplane.hub.nodes[backplane.nodeID] == backplane {
+		delete(backplane.hub.nodes, backplane.nodeID)
+	}
+	backplane.hub.mutex.Unlock()
+
+	backplane.mutex.Lock()
+	backplane.isClosed = true
+	backplane.signal.Broadcast()
+	backplane.mutex.Unlock()
+
+	return nil
+}
+
+// Queues a delivery without blocking the sender, which might be holding it's own manager's lock.
+func (backplane *InProcessBackplane) enqueue(delivery func()) {
+	backplane.mutex.Lock()
+	defer backplane.mutex.Unlock()
+
+	if backplane.isClosed {
+		return
+	}
+
+	backplane.queue = append(backplane.queue, delivery)
+	backplane.signal.Signal()
+}
+
+// Runs the queued deliveries in order until the backplane is closed.
+func (backplane *InProcessBackplane) deliver() {
+	for {
+		backplane.mutex.Lock()
+		for len(backplane.queue) == 0 && !backplane.isClosed {
+			backplane.signal.Wait()
+		}
+
+		if backplane.isClosed {
+			backplane.mutex.Unlock()
+			return
+		}
+
+		delivery := backplane.queue[0]
+		backplane.queue[0] = nil
+		backplane.queue = backplane.queue[1:]
+		backplane.mutex.Unlock()
+
+		delivery()
+	}
+}
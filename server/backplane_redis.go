@@ -0,0 +1,205 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"time"
+
+	"github.com/cowatch/logger"
+	"github.com/redis/go-redis/v9"
+)
+
+const redisKeyPrefix = "cowatch:"
+const redisRoomEventsChannel = redisKeyPrefix + "rooms"
+
+// Deletes the key only if it still holds the expected value so a node can't release
+// a room that has been claimed by another node in the meantime.
+var redisReleaseRoomScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("DEL", KEYS[1])
+end
+return 0
+`)
+
+// Sets the key or extends it's expiry if it's already held by the node, so claiming a room
+// the node owns renews the lease on it.
+var redisClaimRoomScript = redis.NewScript(`
+local owner = redis.call("GET", KEYS[1])
+if owner == false then
+	redis.call("SET", KEYS[1], ARGV[1], "PX", ARGV[2])
+	return 1
+end
+if owner == ARGV[1] then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+	return 1
+end
+return 0
+`)
+
+// RedisBackplane is a [Backplane] that shares the ownership of rooms through redis keys
+// and delivers messages through redis pub/sub channels.
+//
+// Room keys are leases that expire unless they're claimed again in time, so the rooms of a node
+// that went down without releasing them can be claimed by the others.
+type RedisBackplane struct {
+	client        *redis.Client
+	pubsub        *redis.PubSub
+	nodeID        NodeID
+	leaseDuration time.Duration
+
+	context context.Context
+	cancel  context.CancelFunc
+}
+
+// NewRedisBackplane connects to the redis server at the address and verifies it's reachable.
+// The claims on rooms expire after the lease duration unless they're renewed.
+func NewRedisBackplane(address string, nodeID NodeID, leaseDuration time.Duration) (*RedisBackplane, error) {
+	backplaneContext, cancel := context.WithCancel(context.Background())
+	client := redis.NewClient(&redis.Options{Addr: address})
+
+	errorPinging := client.Ping(backplaneContext).Err()
+	if errorPinging != nil {
+		cancel()
+		client.Close()
+		return nil, errorPinging
+	}
+
+	return &RedisBackplane{
+		client:        client,
+		nodeID:        nodeID,
+		leaseDuration: leaseDuration,
+		context:       backplaneContext,
+		cancel:        cancel,
+	}, nil
+}
+
+func (backplane *RedisBackplane) GetNodeID() NodeID {
+	return backplane.nodeID
+}
+
+func (backplane *RedisBackplane) ClaimRoom(roomID RoomID) (bool, error) {
+	leaseMilliseconds := backplane.leaseDuration.Milliseconds()
+	isClaimed, errorClaiming := redisClaimRoomScript.Run(backplane.context, backplane.client, []string{redisRoomKey(roomID)}, string(backplane.nodeID), leaseMilliseconds).Int()
+	return isClaimed == 1, errorClaiming
+}
+
+func (backplane *RedisBackplane) ReleaseRoom(roomID RoomID) error {
+	return redisReleaseRoomScript.Run(backplane.context, backplane.client, []string{redisRoomKey(roomID)}, string(backplane.nodeID)).Err()
+}
+
+func (backplane *RedisBackplane) GetRoomOwner(roomID RoomID) (NodeID, bool, error) {
+	ownerNode, errorGettingOwner := backplane.client.Get(backplane.context, redisRoomKey(roomID)).Result()
+	if errors.Is(errorGettingOwner, redis.Nil) {
+		return "", false, nil
+	}
+
+	if errorGettingOwner != nil {
+		return "", false, errorGettingOwner
+	}
+
+	return NodeID(ownerNode), true, nil
+}
+
+func (backplane *RedisBackplane) SendEnvelope(nodeID NodeID, envelope BackplaneEnvelope) error {
+	rawEnvelope, errorMarshaling := json.Marshal(envelope)
+	if errorMarshaling != nil {
+		return errorMarshaling
+	}
+
+	receivers, errorPublishing := backplane.client.Publish(backplane.context, redisNodeChannel(nodeID), rawEnvelope).Result()
+	if errorPublishing != nil {
+		return errorPublishing
+	}
+
+	if receivers == 0 {
+		return ErrUnknownNode
+	}
+
+	return nil
+}
+
+func (backplane *RedisBackplane) PublishRoomEvent(event RoomEvent) error {
+	rawEvent, errorMarshaling := json.Marshal(event)
+	if errorMarshaling != nil {
+		return errorMarshaling
+	}
+
+	return backplane.client.Publish(backplane.context, redisRoomEventsChannel, rawEvent).Err()
+}
+
+func (backplane *RedisBackplane) Subscribe(onEnvelope func(BackplaneEnvelope), onRoomEvent func(RoomEvent)) error {
+	pubsub := backplane.client.Subscribe(backplane.context, redisNodeChannel(backplane.nodeID), redisRoomEventsChannel)
+
+	// Waits for the subscription to be confirmed so no message sent after Subscribe returns is lost.
+	_, errorSubscribing := pubsub.Receive(backplane.context)
+	if errorSubscribing != nil {
+		pubsub.Close()
+		return errorSubscribing
+	}
+
+	backplane.pubsub = pubsub
+	go func() {
+		for message := range pubsub.Channel() {
+			if message.Channel == redisRoomEventsChannel {
+				var event RoomEvent
+				if errorParsing := json.Unmarshal([]byte(message.Payload), &event); errorParsing != nil {
+					logger.Warn("[Backplane] Received malformed room event: %s\n", errorParsing)
+					continue
+				}
+
+				if event.NodeID != backplane.nodeID {
+					onRoomEvent(event)
+				}
+
+				continue
+			}
+
+			var envelope BackplaneEnvelope
+			if errorParsing := json.Unmarshal([]byte(message.Payload), &envelope); errorParsing != nil {
+				logger.Warn("[Backplane] Received malformed envelope: %s\n", errorParsing)
+				continue
+			}
+
+			onEnvelope(envelope)
+		}
+	}()
+
+	return nil
+}
+
+func (backplane *RedisBackplane) PingStore() error {
+	pingContext, cancel := context.WithTimeout(backplane.context, BackplanePingTimeout)
+	defer cancel()
+
+	return backplane.client.Ping(pingContext).Err()
+}
+
+// Pings through the subscription's own connection, which is the one delivering messages.
+func (backplane *RedisBackplane) PingSubscription() error {
+	if backplane.pubsub == nil {
+		return ErrBackplaneNotSubscribed
+	}
+
+	pingContext, cancel := context.WithTimeout(backplane.context, BackplanePingTimeout)
+	defer cancel()
+
+	return backplane.pubsub.Ping(pingContext)
+}
+
+func (backplane *RedisBackplane) Close() error {
+	if backplane.pubsub != nil {
+		backplane.pubsub.Close()
+	}
+
+	backplane.cancel()
+	return backplane.client.Close()
+}
+
+func redisRoomKey(roomID RoomID) string {
+	return redisKeyPrefix + "room:" + string(roomID)
+}
+
+func redisNodeChannel(nodeID NodeID) string {
+	return redisKeyPrefix + "node:" + string(nodeID)
+}
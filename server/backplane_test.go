@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestInProcessBackplane(t *testing.T) {
+	t.Run("clients of different nodes sharing a room", func(t *testing.T) {
+		hub := NewInProcessBackplaneHub()
+		backplaneA := NewInProcessBackplane(hub, "A")
+		backplaneB := NewInProcessBackplane(hub, "B")
+		defer backplaneA.Close()
+		defer backplaneB.Close()
+
+		assertCrossNodeRoom(t, backplaneA, backplaneB)
+	})
+
+	t.Run("only one node owning a room", func(t *testing.T) {
+		hub := NewInProcessBackplaneHub()
+		backplaneA := NewInProcessBackplane(hub, "A")
+		backplaneB := NewInProcessBackplane(hub, "B")
+
+		assertRoomOwnership(t, backplaneA, backplaneB)
+	})
+
+	t.Run("sending to a node that isn't connected", func(t *testing.T) {
+		backplane := NewInProcessBackplane(NewInProcessBackplaneHub(), "A")
+
+		err := backplane.SendEnvelope("B", BackplaneEnvelope{Type: BackplaneEnvelopeTypeServerMessage})
+		if err != ErrUnknownNode {
+			t.Errorf("Expected %v but got %v\n", ErrUnknownNode, err)
+		}
+	})
+}
+
+func TestRedisBackplane(t *testing.T) {
+	t.Run("clients of different nodes sharing a room", func(t *testing.T) {
+		redisServer := miniredis.RunT(t)
+
+		backplaneA := newTestRedisBackplane(t, redisServer, "A")
+		backplaneB := newTestRedisBackplane(t, redisServer, "B")
+
+		assertCrossNodeRoom(t, backplaneA, backplaneB)
+	})
+
+	t.Run("only one node owning a room", func(t *testing.T) {
+		redisServer := miniredis.RunT(t)
+
+		backplaneA := newTestRedisBackplane(t, redisServer, "A")
+		backplaneB := newTestRedisBackplane(t, redisServer, "B")
+
+		assertRoomOwnership(t, backplaneA, backplaneB)
+	})
+
+	t.Run("sending to a node that isn't subscribed", func(t *testing.T) {
+		redisServer := miniredis.RunT(t)
+		backplane := newTestRedisBackplane(t, redisServer, "A")
+
+		err := backplane.SendEnvelope("B", BackplaneEnvelope{Type: BackplaneEnvelopeTypeServerMessage})
+		if err != ErrUnknownNode {
+			t.Errorf("Expected %v but got %v\n", ErrUnknownNode, err)
+		}
+	})
+
+	t.Run("expiring the claims that aren't renewed", func(t *testing.T) {
+		redisServer := miniredis.RunT(t)
+		backplaneA := newTestRedisBackplane(t, redisServer, "A")
+		backplaneB := newTestRedisBackplane(t, redisServer, "B")
+
+		backplaneA.ClaimRoom("room")
+		redisServer.FastForward(testRedisLeaseDuration / 2)
+		backplaneA.ClaimRoom("room")
+		redisServer.FastForward(testRedisLeaseDuration / 2)
+
+		if claimed, err := backplaneB.ClaimRoom("room"); claimed || err != nil {
+			t.Errorf("Node B claimed a room node A renewed it's claim on (claimed: %t, err: %v)\n", claimed, err)
+		}
+
+		redisServer.FastForward(testRedisLeaseDuration)
+		if claimed, err := backplaneB.ClaimRoom("room"); !claimed || err != nil {
+			t.Errorf("Node B failed to claim a room node A stopped renewing (claimed: %t, err: %v)\n", claimed, err)
+		}
+	})
+
+	t.Run("connecting to a redis server that isn't running", func(t *testing.T) {
+		redisServer := miniredis.RunT(t)
+		address := redisServer.Addr()
+		redisServer.Close()
+
+		_, err := NewRedisBackplane(address, "A", testRedisLeaseDuration)
+		if err == nil {
+			t.Errorf("Expected an error connecting to a closed server\n")
+		}
+	})
+}
+
+func TestRoomClaims(t *testing.T) {
+	t.Run("failing to host a room that can't be claimed", func(t *testing.T) {
+		hub := NewInProcessBackplaneHub()
+		manager := NewManagerWithBackplane(serverVersion, NewGorillaConnectionManager(), &unclaimableBackplane{NewInProcessBackplane(hub, "A")})
+		clock := NewFakeClock(time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC))
+		manager.SetClock(clock)
+
+		host := newTestAuthorizedClient(t, manager, clock, "Host")
+		serverMessages := manager.handleClientMessage(host, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeHostRoom, Message: `{"name":"Test"}`})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeInternalServerError {
+			t.Errorf("Expected hosting to fail but got %+v\n", serverMessages)
+		}
+
+		if len(manager.activeRooms) != 0 || host.RoomID != "" {
+			t.Errorf("Expected no room to be registered but got %+v with the host in %q\n", manager.activeRooms, host.RoomID)
+		}
+	})
+
+	t.Run("closing the rooms claimed by another node", func(t *testing.T) {
+		hub := NewInProcessBackplaneHub()
+		manager := NewManagerWithBackplane(serverVersion, NewGorillaConnectionManager(), NewInProcessBackplane(hub, "A"))
+		clock := NewFakeClock(time.Date(2024, 5, 1, 20, 0, 0, 0, time.UTC))
+		manager.SetClock(clock)
+
+		host, _ := newTestRoomMember(t, manager, clock, "Host")
+		roomID := hostTestRoom(t, manager, host.PrivateToken).RoomID
+
+		manager.RenewRoomClaims()
+		if _, exists := manager.GetRegisteredRoom(roomID); !exists {
+			t.Fatalf("Expected the room to be kept while it's claimed\n")
+		}
+
+		hub.roomOwners[roomID] = "B"
+		manager.RenewRoomClaims()
+		if _, exists := manager.GetRegisteredRoom(roomID); exists {
+			t.Errorf("Expected the room claimed by another node to be closed\n")
+		}
+	})
+}
+
+// A backplane where another node already claimed every room.
+type unclaimableBackplane struct {
+	*InProcessBackplane
+}
+
+func (backplane *unclaimableBackplane) ClaimRoom(roomID RoomID) (bool, error) {
+	return false, nil
+}
+
+const testRedisLeaseDuration = time.Minute
+
+func newTestRedisBackplane(t *testing.T, redisServer *miniredis.Miniredis, nodeID NodeID) *RedisBackplane {
+	t.Helper()
+
+	backplane, err := NewRedisBackplane(redisServer.Addr(), nodeID, testRedisLeaseDuration)
+	if err != nil {
+		t.Fatalf("Failed to connect to redis: %v\n", err)
+	}
+	t.Cleanup(func() { backplane.Close() })
+
+	return backplane
+}
+
+// Hosts a room in the first node and has a viewer of the second node join, follow and leave it.
+func assertCrossNodeRoom(t *testing.T, backplaneA, backplaneB Backplane) {
+	t.Helper()
+
+	managerA := NewManagerWithBackplane(serverVersion, NewGorillaConnectionManager(), backplaneA)
+	managerB := NewManagerWithBackplane(serverVersion, NewGorillaConnectionManager(), backplaneB)
+
+	serverA := setupServer(managerA.HandleMessages)
+	defer serverA.Close()
+	serverB := setupServer(managerB.HandleMessages)
+	defer serverB.Close()
+
+	wsHost, err := connectToServer(serverA)
+	if err != nil {
+		t.Fatalf("Failed to connect to node A: %v\n", err)
+	}
+	defer wsHost.Close()
+
+	wsViewer, err := connectToServer(serverB)
+	if err != nil {
+		t.Fatalf("Failed to connect to node B: %v\n", err)
+	}
+	defer wsViewer.Close()
+
+	sendClientMessage(t, wsHost, ClientMessageTypeAuthorize, ClientRequestAuthorizeRoom{Name: "Host"})
+	readServerMessage(t, wsHost, ServerMessageTypeAuthorize, ServerMessageStatusOk)
+
+	sendClientMessage(t, wsHost, ClientMessageTypeHostRoom, RoomSettings{Name: "Backplane"})
+	var roomRecord RoomRecord
+	json.Unmarshal(readServerMessage(t, wsHost, ServerMessageTypeHostRoom, ServerMessageStatusOk).MessageDetails, &roomRecord)
+
+	ownerNode, isOwned, err := backplaneB.GetRoomOwner(roomRecord.RoomID)
+	if err != nil || !isOwned || ownerNode != backplaneA.GetNodeID() {
+		t.Fatalf("Expected room to be owned by %q but got %q (owned: %t, err: %v)\n", backplaneA.GetNodeID(), ownerNode, isOwned, err)
+	}
+
+	sendClientMessage(t, wsViewer, ClientMessageTypeAuthorize, ClientRequestAuthorizeRoom{Name: "Viewer"})
+	var viewerDetails ServerResponseAuthorizeRoom
+	json.Unmarshal(readServerMessage(t, wsViewer, ServerMessageTypeAuthorize, ServerMessageStatusOk).MessageDetails, &viewerDetails)
+
+	sendClientMessage(t, wsViewer, ClientMessageTypeJoinRoom, ClientRequestJoinRoom{RoomID: roomRecord.RoomID})
+	var joinedRoom struct {
+		Room RoomRecord `json:"room"`
+	}
+	json.Unmarshal(readServerMessage(t, wsViewer, ServerMessageTypeJoinRoom, ServerMessageStatusOk).MessageDetails, &joinedRoom)
+
+	if joinedRoom.Room.RoomID != roomRecord.RoomID || len(joinedRoom.Room.Viewers) != 1 || joinedRoom.Room.Viewers[0].PublicToken != viewerDetails.PublicToken {
+		t.Errorf("Viewer joined an unexpected room: %+v\n", joinedRoom.Room)
+	}
+
+	var joinDelta RoomDelta
+	json.Unmarshal(readServerMessage(t, wsHost, ServerMessageTypeUpdateRoom, ServerMessageStatusOk).MessageDetails, &joinDelta)
+	if joinDelta.Type != RoomDeltaTypeViewerJoined || joinDelta.Client.Name != "Viewer" {
+		t.Errorf("Host expected the viewer to join but got %+v\n", joinDelta)
+	}
+
+	reflection := RoomReflection{ID: "video", State: 1, CurrentTime: 42}
+	sendClientMessage(t, wsHost, ClientMessageTypeSendReflection, reflection)
+
+	var receivedReflection RoomReflection
+	json.Unmarshal(readServerMessage(t, wsViewer, ServerMessageTypeReflectRoom, ServerMessageStatusOk).MessageDetails, &receivedReflection)
+	if receivedReflection != reflection {
+		t.Errorf("Viewer received different reflection\nGot %+v Want %+v\n", receivedReflection, reflection)
+	}
+
+	sendClientMessage(t, wsViewer, ClientMessageTypePing, PingPong{})
+	readServerMessage(t, wsViewer, ServerMessageTypePong, ServerMessageStatusOk)
+
+	sendClientMessage(t, wsViewer, ClientMessageTypeDisconnectRoom, nil)
+	readServerMessage(t, wsViewer, ServerMessageTypeDisconnectRoom, ServerMessageStatusOk)
+
+	var leaveDelta RoomDelta
+	json.Unmarshal(readServerMessage(t, wsHost, ServerMessageTypeUpdateRoom, ServerMessageStatusOk).MessageDetails, &leaveDelta)
+	if leaveDelta.Type != RoomDeltaTypeViewerLeft {
+		t.Errorf("Host expected the viewer to leave but got %q\n", leaveDelta.Type)
+	}
+
+	sendClientMessage(t, wsViewer, ClientMessageTypeSendReflection, reflection)
+	readServerMessage(t, wsViewer, ServerMessageTypeReflectRoom, ServerMessageStatusError)
+}
+
+func assertRoomOwnership(t *testing.T, backplaneA, backplaneB Backplane) {
+	t.Helper()
+
+	const roomID RoomID = "room"
+
+	if claimed, err := backplaneA.ClaimRoom(roomID); !claimed || err != nil {
+		t.Fatalf("Node A failed to claim room (claimed: %t, err: %v)\n", claimed, err)
+	}
+
+	if claimed, err := backplaneA.ClaimRoom(roomID); !claimed || err != nil {
+		t.Errorf("Node A failed to reclaim it's own room (claimed: %t, err: %v)\n", claimed, err)
+	}
+
+	if claimed, err := backplaneB.ClaimRoom(roomID); claimed || err != nil {
+		t.Errorf("Node B claimed a room owned by node A (claimed: %t, err: %v)\n", claimed, err)
+	}
+
+	if err := backplaneB.ReleaseRoom(roomID); err != nil {
+		t.Errorf("Node B failed to release room: %v\n", err)
+	}
+
+	if ownerNode, isOwned, _ := backplaneB.GetRoomOwner(roomID); !isOwned || ownerNode != backplaneA.GetNodeID() {
+		t.Errorf("Node B released a room owned by node A, owner: %q\n", ownerNode)
+	}
+
+	if err := backplaneA.ReleaseRoom(roomID); err != nil {
+		t.Errorf("Node A failed to release room: %v\n", err)
+	}
+
+	if claimed, err := backplaneB.ClaimRoom(roomID); !claimed || err != nil {
+		t.Errorf("Node B failed to claim a released room (claimed: %t, err: %v)\n", claimed, err)
+	}
+}
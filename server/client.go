@@ -10,14 +10,6 @@ import (
 	"github.com/gorilla/websocket"
 )
 
-type ClientType int
-
-const (
-	ClientTypeInnactive = iota
-	ClientTypeHost
-	ClientTypeViewer
-)
-
 type IPAddress net.Addr
 type Client struct {
 	Connection *websocket.Conn
@@ -27,18 +19,16 @@ type Client struct {
 	PublicToken  Token
 
 	Type   ClientType
+	Locale Locale
 	Name   string
 	Image  string
 	Email  string
 	RoomID RoomID
 
-	LatestReply time.Time
-}
+	// NodeID is the node holding the client's connection if it isn't connected to this one.
+	NodeID NodeID
 
-type ClientRecord struct {
-	Name        string `json:"name"`
-	Image       string `json:"image"`
-	PublicToken Token  `json:"publicToken"`
+	LatestReply time.Time // Set by the manager whenever the client sends a message, under it's lock
 }
 
 /*
@@ -52,8 +42,6 @@ func NewClient(privateToken Token) *Client {
 		Email:  "",
 		RoomID: "",
 
-		LatestReply: time.Now(),
-
 		PrivateToken: privateToken,
 		PublicToken:  "",
 	}
@@ -61,13 +49,6 @@ func NewClient(privateToken Token) *Client {
 	return client
 }
 
-type ClientMessageType string
-type ClientMessage struct {
-	ServerVersion string            `json:"version"`
-	MessageType   ClientMessageType `json:"actionType"`
-	Message       string            `json:"action"`
-}
-
 type DirectedServerMessage struct {
 	token   Token
 	message ServerMessage
@@ -75,17 +56,6 @@ type DirectedServerMessage struct {
 
 type ClientRequestHandler func(client *Client, manager *Manager, clientAction string) []DirectedServerMessage
 
-const (
-	ClientMessageTypeAuthorize        = "Authorize"
-	ClientMessageTypeHostRoom         = "HostRoom"
-	ClientMessageTypeJoinRoom         = "JoinRoom"
-	ClientMessageTypeDisconnectRoom   = "DisconnectRoom"
-	ClientMessageTypeSendReflection   = "SendReflection"
-	ClientMessageTypeSendVideoDetails = "SendVideoDetails"
-	ClientMessageTypePing             = "Ping"
-	ClientMessageTypeAttemptReconnect = "AttemptReconnect"
-)
-
 func (client *Client) GetClientMessage() (ClientMessage, error) {
 	_, rawMessage, errorReadingMessage := client.Connection.ReadMessage()
 
@@ -103,50 +73,6 @@ func (client *Client) GetClientMessage() (ClientMessage, error) {
 	return clientMessage, nil
 }
 
-type ServerMessageType string
-
-const (
-	ServerMessageTypeAuthorize           = "Authorize"
-	ServerMessageTypeHostRoom            = "HostRoom"
-	ServerMessageTypeJoinRoom            = "JoinRoom"
-	ServerMessageTypeUpdateRoom          = "UpdateRoom"
-	ServerMessageTypeDisconnectRoom      = "DisconnectRoom"
-	ServerMessageTypeReflectRoom         = "ReflectRoom"
-	ServerMessageTypeReflectVideoDetails = "ReflectVideoDetails"
-	ServerMessageTypePong                = "Pong"
-)
-
-type ServerMessageStatus string
-
-const (
-	ServerMessageStatusOk    = "ok"
-	ServerMessageStatusError = "error"
-)
-
-type ServerErrorMessage string
-
-const (
-	ServerErrorMessageOldServerVersion = "Client running older version than expected"
-
-	ServerErrorMessageInternalServerError = "Internal server error."
-	ServerErrorMessageBadJson             = "Bad request, please upgrade your extension to a newer version"
-
-	ServerErrorMessageShortRoomName = "The room name must be 3 characters or more."
-	ServerErrorMessageLongRoomName  = "The room name must be 50 characters or less."
-
-	ServerErrorMessageNoRoom   = "The room you're trying to join doesn't exist"
-	ServerErrorMessageFullRoom = "The room you're trying to join is full"
-
-	ServerErrorMessageClientNotHost = "You're not a host"
-)
-
-type ServerMessage struct {
-	MessageType    ServerMessageType   `json:"actionType"`
-	MessageDetails json.RawMessage     `json:"action"`
-	Status         ServerMessageStatus `json:"status"`       // Returns 'ok' or 'error'
-	ErrorMessage   ServerErrorMessage  `json:"errorMessage"` // Populated only if there's an error
-}
-
 func (client *Client) SendMessage(
 	messageType ServerMessageType, messageDetails json.RawMessage,
 	status ServerMessageStatus, errorMessage ServerErrorMessage,
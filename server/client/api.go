@@ -0,0 +1,330 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/cowatch/protocol"
+)
+
+// handlers are called on the goroutine reading the connection, one message at a time.
+// A handler must not wait on a call of the same client as the response can't be read until it returns.
+type handlers struct {
+	onMessage        func(protocol.ServerMessage)
+	onReflect        func(protocol.RoomReflection)
+	onRoomUpdate     func(protocol.RoomDelta)
+	onVideoDetails   func(protocol.VideoDetails)
+	onDisconnectRoom func()
+	onAnnouncement   func(protocol.ServerAnnouncement)
+	onRoomClosing    func(protocol.ServerRoomClosing)
+	onCountdown      func(protocol.ServerCountdown)
+	onVote           func(protocol.ServerVote)
+	onConnectionLost func(error)
+}
+
+// OnMessage is called with every message the server sends, before any other handler.
+func (client *Client) OnMessage(handler func(protocol.ServerMessage)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.handlers.onMessage = handler
+}
+
+// OnReflect is called with every reflection the host of the room sends.
+func (client *Client) OnReflect(handler func(protocol.RoomReflection)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.handlers.onReflect = handler
+}
+
+// OnRoomUpdate is called with every change made to the room's members or settings.
+func (client *Client) OnRoomUpdate(handler func(protocol.RoomDelta)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.handlers.onRoomUpdate = handler
+}
+
+// OnVideoDetails is called whenever the host of the room starts playing a new video.
+func (client *Client) OnVideoDetails(handler func(protocol.VideoDetails)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.handlers.onVideoDetails = handler
+}
+
+// OnDisconnectRoom is called when the client is removed from it's room, e.g. because the host left.
+func (client *Client) OnDisconnectRoom(handler func()) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.handlers.onDisconnectRoom = handler
+}
+
+// OnAnnouncement is called with every announcement of the server's operators.
+func (client *Client) OnAnnouncement(handler func(protocol.ServerAnnouncement)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.handlers.onAnnouncement = handler
+}
+
+// OnRoomClosing is called when the server warns that it will close the room, or that it no longer will.
+func (client *Client) OnRoomClosing(handler func(protocol.ServerRoomClosing)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.handlers.onRoomClosing = handler
+}
+
+// OnCountdown is called with the ticks counting down to the scheduled start of the room.
+func (client *Client) OnCountdown(handler func(protocol.ServerCountdown)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.handlers.onCountdown = handler
+}
+
+// OnVote is called with every tally of the room's votes, the last one carrying the vote's result.
+func (client *Client) OnVote(handler func(protocol.ServerVote)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.handlers.onVote = handler
+}
+
+// OnConnectionLost is called when the connection ends without the client being closed,
+// which is the moment to [Client.AttemptReconnect].
+func (client *Client) OnConnectionLost(handler func(error)) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	client.handlers.onConnectionLost = handler
+}
+
+// Notifies the handlers interested in a message.
+func (client *Client) dispatch(serverMessage protocol.ServerMessage) {
+	client.mutex.Lock()
+	handlers := client.handlers
+	client.mutex.Unlock()
+
+	if handlers.onMessage != nil {
+		handlers.onMessage(serverMessage)
+	}
+
+	if serverMessage.Status != protocol.ServerMessageStatusOk {
+		return
+	}
+
+	switch serverMessage.MessageType {
+	case protocol.ServerMessageTypeReflectRoom:
+		dispatchDetails(serverMessage, handlers.onReflect)
+	case protocol.ServerMessageTypeUpdateRoom:
+		dispatchDetails(serverMessage, handlers.onRoomUpdate)
+	case protocol.ServerMessageTypeReflectVideoDetails:
+		dispatchDetails(serverMessage, handlers.onVideoDetails)
+	case protocol.ServerMessageTypeServerAnnouncement:
+		dispatchDetails(serverMessage, handlers.onAnnouncement)
+	case protocol.ServerMessageTypeRoomClosing:
+		dispatchDetails(serverMessage, handlers.onRoomClosing)
+	case protocol.ServerMessageTypeCountdown:
+		dispatchDetails(serverMessage, handlers.onCountdown)
+	case protocol.ServerMessageTypeVote:
+		dispatchDetails(serverMessage, handlers.onVote)
+	case protocol.ServerMessageTypeDisconnectRoom:
+		if handlers.onDisconnectRoom != nil {
+			handlers.onDisconnectRoom()
+		}
+	}
+}
+
+func dispatchDetails[T any](serverMessage protocol.ServerMessage, handler func(T)) {
+	if handler == nil {
+		return
+	}
+
+	var details T
+	if errorDecoding := json.Unmarshal(serverMessage.MessageDetails, &details); errorDecoding != nil {
+		return
+	}
+
+	handler(details)
+}
+
+// Decodes the details of a response.
+func decodeResponse[T any](serverMessage protocol.ServerMessage, errorRequesting error) (T, error) {
+	var details T
+	if errorRequesting != nil {
+		return details, errorRequesting
+	}
+
+	errorDecoding := json.Unmarshal(serverMessage.MessageDetails, &details)
+	return details, errorDecoding
+}
+
+// Authorize identifies the client to the server. A known private token restores the session it belonged to.
+func (client *Client) Authorize(ctx context.Context, request protocol.ClientRequestAuthorizeRoom) (protocol.ServerResponseAuthorizeRoom, error) {
+	client.mutex.Lock()
+	connection := client.connection
+	client.mutex.Unlock()
+
+	return client.authorizeOver(ctx, connection, request)
+}
+
+func (client *Client) authorizeOver(ctx context.Context, connection *connection, request protocol.ClientRequestAuthorizeRoom) (protocol.ServerResponseAuthorizeRoom, error) {
+	authorization, errorAuthorizing := decodeResponse[protocol.ServerResponseAuthorizeRoom](
+		client.requestOver(ctx, connection, protocol.ClientMessageTypeAuthorize, request, protocol.ServerMessageTypeAuthorize),
+	)
+	if errorAuthorizing != nil {
+		return authorization, errorAuthorizing
+	}
+
+	client.mutex.Lock()
+	client.authorization = &authorization
+	client.mutex.Unlock()
+
+	return authorization, nil
+}
+
+// HostRoom creates a room hosted by the client, leaving the room it was in.
+func (client *Client) HostRoom(ctx context.Context, settings protocol.RoomSettings) (protocol.RoomRecord, error) {
+	return decodeResponse[protocol.RoomRecord](
+		client.Request(ctx, protocol.ClientMessageTypeHostRoom, settings, protocol.ServerMessageTypeHostRoom),
+	)
+}
+
+// JoinRoom joins a room as a viewer.
+func (client *Client) JoinRoom(ctx context.Context, roomID protocol.RoomID) (protocol.ServerResponseJoinRoom, error) {
+	return decodeResponse[protocol.ServerResponseJoinRoom](
+		client.Request(ctx, protocol.ClientMessageTypeJoinRoom, protocol.ClientRequestJoinRoom{RoomID: roomID}, protocol.ServerMessageTypeJoinRoom),
+	)
+}
+
+// DisconnectRoom leaves the client's room, closing it if the client hosts it.
+func (client *Client) DisconnectRoom(ctx context.Context) error {
+	_, errorDisconnecting := client.Request(ctx, protocol.ClientMessageTypeDisconnectRoom, struct{}{}, protocol.ServerMessageTypeDisconnectRoom)
+	return errorDisconnecting
+}
+
+// Reflect sends the host's playback state to every viewer of the room.
+func (client *Client) Reflect(ctx context.Context, reflection protocol.RoomReflection) error {
+	_, errorReflecting := client.Request(ctx, protocol.ClientMessageTypeSendReflection, reflection)
+	return errorReflecting
+}
+
+// SendIntent asks to play, pause or seek the room's playback, for members the room lets control it.
+// The server reflects the resolved playback to every member, including the client.
+func (client *Client) SendIntent(ctx context.Context, action protocol.PlaybackAction, playbackTime float32) error {
+	_, errorSending := client.Request(ctx, protocol.ClientMessageTypeSendIntent, protocol.ClientRequestIntent{Action: action, Time: playbackTime})
+	return errorSending
+}
+
+// StartVote starts a vote on an action in the room, counting the client in favor of it.
+func (client *Client) StartVote(ctx context.Context, request protocol.ClientRequestStartVote) (protocol.ServerVote, error) {
+	return decodeResponse[protocol.ServerVote](
+		client.Request(ctx, protocol.ClientMessageTypeStartVote, request, protocol.ServerMessageTypeVote),
+	)
+}
+
+// CastVote votes for or against the vote in progress in the room, returning it's tally.
+func (client *Client) CastVote(ctx context.Context, voteID protocol.VoteID, isInFavor bool) (protocol.ServerVote, error) {
+	return decodeResponse[protocol.ServerVote](
+		client.Request(ctx, protocol.ClientMessageTypeCastVote, protocol.ClientRequestCastVote{VoteID: voteID, InFavor: isInFavor}, protocol.ServerMessageTypeVote),
+	)
+}
+
+// AssignPermissions makes a viewer of the room the client hosts a co-host with the given permissions,
+// or a viewer again without any.
+func (client *Client) AssignPermissions(ctx context.Context, publicToken protocol.Token, permissions []protocol.RoomPermission) (protocol.RoomDelta, error) {
+	return decodeResponse[protocol.RoomDelta](
+		client.Request(ctx, protocol.ClientMessageTypeAssignPermissions, protocol.ClientRequestAssignPermissions{PublicToken: publicToken, Permissions: permissions}, protocol.ServerMessageTypeUpdateRoom),
+	)
+}
+
+// KickViewer removes a viewer from the room, which the host and co-hosts allowed to kick can do.
+func (client *Client) KickViewer(ctx context.Context, publicToken protocol.Token) (protocol.RoomDelta, error) {
+	return decodeResponse[protocol.RoomDelta](
+		client.Request(ctx, protocol.ClientMessageTypeKickViewer, protocol.ClientRequestKickViewer{PublicToken: publicToken}, protocol.ServerMessageTypeUpdateRoom),
+	)
+}
+
+// SendReadiness reports whether the viewer can play without buffering, for rooms waiting for their viewers.
+func (client *Client) SendReadiness(ctx context.Context, isReady bool) error {
+	_, errorSending := client.Request(ctx, protocol.ClientMessageTypeSendReadiness, protocol.ClientRequestReadiness{Ready: isReady})
+	return errorSending
+}
+
+// SendVideoDetails sends the details of the video the host is playing to every viewer of the room.
+func (client *Client) SendVideoDetails(ctx context.Context, videoDetails protocol.VideoDetails) error {
+	_, errorSending := client.Request(ctx, protocol.ClientMessageTypeSendVideoDetails, videoDetails)
+	return errorSending
+}
+
+// UpdateRoomSettings changes the settings of the room the client hosts.
+func (client *Client) UpdateRoomSettings(ctx context.Context, settings protocol.RoomSettings) (protocol.RoomDelta, error) {
+	return decodeResponse[protocol.RoomDelta](
+		client.Request(ctx, protocol.ClientMessageTypeUpdateRoomSettings, settings, protocol.ServerMessageTypeUpdateRoom),
+	)
+}
+
+// ResyncRoom collects the changes made to the room after the given revision.
+func (client *Client) ResyncRoom(ctx context.Context, revision protocol.RoomRevision) (protocol.ServerResponseResyncRoom, error) {
+	return decodeResponse[protocol.ServerResponseResyncRoom](
+		client.Request(ctx, protocol.ClientMessageTypeResyncRoom, protocol.ClientRequestResyncRoom{Revision: revision}, protocol.ServerMessageTypeResyncRoom),
+	)
+}
+
+// Ping keeps the connection alive and measures the round trip to the server.
+func (client *Client) Ping(ctx context.Context) (time.Duration, error) {
+	sentAt := time.Now()
+	_, errorPinging := client.Request(ctx, protocol.ClientMessageTypePing, protocol.PingPong{Timestamp: protocol.Timestamp(sentAt.UnixMilli())}, protocol.ServerMessageTypePong)
+
+	return time.Since(sentAt), errorPinging
+}
+
+// AttemptReconnect replaces a lost connection and restores the client's session on it.
+// The client authorizes with the private token of it's previous session and rejoins the room it was in.
+//
+// It returns nil if the client wasn't in a room or the room no longer exists.
+func (client *Client) AttemptReconnect(ctx context.Context) (*protocol.ServerResponseJoinRoom, error) {
+	client.mutex.Lock()
+	authorization := client.authorization
+	previousConnection := client.connection
+	client.mutex.Unlock()
+
+	if authorization == nil {
+		return nil, ErrNotAuthorized
+	}
+
+	if errorConnecting := client.connect(ctx); errorConnecting != nil {
+		return nil, errorConnecting
+	}
+	previousConnection.ws.Close()
+
+	client.mutex.Lock()
+	connection := client.connection
+	client.mutex.Unlock()
+
+	_, errorAuthorizing := client.authorizeOver(ctx, connection, protocol.ClientRequestAuthorizeRoom{
+		Name:         authorization.Name,
+		Image:        authorization.Image,
+		PrivateToken: authorization.PrivateToken,
+	})
+	if errorAuthorizing != nil {
+		return nil, errorAuthorizing
+	}
+
+	response, errorReconnecting := client.requestOver(ctx, connection, protocol.ClientMessageTypeAttemptReconnect, struct{}{}, protocol.ServerMessageTypeJoinRoom)
+	if errorReconnecting != nil || response.MessageType != protocol.ServerMessageTypeJoinRoom {
+		return nil, errorReconnecting
+	}
+
+	joinRoom, errorDecoding := decodeResponse[protocol.ServerResponseJoinRoom](response, nil)
+	if errorDecoding != nil {
+		return nil, errorDecoding
+	}
+
+	return &joinRoom, nil
+}
@@ -0,0 +1,360 @@
+// Package client speaks the cowatch protocol over a websocket connection.
+//
+// Every request is identified with a [protocol.RequestID] so calls wait for the response the server
+// sends to them, while messages sent by other clients of the room are delivered to the handlers
+// registered with [Client.OnReflect], [Client.OnRoomUpdate] and friends.
+//
+//	cowatch, err := client.Dial(ctx, "ws://localhost:8080/reflect", client.Options{ServerVersion: "0.0.5"})
+//	cowatch.Authorize(ctx, protocol.ClientRequestAuthorizeRoom{Name: "Viewer"})
+//	cowatch.OnReflect(func(reflection protocol.RoomReflection) { ... })
+//	cowatch.JoinRoom(ctx, roomID)
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/cowatch/protocol"
+	"github.com/gorilla/websocket"
+)
+
+// The interval the extension pings at to keep it's connection alive.
+const DefaultPingInterval = 120 * time.Second
+
+var ErrClosed = errors.New("The client is closed")
+var ErrConnectionLost = errors.New("The connection to the server was lost")
+var ErrNotAuthorized = errors.New("The client must be authorized before reconnecting")
+
+// ServerError is returned by a call the server responded to with an error.
+type ServerError struct {
+	MessageType protocol.ServerMessageType
+	Code        protocol.ServerErrorCode
+	Message     protocol.ServerErrorMessage
+	Details     json.RawMessage
+}
+
+func (serverError *ServerError) Error() string {
+	return fmt.Sprintf("%s failed with %s: %s", serverError.MessageType, serverError.Code, serverError.Message)
+}
+
+// IsServerError reports whether err is a [ServerError] with the given code.
+func IsServerError(err error, code protocol.ServerErrorCode) bool {
+	var serverError *ServerError
+	return errors.As(err, &serverError) && serverError.Code == code
+}
+
+type Options struct {
+	ServerVersion string
+	Subprotocol   string // The codec requested during the handshake, defaults to json
+	Locale        protocol.Locale
+	PingInterval  time.Duration // Defaults to the DefaultPingInterval, a negative interval disables pinging
+	Header        http.Header   // Sent with every handshake
+
+	// Trace is called with every frame sent or received, to debug the raw traffic.
+	Trace func(isOutgoing bool, rawMessage []byte)
+}
+
+// Client is a connection to a cowatch server that survives reconnects through [Client.AttemptReconnect].
+// It's safe for concurrent use.
+type Client struct {
+	url           string
+	options       Options
+	nextRequestID atomic.Uint64
+
+	mutex           sync.Mutex
+	connection      *connection
+	pendingRequests map[protocol.RequestID]*pendingRequest
+	authorization   *protocol.ServerResponseAuthorizeRoom
+	handlers        handlers
+	isClosed        bool
+}
+
+// connection is a single websocket connection of a client, replaced whenever the client reconnects.
+type connection struct {
+	ws         *websocket.Conn
+	codec      protocol.Codec
+	writeMutex sync.Mutex
+
+	done chan struct{}
+	err  error // Why the connection ended, set before done is closed
+}
+
+type pendingRequest struct {
+	expectedTypes []protocol.ServerMessageType
+	response      chan protocol.ServerMessage
+}
+
+// Dial connects to the reflect endpoint of a server.
+// The client still has to [Client.Authorize] before making any other request.
+func Dial(ctx context.Context, url string, options Options) (*Client, error) {
+	if options.PingInterval == 0 {
+		options.PingInterval = DefaultPingInterval
+	}
+
+	if options.Subprotocol == "" {
+		options.Subprotocol = protocol.SubprotocolJSON
+	}
+
+	client := &Client{
+		url:             url,
+		options:         options,
+		pendingRequests: make(map[protocol.RequestID]*pendingRequest),
+	}
+
+	if errorConnecting := client.connect(ctx); errorConnecting != nil {
+		return nil, errorConnecting
+	}
+
+	return client, nil
+}
+
+// Close ends the connection, failing every call still waiting for a response.
+func (client *Client) Close() error {
+	client.mutex.Lock()
+	client.isClosed = true
+	connection := client.connection
+	client.mutex.Unlock()
+
+	return connection.ws.Close()
+}
+
+// Done is closed when the current connection ends.
+func (client *Client) Done() <-chan struct{} {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	return client.connection.done
+}
+
+// GetAuthorization returns the details the server authorized the client with, if it did.
+func (client *Client) GetAuthorization() (protocol.ServerResponseAuthorizeRoom, bool) {
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	if client.authorization == nil {
+		return protocol.ServerResponseAuthorizeRoom{}, false
+	}
+
+	return *client.authorization, true
+}
+
+// Opens a new connection and starts reading from it.
+func (client *Client) connect(ctx context.Context) error {
+	dialer := websocket.Dialer{
+		Proxy:            http.ProxyFromEnvironment,
+		HandshakeTimeout: 45 * time.Second,
+		Subprotocols:     []string{client.options.Subprotocol},
+	}
+
+	ws, _, errorDialing := dialer.DialContext(ctx, client.url, client.options.Header)
+	if errorDialing != nil {
+		return errorDialing
+	}
+
+	newConnection := &connection{
+		ws:    ws,
+		codec: protocol.GetCodec(ws.Subprotocol()),
+		done:  make(chan struct{}),
+	}
+
+	client.mutex.Lock()
+	if client.isClosed {
+		client.mutex.Unlock()
+		ws.Close()
+		return ErrClosed
+	}
+
+	client.connection = newConnection
+	client.mutex.Unlock()
+
+	go client.readMessages(newConnection)
+	if client.options.PingInterval > 0 {
+		go client.pingPeriodically(newConnection)
+	}
+
+	return nil
+}
+
+// Reads until the connection ends, completing the pending requests and notifying the handlers.
+func (client *Client) readMessages(connection *connection) {
+	for {
+		_, rawMessage, errorReading := connection.ws.ReadMessage()
+		if errorReading != nil {
+			client.endConnection(connection, errorReading)
+			return
+		}
+
+		if client.options.Trace != nil {
+			client.options.Trace(false, rawMessage)
+		}
+
+		var serverMessage protocol.ServerMessage
+		if errorDecoding := connection.codec.Unmarshal(rawMessage, &serverMessage); errorDecoding != nil {
+			continue
+		}
+
+		client.completeRequest(serverMessage)
+		client.dispatch(serverMessage)
+	}
+}
+
+// Fails every request made over the connection and lets the handlers know if it was lost.
+// Connections replaced by a reconnect aren't considered lost.
+func (client *Client) endConnection(connection *connection, errorReading error) {
+	client.mutex.Lock()
+	isLost := !client.isClosed && client.connection == connection
+	onConnectionLost := client.handlers.onConnectionLost
+
+	connection.err = ErrClosed
+	if !client.isClosed {
+		connection.err = fmt.Errorf("%w: %w", ErrConnectionLost, errorReading)
+	}
+	client.mutex.Unlock()
+
+	close(connection.done)
+
+	if isLost && onConnectionLost != nil {
+		onConnectionLost(connection.err)
+	}
+}
+
+// Hands a response to the request waiting for it.
+func (client *Client) completeRequest(serverMessage protocol.ServerMessage) {
+	if serverMessage.RequestID == "" {
+		return
+	}
+
+	client.mutex.Lock()
+	defer client.mutex.Unlock()
+
+	request, exists := client.pendingRequests[serverMessage.RequestID]
+	if !exists {
+		return
+	}
+
+	if serverMessage.Status != protocol.ServerMessageStatusError &&
+		serverMessage.MessageType != protocol.ServerMessageTypeAck &&
+		!slices.Contains(request.expectedTypes, serverMessage.MessageType) {
+		return
+	}
+
+	delete(client.pendingRequests, serverMessage.RequestID)
+	request.response <- serverMessage
+}
+
+// Pings every ping interval until the connection ends.
+func (client *Client) pingPeriodically(connection *connection) {
+	ticker := time.NewTicker(client.options.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-connection.done:
+			return
+		case <-ticker.C:
+		}
+
+		ctx, cancel := context.WithTimeout(context.Background(), client.options.PingInterval)
+		client.Ping(ctx)
+		cancel()
+	}
+}
+
+// Request sends any client message and waits for the response of one of the expected types,
+// an Ack or an error. It's meant for message types without a call of their own.
+// Responses with an error status are returned as a [ServerError].
+func (client *Client) Request(
+	ctx context.Context, messageType protocol.ClientMessageType, request interface{},
+	expectedTypes ...protocol.ServerMessageType,
+) (protocol.ServerMessage, error) {
+	client.mutex.Lock()
+	connection := client.connection
+	client.mutex.Unlock()
+
+	return client.requestOver(ctx, connection, messageType, request, expectedTypes...)
+}
+
+func (client *Client) requestOver(
+	ctx context.Context, connection *connection, messageType protocol.ClientMessageType, request interface{},
+	expectedTypes ...protocol.ServerMessageType,
+) (protocol.ServerMessage, error) {
+	requestID := protocol.RequestID(strconv.FormatUint(client.nextRequestID.Add(1), 10))
+	pending := &pendingRequest{
+		expectedTypes: expectedTypes,
+		response:      make(chan protocol.ServerMessage, 1),
+	}
+
+	client.mutex.Lock()
+	client.pendingRequests[requestID] = pending
+	client.mutex.Unlock()
+
+	defer func() {
+		client.mutex.Lock()
+		delete(client.pendingRequests, requestID)
+		client.mutex.Unlock()
+	}()
+
+	if errorSending := client.send(connection, messageType, request, requestID); errorSending != nil {
+		return protocol.ServerMessage{}, errorSending
+	}
+
+	select {
+	case <-ctx.Done():
+		return protocol.ServerMessage{}, ctx.Err()
+	case <-connection.done:
+		return protocol.ServerMessage{}, connection.err
+	case serverMessage := <-pending.response:
+		if serverMessage.Status == protocol.ServerMessageStatusError {
+			return serverMessage, &ServerError{
+				MessageType: serverMessage.MessageType,
+				Code:        serverMessage.ErrorCode,
+				Message:     serverMessage.ErrorMessage,
+				Details:     serverMessage.ErrorDetails,
+			}
+		}
+
+		return serverMessage, nil
+	}
+}
+
+// Wraps a request in a client message, encoding it as the json string the server expects.
+func (client *Client) send(connection *connection, messageType protocol.ClientMessageType, request interface{}, requestID protocol.RequestID) error {
+	encodedRequest, errorEncoding := json.Marshal(request)
+	if errorEncoding != nil {
+		return errorEncoding
+	}
+
+	encodedMessage, errorEncoding := connection.codec.Marshal(protocol.ClientMessage{
+		ServerVersion: client.options.ServerVersion,
+		MessageType:   messageType,
+		Message:       string(encodedRequest),
+		RequestID:     requestID,
+		Locale:        client.options.Locale,
+	})
+	if errorEncoding != nil {
+		return errorEncoding
+	}
+
+	connection.writeMutex.Lock()
+	defer connection.writeMutex.Unlock()
+
+	select {
+	case <-connection.done:
+		return connection.err
+	default:
+	}
+
+	if client.options.Trace != nil {
+		client.options.Trace(true, encodedMessage)
+	}
+
+	return connection.ws.WriteMessage(connection.codec.GetFrameType(), encodedMessage)
+}
@@ -0,0 +1,223 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cowatch/protocol"
+	"github.com/gorilla/websocket"
+)
+
+func TestClient(t *testing.T) {
+	t.Run("wrapping requests and matching responses by their request id", func(t *testing.T) {
+		cowatch := dialFakeServer(t, func(ws *websocket.Conn, clientMessage protocol.ClientMessage) {
+			var settings protocol.RoomSettings
+			if err := json.Unmarshal([]byte(clientMessage.Message), &settings); err != nil {
+				t.Errorf("Expected the action to be a json string but got %q\n", clientMessage.Message)
+			}
+
+			if clientMessage.ServerVersion != "1.0.0" || clientMessage.RequestID == "" {
+				t.Errorf("Got unexpected client message %+v\n", clientMessage)
+			}
+
+			// Responses directed to other requests or without an id must not complete the call
+			writeFakeServerMessage(t, ws, protocol.ServerMessageTypeHostRoom, "", protocol.RoomRecord{RoomID: "Other"})
+			writeFakeServerMessage(t, ws, protocol.ServerMessageTypeHostRoom, "Unknown", protocol.RoomRecord{RoomID: "Other"})
+			writeFakeServerMessage(t, ws, protocol.ServerMessageTypeHostRoom, clientMessage.RequestID, protocol.RoomRecord{RoomID: "Room", Settings: settings})
+		})
+
+		room, err := cowatch.HostRoom(context.Background(), protocol.RoomSettings{Name: "Movie night"})
+		if err != nil || room.RoomID != "Room" || room.Settings.Name != "Movie night" {
+			t.Errorf("Expected the hosted room but got %+v %v\n", room, err)
+		}
+	})
+
+	t.Run("returning error responses as server errors", func(t *testing.T) {
+		cowatch := dialFakeServer(t, func(ws *websocket.Conn, clientMessage protocol.ClientMessage) {
+			writeServerMessage(t, ws, protocol.ServerMessage{
+				MessageType:  protocol.ServerMessageTypeJoinRoom,
+				Status:       protocol.ServerMessageStatusError,
+				ErrorMessage: protocol.ServerErrorMessageNoRoom,
+				ErrorCode:    protocol.ServerErrorCodeNoRoom,
+				RequestID:    clientMessage.RequestID,
+			})
+		})
+
+		_, err := cowatch.JoinRoom(context.Background(), "Missing")
+		if !IsServerError(err, protocol.ServerErrorCodeNoRoom) {
+			t.Errorf("Expected a %s server error but got %v\n", protocol.ServerErrorCodeNoRoom, err)
+		}
+	})
+
+	t.Run("giving up on a call when the context is done", func(t *testing.T) {
+		cowatch := dialFakeServer(t, func(ws *websocket.Conn, clientMessage protocol.ClientMessage) {})
+
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+
+		if _, err := cowatch.Ping(ctx); !errors.Is(err, context.DeadlineExceeded) {
+			t.Errorf("Expected the call to time out but got %v\n", err)
+		}
+	})
+
+	t.Run("delivering messages of the room to the handlers", func(t *testing.T) {
+		cowatch := dialFakeServer(t, func(ws *websocket.Conn, clientMessage protocol.ClientMessage) {
+			writeFakeServerMessage(t, ws, protocol.ServerMessageTypeReflectRoom, "", protocol.RoomReflection{ID: "Video", State: 1, CurrentTime: 4.5})
+			writeFakeServerMessage(t, ws, protocol.ServerMessageTypeUpdateRoom, "", protocol.RoomDelta{Revision: 2, Type: protocol.RoomDeltaTypeViewerJoined})
+			writeFakeServerMessage(t, ws, protocol.ServerMessageTypeAck, clientMessage.RequestID, protocol.ServerResponseAck{MessageType: clientMessage.MessageType})
+		})
+
+		reflections := make(chan protocol.RoomReflection, 1)
+		deltas := make(chan protocol.RoomDelta, 1)
+		cowatch.OnReflect(func(reflection protocol.RoomReflection) { reflections <- reflection })
+		cowatch.OnRoomUpdate(func(delta protocol.RoomDelta) { deltas <- delta })
+
+		if err := cowatch.Reflect(context.Background(), protocol.RoomReflection{}); err != nil {
+			t.Fatalf("Expected the reflection to be acknowledged but got %v\n", err)
+		}
+
+		if reflection := <-reflections; reflection.ID != "Video" || reflection.CurrentTime != 4.5 {
+			t.Errorf("Got unexpected reflection %+v\n", reflection)
+		}
+
+		if delta := <-deltas; delta.Revision != 2 || delta.Type != protocol.RoomDeltaTypeViewerJoined {
+			t.Errorf("Got unexpected delta %+v\n", delta)
+		}
+	})
+
+	t.Run("failing pending calls when the connection is lost", func(t *testing.T) {
+		cowatch := dialFakeServer(t, func(ws *websocket.Conn, clientMessage protocol.ClientMessage) {
+			ws.Close()
+		})
+
+		connectionLost := make(chan error, 1)
+		cowatch.OnConnectionLost(func(err error) { connectionLost <- err })
+
+		if _, err := cowatch.Ping(context.Background()); !errors.Is(err, ErrConnectionLost) {
+			t.Errorf("Expected the call to fail with %v but got %v\n", ErrConnectionLost, err)
+		}
+
+		if err := <-connectionLost; !errors.Is(err, ErrConnectionLost) {
+			t.Errorf("Expected the handler to receive %v but got %v\n", ErrConnectionLost, err)
+		}
+
+		if _, err := cowatch.AttemptReconnect(context.Background()); !errors.Is(err, ErrNotAuthorized) {
+			t.Errorf("Expected reconnecting without authorizing to fail but got %v\n", err)
+		}
+	})
+
+	t.Run("pinging automatically", func(t *testing.T) {
+		pings := make(chan protocol.ClientMessage, 1)
+		dialFakeServerWithOptions(t, Options{PingInterval: 20 * time.Millisecond}, func(ws *websocket.Conn, clientMessage protocol.ClientMessage) {
+			select {
+			case pings <- clientMessage:
+			default:
+			}
+		})
+
+		select {
+		case ping := <-pings:
+			if ping.MessageType != protocol.ClientMessageTypePing {
+				t.Errorf("Expected a ping but got %+v\n", ping)
+			}
+		case <-time.After(time.Second):
+			t.Errorf("Expected the client to ping\n")
+		}
+	})
+
+	t.Run("negotiating msgpack", func(t *testing.T) {
+		cowatch := dialFakeServerWithOptions(t, Options{Subprotocol: protocol.SubprotocolMsgpack}, func(ws *websocket.Conn, clientMessage protocol.ClientMessage) {
+			writeFakeServerMessage(t, ws, protocol.ServerMessageTypePong, clientMessage.RequestID, protocol.PingPong{Timestamp: 1})
+		})
+
+		if _, err := cowatch.Ping(context.Background()); err != nil {
+			t.Errorf("Expected a pong over msgpack but got %v\n", err)
+		}
+	})
+}
+
+// Starts a server that calls respond with every client message it reads.
+func dialFakeServer(t *testing.T, respond func(ws *websocket.Conn, clientMessage protocol.ClientMessage)) *Client {
+	return dialFakeServerWithOptions(t, Options{}, respond)
+}
+
+func dialFakeServerWithOptions(t *testing.T, options Options, respond func(ws *websocket.Conn, clientMessage protocol.ClientMessage)) *Client {
+	t.Helper()
+
+	upgrader := websocket.Upgrader{Subprotocols: protocol.SupportedSubprotocols}
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ws, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			return
+		}
+		defer ws.Close()
+
+		codec := protocol.GetCodec(ws.Subprotocol())
+		for {
+			_, rawMessage, err := ws.ReadMessage()
+			if err != nil {
+				return
+			}
+
+			var clientMessage protocol.ClientMessage
+			if err := codec.Unmarshal(rawMessage, &clientMessage); err != nil {
+				t.Errorf("Failed to decode %q: %v\n", rawMessage, err)
+				return
+			}
+
+			respond(ws, clientMessage)
+		}
+	}))
+	t.Cleanup(mockServer.Close)
+
+	if options.ServerVersion == "" {
+		options.ServerVersion = "1.0.0"
+	}
+
+	if options.PingInterval == 0 {
+		options.PingInterval = -1
+	}
+
+	cowatch, err := Dial(context.Background(), "ws"+strings.TrimPrefix(mockServer.URL, "http"), options)
+	if err != nil {
+		t.Fatalf("Failed to dial: %v\n", err)
+	}
+	t.Cleanup(func() { cowatch.Close() })
+
+	return cowatch
+}
+
+func writeFakeServerMessage(t *testing.T, ws *websocket.Conn, messageType protocol.ServerMessageType, requestID protocol.RequestID, details interface{}) {
+	t.Helper()
+
+	messageDetails, err := json.Marshal(details)
+	if err != nil {
+		t.Fatalf("Failed to marshal %+v: %v\n", details, err)
+	}
+
+	writeServerMessage(t, ws, protocol.ServerMessage{
+		MessageType:    messageType,
+		MessageDetails: messageDetails,
+		Status:         protocol.ServerMessageStatusOk,
+		RequestID:      requestID,
+	})
+}
+
+func writeServerMessage(t *testing.T, ws *websocket.Conn, serverMessage protocol.ServerMessage) {
+	t.Helper()
+
+	codec := protocol.GetCodec(ws.Subprotocol())
+	rawMessage, err := codec.Marshal(serverMessage)
+	if err != nil {
+		t.Errorf("Failed to encode %+v: %v\n", serverMessage, err)
+		return
+	}
+
+	ws.WriteMessage(codec.GetFrameType(), rawMessage)
+}
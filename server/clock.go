@@ -0,0 +1,233 @@
+package main
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is the source of time of the [Manager].
+//
+// Everything the manager times (client inactivity, room creation, pongs, timeouts and the cleanup routine)
+// goes through it, so tests can swap it for a [FakeClock] and move time along instead of sleeping.
+type Clock interface {
+	Now() time.Time
+
+	// NewTicker creates a ticker that fires every interval until it's stopped.
+	NewTicker(interval time.Duration) Ticker
+
+	// AfterFunc calls the function on it's own goroutine once the duration passed, unless it's stopped before.
+	AfterFunc(duration time.Duration, function func()) Timer
+}
+
+// Ticker delivers the ticks of a [Clock].
+type Ticker interface {
+	C() <-chan time.Time
+	Stop()
+}
+
+// Timer calls a function once, the way [time.AfterFunc] does.
+type Timer interface {
+	// Stop prevents the function from being called, returning false if it already was.
+	Stop() bool
+}
+
+// SystemClock is the wall clock.
+type SystemClock struct{}
+
+func (SystemClock) Now() time.Time {
+	return time.Now()
+}
+
+func (SystemClock) NewTicker(interval time.Duration) Ticker {
+	return &systemTicker{ticker: time.NewTicker(interval)}
+}
+
+func (SystemClock) AfterFunc(duration time.Duration, function func()) Timer {
+	return time.AfterFunc(duration, function)
+}
+
+type systemTicker struct {
+	ticker *time.Ticker
+}
+
+func (ticker *systemTicker) C() <-chan time.Time {
+	return ticker.ticker.C
+}
+
+func (ticker *systemTicker) Stop() {
+	ticker.ticker.Stop()
+}
+
+// FakeClock is a clock that only moves when it's told to, for tests that depend on time passing.
+type FakeClock struct {
+	mutex   sync.Mutex
+	now     time.Time
+	tickers []*fakeTicker
+	timers  []*fakeTimer
+}
+
+func NewFakeClock(now time.Time) *FakeClock {
+	return &FakeClock{now: now}
+}
+
+func (clock *FakeClock) Now() time.Time {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	return clock.now
+}
+
+func (clock *FakeClock) NewTicker(interval time.Duration) Ticker {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	ticker := &fakeTicker{
+		clock:    clock,
+		interval: interval,
+		nextTick: clock.now.Add(interval),
+		ticks:    make(chan time.Time),
+		stopped:  make(chan struct{}),
+	}
+	clock.tickers = append(clock.tickers, ticker)
+
+	return ticker
+}
+
+func (clock *FakeClock) AfterFunc(duration time.Duration, function func()) Timer {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	timer := &fakeTimer{clock: clock, firesAt: clock.now.Add(duration), function: function}
+	clock.timers = append(clock.timers, timer)
+
+	return timer
+}
+
+// Advance moves the clock forward, firing every tick and timer that became due along the way.
+//
+// Ticks are delivered unbuffered, so Advance returns once every running ticker received it's ticks.
+// Since a receiver handles a tick before taking the next one, a tick is only guaranteed to be handled
+// once the following one is delivered or the receiver is stopped. Timers are called right away instead,
+// so their function has run once Advance returns.
+func (clock *FakeClock) Advance(duration time.Duration) {
+	clock.mutex.Lock()
+	target := clock.now.Add(duration)
+	clock.mutex.Unlock()
+
+	for {
+		ticker, timer, tick, isDue := clock.nextDue(target)
+		if !isDue {
+			break
+		}
+
+		if timer != nil {
+			timer.function()
+			continue
+		}
+
+		select {
+		case ticker.ticks <- tick:
+		case <-ticker.stopped:
+		}
+	}
+
+	clock.mutex.Lock()
+	clock.now = target
+	clock.mutex.Unlock()
+}
+
+// Collects the earliest tick or timer due until the target and moves the clock to it.
+func (clock *FakeClock) nextDue(target time.Time) (*fakeTicker, *fakeTimer, time.Time, bool) {
+	clock.mutex.Lock()
+	defer clock.mutex.Unlock()
+
+	var dueTicker *fakeTicker
+	for _, ticker := range clock.tickers {
+		if ticker.nextTick.After(target) {
+			continue
+		}
+
+		if dueTicker == nil || ticker.nextTick.Before(dueTicker.nextTick) {
+			dueTicker = ticker
+		}
+	}
+
+	dueTimerIndex := -1
+	for index, timer := range clock.timers {
+		if timer.firesAt.After(target) {
+			continue
+		}
+
+		if dueTimerIndex < 0 || timer.firesAt.Before(clock.timers[dueTimerIndex].firesAt) {
+			dueTimerIndex = index
+		}
+	}
+
+	if dueTimerIndex >= 0 && (dueTicker == nil || !dueTicker.nextTick.Before(clock.timers[dueTimerIndex].firesAt)) {
+		timer := clock.timers[dueTimerIndex]
+		clock.timers = RemoveFromSlice(clock.timers, dueTimerIndex)
+		clock.now = timer.firesAt
+
+		return nil, timer, timer.firesAt, true
+	}
+
+	if dueTicker == nil {
+		return nil, nil, time.Time{}, false
+	}
+
+	tick := dueTicker.nextTick
+	clock.now = tick
+	dueTicker.nextTick = tick.Add(dueTicker.interval)
+
+	return dueTicker, nil, tick, true
+}
+
+type fakeTicker struct {
+	clock    *FakeClock
+	interval time.Duration
+	nextTick time.Time
+
+	ticks    chan time.Time
+	stopped  chan struct{}
+	stopOnce sync.Once
+}
+
+func (ticker *fakeTicker) C() <-chan time.Time {
+	return ticker.ticks
+}
+
+func (ticker *fakeTicker) Stop() {
+	ticker.stopOnce.Do(func() {
+		close(ticker.stopped)
+
+		ticker.clock.mutex.Lock()
+		defer ticker.clock.mutex.Unlock()
+
+		for index, clockTicker := range ticker.clock.tickers {
+			if clockTicker == ticker {
+				ticker.clock.tickers = RemoveFromSlice(ticker.clock.tickers, index)
+				break
+			}
+		}
+	})
+}
+
+type fakeTimer struct {
+	clock    *FakeClock
+	firesAt  time.Time
+	function func()
+}
+
+func (timer *fakeTimer) Stop() bool {
+	timer.clock.mutex.Lock()
+	defer timer.clock.mutex.Unlock()
+
+	for index, clockTimer := range timer.clock.timers {
+		if clockTimer == timer {
+			timer.clock.timers = RemoveFromSlice(timer.clock.timers, index)
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestFakeClock(t *testing.T) {
+	t.Run("delivering every tick that became due in order", func(t *testing.T) {
+		start := time.Date(2024, time.May, 1, 20, 0, 0, 0, time.UTC)
+		clock := NewFakeClock(start)
+		ticker := clock.NewTicker(10 * time.Second)
+		defer ticker.Stop()
+
+		ticks := make(chan time.Time, 10)
+		go func() {
+			for tick := range ticker.C() {
+				ticks <- tick
+			}
+		}()
+
+		clock.Advance(35 * time.Second)
+
+		for _, expected := range []time.Duration{10 * time.Second, 20 * time.Second, 30 * time.Second} {
+			if tick := <-ticks; !tick.Equal(start.Add(expected)) {
+				t.Errorf("Expected a tick at %s but got %s\n", start.Add(expected), tick)
+			}
+		}
+
+		if !clock.Now().Equal(start.Add(35 * time.Second)) {
+			t.Errorf("Expected the clock to end up 35 seconds later but got %s\n", clock.Now())
+		}
+	})
+
+	t.Run("skipping stopped tickers", func(t *testing.T) {
+		clock := NewFakeClock(time.Time{})
+		ticker := clock.NewTicker(time.Second)
+		ticker.Stop()
+		ticker.Stop()
+
+		isAdvanced := make(chan struct{})
+		go func() {
+			clock.Advance(time.Minute)
+			close(isAdvanced)
+		}()
+
+		select {
+		case <-isAdvanced:
+		case <-time.After(time.Second):
+			t.Fatalf("Expected advancing to not wait on a stopped ticker\n")
+		}
+	})
+
+	t.Run("calling due timers once unless they're stopped", func(t *testing.T) {
+		start := time.Date(2024, time.May, 1, 20, 0, 0, 0, time.UTC)
+		clock := NewFakeClock(start)
+
+		var calledAt []time.Time
+		clock.AfterFunc(10*time.Second, func() { calledAt = append(calledAt, clock.Now()) })
+		stoppedTimer := clock.AfterFunc(5*time.Second, func() { t.Errorf("Expected a stopped timer to not be called\n") })
+		if !stoppedTimer.Stop() || stoppedTimer.Stop() {
+			t.Errorf("Expected only the first stop to prevent the call\n")
+		}
+
+		clock.Advance(9 * time.Second)
+		if len(calledAt) != 0 {
+			t.Errorf("Expected the timer to not be due yet but it was called at %v\n", calledAt)
+		}
+
+		clock.Advance(time.Minute)
+		if len(calledAt) != 1 || !calledAt[0].Equal(start.Add(10*time.Second)) {
+			t.Errorf("Expected the timer to be called once at %s but got %v\n", start.Add(10*time.Second), calledAt)
+		}
+	})
+}
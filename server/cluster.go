@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/url"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/cowatch/logger"
+)
+
+// The amount of points every member occupies on the [HashRing].
+// More points spread the rooms more evenly between the members.
+const CLUSTER_VIRTUAL_NODES = 64
+
+var ErrInvalidClusterMember = errors.New("Cluster member must be formatted as id=address")
+
+// ClusterMember is a node of the cluster and the address clients can reach it at.
+type ClusterMember struct {
+	ID      NodeID `json:"id"`
+	Address string `json:"address"` // Base http(s) address of the node, e.g. "https://node-a.example.com"
+}
+
+// GetReflectEndpoint returns the websocket endpoint clients should connect to.
+func (member ClusterMember) GetReflectEndpoint() string {
+	endpoint, errorParsing := url.Parse(member.Address)
+	if errorParsing != nil {
+		return member.Address + EndpointReflect
+	}
+
+	switch endpoint.Scheme {
+	case "https":
+		endpoint.Scheme = "wss"
+	case "http":
+		endpoint.Scheme = "ws"
+	}
+
+	endpoint.Path = strings.TrimSuffix(endpoint.Path, "/") + EndpointReflect
+	return endpoint.String()
+}
+
+// ParseClusterMembers parses a comma separated list of members formatted as id=address.
+func ParseClusterMembers(rawMembers string) ([]ClusterMember, error) {
+	members := make([]ClusterMember, 0)
+
+	for _, rawMember := range strings.Split(rawMembers, ",") {
+		rawMember = strings.TrimSpace(rawMember)
+		if rawMember == "" {
+			continue
+		}
+
+		id, address, isValid := strings.Cut(rawMember, "=")
+		if !isValid || id == "" || address == "" {
+			return nil, ErrInvalidClusterMember
+		}
+
+		members = append(members, ClusterMember{ID: NodeID(id), Address: address})
+	}
+
+	return members, nil
+}
+
+// ClusterMembership keeps track of the members of the cluster.
+type ClusterMembership interface {
+
+	// GetMembers returns every member currently considered alive, including the node itself.
+	GetMembers() []ClusterMember
+}
+
+// StaticMembership is a [ClusterMembership] whose members are known upfront and never change.
+type StaticMembership struct {
+	members []ClusterMember
+}
+
+func NewStaticMembership(members []ClusterMember) *StaticMembership {
+	return &StaticMembership{members: slices.Clone(members)}
+}
+
+func (membership *StaticMembership) GetMembers() []ClusterMember {
+	return slices.Clone(membership.members)
+}
+
+type hashRingPoint struct {
+	hash   uint64
+	member ClusterMember
+}
+
+// HashRing maps keys to members with consistent hashing, so adding or removing a member
+// only moves the keys of that member.
+type HashRing struct {
+	points []hashRingPoint
+}
+
+func NewHashRing(members []ClusterMember) *HashRing {
+	ring := &HashRing{points: make([]hashRingPoint, 0, len(members)*CLUSTER_VIRTUAL_NODES)}
+
+	for _, member := range members {
+		for virtualNode := 0; virtualNode < CLUSTER_VIRTUAL_NODES; virtualNode++ {
+			ring.points = append(ring.points, hashRingPoint{
+				hash:   hashRingKey(string(member.ID) + "#" + strconv.Itoa(virtualNode)),
+				member: member,
+			})
+		}
+	}
+
+	slices.SortFunc(ring.points, func(a, b hashRingPoint) int {
+		if a.hash != b.hash {
+			if a.hash < b.hash {
+				return -1
+			}
+
+			return 1
+		}
+
+		return strings.Compare(string(a.member.ID), string(b.member.ID))
+	})
+
+	return ring
+}
+
+// GetMember returns the member owning the key.
+func (ring *HashRing) GetMember(key string) (ClusterMember, bool) {
+	if len(ring.points) == 0 {
+		return ClusterMember{}, false
+	}
+
+	keyHash := hashRingKey(key)
+	index, _ := slices.BinarySearchFunc(ring.points, keyHash, func(point hashRingPoint, target uint64) int {
+		if point.hash < target {
+			return -1
+		}
+
+		if point.hash > target {
+			return 1
+		}
+
+		return 0
+	})
+
+	if index == len(ring.points) {
+		index = 0
+	}
+
+	return ring.points[index].member, true
+}
+
+// Hashes a key with FNV-1a followed by the murmur3 finalizer, as FNV alone places
+// similar keys such as the virtual nodes of a member close to each other.
+func hashRingKey(key string) uint64 {
+	hash := fnv.New64a()
+	hash.Write([]byte(key))
+
+	mixedHash := hash.Sum64()
+	mixedHash ^= mixedHash >> 33
+	mixedHash *= 0xff51afd7ed558ccd
+	mixedHash ^= mixedHash >> 33
+	mixedHash *= 0xc4ceb9fe1a85ec53
+	mixedHash ^= mixedHash >> 33
+
+	return mixedHash
+}
+
+// Cluster assigns every room to a member. Rooms stay with the member that created them, which it's RoomID
+// names, and rooms whose creator is gone or that don't name one are assigned by hashing their RoomID.
+// Clients trying to join a room owned by another member are redirected to it.
+type Cluster struct {
+	self       ClusterMember
+	membership ClusterMembership
+
+	mutex       sync.Mutex
+	ring        *HashRing
+	ringMembers []ClusterMember
+}
+
+func NewCluster(self ClusterMember, membership ClusterMembership) *Cluster {
+	return &Cluster{
+		self:       self,
+		membership: membership,
+	}
+}
+
+func (cluster *Cluster) GetSelf() ClusterMember {
+	return cluster.self
+}
+
+// PinRoomID tags a RoomID with the member, so the room stays with it when the membership changes
+// and the ring assigns the id to another member.
+func (cluster *Cluster) PinRoomID(roomID RoomID) RoomID {
+	return roomID + "-" + RoomID(getClusterMemberTag(cluster.self.ID))
+}
+
+// GetRoomOwner returns the member the room is assigned to.
+func (cluster *Cluster) GetRoomOwner(roomID RoomID) (ClusterMember, bool) {
+	ring, members := cluster.getRing()
+
+	if _, tag, isPinned := strings.Cut(string(roomID), "-"); isPinned {
+		for _, member := range members {
+			if getClusterMemberTag(member.ID) == tag {
+				return member, true
+			}
+		}
+	}
+
+	return ring.GetMember(string(roomID))
+}
+
+// Shortens the id of a member to the few characters a pinned RoomID ends with.
+func getClusterMemberTag(memberID NodeID) string {
+	return fmt.Sprintf("%06x", hashRingKey(string(memberID))&0xffffff)
+}
+
+// Rebuilds the ring only when the membership has changed since the last lookup.
+// Returns the ring along with the members it was built from.
+func (cluster *Cluster) getRing() (*HashRing, []ClusterMember) {
+	cluster.mutex.Lock()
+	defer cluster.mutex.Unlock()
+
+	members := cluster.membership.GetMembers()
+	isSelfMember := slices.ContainsFunc(members, func(member ClusterMember) bool {
+		return member.ID == cluster.self.ID
+	})
+
+	if !isSelfMember {
+		members = append(members, cluster.self)
+	}
+
+	slices.SortFunc(members, func(a, b ClusterMember) int {
+		return strings.Compare(string(a.ID), string(b.ID))
+	})
+
+	if cluster.ring == nil || !slices.Equal(members, cluster.ringMembers) {
+		logger.Info("[%s] [Cluster] Rebuilding hash ring with %d members\n", cluster.self.ID, len(members))
+		cluster.ring = NewHashRing(members)
+		cluster.ringMembers = members
+	}
+
+	return cluster.ring, cluster.ringMembers
+}
+
+// SetCluster enables the cluster mode, in which rooms are assigned to nodes by their RoomID.
+func (manager *Manager) SetCluster(cluster *Cluster) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	manager.cluster = cluster
+}
+
+// Returns the member owning a room that isn't hosted on this node while running in cluster mode.
+func (manager *Manager) getClusterRoomOwner(roomID RoomID) (ClusterMember, bool) {
+	if manager.cluster == nil {
+		return ClusterMember{}, false
+	}
+
+	owner, exists := manager.cluster.GetRoomOwner(roomID)
+	if !exists || owner.ID == manager.cluster.GetSelf().ID {
+		return ClusterMember{}, false
+	}
+
+	return owner, true
+}
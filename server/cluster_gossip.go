@@ -0,0 +1,250 @@
+package main
+
+import (
+	"bytes"
+	"crypto/subtle"
+	"encoding/json"
+	"math/rand/v2"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cowatch/logger"
+)
+
+const EndpointClusterGossip = "/cluster/gossip"
+
+type GossipOptions struct {
+	Interval       time.Duration // How often the node exchanges it's member list with a random peer
+	FailureTimeout time.Duration // How long a member can go without a new heartbeat before it's considered dead
+
+	// The secret shared by every node of the cluster, gossip that doesn't carry it is rejected
+	// so nobody else can add members and have clients redirected to them.
+	Secret string
+
+	// Accept members that aren't among the seeds, otherwise gossip only tells which seeds are alive.
+	Discovery bool
+
+	Clock Clock // Times the gossip rounds and the heartbeats of the members, the wall clock if it's nil
+}
+
+var DefaultGossipOptions = GossipOptions{
+	Interval:       time.Second,
+	FailureTimeout: 10 * time.Second,
+}
+
+type gossipMemberState struct {
+	Member    ClusterMember `json:"member"`
+	Heartbeat uint64        `json:"heartbeat"`
+}
+
+type gossipMessage struct {
+	Members []gossipMemberState `json:"members"`
+}
+
+type gossipMember struct {
+	state     gossipMemberState
+	updatedAt time.Time
+}
+
+// GossipMembership is a [ClusterMembership] that discovers the members of the cluster by
+// periodically exchanging heartbeats with random peers, starting from a list of seed members.
+type GossipMembership struct {
+	self       ClusterMember
+	seeds      []ClusterMember
+	options    GossipOptions
+	httpClient *http.Client
+
+	mutex     sync.Mutex
+	heartbeat uint64
+	members   map[NodeID]*gossipMember
+
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+func NewGossipMembership(self ClusterMember, seeds []ClusterMember, options GossipOptions) *GossipMembership {
+	if options.Clock == nil {
+		options.Clock = SystemClock{}
+	}
+
+	return &GossipMembership{
+		self:       self,
+		seeds:      seeds,
+		options:    options,
+		httpClient: &http.Client{Timeout: options.Interval},
+		members:    make(map[NodeID]*gossipMember),
+		stop:       make(chan struct{}),
+	}
+}
+
+func (membership *GossipMembership) GetMembers() []ClusterMember {
+	membership.mutex.Lock()
+	defer membership.mutex.Unlock()
+
+	now := membership.options.Clock.Now()
+	members := []ClusterMember{membership.self}
+	for _, member := range membership.members {
+		if now.Sub(member.updatedAt) <= membership.options.FailureTimeout {
+			members = append(members, member.state.Member)
+		}
+	}
+
+	return members
+}
+
+// Start gossips with a random peer every interval until the membership is stopped.
+func (membership *GossipMembership) Start() {
+	go func() {
+		ticker := membership.options.Clock.NewTicker(membership.options.Interval)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C():
+				membership.Gossip()
+			case <-membership.stop:
+				return
+			}
+		}
+	}()
+}
+
+func (membership *GossipMembership) Stop() {
+	membership.stopOnce.Do(func() { close(membership.stop) })
+}
+
+// Gossip exchanges the known member list with a random peer.
+func (membership *GossipMembership) Gossip() {
+	peer, hasPeer := membership.pickPeer()
+	if !hasPeer {
+		return
+	}
+
+	rawMessage, _ := json.Marshal(membership.collectGossip(true))
+	request, errorCreatingRequest := http.NewRequest(http.MethodPost, strings.TrimSuffix(peer.Address, "/")+EndpointClusterGossip, bytes.NewReader(rawMessage))
+	if errorCreatingRequest != nil {
+		logger.Warn("[%s] [Gossip] Failed to create the request to %q: %s\n", membership.self.ID, peer.ID, errorCreatingRequest)
+		return
+	}
+
+	request.Header.Set("Content-Type", "application/json")
+	request.Header.Set("Authorization", "Bearer "+membership.options.Secret)
+	response, errorGossiping := membership.httpClient.Do(request)
+	if errorGossiping != nil {
+		logger.Debug("[%s] [Gossip] Failed to reach %q: %s\n", membership.self.ID, peer.ID, errorGossiping)
+		return
+	}
+	defer response.Body.Close()
+
+	if response.StatusCode != http.StatusOK {
+		logger.Warn("[%s] [Gossip] %q rejected our gossip: %s\n", membership.self.ID, peer.ID, response.Status)
+		return
+	}
+
+	var peerGossip gossipMessage
+	if errorParsing := json.NewDecoder(response.Body).Decode(&peerGossip); errorParsing != nil {
+		logger.Warn("[%s] [Gossip] Received malformed gossip from %q: %s\n", membership.self.ID, peer.ID, errorParsing)
+		return
+	}
+
+	membership.merge(peerGossip)
+}
+
+// HandleGossip merges the member list of a peer and replies with the known member list.
+func (membership *GossipMembership) HandleGossip(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		w.WriteHeader(http.StatusMethodNotAllowed)
+		return
+	}
+
+	secret, hasBearerToken := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	if !hasBearerToken || subtle.ConstantTimeCompare([]byte(secret), []byte(membership.options.Secret)) != 1 {
+		logger.Warn("[%s] [Gossip] Rejected gossip without the cluster secret from %s\n", membership.self.ID, r.RemoteAddr)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var peerGossip gossipMessage
+	if errorParsing := json.NewDecoder(r.Body).Decode(&peerGossip); errorParsing != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	membership.merge(peerGossip)
+
+	w.Header().Add("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(membership.collectGossip(false))
+}
+
+// Collects the heartbeats of every known member, optionally beating our own heart first.
+func (membership *GossipMembership) collectGossip(isBeating bool) gossipMessage {
+	membership.mutex.Lock()
+	defer membership.mutex.Unlock()
+
+	if isBeating {
+		membership.heartbeat++
+	}
+
+	message := gossipMessage{Members: make([]gossipMemberState, 0, len(membership.members)+1)}
+	message.Members = append(message.Members, gossipMemberState{Member: membership.self, Heartbeat: membership.heartbeat})
+	for _, member := range membership.members {
+		message.Members = append(message.Members, member.state)
+	}
+
+	return message
+}
+
+// Keeps the most recent heartbeat of every member, of the seeds only unless discovery is enabled.
+func (membership *GossipMembership) merge(message gossipMessage) {
+	membership.mutex.Lock()
+	defer membership.mutex.Unlock()
+
+	for _, state := range message.Members {
+		if state.Member.ID == membership.self.ID || state.Member.ID == "" {
+			continue
+		}
+
+		if !membership.options.Discovery && !slices.Contains(membership.seeds, state.Member) {
+			logger.Debug("[%s] [Gossip] Ignoring member %q at %s that isn't a seed\n", membership.self.ID, state.Member.ID, state.Member.Address)
+			continue
+		}
+
+		existingMember, exists := membership.members[state.Member.ID]
+		if exists && existingMember.state.Heartbeat >= state.Heartbeat {
+			continue
+		}
+
+		if !exists {
+			logger.Info("[%s] [Gossip] Discovered member %q at %s\n", membership.self.ID, state.Member.ID, state.Member.Address)
+		}
+
+		membership.members[state.Member.ID] = &gossipMember{state: state, updatedAt: membership.options.Clock.Now()}
+	}
+}
+
+// Picks a random live member, falling back to the seeds until a member is discovered.
+func (membership *GossipMembership) pickPeer() (ClusterMember, bool) {
+	peers := make([]ClusterMember, 0, len(membership.seeds))
+	for _, member := range membership.GetMembers() {
+		if member.ID != membership.self.ID {
+			peers = append(peers, member)
+		}
+	}
+
+	if len(peers) == 0 {
+		for _, seed := range membership.seeds {
+			if seed.ID != membership.self.ID {
+				peers = append(peers, seed)
+			}
+		}
+	}
+
+	if len(peers) == 0 {
+		return ClusterMember{}, false
+	}
+
+	return peers[rand.IntN(len(peers))], true
+}
@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestHashRing(t *testing.T) {
+	members := []ClusterMember{
+		{ID: "A", Address: "http://a"},
+		{ID: "B", Address: "http://b"},
+		{ID: "C", Address: "http://c"},
+	}
+
+	t.Run("spreading keys between every member", func(t *testing.T) {
+		ring := NewHashRing(members)
+		keysPerMember := make(map[NodeID]int)
+
+		const keyCount = 3000
+		for key := 0; key < keyCount; key++ {
+			member, _ := ring.GetMember(fmt.Sprintf("room-%d", key))
+			keysPerMember[member.ID]++
+		}
+
+		for _, member := range members {
+			if keysPerMember[member.ID] < keyCount/len(members)/2 {
+				t.Errorf("Member %q got only %d of %d keys\n", member.ID, keysPerMember[member.ID], keyCount)
+			}
+		}
+	})
+
+	t.Run("removing a member only moves it's keys", func(t *testing.T) {
+		fullRing := NewHashRing(members)
+		reducedRing := NewHashRing(members[:2])
+
+		for key := 0; key < 1000; key++ {
+			fullOwner, _ := fullRing.GetMember(fmt.Sprintf("room-%d", key))
+			reducedOwner, _ := reducedRing.GetMember(fmt.Sprintf("room-%d", key))
+
+			if fullOwner.ID != "C" && fullOwner != reducedOwner {
+				t.Fatalf("Key %d moved from %q to %q\n", key, fullOwner.ID, reducedOwner.ID)
+			}
+		}
+	})
+
+	t.Run("getting a member from an empty ring", func(t *testing.T) {
+		_, exists := NewHashRing(nil).GetMember("room")
+		if exists {
+			t.Errorf("Expected an empty ring to have no members\n")
+		}
+	})
+}
+
+func TestParseClusterMembers(t *testing.T) {
+	t.Run("parsing a list of members", func(t *testing.T) {
+		got, err := ParseClusterMembers("A=https://a.example.com, B=http://b:8080")
+		want := []ClusterMember{
+			{ID: "A", Address: "https://a.example.com"},
+			{ID: "B", Address: "http://b:8080"},
+		}
+
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("Got %+v (err: %v) Want %+v\n", got, err, want)
+		}
+
+		if endpoint := got[0].GetReflectEndpoint(); endpoint != "wss://a.example.com"+EndpointReflect {
+			t.Errorf("Got endpoint %q\n", endpoint)
+		}
+	})
+
+	t.Run("parsing a malformed member", func(t *testing.T) {
+		_, err := ParseClusterMembers("A=http://a,B")
+		if err != ErrInvalidClusterMember {
+			t.Errorf("Expected %v but got %v\n", ErrInvalidClusterMember, err)
+		}
+	})
+}
+
+func TestClusterMode(t *testing.T) {
+	t.Run("generating room ids owned by the node", func(t *testing.T) {
+		nodes := startClusterNodes(t, 3, nil)
+
+		for _, node := range nodes {
+			for range 20 {
+				roomID := node.manager.GenerateUniqueRoomID()
+				owner, _ := node.cluster.GetRoomOwner(roomID)
+				if owner.ID != node.member.ID {
+					t.Fatalf("Node %q generated room %q owned by %q\n", node.member.ID, roomID, owner.ID)
+				}
+			}
+		}
+	})
+
+	t.Run("keeping rooms with the node that created them when the membership changes", func(t *testing.T) {
+		self := ClusterMember{ID: "node-0", Address: "http://node-0"}
+		membership := &changingMembership{members: []ClusterMember{self, {ID: "node-1", Address: "http://node-1"}}}
+		manager := NewManager(serverVersion, NewGorillaConnectionManager())
+		manager.SetCluster(NewCluster(self, membership))
+
+		roomIDs := make([]RoomID, 0)
+		for range 20 {
+			roomIDs = append(roomIDs, manager.GenerateUniqueRoomID())
+		}
+
+		// The new members take over part of the ring, which moves most ids to them
+		for index := 2; index < 8; index++ {
+			membership.members = append(membership.members, ClusterMember{ID: NodeID(fmt.Sprintf("node-%d", index)), Address: fmt.Sprintf("http://node-%d", index)})
+		}
+		membership.members = slices.Delete(membership.members, 1, 2)
+
+		otherCluster := NewCluster(membership.members[1], membership)
+		for _, roomID := range roomIDs {
+			if owner, isForeign := manager.getClusterRoomOwner(roomID); isForeign {
+				t.Errorf("Expected room %q to stay with it's creator but it moved to %q\n", roomID, owner.ID)
+			}
+
+			if owner, _ := otherCluster.GetRoomOwner(roomID); owner != self {
+				t.Errorf("Expected room %q to be owned by %q for the other members but got %q\n", roomID, self.ID, owner.ID)
+			}
+		}
+
+		// Without it's creator a room is assigned by the ring like any id
+		membership.members = membership.members[1:]
+		owner, _ := otherCluster.GetRoomOwner(roomIDs[0])
+		ringOwner, _ := NewHashRing(membership.members).GetMember(string(roomIDs[0]))
+		if owner != ringOwner {
+			t.Errorf("Expected the room of a member that left to be assigned to %q but got %q\n", ringOwner.ID, owner.ID)
+		}
+	})
+
+	t.Run("redirecting a viewer to the node owning the room", func(t *testing.T) {
+		nodes := startClusterNodes(t, 3, nil)
+
+		wsHost := dialClusterNode(t, nodes[0].member.GetReflectEndpoint())
+		sendClientMessage(t, wsHost, ClientMessageTypeAuthorize, ClientRequestAuthorizeRoom{Name: "Host"})
+		readServerMessage(t, wsHost, ServerMessageTypeAuthorize, ServerMessageStatusOk)
+
+		sendClientMessage(t, wsHost, ClientMessageTypeHostRoom, RoomSettings{Name: "Cluster"})
+		var roomRecord RoomRecord
+		json.Unmarshal(readServerMessage(t, wsHost, ServerMessageTypeHostRoom, ServerMessageStatusOk).MessageDetails, &roomRecord)
+
+		wsViewer := dialClusterNode(t, nodes[1].member.GetReflectEndpoint())
+		sendClientMessage(t, wsViewer, ClientMessageTypeAuthorize, ClientRequestAuthorizeRoom{Name: "Viewer"})
+		readServerMessage(t, wsViewer, ServerMessageTypeAuthorize, ServerMessageStatusOk)
+
+		sendClientMessage(t, wsViewer, ClientMessageTypeJoinRoom, ClientRequestJoinRoom{RoomID: roomRecord.RoomID})
+		redirect := readServerMessage(t, wsViewer, ServerMessageTypeJoinRoom, ServerMessageStatusError)
+
+		var redirectDetails ServerErrorDetailsRoomRedirect
+		json.Unmarshal(redirect.ErrorDetails, &redirectDetails)
+
+		wantDetails := ServerErrorDetailsRoomRedirect{NodeID: nodes[0].member.ID, Endpoint: nodes[0].member.GetReflectEndpoint()}
+		if redirect.ErrorCode != ServerErrorCodeRoomRedirect || redirectDetails != wantDetails {
+			t.Fatalf("Expected a redirect to %+v but got %q %+v\n", wantDetails, redirect.ErrorCode, redirectDetails)
+		}
+
+		wsRedirectedViewer := dialClusterNode(t, redirectDetails.Endpoint)
+		sendClientMessage(t, wsRedirectedViewer, ClientMessageTypeAuthorize, ClientRequestAuthorizeRoom{Name: "Viewer"})
+		readServerMessage(t, wsRedirectedViewer, ServerMessageTypeAuthorize, ServerMessageStatusOk)
+
+		sendClientMessage(t, wsRedirectedViewer, ClientMessageTypeJoinRoom, ClientRequestJoinRoom{RoomID: roomRecord.RoomID})
+		readServerMessage(t, wsRedirectedViewer, ServerMessageTypeJoinRoom, ServerMessageStatusOk)
+	})
+
+	t.Run("joining a room that doesn't exist on the owning node", func(t *testing.T) {
+		nodes := startClusterNodes(t, 2, nil)
+		roomID := nodes[0].manager.GenerateUniqueRoomID()
+
+		ws := dialClusterNode(t, nodes[0].member.GetReflectEndpoint())
+		sendClientMessage(t, ws, ClientMessageTypeAuthorize, ClientRequestAuthorizeRoom{Name: "Viewer"})
+		readServerMessage(t, ws, ServerMessageTypeAuthorize, ServerMessageStatusOk)
+
+		sendClientMessage(t, ws, ClientMessageTypeJoinRoom, ClientRequestJoinRoom{RoomID: roomID})
+		if response := readServerMessage(t, ws, ServerMessageTypeJoinRoom, ServerMessageStatusError); response.ErrorCode != ServerErrorCodeNoRoom {
+			t.Errorf("Expected %q but got %q\n", ServerErrorCodeNoRoom, response.ErrorCode)
+		}
+	})
+}
+
+func TestGossipMembership(t *testing.T) {
+	gossipOptions := GossipOptions{Interval: time.Second, FailureTimeout: 200 * time.Millisecond, Secret: "Secret", Discovery: true}
+
+	t.Run("discovering every member from a single seed", func(t *testing.T) {
+		nodes := startClusterNodes(t, 3, &gossipOptions)
+
+		gossipUntil(t, nodes, func() bool {
+			for _, node := range nodes {
+				if len(node.gossip.GetMembers()) != len(nodes) {
+					return false
+				}
+			}
+
+			return true
+		})
+	})
+
+	t.Run("removing a member that stopped gossiping", func(t *testing.T) {
+		clock := NewFakeClock(time.Date(2024, time.May, 1, 20, 0, 0, 0, time.UTC))
+		clockedOptions := gossipOptions
+		clockedOptions.FailureTimeout, clockedOptions.Clock = time.Minute, clock
+		nodes := startClusterNodes(t, 3, &clockedOptions)
+
+		gossipUntil(t, nodes, func() bool {
+			return len(nodes[0].gossip.GetMembers()) == len(nodes)
+		})
+
+		nodes[2].server.Close()
+		remainingNodes := nodes[:2]
+
+		clock.Advance(clockedOptions.FailureTimeout - time.Second)
+		if len(nodes[0].gossip.GetMembers()) != len(nodes) {
+			t.Fatalf("Expected the member to be kept until the failure timeout\n")
+		}
+
+		// Gossip can still carry a newer heartbeat of the member it missed, which expires again as time goes by
+		gossipUntil(t, remainingNodes, func() bool {
+			clock.Advance(10 * time.Second)
+			for _, node := range remainingNodes {
+				if len(node.gossip.GetMembers()) != len(remainingNodes) {
+					return false
+				}
+			}
+
+			return true
+		})
+
+		for range 20 {
+			roomID := nodes[0].manager.GenerateUniqueRoomID()
+			if owner, _ := nodes[1].cluster.GetRoomOwner(roomID); owner.ID != nodes[0].member.ID {
+				t.Fatalf("Room %q owned by %q after %q left\n", roomID, owner.ID, nodes[2].member.ID)
+			}
+		}
+	})
+}
+
+func TestGossipAuthentication(t *testing.T) {
+	self := ClusterMember{ID: "node-0", Address: "http://node-0"}
+	seed := ClusterMember{ID: "node-1", Address: "http://node-1"}
+	stranger := ClusterMember{ID: "node-2", Address: "http://attacker"}
+
+	postGossip := func(membership *GossipMembership, secret string, members ...ClusterMember) int {
+		message := gossipMessage{}
+		for _, member := range members {
+			message.Members = append(message.Members, gossipMemberState{Member: member, Heartbeat: 1000})
+		}
+
+		rawMessage, _ := json.Marshal(message)
+		request := httptest.NewRequest(http.MethodPost, EndpointClusterGossip, bytes.NewReader(rawMessage))
+		if secret != "" {
+			request.Header.Set("Authorization", "Bearer "+secret)
+		}
+
+		recorder := httptest.NewRecorder()
+		membership.HandleGossip(recorder, request)
+		return recorder.Code
+	}
+
+	t.Run("rejecting gossip without the cluster secret", func(t *testing.T) {
+		membership := NewGossipMembership(self, []ClusterMember{seed}, GossipOptions{Interval: time.Second, FailureTimeout: time.Minute, Secret: "Secret", Discovery: true})
+
+		for _, secret := range []string{"", "Wrong"} {
+			if status := postGossip(membership, secret, stranger); status != http.StatusUnauthorized {
+				t.Errorf("Expected gossip with secret %q to be rejected but got %d\n", secret, status)
+			}
+		}
+
+		if members := membership.GetMembers(); len(members) != 1 {
+			t.Errorf("Expected no member to be added but got %+v\n", members)
+		}
+	})
+
+	t.Run("accepting only the seeds without discovery", func(t *testing.T) {
+		membership := NewGossipMembership(self, []ClusterMember{seed}, GossipOptions{Interval: time.Second, FailureTimeout: time.Minute, Secret: "Secret"})
+
+		if status := postGossip(membership, "Secret", seed, stranger, ClusterMember{ID: seed.ID, Address: stranger.Address}); status != http.StatusOK {
+			t.Fatalf("Expected the gossip to be accepted but got %d\n", status)
+		}
+
+		members := membership.GetMembers()
+		if len(members) != 2 || !slices.Contains(members, seed) {
+			t.Errorf("Expected only the seed to be added but got %+v\n", members)
+		}
+	})
+}
+
+type clusterTestNode struct {
+	member  ClusterMember
+	server  *httptest.Server
+	manager *Manager
+	cluster *Cluster
+	gossip  *GossipMembership
+}
+
+// Starts nodes that know each other statically, or through gossip seeded with the first node.
+// A membership whose members are changed by the test.
+type changingMembership struct {
+	members []ClusterMember
+}
+
+func (membership *changingMembership) GetMembers() []ClusterMember {
+	return slices.Clone(membership.members)
+}
+
+func startClusterNodes(t *testing.T, nodeCount int, gossipOptions *GossipOptions) []*clusterTestNode {
+	t.Helper()
+
+	nodes := make([]*clusterTestNode, nodeCount)
+	members := make([]ClusterMember, nodeCount)
+
+	for index := range nodes {
+		router := http.NewServeMux()
+		server := httptest.NewUnstartedServer(router)
+
+		members[index] = ClusterMember{ID: NodeID(fmt.Sprintf("node-%d", index)), Address: "http://" + server.Listener.Addr().String()}
+		nodes[index] = &clusterTestNode{
+			member:  members[index],
+			server:  server,
+			manager: NewManager(serverVersion, NewGorillaConnectionManager()),
+		}
+
+		router.HandleFunc(EndpointReflect, nodes[index].manager.HandleMessages)
+		if gossipOptions != nil {
+			nodes[index].gossip = NewGossipMembership(members[index], members[:1], *gossipOptions)
+			router.HandleFunc(EndpointClusterGossip, nodes[index].gossip.HandleGossip)
+		}
+
+		server.Start()
+		t.Cleanup(server.Close)
+	}
+
+	for _, node := range nodes {
+		var membership ClusterMembership = NewStaticMembership(members)
+		if node.gossip != nil {
+			membership = node.gossip
+		}
+
+		node.cluster = NewCluster(node.member, membership)
+		node.manager.SetCluster(node.cluster)
+	}
+
+	return nodes
+}
+
+// Runs gossip rounds on every node until the condition is met.
+func gossipUntil(t *testing.T, nodes []*clusterTestNode, condition func() bool) {
+	t.Helper()
+
+	for range 50 {
+		for _, node := range nodes {
+			node.gossip.Gossip()
+		}
+
+		if condition() {
+			return
+		}
+
+		time.Sleep(20 * time.Millisecond)
+	}
+
+	t.Fatalf("Gossip didn't converge\n")
+}
+
+func dialClusterNode(t *testing.T, endpoint string) *websocket.Conn {
+	t.Helper()
+
+	ws, _, err := websocket.DefaultDialer.Dial(endpoint, nil)
+	if err != nil {
+		t.Fatalf("Failed to connect to %q: %v\n", endpoint, err)
+	}
+	t.Cleanup(func() { ws.Close() })
+
+	return ws
+}
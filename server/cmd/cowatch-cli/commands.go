@@ -0,0 +1,399 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/cowatch/protocol"
+)
+
+var errQuit = errors.New("quit")
+
+type cliCommand struct {
+	Name        string
+	Arguments   string
+	Description string
+	Run         func(session *cliSession, ctx context.Context, arguments string) error
+}
+
+var cliCommands = []cliCommand{
+	{"status", "", "Show the room, the video and the extrapolated playback", runStatus},
+	{"host", "<name>", "Host a new room", runHost},
+	{"join", "<roomID>", "Join a room as a viewer", runJoin},
+	{"leave", "", "Leave the room, closing it if you host it", runLeave},
+	{"rename", "<name>", "Rename the room you host", runRename},
+	{"wait", "<on|off>", "Hold the start of the playback until the viewers are ready in the room you host", runWait},
+	{"schedule", "<in|off>", "Schedule the start of the room you host, e.g. schedule 10m, the viewers wait until then", runSchedule},
+	{"ready", "<yes|no>", "Report whether you're ready to play to a room waiting for it's viewers", runReady},
+	{"video", "<videoID>", "Start playing a youtube video in the room you host", runVideo},
+	{"control", "<host|co_hosts|everyone>", "Choose who can control the playback of the room you host", runControl},
+	{"cohost", "<publicToken> [permission...]", "Make a viewer a co-host with permissions like control_playback, kick or change_settings, none makes them a viewer again", runCoHost},
+	{"kick", "<publicToken>", "Remove a viewer from the room", runKick},
+	{"vote", "<skip|pause|seek> [time]", "Start a vote to skip the video, pause or seek to a time", runVote},
+	{"ballot", "<yes|no>", "Vote for or against the latest vote of the room", runBallot},
+	{"play", "[time]", "Resume playback, optionally from a time like 90 or 1:30", runPlay},
+	{"pause", "[time]", "Pause playback, optionally at a time", runPause},
+	{"seek", "<time>", "Jump to a time", runSeek},
+	{"details", "<json>", "Send the details of the video, e.g. {\"title\": \"...\", \"author\": \"...\"}", runDetails},
+	{"resync", "", "Request the changes made to the room since the latest known revision", runResync},
+	{"ping", "", "Measure the round trip to the server", runPing},
+	{"raw", "<actionType> [json]", "Send any client message, e.g. a message type the cli doesn't know about", runRaw},
+	{"quit", "", "Disconnect and exit", runQuit},
+}
+
+// Executes the commands read from in until it ends, the context is done or quit is entered.
+func (session *cliSession) runCommands(ctx context.Context, in io.Reader) {
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+
+		scanner := bufio.NewScanner(in)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+		}
+	}()
+
+	session.printf("Type help to list the commands\n")
+	for {
+		var line string
+		var isOpen bool
+
+		select {
+		case <-ctx.Done():
+			return
+		case line, isOpen = <-lines:
+		}
+
+		if !isOpen {
+			return
+		}
+
+		if errorExecuting := session.executeCommand(ctx, line); errors.Is(errorExecuting, errQuit) {
+			return
+		} else if errorExecuting != nil {
+			session.printf("Error: %s\n", errorExecuting)
+		}
+	}
+}
+
+func (session *cliSession) executeCommand(ctx context.Context, line string) error {
+	name, arguments, _ := strings.Cut(strings.TrimSpace(line), " ")
+	arguments = strings.TrimSpace(arguments)
+
+	if name == "" {
+		return nil
+	}
+
+	if name == "help" {
+		session.printHelp()
+		return nil
+	}
+
+	for _, command := range cliCommands {
+		if command.Name != name {
+			continue
+		}
+
+		ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+		defer cancel()
+
+		return command.Run(session, ctx, arguments)
+	}
+
+	return fmt.Errorf("Unknown command %q, type help to list the commands", name)
+}
+
+func (session *cliSession) printHelp() {
+	session.outMutex.Lock()
+	defer session.outMutex.Unlock()
+
+	for _, command := range cliCommands {
+		fmt.Fprintf(session.out, "  %-28s %s\n", strings.TrimSpace(command.Name+" "+command.Arguments), command.Description)
+	}
+}
+
+func requireArguments(arguments string, usage string) error {
+	if arguments == "" {
+		return fmt.Errorf("Missing arguments, usage: %s", usage)
+	}
+
+	return nil
+}
+
+func runStatus(session *cliSession, ctx context.Context, arguments string) error {
+	session.printStatus()
+	return nil
+}
+
+func runHost(session *cliSession, ctx context.Context, arguments string) error {
+	if errorValidating := requireArguments(arguments, "host <name>"); errorValidating != nil {
+		return errorValidating
+	}
+
+	return session.hostRoom(ctx, arguments)
+}
+
+func runJoin(session *cliSession, ctx context.Context, arguments string) error {
+	if errorValidating := requireArguments(arguments, "join <roomID>"); errorValidating != nil {
+		return errorValidating
+	}
+
+	return session.joinRoom(ctx, protocol.RoomID(arguments))
+}
+
+func runLeave(session *cliSession, ctx context.Context, arguments string) error {
+	return session.client.DisconnectRoom(ctx)
+}
+
+func runRename(session *cliSession, ctx context.Context, arguments string) error {
+	if errorValidating := requireArguments(arguments, "rename <name>"); errorValidating != nil {
+		return errorValidating
+	}
+
+	settings, isInRoom := session.getRoomSettings()
+	if !isInRoom {
+		return fmt.Errorf("Not in a room")
+	}
+
+	settings.Name = arguments
+	_, errorRenaming := session.client.UpdateRoomSettings(ctx, settings)
+	return errorRenaming
+}
+
+func runWait(session *cliSession, ctx context.Context, arguments string) error {
+	if arguments != "on" && arguments != "off" {
+		return fmt.Errorf("Expected on or off, usage: wait <on|off>")
+	}
+
+	settings, isInRoom := session.getRoomSettings()
+	if !isInRoom {
+		return fmt.Errorf("Not in a room")
+	}
+
+	settings.WaitForViewers = arguments == "on"
+	_, errorUpdating := session.client.UpdateRoomSettings(ctx, settings)
+	return errorUpdating
+}
+
+func runSchedule(session *cliSession, ctx context.Context, arguments string) error {
+	if errorValidating := requireArguments(arguments, "schedule <in|off>"); errorValidating != nil {
+		return errorValidating
+	}
+
+	settings, isInRoom := session.getRoomSettings()
+	if !isInRoom {
+		return fmt.Errorf("Not in a room")
+	}
+
+	settings.ScheduledStart = 0
+	if arguments != "off" {
+		startsIn, errorParsing := time.ParseDuration(arguments)
+		if errorParsing != nil {
+			return fmt.Errorf("Expected a duration like 90s or 10m, usage: schedule <in|off>")
+		}
+
+		settings.ScheduledStart = protocol.Timestamp(time.Now().Add(startsIn).Unix())
+	}
+
+	_, errorUpdating := session.client.UpdateRoomSettings(ctx, settings)
+	return errorUpdating
+}
+
+func runReady(session *cliSession, ctx context.Context, arguments string) error {
+	if arguments != "yes" && arguments != "no" {
+		return fmt.Errorf("Expected yes or no, usage: ready <yes|no>")
+	}
+
+	return session.client.SendReadiness(ctx, arguments == "yes")
+}
+
+func runControl(session *cliSession, ctx context.Context, arguments string) error {
+	if arguments == "" {
+		return fmt.Errorf("Expected a control mode, usage: control <host|co_hosts|everyone>")
+	}
+
+	settings, isInRoom := session.getRoomSettings()
+	if !isInRoom {
+		return fmt.Errorf("Not in a room")
+	}
+
+	settings.ControlMode = protocol.RoomControlMode(strings.ToUpper(arguments))
+	_, errorUpdating := session.client.UpdateRoomSettings(ctx, settings)
+	return errorUpdating
+}
+
+func runCoHost(session *cliSession, ctx context.Context, arguments string) error {
+	fields := strings.Fields(arguments)
+	if len(fields) == 0 {
+		return fmt.Errorf("Expected a public token, usage: cohost <publicToken> [permission...]")
+	}
+
+	permissions := make([]protocol.RoomPermission, 0, len(fields)-1)
+	for _, permission := range fields[1:] {
+		permissions = append(permissions, protocol.RoomPermission(strings.ToUpper(permission)))
+	}
+
+	_, errorAssigning := session.client.AssignPermissions(ctx, protocol.Token(fields[0]), permissions)
+	return errorAssigning
+}
+
+func runKick(session *cliSession, ctx context.Context, arguments string) error {
+	if arguments == "" {
+		return fmt.Errorf("Expected a public token, usage: kick <publicToken>")
+	}
+
+	_, errorKicking := session.client.KickViewer(ctx, protocol.Token(arguments))
+	return errorKicking
+}
+
+func runVote(session *cliSession, ctx context.Context, arguments string) error {
+	action, timeArgument, _ := strings.Cut(arguments, " ")
+	request := protocol.ClientRequestStartVote{Action: protocol.VoteAction(strings.ToUpper(action))}
+	if request.Action != protocol.VoteActionSkip && request.Action != protocol.VoteActionPause && request.Action != protocol.VoteActionSeek {
+		return fmt.Errorf("Expected skip, pause or seek, usage: vote <skip|pause|seek> [time]")
+	}
+
+	if request.Action == protocol.VoteActionSeek {
+		playbackTime, errorParsing := parsePlaybackTime(timeArgument)
+		if errorParsing != nil {
+			return errorParsing
+		}
+
+		request.Time = playbackTime
+	}
+
+	_, errorVoting := session.client.StartVote(ctx, request)
+	return errorVoting
+}
+
+func runBallot(session *cliSession, ctx context.Context, arguments string) error {
+	if arguments != "yes" && arguments != "no" {
+		return fmt.Errorf("Expected yes or no, usage: ballot <yes|no>")
+	}
+
+	session.mutex.Lock()
+	voteID := session.latestVoteID
+	session.mutex.Unlock()
+
+	_, errorVoting := session.client.CastVote(ctx, voteID, arguments == "yes")
+	return errorVoting
+}
+
+func runVideo(session *cliSession, ctx context.Context, arguments string) error {
+	if errorValidating := requireArguments(arguments, "video <videoID>"); errorValidating != nil {
+		return errorValidating
+	}
+
+	return session.controlPlayback(ctx, func(reflection *protocol.RoomReflection) {
+		reflection.ID = arguments
+		reflection.State = protocol.PlayerStatePlaying
+		reflection.CurrentTime = 0
+	})
+}
+
+func runPlay(session *cliSession, ctx context.Context, arguments string) error {
+	return controlPlaybackAt(session, ctx, arguments, protocol.PlayerStatePlaying)
+}
+
+func runPause(session *cliSession, ctx context.Context, arguments string) error {
+	return controlPlaybackAt(session, ctx, arguments, protocol.PlayerStatePaused)
+}
+
+// Changes the state of the playback, moving it to the time if one is given.
+func controlPlaybackAt(session *cliSession, ctx context.Context, arguments string, state int) error {
+	var playbackTime float32
+	if arguments != "" {
+		var errorParsing error
+		if playbackTime, errorParsing = parsePlaybackTime(arguments); errorParsing != nil {
+			return errorParsing
+		}
+	}
+
+	return session.controlPlayback(ctx, func(reflection *protocol.RoomReflection) {
+		reflection.State = state
+		if arguments != "" {
+			reflection.CurrentTime = playbackTime
+		}
+	})
+}
+
+func runSeek(session *cliSession, ctx context.Context, arguments string) error {
+	if errorValidating := requireArguments(arguments, "seek <time>"); errorValidating != nil {
+		return errorValidating
+	}
+
+	playbackTime, errorParsing := parsePlaybackTime(arguments)
+	if errorParsing != nil {
+		return errorParsing
+	}
+
+	return session.controlPlayback(ctx, func(reflection *protocol.RoomReflection) {
+		reflection.CurrentTime = playbackTime
+	})
+}
+
+func runDetails(session *cliSession, ctx context.Context, arguments string) error {
+	if errorValidating := requireArguments(arguments, "details <json>"); errorValidating != nil {
+		return errorValidating
+	}
+
+	var videoDetails protocol.VideoDetails
+	if errorParsing := json.Unmarshal([]byte(arguments), &videoDetails); errorParsing != nil {
+		return errorParsing
+	}
+
+	if errorSending := session.client.SendVideoDetails(ctx, videoDetails); errorSending != nil {
+		return errorSending
+	}
+
+	session.handleVideoDetails(videoDetails)
+	return nil
+}
+
+func runResync(session *cliSession, ctx context.Context, arguments string) error {
+	return session.resyncRoom(ctx)
+}
+
+func runPing(session *cliSession, ctx context.Context, arguments string) error {
+	roundTrip, errorPinging := session.client.Ping(ctx)
+	if errorPinging != nil {
+		return errorPinging
+	}
+
+	session.printf("Pong after %s\n", roundTrip)
+	return nil
+}
+
+func runRaw(session *cliSession, ctx context.Context, arguments string) error {
+	if errorValidating := requireArguments(arguments, "raw <actionType> [json]"); errorValidating != nil {
+		return errorValidating
+	}
+
+	messageType, action, _ := strings.Cut(arguments, " ")
+	action = strings.TrimSpace(action)
+	if action == "" {
+		action = "{}"
+	}
+
+	if !json.Valid([]byte(action)) {
+		return fmt.Errorf("The action must be json but got %q", action)
+	}
+
+	response, errorRequesting := session.client.Request(ctx, protocol.ClientMessageType(messageType), json.RawMessage(action), protocol.ServerMessageType(messageType))
+	if errorRequesting != nil {
+		return errorRequesting
+	}
+
+	session.printf("%s %s %s\n", response.MessageType, response.Status, response.MessageDetails)
+	return nil
+}
+
+func runQuit(session *cliSession, ctx context.Context, arguments string) error {
+	return errQuit
+}
@@ -0,0 +1,110 @@
+// cowatch-cli joins or hosts a room from the terminal, to watch and debug rooms without a browser.
+// Once connected it reads commands from stdin, type help to list them.
+//
+//	$ go run ./cmd/cowatch-cli -join 1a2b3c4d
+//	$ go run ./cmd/cowatch-cli -host "Movie night" -raw
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/cowatch/client"
+	"github.com/cowatch/logger"
+	"github.com/cowatch/protocol"
+)
+
+type cliOptions struct {
+	URL                string
+	ServerVersion      string
+	Subprotocol        string
+	Name               string
+	HostRoom           string
+	JoinRoom           string
+	ReflectionInterval time.Duration
+	DumpRaw            bool
+}
+
+func main() {
+	var options cliOptions
+	var logLevel string
+
+	flag.StringVar(&options.URL, "url", "ws://localhost:8080/reflect", "The reflect endpoint of the server")
+	flag.StringVar(&options.ServerVersion, "server-version", "0.0.5", "The server version the client claims to speak")
+	flag.StringVar(&options.Subprotocol, "subprotocol", protocol.SubprotocolJSON, "The codec requested from the server, cowatch.json or cowatch.msgpack")
+	flag.StringVar(&options.Name, "name", "cowatch-cli", "The name shown to the other members of the room")
+	flag.StringVar(&options.HostRoom, "host", "", "Host a room with the given name once authorized")
+	flag.StringVar(&options.JoinRoom, "join", "", "Join the room with the given id once authorized")
+	flag.DurationVar(&options.ReflectionInterval, "reflection-interval", 500*time.Millisecond, "How often a hosted room's playback is reflected, the extension's default is 500ms")
+	flag.BoolVar(&options.DumpRaw, "raw", false, "Print every frame sent and received")
+	flag.StringVar(&logLevel, "log-level", logger.LogLevelWarn, "The level of the messages logged while running")
+	flag.Parse()
+
+	if !logger.SetLevel(logger.LogLevel(logLevel)) {
+		logger.Error("Unknown log level %q\n", logLevel)
+		os.Exit(2)
+	}
+
+	if options.HostRoom != "" && options.JoinRoom != "" {
+		logger.Error("Only one of -host and -join can be used\n")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	session, errorStarting := startSession(ctx, options, os.Stdout)
+	if errorStarting != nil {
+		fmt.Fprintf(os.Stderr, "Failed to start: %s\n", errorStarting)
+		os.Exit(1)
+	}
+	defer session.client.Close()
+
+	session.runCommands(ctx, os.Stdin)
+}
+
+// Connects, authorizes and enters the room requested by the options.
+func startSession(ctx context.Context, options cliOptions, out io.Writer) (*cliSession, error) {
+	session := newCliSession(options, out)
+
+	clientOptions := client.Options{ServerVersion: options.ServerVersion, Subprotocol: options.Subprotocol}
+	if options.DumpRaw {
+		clientOptions.Trace = session.printTraffic
+	}
+
+	setupCtx, cancel := context.WithTimeout(ctx, SetupTimeout)
+	defer cancel()
+
+	cowatch, errorDialing := client.Dial(setupCtx, options.URL, clientOptions)
+	if errorDialing != nil {
+		return nil, errorDialing
+	}
+	session.attach(cowatch)
+
+	authorization, errorAuthorizing := cowatch.Authorize(setupCtx, protocol.ClientRequestAuthorizeRoom{Name: options.Name})
+	if errorAuthorizing != nil {
+		cowatch.Close()
+		return nil, errorAuthorizing
+	}
+	session.printf("Authorized as %q (%s)\n", authorization.Name, authorization.PublicToken)
+
+	var errorEntering error
+	switch {
+	case options.HostRoom != "":
+		errorEntering = session.hostRoom(setupCtx, options.HostRoom)
+	case options.JoinRoom != "":
+		errorEntering = session.joinRoom(setupCtx, protocol.RoomID(options.JoinRoom))
+	}
+
+	if errorEntering != nil {
+		cowatch.Close()
+		return nil, errorEntering
+	}
+
+	return session, nil
+}
@@ -0,0 +1,561 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cowatch/client"
+	"github.com/cowatch/protocol"
+)
+
+// The longest the client waits for the server to answer while connecting.
+const SetupTimeout = 10 * time.Second
+
+// The longest a command waits for the server to answer.
+const RequestTimeout = 10 * time.Second
+
+// Reflections this many seconds away from the extrapolated time are reported as seeks.
+const SeekThreshold = 2
+
+// How many times a lost connection is retried before giving up, waiting a second longer every time.
+const ReconnectAttempts = 5
+
+// cliSession keeps the latest state of the room the client is in and prints every change to it.
+type cliSession struct {
+	options cliOptions
+	client  *client.Client
+
+	outMutex sync.Mutex
+	out      io.Writer
+
+	mutex          sync.Mutex
+	room           *protocol.RoomRecord
+	clientType     protocol.ClientType
+	videoDetails   *protocol.VideoDetails
+	reflection     *protocol.RoomReflection
+	reflectedAt    time.Time
+	stopReflecting context.CancelFunc
+	latestVoteID   protocol.VoteID
+}
+
+func newCliSession(options cliOptions, out io.Writer) *cliSession {
+	return &cliSession{options: options, out: out}
+}
+
+// Registers the session's handlers on the client.
+func (session *cliSession) attach(cowatch *client.Client) {
+	session.client = cowatch
+
+	cowatch.OnRoomUpdate(session.handleRoomUpdate)
+	cowatch.OnReflect(session.handleReflect)
+	cowatch.OnVideoDetails(session.handleVideoDetails)
+	cowatch.OnDisconnectRoom(session.handleDisconnectRoom)
+	cowatch.OnAnnouncement(session.handleAnnouncement)
+	cowatch.OnRoomClosing(session.handleRoomClosing)
+	cowatch.OnCountdown(session.handleCountdown)
+	cowatch.OnVote(session.handleVote)
+	cowatch.OnConnectionLost(session.handleConnectionLost)
+}
+
+func (session *cliSession) printf(format string, arguments ...interface{}) {
+	session.outMutex.Lock()
+	defer session.outMutex.Unlock()
+
+	fmt.Fprintf(session.out, format, arguments...)
+}
+
+// Prints a raw frame, binary frames are printed in hex.
+func (session *cliSession) printTraffic(isOutgoing bool, rawMessage []byte) {
+	direction := "<-"
+	if isOutgoing {
+		direction = "->"
+	}
+
+	if json.Valid(rawMessage) {
+		session.printf("%s %s\n", direction, rawMessage)
+	} else {
+		session.printf("%s % x\n", direction, rawMessage)
+	}
+}
+
+func (session *cliSession) hostRoom(ctx context.Context, name string) error {
+	record, errorHosting := session.client.HostRoom(ctx, protocol.RoomSettings{Name: name})
+	if errorHosting != nil {
+		return errorHosting
+	}
+
+	session.mutex.Lock()
+	session.enterRoom(record, protocol.ClientTypeHost)
+	session.mutex.Unlock()
+
+	session.printStatus()
+	return nil
+}
+
+func (session *cliSession) joinRoom(ctx context.Context, roomID protocol.RoomID) error {
+	joinRoom, errorJoining := session.client.JoinRoom(ctx, roomID)
+	if errorJoining != nil {
+		return errorJoining
+	}
+
+	session.mutex.Lock()
+	session.enterRoom(joinRoom.Room, joinRoom.Type)
+	session.mutex.Unlock()
+
+	session.printStatus()
+	return nil
+}
+
+// Replaces the state of the previous room, hosts start reflecting their playback.
+// Expects the session to be locked.
+func (session *cliSession) enterRoom(record protocol.RoomRecord, clientType protocol.ClientType) {
+	session.leaveRoom()
+	session.room = &record
+	session.clientType = clientType
+
+	if clientType == protocol.ClientTypeHost && session.options.ReflectionInterval > 0 {
+		ctx, cancel := context.WithCancel(context.Background())
+		session.stopReflecting = cancel
+		go session.reflectPeriodically(ctx)
+	}
+}
+
+// Forgets the room, expects the session to be locked.
+func (session *cliSession) leaveRoom() {
+	if session.stopReflecting != nil {
+		session.stopReflecting()
+		session.stopReflecting = nil
+	}
+
+	session.room = nil
+	session.clientType = protocol.ClientTypeInnactive
+	session.videoDetails = nil
+	session.reflection = nil
+}
+
+// Sends the host's extrapolated playback every reflection interval, like the extension does.
+func (session *cliSession) reflectPeriodically(ctx context.Context) {
+	ticker := time.NewTicker(session.options.ReflectionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		reflection, exists := session.getExtrapolatedReflection(time.Now())
+		if !exists {
+			continue
+		}
+
+		requestCtx, cancel := context.WithTimeout(ctx, RequestTimeout)
+		session.client.Reflect(requestCtx, reflection)
+		cancel()
+	}
+}
+
+// Estimates the room's current playback from the latest reflection.
+func (session *cliSession) getExtrapolatedReflection(now time.Time) (protocol.RoomReflection, bool) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.reflection == nil {
+		return protocol.RoomReflection{}, false
+	}
+
+	reflection := *session.reflection
+	reflection.CurrentTime = reflection.GetExtrapolatedTime(now.Sub(session.reflectedAt))
+	return reflection, true
+}
+
+// Changes the playback of a hosted room and reflects it right away.
+// Viewers and co-hosts send the change as an intent instead, which the server reflects back once it's applied.
+func (session *cliSession) controlPlayback(ctx context.Context, change func(reflection *protocol.RoomReflection)) error {
+	now := time.Now()
+	reflection, _ := session.getExtrapolatedReflection(now)
+	previousState := reflection.State
+	change(&reflection)
+
+	session.mutex.Lock()
+	isViewer := session.clientType != protocol.ClientTypeHost
+	session.mutex.Unlock()
+
+	if isViewer {
+		action := protocol.PlaybackAction(protocol.PlaybackActionSeek)
+		if reflection.State != previousState && reflection.State == protocol.PlayerStatePlaying {
+			action = protocol.PlaybackActionPlay
+		} else if reflection.State != previousState && reflection.State == protocol.PlayerStatePaused {
+			action = protocol.PlaybackActionPause
+		}
+
+		return session.client.SendIntent(ctx, action, reflection.CurrentTime)
+	}
+
+	if errorReflecting := session.client.Reflect(ctx, reflection); errorReflecting != nil {
+		return errorReflecting
+	}
+
+	session.mutex.Lock()
+	session.reflection = &reflection
+	session.reflectedAt = now
+	session.mutex.Unlock()
+
+	session.printf("%s\n", describeReflection(reflection))
+	return nil
+}
+
+func (session *cliSession) handleRoomUpdate(delta protocol.RoomDelta) {
+	session.mutex.Lock()
+	isInRoom := session.room != nil
+	isStale := isInRoom && delta.Revision <= session.room.Revision // e.g. the client's own join, already part of the record
+	isApplied := isInRoom && !isStale && session.room.ApplyDelta(delta)
+	session.mutex.Unlock()
+
+	if !isInRoom || isStale {
+		return
+	}
+
+	if !isApplied {
+		session.printf("Missed an update of the room, resyncing\n")
+		go session.resyncRoom(context.Background())
+		return
+	}
+
+	session.printf("%s\n", describeRoomDelta(delta))
+}
+
+// Brings the room up to date after missing some of it's updates.
+func (session *cliSession) resyncRoom(ctx context.Context) error {
+	session.mutex.Lock()
+	if session.room == nil {
+		session.mutex.Unlock()
+		return fmt.Errorf("Not in a room")
+	}
+	revision := session.room.Revision
+	session.mutex.Unlock()
+
+	ctx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	resync, errorResyncing := session.client.ResyncRoom(ctx, revision)
+	if errorResyncing != nil {
+		session.printf("Failed to resync the room: %s\n", errorResyncing)
+		return errorResyncing
+	}
+
+	session.mutex.Lock()
+	if session.room != nil {
+		if resync.Room != nil {
+			session.room = resync.Room
+		}
+
+		for _, delta := range resync.Deltas {
+			session.room.ApplyDelta(delta)
+		}
+	}
+	session.mutex.Unlock()
+
+	session.printStatus()
+	return nil
+}
+
+func (session *cliSession) handleReflect(reflection protocol.RoomReflection) {
+	now := time.Now()
+
+	session.mutex.Lock()
+	previous := session.reflection
+	previousAt := session.reflectedAt
+	session.reflection = &reflection
+	session.reflectedAt = now
+	session.mutex.Unlock()
+
+	if previous == nil || hasPlaybackChanged(*previous, reflection, now.Sub(previousAt)) {
+		session.printf("%s\n", describeReflection(reflection))
+	}
+}
+
+func (session *cliSession) handleVideoDetails(videoDetails protocol.VideoDetails) {
+	session.mutex.Lock()
+	session.videoDetails = &videoDetails
+	session.mutex.Unlock()
+
+	session.printf("Now watching %q by %s\n", videoDetails.Title, videoDetails.Author)
+}
+
+func (session *cliSession) handleDisconnectRoom() {
+	session.mutex.Lock()
+	session.leaveRoom()
+	session.mutex.Unlock()
+
+	session.printf("Left the room\n")
+}
+
+func (session *cliSession) handleAnnouncement(announcement protocol.ServerAnnouncement) {
+	if announcement.Maintenance {
+		session.printf("Announcement (maintenance): %s\n", announcement.Message)
+		return
+	}
+
+	session.printf("Announcement: %s\n", announcement.Message)
+}
+
+func (session *cliSession) handleRoomClosing(roomClosing protocol.ServerRoomClosing) {
+	if roomClosing.Cancelled {
+		session.printf("The room will no longer be closed (%s)\n", roomClosing.Reason)
+		return
+	}
+
+	session.printf("The room closes in %ds (%s)\n", roomClosing.SecondsLeft, roomClosing.Reason)
+}
+
+func (session *cliSession) handleCountdown(countdown protocol.ServerCountdown) {
+	session.printf("The playback starts in %ds\n", countdown.SecondsLeft)
+}
+
+func (session *cliSession) handleVote(vote protocol.ServerVote) {
+	session.mutex.Lock()
+	session.latestVoteID = vote.VoteID
+	session.mutex.Unlock()
+
+	if vote.Result != "" {
+		session.printf("The vote to %s %s with %d in favor and %d against\n", strings.ToLower(string(vote.Action)), strings.ToLower(string(vote.Result)), vote.InFavor, vote.Against)
+		return
+	}
+
+	session.printf("%s voted to %s: %d in favor, %d against, %d needed\n", vote.StartedBy.Name, strings.ToLower(string(vote.Action)), vote.InFavor, vote.Against, vote.Required)
+}
+
+func (session *cliSession) handleConnectionLost(errorReading error) {
+	session.printf("%s, reconnecting\n", errorReading)
+	go session.reconnect()
+}
+
+// Restores the session on a new connection, retrying a few times before giving up.
+func (session *cliSession) reconnect() {
+	for attempt := 1; attempt <= ReconnectAttempts; attempt++ {
+		time.Sleep(time.Duration(attempt) * time.Second)
+
+		ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+		joinRoom, errorReconnecting := session.client.AttemptReconnect(ctx)
+		cancel()
+
+		if errorReconnecting != nil {
+			session.printf("Failed to reconnect (%d/%d): %s\n", attempt, ReconnectAttempts, errorReconnecting)
+			continue
+		}
+
+		session.restoreRoom(joinRoom)
+
+		session.printf("Reconnected\n")
+		session.printStatus()
+		return
+	}
+
+	session.printf("Giving up, the server is unreachable\n")
+}
+
+// Catches up with the room rejoined after reconnecting, keeping the playback of the room it was already in.
+func (session *cliSession) restoreRoom(joinRoom *protocol.ServerResponseJoinRoom) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if joinRoom == nil {
+		session.leaveRoom()
+		return
+	}
+
+	if session.room != nil && session.room.RoomID == joinRoom.Room.RoomID {
+		session.room = &joinRoom.Room
+		session.clientType = joinRoom.Type
+		return
+	}
+
+	session.enterRoom(joinRoom.Room, joinRoom.Type)
+}
+
+// Collects the settings of the room the session is in.
+func (session *cliSession) getRoomSettings() (protocol.RoomSettings, bool) {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	if session.room == nil {
+		return protocol.RoomSettings{}, false
+	}
+
+	return session.room.Settings, true
+}
+
+func (session *cliSession) printStatus() {
+	session.mutex.Lock()
+	defer session.mutex.Unlock()
+
+	session.outMutex.Lock()
+	defer session.outMutex.Unlock()
+
+	session.writeStatus(session.out, time.Now())
+}
+
+// Writes the room, the video and the extrapolated playback, expects the session to be locked.
+func (session *cliSession) writeStatus(w io.Writer, now time.Time) {
+	if session.room == nil {
+		fmt.Fprintf(w, "Not in a room\n")
+		return
+	}
+
+	role := "a viewer"
+	if session.clientType == protocol.ClientTypeHost {
+		role = "the host"
+	} else if session.clientType == protocol.ClientTypeCoHost {
+		role = "a co-host"
+	}
+
+	fmt.Fprintf(w, "Room %q (%s) at revision %d, you are %s\n", session.room.Settings.Name, session.room.RoomID, session.room.Revision, role)
+	fmt.Fprintf(w, "  Host:     %s\n", describeClient(session.room.Host))
+
+	viewers := make([]string, 0, len(session.room.Viewers))
+	for _, viewer := range session.room.Viewers {
+		viewers = append(viewers, describeClient(viewer))
+	}
+	fmt.Fprintf(w, "  Viewers:  %d", len(viewers))
+	if len(viewers) > 0 {
+		fmt.Fprintf(w, " %s", strings.Join(viewers, ", "))
+	}
+	fmt.Fprintf(w, "\n")
+
+	if session.videoDetails != nil {
+		fmt.Fprintf(w, "  Video:    %q by %s\n", session.videoDetails.Title, session.videoDetails.Author)
+	}
+
+	if session.reflection != nil {
+		reflection := *session.reflection
+		reflection.CurrentTime = reflection.GetExtrapolatedTime(now.Sub(session.reflectedAt))
+		fmt.Fprintf(w, "  Playback: %s (reflected %s ago)\n", describeReflection(reflection), now.Sub(session.reflectedAt).Round(time.Millisecond))
+	}
+}
+
+func describeClient(record protocol.ClientRecord) string {
+	if record.Role == protocol.ClientTypeCoHost {
+		return fmt.Sprintf("%s (%s, co-host)", record.Name, record.PublicToken)
+	}
+
+	return fmt.Sprintf("%s (%s)", record.Name, record.PublicToken)
+}
+
+func describeRoomDelta(delta protocol.RoomDelta) string {
+	name := ""
+	if delta.Client != nil {
+		name = delta.Client.Name
+	}
+
+	switch delta.Type {
+	case protocol.RoomDeltaTypeViewerJoined:
+		return fmt.Sprintf("%s joined", name)
+	case protocol.RoomDeltaTypeViewerLeft:
+		return fmt.Sprintf("%s left", name)
+	case protocol.RoomDeltaTypeHostChanged:
+		return fmt.Sprintf("%s is hosting", name)
+	case protocol.RoomDeltaTypeRoleChanged:
+		if delta.Client == nil || delta.Client.Role != protocol.ClientTypeCoHost {
+			return fmt.Sprintf("%s is a viewer", name)
+		}
+
+		permissions := make([]string, 0, len(delta.Client.Permissions))
+		for _, permission := range delta.Client.Permissions {
+			permissions = append(permissions, strings.ToLower(string(permission)))
+		}
+		return fmt.Sprintf("%s is a co-host who can: %s", name, strings.Join(permissions, ", "))
+	case protocol.RoomDeltaTypeSettingsChanged:
+		if delta.Settings != nil {
+			description := fmt.Sprintf("The room's settings changed, it's named %q and waits for viewers: %t", delta.Settings.Name, delta.Settings.WaitForViewers)
+			if delta.Settings.ControlMode != "" && delta.Settings.ControlMode != protocol.RoomControlModeHost {
+				description += fmt.Sprintf(", it's controlled by %s", strings.ToLower(string(delta.Settings.ControlMode)))
+			}
+
+			if delta.Settings.ScheduledStart != 0 {
+				description += fmt.Sprintf(", it starts at %s", time.Unix(int64(delta.Settings.ScheduledStart), 0).Format(time.TimeOnly))
+			}
+
+			return description
+		}
+	case protocol.RoomDeltaTypeWaitingChanged:
+		if len(delta.WaitingFor) == 0 {
+			return "Nobody is holding the start of the playback"
+		}
+
+		waitingFor := make([]string, 0, len(delta.WaitingFor))
+		for _, viewer := range delta.WaitingFor {
+			waitingFor = append(waitingFor, viewer.Name)
+		}
+		return fmt.Sprintf("Waiting for %s to be ready", strings.Join(waitingFor, ", "))
+	}
+
+	return fmt.Sprintf("The room changed (%s)", delta.Type)
+}
+
+var playerStateNames = map[int]string{
+	protocol.PlayerStateUnstarted: "unstarted",
+	protocol.PlayerStateEnded:     "ended",
+	protocol.PlayerStatePlaying:   "playing",
+	protocol.PlayerStatePaused:    "paused",
+	protocol.PlayerStateBuffering: "buffering",
+	protocol.PlayerStateVideoCued: "cued",
+}
+
+func describeReflection(reflection protocol.RoomReflection) string {
+	state, exists := playerStateNames[reflection.State]
+	if !exists {
+		state = fmt.Sprintf("state %d", reflection.State)
+	}
+
+	return fmt.Sprintf("%s %s at %s", state, reflection.ID, formatPlaybackTime(reflection.CurrentTime))
+}
+
+// Whether a reflection changed the video or state, or jumped away from where the previous one was heading.
+func hasPlaybackChanged(previous protocol.RoomReflection, reflection protocol.RoomReflection, elapsed time.Duration) bool {
+	if previous.ID != reflection.ID || previous.State != reflection.State {
+		return true
+	}
+
+	return math.Abs(float64(previous.GetExtrapolatedTime(elapsed)-reflection.CurrentTime)) > SeekThreshold
+}
+
+// Formats seconds as m:ss or h:mm:ss.
+func formatPlaybackTime(seconds float32) string {
+	totalSeconds := int(max(0, seconds))
+	hours, minutes, remainingSeconds := totalSeconds/3600, totalSeconds/60%60, totalSeconds%60
+
+	if hours > 0 {
+		return fmt.Sprintf("%d:%02d:%02d", hours, minutes, remainingSeconds)
+	}
+
+	return fmt.Sprintf("%d:%02d", minutes, remainingSeconds)
+}
+
+// Parses seconds written as 90, 90.5, 1:30 or 1:01:30.
+func parsePlaybackTime(text string) (float32, error) {
+	parts := strings.Split(text, ":")
+	if len(parts) > 3 {
+		return 0, fmt.Errorf("Invalid time %q", text)
+	}
+
+	var seconds float64
+	for index, part := range parts {
+		value, errorParsing := strconv.ParseFloat(part, 64)
+		if errorParsing != nil || value < 0 || (index > 0 && value >= 60) {
+			return 0, fmt.Errorf("Invalid time %q", text)
+		}
+
+		seconds = seconds*60 + value
+	}
+
+	return float32(seconds), nil
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cowatch/protocol"
+)
+
+func TestPlaybackTime(t *testing.T) {
+	t.Run("parsing seconds and clock times", func(t *testing.T) {
+		tests := map[string]float32{
+			"0":       0,
+			"90":      90,
+			"90.5":    90.5,
+			"1:30":    90,
+			"1:01:30": 3690,
+		}
+
+		for text, expected := range tests {
+			if parsed, err := parsePlaybackTime(text); err != nil || parsed != expected {
+				t.Errorf("Expected %q to parse to %v but got %v %v\n", text, expected, parsed, err)
+			}
+		}
+
+		for _, text := range []string{"", "abc", "-5", "1:60", "1:2:3:4"} {
+			if _, err := parsePlaybackTime(text); err == nil {
+				t.Errorf("Expected %q to be rejected\n", text)
+			}
+		}
+	})
+
+	t.Run("formatting seconds", func(t *testing.T) {
+		tests := map[float32]string{
+			0:      "0:00",
+			90.7:   "1:30",
+			3690:   "1:01:30",
+			-3:     "0:00",
+			359999: "99:59:59",
+		}
+
+		for seconds, expected := range tests {
+			if formatted := formatPlaybackTime(seconds); formatted != expected {
+				t.Errorf("Expected %v to format as %q but got %q\n", seconds, expected, formatted)
+			}
+		}
+	})
+
+	t.Run("detecting changes of the playback", func(t *testing.T) {
+		playing := protocol.RoomReflection{ID: "Video", State: protocol.PlayerStatePlaying, CurrentTime: 10}
+
+		tests := []struct {
+			reflection protocol.RoomReflection
+			expected   bool
+		}{
+			{protocol.RoomReflection{ID: "Video", State: protocol.PlayerStatePlaying, CurrentTime: 11}, false},
+			{protocol.RoomReflection{ID: "Video", State: protocol.PlayerStatePlaying, CurrentTime: 30}, true},
+			{protocol.RoomReflection{ID: "Video", State: protocol.PlayerStatePaused, CurrentTime: 11}, true},
+			{protocol.RoomReflection{ID: "Other", State: protocol.PlayerStatePlaying, CurrentTime: 11}, true},
+		}
+
+		for _, test := range tests {
+			if hasChanged := hasPlaybackChanged(playing, test.reflection, time.Second); hasChanged != test.expected {
+				t.Errorf("Expected %+v to be a change %t but got %t\n", test.reflection, test.expected, hasChanged)
+			}
+		}
+	})
+}
+
+func TestCliSession(t *testing.T) {
+	t.Run("keeping the room up to date", func(t *testing.T) {
+		session, out := newTestCliSession()
+		session.enterRoom(protocol.RoomRecord{
+			RoomID:   "Room",
+			Host:     protocol.ClientRecord{Name: "Alice", PublicToken: "A"},
+			Viewers:  []protocol.ClientRecord{{Name: "Bob", PublicToken: "B"}},
+			Settings: protocol.RoomSettings{Name: "Movie night"},
+			Revision: 1,
+		}, protocol.ClientTypeViewer)
+
+		session.handleRoomUpdate(protocol.RoomDelta{Revision: 1, Type: protocol.RoomDeltaTypeViewerJoined, Client: &protocol.ClientRecord{Name: "Bob", PublicToken: "B"}})
+		session.handleRoomUpdate(protocol.RoomDelta{Revision: 2, Type: protocol.RoomDeltaTypeViewerJoined, Client: &protocol.ClientRecord{Name: "Carol", PublicToken: "C"}})
+
+		if output := out.String(); output != "Carol joined\n" {
+			t.Errorf("Expected only the new delta to be printed but got %q\n", output)
+		}
+
+		session.handleReflect(protocol.RoomReflection{ID: "Video", State: protocol.PlayerStatePlaying, CurrentTime: 10})
+		session.handleVideoDetails(protocol.VideoDetails{Title: "Song", Author: "Rick"})
+
+		var status bytes.Buffer
+		session.reflectedAt = time.Now().Add(-5 * time.Second)
+		session.writeStatus(&status, session.reflectedAt.Add(5*time.Second))
+
+		for _, expected := range []string{
+			`Room "Movie night" (Room) at revision 2, you are a viewer`,
+			"Viewers:  2 Bob (B), Carol (C)",
+			`Video:    "Song" by Rick`,
+			"Playback: playing Video at 0:15",
+		} {
+			if !strings.Contains(status.String(), expected) {
+				t.Errorf("Expected the status to contain %q but got:\n%s", expected, status.String())
+			}
+		}
+
+		session.handleDisconnectRoom()
+		if session.room != nil || session.reflection != nil {
+			t.Errorf("Expected the room to be forgotten but got %+v %+v\n", session.room, session.reflection)
+		}
+	})
+
+	t.Run("rejecting unknown commands and missing arguments", func(t *testing.T) {
+		session, out := newTestCliSession()
+
+		if err := session.executeCommand(context.Background(), "dance"); err == nil || !strings.Contains(err.Error(), "Unknown command") {
+			t.Errorf("Expected an unknown command error but got %v\n", err)
+		}
+
+		for _, command := range []string{"join", "seek", "raw", "details"} {
+			if err := session.executeCommand(context.Background(), command); err == nil || !strings.Contains(err.Error(), "usage") {
+				t.Errorf("Expected %q to require arguments but got %v\n", command, err)
+			}
+		}
+
+		if err := session.executeCommand(context.Background(), "seek 1:75"); err == nil {
+			t.Errorf("Expected an invalid time to be rejected\n")
+		}
+
+		if err := session.executeCommand(context.Background(), "help"); err != nil || !strings.Contains(out.String(), "join <roomID>") {
+			t.Errorf("Expected help to list the commands but got %q %v\n", out.String(), err)
+		}
+	})
+}
+
+func newTestCliSession() (*cliSession, *bytes.Buffer) {
+	var out bytes.Buffer
+	return newCliSession(cliOptions{}, &out), &out
+}
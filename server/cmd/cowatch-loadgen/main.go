@@ -0,0 +1,87 @@
+// cowatch-loadgen simulates rooms of hosts and viewers speaking the real protocol against a server
+// and reports how quickly reflections fan out to the viewers.
+//
+//	$ go run ./cmd/cowatch-loadgen -rooms 50 -viewers 5 -duration 1m
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/cowatch/logger"
+)
+
+type loadOptions struct {
+	URL                string
+	ServerVersion      string
+	Rooms              int
+	ViewersPerRoom     int
+	Duration           time.Duration
+	RampUp             time.Duration // Room starts are spread across the ramp up instead of all connecting at once
+	ReflectionInterval time.Duration
+	PingInterval       time.Duration
+}
+
+func main() {
+	var options loadOptions
+	var logLevel string
+
+	flag.StringVar(&options.URL, "url", "ws://localhost:8080/reflect", "The reflect endpoint of the server under test")
+	flag.StringVar(&options.ServerVersion, "server-version", "0.0.5", "The server version the simulated clients claim to speak")
+	flag.IntVar(&options.Rooms, "rooms", 10, "The amount of rooms to host")
+	flag.IntVar(&options.ViewersPerRoom, "viewers", 5, "The amount of viewers joining every room")
+	flag.DurationVar(&options.Duration, "duration", 30*time.Second, "How long hosts keep reflecting once every room has started")
+	flag.DurationVar(&options.RampUp, "ramp-up", 5*time.Second, "The time over which room starts are spread")
+	flag.DurationVar(&options.ReflectionInterval, "reflection-interval", 500*time.Millisecond, "How often hosts send a reflection, the extension's default is 500ms")
+	flag.DurationVar(&options.PingInterval, "ping-interval", 120*time.Second, "How often every client pings after the first ping, the extension's default is 120s")
+	flag.StringVar(&logLevel, "log-level", logger.LogLevelWarn, "The level of the messages logged while running")
+	flag.Parse()
+
+	if !logger.SetLevel(logger.LogLevel(logLevel)) {
+		logger.Error("Unknown log level %q\n", logLevel)
+		os.Exit(2)
+	}
+
+	startedAt := time.Now()
+	stats := runLoadTest(options)
+	stats.writeReport(os.Stdout, options, time.Since(startedAt))
+
+	if stats.connectionFailures.Load()+stats.setupFailures.Load() > 0 {
+		os.Exit(1)
+	}
+}
+
+// Starts every room across the ramp up and lets them reflect until the duration ends.
+func runLoadTest(options loadOptions) *loadStats {
+	test := &loadTest{options: options, stats: &loadStats{}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), options.RampUp+options.Duration)
+	defer cancel()
+
+	var waitGroup sync.WaitGroup
+	for roomIndex := range options.Rooms {
+		startDelay := time.Duration(0)
+		if options.Rooms > 1 {
+			startDelay = options.RampUp * time.Duration(roomIndex) / time.Duration(options.Rooms-1)
+		}
+
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(startDelay):
+			}
+
+			test.runRoom(ctx, roomIndex)
+		}()
+	}
+
+	waitGroup.Wait()
+	return test.stats
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/cowatch/client"
+	"github.com/cowatch/logger"
+	"github.com/cowatch/protocol"
+)
+
+// The longest a client waits for the server to answer while setting up.
+const SetupTimeout = 10 * time.Second
+
+// How long viewers keep listening after the hosts stop, so late reflections aren't counted as dropped.
+const DrainPeriod = 2 * time.Second
+
+// The video every simulated host claims to be playing.
+const LoadTestVideoID = "dQw4w9WgXcQ"
+
+type loadTest struct {
+	options loadOptions
+	stats   *loadStats
+}
+
+// loadRoom tracks when every reflection of a room was sent so viewers can measure the fan-out latency.
+// Reflections are identified by their playback time, which only ever increases within a room.
+type loadRoom struct {
+	mutex  sync.Mutex
+	sentAt map[float32]time.Time
+}
+
+func (room *loadRoom) recordSent(playbackTime float32, sentAt time.Time) {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	room.sentAt[playbackTime] = sentAt
+}
+
+func (room *loadRoom) getSentAt(playbackTime float32) (time.Time, bool) {
+	room.mutex.Lock()
+	defer room.mutex.Unlock()
+
+	sentAt, exists := room.sentAt[playbackTime]
+	return sentAt, exists
+}
+
+// Runs a host and its viewers until the context is done.
+func (test *loadTest) runRoom(ctx context.Context, roomIndex int) {
+	host, errorConnecting := test.connectClient(fmt.Sprintf("Host %d", roomIndex))
+	if errorConnecting != nil {
+		return
+	}
+	defer host.Close()
+
+	setupCtx, cancelSetup := context.WithTimeout(ctx, SetupTimeout)
+	record, errorHosting := host.HostRoom(setupCtx, protocol.RoomSettings{Name: fmt.Sprintf("Load test %d", roomIndex)})
+	cancelSetup()
+	if errorHosting != nil {
+		test.recordSetupFailure("host room", errorHosting)
+		return
+	}
+
+	room := &loadRoom{sentAt: make(map[float32]time.Time)}
+	viewers := test.joinViewers(ctx, roomIndex, record.RoomID, room)
+	defer func() {
+		time.Sleep(DrainPeriod)
+		for _, viewer := range viewers {
+			viewer.Close()
+		}
+	}()
+
+	for _, viewer := range viewers {
+		go test.pingPeriodically(ctx, viewer)
+	}
+	go test.pingPeriodically(ctx, host)
+
+	test.reflectPeriodically(ctx, host, room, len(viewers))
+}
+
+// Connects every viewer of a room at once, returning the ones that joined.
+// Viewers measure the latency of every reflection they receive from the moment it was sent.
+func (test *loadTest) joinViewers(ctx context.Context, roomIndex int, roomID protocol.RoomID, room *loadRoom) []*client.Client {
+	var mutex sync.Mutex
+	var waitGroup sync.WaitGroup
+	viewers := make([]*client.Client, 0, test.options.ViewersPerRoom)
+
+	for viewerIndex := range test.options.ViewersPerRoom {
+		waitGroup.Add(1)
+		go func() {
+			defer waitGroup.Done()
+
+			viewer, errorConnecting := test.connectClient(fmt.Sprintf("Viewer %d-%d", roomIndex, viewerIndex))
+			if errorConnecting != nil {
+				return
+			}
+
+			viewer.OnReflect(func(reflection protocol.RoomReflection) {
+				if sentAt, exists := room.getSentAt(reflection.CurrentTime); exists {
+					test.stats.fanOutLatency.add(time.Since(sentAt))
+					test.stats.deliveriesReceived.Add(1)
+				}
+			})
+
+			setupCtx, cancelSetup := context.WithTimeout(ctx, SetupTimeout)
+			_, errorJoining := viewer.JoinRoom(setupCtx, roomID)
+			cancelSetup()
+
+			if errorJoining != nil {
+				test.recordSetupFailure("join room", errorJoining)
+				viewer.Close()
+				return
+			}
+
+			mutex.Lock()
+			viewers = append(viewers, viewer)
+			mutex.Unlock()
+		}()
+	}
+
+	waitGroup.Wait()
+	return viewers
+}
+
+// Opens a connection and authorizes it.
+func (test *loadTest) connectClient(name string) (*client.Client, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), SetupTimeout)
+	defer cancel()
+
+	// Pinging is left to the load test so the round trips can be measured
+	connection, errorDialing := client.Dial(ctx, test.options.URL, client.Options{ServerVersion: test.options.ServerVersion, PingInterval: -1})
+	if errorDialing != nil {
+		logger.Warn("[%s] Failed to connect: %s\n", name, errorDialing)
+		test.stats.connectionFailures.Add(1)
+		return nil, errorDialing
+	}
+	test.stats.connections.Add(1)
+
+	connection.OnConnectionLost(func(errorReading error) {
+		logger.Warn("[%s] Connection dropped: %s\n", name, errorReading)
+		test.stats.disconnects.Add(1)
+	})
+
+	if _, errorAuthorizing := connection.Authorize(ctx, protocol.ClientRequestAuthorizeRoom{Name: name}); errorAuthorizing != nil {
+		test.recordSetupFailure("authorize", errorAuthorizing)
+		connection.Close()
+		return nil, errorAuthorizing
+	}
+
+	return connection, nil
+}
+
+func (test *loadTest) recordSetupFailure(step string, errorSettingUp error) {
+	logger.Warn("Failed to %s: %s\n", step, errorSettingUp)
+	test.stats.setupFailures.Add(1)
+}
+
+// Records a failed call, returning false if the connection can no longer be used.
+func (test *loadTest) recordCallFailure(call string, errorCalling error) bool {
+	var serverError *client.ServerError
+	if errors.As(errorCalling, &serverError) {
+		logger.Warn("[%s] Received error %s: %s\n", call, serverError.Code, serverError.Message)
+		test.stats.errorResponses.Add(1)
+		return true
+	}
+
+	if !errors.Is(errorCalling, context.Canceled) && !errors.Is(errorCalling, context.DeadlineExceeded) {
+		logger.Warn("Failed to %s: %s\n", call, errorCalling)
+	}
+
+	return false
+}
+
+// Sends the host's playback position every reflection interval, the way the extension does while a video plays.
+func (test *loadTest) reflectPeriodically(ctx context.Context, host *client.Client, room *loadRoom, viewerCount int) {
+	ticker := time.NewTicker(test.options.ReflectionInterval)
+	defer ticker.Stop()
+
+	for tick := 1; ; tick++ {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		playbackTime := float32((time.Duration(tick) * test.options.ReflectionInterval).Seconds())
+		room.recordSent(playbackTime, time.Now())
+
+		errorReflecting := host.Reflect(ctx, protocol.RoomReflection{ID: LoadTestVideoID, State: protocol.PlayerStatePlaying, CurrentTime: playbackTime})
+		if errorReflecting != nil {
+			if !test.recordCallFailure("send reflection", errorReflecting) {
+				return
+			}
+
+			continue
+		}
+
+		test.stats.reflectionsSent.Add(1)
+		test.stats.deliveriesExpected.Add(int64(viewerCount))
+	}
+}
+
+// Pings right away and then every ping interval, like the extension keeping it's connection alive.
+func (test *loadTest) pingPeriodically(ctx context.Context, connection *client.Client) {
+	ticker := time.NewTicker(test.options.PingInterval)
+	defer ticker.Stop()
+
+	for {
+		roundTrip, errorPinging := connection.Ping(ctx)
+		if errorPinging == nil {
+			test.stats.pingLatency.add(roundTrip)
+		} else if !test.recordCallFailure("ping", errorPinging) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// latencyRecorder keeps every sample so exact percentiles can be reported at the end of a run.
+type latencyRecorder struct {
+	mutex   sync.Mutex
+	samples []time.Duration
+}
+
+func (recorder *latencyRecorder) add(sample time.Duration) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recorder.samples = append(recorder.samples, sample)
+}
+
+type latencySummary struct {
+	Count int
+	P50   time.Duration
+	P90   time.Duration
+	P99   time.Duration
+	Max   time.Duration
+}
+
+func (recorder *latencyRecorder) summarize() latencySummary {
+	recorder.mutex.Lock()
+	samples := slices.Clone(recorder.samples)
+	recorder.mutex.Unlock()
+
+	if len(samples) == 0 {
+		return latencySummary{}
+	}
+
+	slices.Sort(samples)
+	return latencySummary{
+		Count: len(samples),
+		P50:   percentile(samples, 50),
+		P90:   percentile(samples, 90),
+		P99:   percentile(samples, 99),
+		Max:   samples[len(samples)-1],
+	}
+}
+
+// Picks the nearest-rank percentile of sorted samples.
+func percentile(sortedSamples []time.Duration, rank float64) time.Duration {
+	index := int(math.Ceil(rank/100*float64(len(sortedSamples)))) - 1
+	return sortedSamples[max(0, min(index, len(sortedSamples)-1))]
+}
+
+// loadStats collects the outcome of every simulated client of a run.
+type loadStats struct {
+	connections        atomic.Int64
+	connectionFailures atomic.Int64
+	setupFailures      atomic.Int64 // Clients that connected but failed to authorize, host or join
+	disconnects        atomic.Int64 // Connections the server closed before the run ended
+	errorResponses     atomic.Int64
+
+	reflectionsSent    atomic.Int64
+	deliveriesExpected atomic.Int64
+	deliveriesReceived atomic.Int64
+
+	fanOutLatency latencyRecorder
+	pingLatency   latencyRecorder
+}
+
+func (stats *loadStats) writeReport(w io.Writer, options loadOptions, elapsed time.Duration) {
+	attemptedConnections := stats.connections.Load() + stats.connectionFailures.Load()
+	expected := stats.deliveriesExpected.Load()
+	received := stats.deliveriesReceived.Load()
+	dropped := max(0, expected-received)
+
+	fmt.Fprintf(w, "cowatch load test against %s (%s)\n", options.URL, elapsed.Round(time.Millisecond))
+	fmt.Fprintf(w, "  rooms:        %d with %d viewers each\n", options.Rooms, options.ViewersPerRoom)
+	fmt.Fprintf(w, "  connections:  %d opened, %d failed, %d failed to set up, %d dropped by the server\n",
+		stats.connections.Load(), stats.connectionFailures.Load(), stats.setupFailures.Load(), stats.disconnects.Load())
+	fmt.Fprintf(w, "  errors:       %d error responses (%.2f%% of clients failed)\n",
+		stats.errorResponses.Load(), ratio(stats.connectionFailures.Load()+stats.setupFailures.Load(), attemptedConnections))
+	fmt.Fprintf(w, "  reflections:  %d sent, %d of %d deliveries received, %d dropped (%.2f%%)\n",
+		stats.reflectionsSent.Load(), received, expected, dropped, ratio(dropped, expected))
+	writeLatencySummary(w, "fan-out", stats.fanOutLatency.summarize())
+	writeLatencySummary(w, "ping rtt", stats.pingLatency.summarize())
+}
+
+func writeLatencySummary(w io.Writer, name string, summary latencySummary) {
+	if summary.Count == 0 {
+		fmt.Fprintf(w, "  %-13s no samples\n", name+":")
+		return
+	}
+
+	fmt.Fprintf(w, "  %-13s p50 %s  p90 %s  p99 %s  max %s  (%d samples)\n", name+":",
+		summary.P50.Round(time.Microsecond), summary.P90.Round(time.Microsecond),
+		summary.P99.Round(time.Microsecond), summary.Max.Round(time.Microsecond), summary.Count)
+}
+
+// Percentage of part in total, 0 if there's nothing to compare with.
+func ratio(part int64, total int64) float64 {
+	if total == 0 {
+		return 0
+	}
+
+	return float64(part) / float64(total) * 100
+}
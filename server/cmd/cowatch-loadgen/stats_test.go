@@ -0,0 +1,69 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestLatencyRecorder(t *testing.T) {
+	t.Run("summarizing samples with nearest rank percentiles", func(t *testing.T) {
+		var recorder latencyRecorder
+		for sample := 100; sample >= 1; sample-- {
+			recorder.add(time.Duration(sample) * time.Millisecond)
+		}
+
+		got := recorder.summarize()
+		want := latencySummary{
+			Count: 100,
+			P50:   50 * time.Millisecond,
+			P90:   90 * time.Millisecond,
+			P99:   99 * time.Millisecond,
+			Max:   100 * time.Millisecond,
+		}
+
+		if got != want {
+			t.Errorf("Got %+v Want %+v\n", got, want)
+		}
+	})
+
+	t.Run("summarizing a single sample", func(t *testing.T) {
+		var recorder latencyRecorder
+		recorder.add(time.Second)
+
+		if got := recorder.summarize(); got.P50 != time.Second || got.P99 != time.Second {
+			t.Errorf("Got %+v\n", got)
+		}
+	})
+
+	t.Run("summarizing no samples", func(t *testing.T) {
+		var recorder latencyRecorder
+		if got := recorder.summarize(); got != (latencySummary{}) {
+			t.Errorf("Got %+v\n", got)
+		}
+	})
+}
+
+func TestLoadReport(t *testing.T) {
+	t.Run("reporting dropped deliveries and latencies", func(t *testing.T) {
+		stats := &loadStats{}
+		stats.connections.Store(6)
+		stats.reflectionsSent.Store(10)
+		stats.deliveriesExpected.Store(50)
+		stats.deliveriesReceived.Store(45)
+		stats.fanOutLatency.add(2 * time.Millisecond)
+
+		var report strings.Builder
+		stats.writeReport(&report, loadOptions{URL: "ws://localhost/reflect", Rooms: 1, ViewersPerRoom: 5}, time.Second)
+
+		for _, expected := range []string{
+			"45 of 50 deliveries received, 5 dropped (10.00%)",
+			"fan-out:      p50 2ms",
+			"ping rtt:     no samples",
+		} {
+			if !strings.Contains(report.String(), expected) {
+				t.Errorf("Expected the report to contain %q\n%s", expected, report.String())
+			}
+		}
+	})
+}
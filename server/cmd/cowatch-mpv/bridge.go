@@ -0,0 +1,361 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cowatch/client"
+	"github.com/cowatch/logger"
+	"github.com/cowatch/protocol"
+)
+
+// The longest the bridge waits for mpv or the server to answer.
+const RequestTimeout = 10 * time.Second
+
+// How many times a lost connection is retried before giving up, waiting a second longer every time.
+const ReconnectAttempts = 5
+
+// bridge keeps mpv and a room in sync.
+// Viewers drive mpv to match the room's reflections, hosts reflect mpv's playback to the room.
+type bridge struct {
+	options bridgeOptions
+	client  *client.Client
+	mpv     *mpvIPC
+
+	mutex          sync.Mutex
+	clientType     protocol.ClientType
+	reflection     *protocol.RoomReflection
+	reflectedAt    time.Time
+	loadedVideoID  string // The video the viewer last loaded in mpv
+	reflectedVideo string // The video the host last sent the details of
+
+	reflected chan struct{} // Signals the viewer's sync loop that a new reflection arrived
+	stopped   chan struct{} // Closed when the bridge gives up reconnecting
+	stopOnce  sync.Once
+}
+
+func newBridge(options bridgeOptions, mpv *mpvIPC) *bridge {
+	return &bridge{
+		options:   options,
+		mpv:       mpv,
+		reflected: make(chan struct{}, 1),
+		stopped:   make(chan struct{}),
+	}
+}
+
+// Registers the bridge's handlers on the client.
+func (bridge *bridge) attach(cowatch *client.Client) {
+	bridge.client = cowatch
+
+	cowatch.OnReflect(bridge.handleReflect)
+	cowatch.OnDisconnectRoom(bridge.handleDisconnectRoom)
+	cowatch.OnAnnouncement(bridge.handleAnnouncement)
+	cowatch.OnConnectionLost(bridge.handleConnectionLost)
+}
+
+func (bridge *bridge) setClientType(clientType protocol.ClientType) {
+	bridge.mutex.Lock()
+	defer bridge.mutex.Unlock()
+
+	bridge.clientType = clientType
+}
+
+func (bridge *bridge) getClientType() protocol.ClientType {
+	bridge.mutex.Lock()
+	defer bridge.mutex.Unlock()
+
+	return bridge.clientType
+}
+
+// Syncs until the context is done, mpv quits or the server can't be reached.
+func (bridge *bridge) run(ctx context.Context) {
+	ticker := time.NewTicker(bridge.options.ReflectionInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-bridge.stopped:
+			return
+		case <-bridge.mpv.Done():
+			logger.Info("[Bridge] mpv quit: %s\n", bridge.mpv.err)
+			return
+		case <-bridge.reflected:
+		case <-ticker.C:
+		}
+
+		requestCtx, cancel := context.WithTimeout(ctx, RequestTimeout)
+		switch bridge.getClientType() {
+		case protocol.ClientTypeHost:
+			bridge.reflectPlayback(requestCtx)
+		case protocol.ClientTypeViewer, protocol.ClientTypeCoHost:
+			bridge.syncPlayback(requestCtx)
+		}
+		cancel()
+	}
+}
+
+func (bridge *bridge) handleReflect(reflection protocol.RoomReflection) {
+	bridge.mutex.Lock()
+	bridge.reflection = &reflection
+	bridge.reflectedAt = time.Now()
+	bridge.mutex.Unlock()
+
+	select {
+	case bridge.reflected <- struct{}{}:
+	default:
+	}
+}
+
+func (bridge *bridge) handleDisconnectRoom() {
+	logger.Warn("[Bridge] The room was closed\n")
+
+	bridge.mutex.Lock()
+	bridge.clientType = protocol.ClientTypeInnactive
+	bridge.reflection = nil
+	bridge.mutex.Unlock()
+
+	bridge.stop()
+}
+
+func (bridge *bridge) handleAnnouncement(announcement protocol.ServerAnnouncement) {
+	logger.Warn("[Bridge] Announcement: %s\n", announcement.Message)
+
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+		defer cancel()
+
+		bridge.mpv.Command(ctx, "show-text", "cowatch: "+announcement.Message, 5000)
+	}()
+}
+
+func (bridge *bridge) handleConnectionLost(errorReading error) {
+	logger.Warn("[Bridge] %s, reconnecting\n", errorReading)
+	go bridge.reconnect()
+}
+
+func (bridge *bridge) stop() {
+	bridge.stopOnce.Do(func() { close(bridge.stopped) })
+}
+
+// Restores the session on a new connection, retrying a few times before giving up.
+func (bridge *bridge) reconnect() {
+	for attempt := 1; attempt <= ReconnectAttempts; attempt++ {
+		time.Sleep(time.Duration(attempt) * time.Second)
+
+		ctx, cancel := context.WithTimeout(context.Background(), RequestTimeout)
+		joinRoom, errorReconnecting := bridge.client.AttemptReconnect(ctx)
+		cancel()
+
+		if errorReconnecting != nil {
+			logger.Warn("[Bridge] Failed to reconnect (%d/%d): %s\n", attempt, ReconnectAttempts, errorReconnecting)
+			continue
+		}
+
+		if joinRoom == nil {
+			logger.Warn("[Bridge] Reconnected but the room no longer exists\n")
+			bridge.stop()
+			return
+		}
+
+		bridge.setClientType(joinRoom.Type)
+		logger.Info("[Bridge] Reconnected to room %s\n", joinRoom.Room.RoomID)
+		return
+	}
+
+	logger.Error("[Bridge] Giving up, the server is unreachable\n")
+	bridge.stop()
+}
+
+// Moves mpv to the extrapolated playback of the latest reflection.
+func (bridge *bridge) syncPlayback(ctx context.Context) {
+	bridge.mutex.Lock()
+	if bridge.reflection == nil {
+		bridge.mutex.Unlock()
+		return
+	}
+	reflection := *bridge.reflection
+	reflection.CurrentTime = reflection.GetExtrapolatedTime(time.Since(bridge.reflectedAt))
+	bridge.mutex.Unlock()
+
+	if errorApplying := bridge.applyReflection(ctx, reflection); errorApplying != nil {
+		logger.Warn("[Bridge] Failed to sync mpv: %s\n", errorApplying)
+	}
+}
+
+// Loads the reflected video if mpv plays another one, then matches it's pause state and seeks if it drifted too far.
+func (bridge *bridge) applyReflection(ctx context.Context, reflection protocol.RoomReflection) error {
+	if reflection.ID == "" {
+		return nil
+	}
+
+	bridge.mutex.Lock()
+	isLoaded := bridge.loadedVideoID == reflection.ID
+	bridge.mutex.Unlock()
+
+	if !isLoaded {
+		logger.Info("[Bridge] Loading %s\n", reflection.ID)
+		if _, errorLoading := bridge.mpv.Command(ctx, "loadfile", videoURL(reflection.ID), "replace"); errorLoading != nil {
+			return errorLoading
+		}
+
+		bridge.mutex.Lock()
+		bridge.loadedVideoID = reflection.ID
+		bridge.mutex.Unlock()
+	}
+
+	// Buffering is the host waiting on it's connection, the viewer keeps going until the host resumes or pauses
+	if reflection.State != protocol.PlayerStateBuffering {
+		if errorPausing := bridge.mpv.SetProperty(ctx, "pause", reflection.State != protocol.PlayerStatePlaying); errorPausing != nil {
+			return errorPausing
+		}
+	}
+
+	var playbackTime float64
+	if errorGetting := bridge.mpv.GetProperty(ctx, "time-pos", &playbackTime); errors.Is(errorGetting, ErrPropertyUnavailable) {
+		return nil // Still loading, the next reflection will seek
+	} else if errorGetting != nil {
+		return errorGetting
+	}
+
+	if math.Abs(playbackTime-float64(reflection.CurrentTime)) <= bridge.options.MaxDrift.Seconds() {
+		return nil
+	}
+
+	logger.Debug("[Bridge] Seeking from %.1f to %.1f\n", playbackTime, reflection.CurrentTime)
+	_, errorSeeking := bridge.mpv.Command(ctx, "seek", reflection.CurrentTime, "absolute")
+	return errorSeeking
+}
+
+// Sends mpv's playback to the room, along with the details of the video whenever it changes.
+func (bridge *bridge) reflectPlayback(ctx context.Context) {
+	reflection, isPlaying, errorReading := bridge.readReflection(ctx)
+	if errorReading != nil {
+		logger.Warn("[Bridge] Failed to read mpv's playback: %s\n", errorReading)
+		return
+	}
+
+	if !isPlaying {
+		return
+	}
+
+	if errorReflecting := bridge.client.Reflect(ctx, reflection); errorReflecting != nil {
+		logger.Warn("[Bridge] Failed to reflect: %s\n", errorReflecting)
+		return
+	}
+
+	bridge.mutex.Lock()
+	hasVideoChanged := bridge.reflectedVideo != reflection.ID
+	bridge.mutex.Unlock()
+
+	if !hasVideoChanged {
+		return
+	}
+
+	videoDetails := bridge.readVideoDetails(ctx)
+	if errorSending := bridge.client.SendVideoDetails(ctx, videoDetails); errorSending != nil {
+		logger.Warn("[Bridge] Failed to send the video details: %s\n", errorSending)
+		return
+	}
+
+	bridge.mutex.Lock()
+	bridge.reflectedVideo = reflection.ID
+	bridge.mutex.Unlock()
+}
+
+// Reads mpv's playback as a reflection, isPlaying is false while mpv is idle.
+func (bridge *bridge) readReflection(ctx context.Context) (reflection protocol.RoomReflection, isPlaying bool, err error) {
+	var isIdle bool
+	if errorGetting := bridge.mpv.GetProperty(ctx, "idle-active", &isIdle); errorGetting != nil || isIdle {
+		return reflection, false, errorGetting
+	}
+
+	var path string
+	if errorGetting := bridge.mpv.GetProperty(ctx, "path", &path); errors.Is(errorGetting, ErrPropertyUnavailable) {
+		return reflection, false, nil
+	} else if errorGetting != nil {
+		return reflection, false, errorGetting
+	}
+
+	var playbackTime float64
+	if errorGetting := bridge.mpv.GetProperty(ctx, "time-pos", &playbackTime); errors.Is(errorGetting, ErrPropertyUnavailable) {
+		return reflection, false, nil
+	} else if errorGetting != nil {
+		return reflection, false, errorGetting
+	}
+
+	var isPaused, isBuffering, hasEnded bool
+	for name, value := range map[string]*bool{"pause": &isPaused, "paused-for-cache": &isBuffering, "eof-reached": &hasEnded} {
+		if errorGetting := bridge.mpv.GetProperty(ctx, name, value); errorGetting != nil && !errors.Is(errorGetting, ErrPropertyUnavailable) {
+			return reflection, false, errorGetting
+		}
+	}
+
+	reflection.ID = videoID(path)
+	reflection.CurrentTime = float32(playbackTime)
+
+	switch {
+	case hasEnded:
+		reflection.State = protocol.PlayerStateEnded
+	case isBuffering:
+		reflection.State = protocol.PlayerStateBuffering
+	case isPaused:
+		reflection.State = protocol.PlayerStatePaused
+	default:
+		reflection.State = protocol.PlayerStatePlaying
+	}
+
+	return reflection, true, nil
+}
+
+// Reads what mpv knows about the video, yt-dlp fills in the title and the uploader of youtube videos.
+func (bridge *bridge) readVideoDetails(ctx context.Context) protocol.VideoDetails {
+	var videoDetails protocol.VideoDetails
+	bridge.mpv.GetProperty(ctx, "media-title", &videoDetails.Title)
+
+	for _, key := range []string{"uploader", "artist"} {
+		if bridge.mpv.GetProperty(ctx, "metadata/by-key/"+key, &videoDetails.Author) == nil && videoDetails.Author != "" {
+			break
+		}
+	}
+
+	return videoDetails
+}
+
+// The url mpv opens for a reflected video, ids that aren't youtube's are already urls.
+func videoURL(id string) string {
+	if strings.Contains(id, "://") {
+		return id
+	}
+
+	return fmt.Sprintf("https://www.youtube.com/watch?v=%s", url.QueryEscape(id))
+}
+
+// The id reflected for what mpv is playing, the youtube id if it's a youtube video so the extension can load it.
+func videoID(path string) string {
+	if strings.HasPrefix(path, "ytdl://") {
+		return strings.TrimPrefix(path, "ytdl://")
+	}
+
+	parsed, errorParsing := url.Parse(path)
+	if errorParsing != nil {
+		return path
+	}
+
+	host := strings.TrimPrefix(parsed.Hostname(), "www.")
+	switch {
+	case host == "youtu.be":
+		return strings.TrimPrefix(parsed.Path, "/")
+	case (host == "youtube.com" || host == "m.youtube.com" || host == "music.youtube.com") && parsed.Query().Get("v") != "":
+		return parsed.Query().Get("v")
+	}
+
+	return path
+}
@@ -0,0 +1,329 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/cowatch/protocol"
+)
+
+func TestMpvIPC(t *testing.T) {
+	t.Run("getting and setting properties", func(t *testing.T) {
+		fake, mpv := startFakeMpv(t, map[string]interface{}{"pause": false})
+
+		if errorSetting := mpv.SetProperty(context.Background(), "pause", true); errorSetting != nil {
+			t.Fatalf("Failed to set the property: %s\n", errorSetting)
+		}
+
+		var isPaused bool
+		if errorGetting := mpv.GetProperty(context.Background(), "pause", &isPaused); errorGetting != nil || !isPaused {
+			t.Errorf("Expected pause to be true but got %t %v\n", isPaused, errorGetting)
+		}
+
+		var playbackTime float64
+		if errorGetting := mpv.GetProperty(context.Background(), "time-pos", &playbackTime); !errors.Is(errorGetting, ErrPropertyUnavailable) {
+			t.Errorf("Expected time-pos to be unavailable but got %v\n", errorGetting)
+		}
+
+		if _, errorRunning := mpv.Command(context.Background(), "dance"); errorRunning == nil {
+			t.Errorf("Expected an unknown command to fail\n")
+		}
+
+		if commands := fake.getCommands(); len(commands) != 4 {
+			t.Errorf("Expected every command to reach mpv but got %v\n", commands)
+		}
+	})
+
+	t.Run("ending when mpv quits", func(t *testing.T) {
+		fake, mpv := startFakeMpv(t, nil)
+		fake.quit()
+
+		select {
+		case <-mpv.Done():
+		case <-time.After(time.Second):
+			t.Fatalf("Expected the connection to end\n")
+		}
+
+		if _, errorRunning := mpv.Command(context.Background(), "get_property", "pause"); errorRunning == nil {
+			t.Errorf("Expected commands to fail once mpv quit but got %v\n", errorRunning)
+		}
+	})
+}
+
+func TestBridge(t *testing.T) {
+	options := bridgeOptions{ReflectionInterval: 500 * time.Millisecond, MaxDrift: 2 * time.Second}
+
+	t.Run("viewers load the reflected video and follow it's playback", func(t *testing.T) {
+		fake, mpv := startFakeMpv(t, map[string]interface{}{"pause": true})
+		bridge := newBridge(options, mpv)
+
+		reflection := protocol.RoomReflection{ID: "dQw4w9WgXcQ", State: protocol.PlayerStatePlaying, CurrentTime: 30}
+		if errorApplying := bridge.applyReflection(context.Background(), reflection); errorApplying != nil {
+			t.Fatalf("Failed to apply the reflection: %s\n", errorApplying)
+		}
+
+		expected := [][]interface{}{
+			{"loadfile", "https://www.youtube.com/watch?v=dQw4w9WgXcQ", "replace"},
+			{"set_property", "pause", false},
+			{"get_property", "time-pos"},
+		}
+		if commands := fake.getCommands(); !reflect.DeepEqual(commands, expected) {
+			t.Fatalf("Expected commands %v but got %v\n", expected, commands)
+		}
+
+		fake.setProperty("time-pos", 10.0)
+		bridge.applyReflection(context.Background(), reflection)
+
+		reflection.CurrentTime = 31
+		bridge.applyReflection(context.Background(), reflection)
+
+		expected = [][]interface{}{
+			{"set_property", "pause", false},
+			{"get_property", "time-pos"},
+			{"seek", 30.0, "absolute"},
+			{"set_property", "pause", false},
+			{"get_property", "time-pos"},
+		}
+		if commands := fake.getCommands(); !reflect.DeepEqual(commands, expected) {
+			t.Errorf("Expected to seek only once drifting too far but got %v\n", commands)
+		}
+	})
+
+	t.Run("viewers keep playing while the host buffers", func(t *testing.T) {
+		fake, mpv := startFakeMpv(t, map[string]interface{}{"pause": false, "time-pos": 10.0})
+		bridge := newBridge(options, mpv)
+		bridge.loadedVideoID = "dQw4w9WgXcQ"
+
+		bridge.applyReflection(context.Background(), protocol.RoomReflection{ID: "dQw4w9WgXcQ", State: protocol.PlayerStateBuffering, CurrentTime: 10})
+		bridge.applyReflection(context.Background(), protocol.RoomReflection{ID: "dQw4w9WgXcQ", State: protocol.PlayerStatePaused, CurrentTime: 10})
+
+		expected := [][]interface{}{
+			{"get_property", "time-pos"},
+			{"set_property", "pause", true},
+			{"get_property", "time-pos"},
+		}
+		if commands := fake.getCommands(); !reflect.DeepEqual(commands, expected) {
+			t.Errorf("Expected commands %v but got %v\n", expected, commands)
+		}
+	})
+
+	t.Run("hosts reflect mpv's playback", func(t *testing.T) {
+		fake, mpv := startFakeMpv(t, map[string]interface{}{
+			"idle-active":              false,
+			"path":                     "https://www.youtube.com/watch?v=dQw4w9WgXcQ&t=10",
+			"time-pos":                 42.5,
+			"pause":                    true,
+			"paused-for-cache":         false,
+			"eof-reached":              false,
+			"media-title":              "Never Gonna Give You Up",
+			"metadata/by-key/uploader": "Rick Astley",
+		})
+		bridge := newBridge(options, mpv)
+
+		tests := []struct {
+			property string
+			value    interface{}
+			expected protocol.RoomReflection
+		}{
+			{"pause", true, protocol.RoomReflection{ID: "dQw4w9WgXcQ", State: protocol.PlayerStatePaused, CurrentTime: 42.5}},
+			{"pause", false, protocol.RoomReflection{ID: "dQw4w9WgXcQ", State: protocol.PlayerStatePlaying, CurrentTime: 42.5}},
+			{"paused-for-cache", true, protocol.RoomReflection{ID: "dQw4w9WgXcQ", State: protocol.PlayerStateBuffering, CurrentTime: 42.5}},
+			{"eof-reached", true, protocol.RoomReflection{ID: "dQw4w9WgXcQ", State: protocol.PlayerStateEnded, CurrentTime: 42.5}},
+		}
+
+		for _, test := range tests {
+			fake.setProperty(test.property, test.value)
+
+			reflection, isPlaying, errorReading := bridge.readReflection(context.Background())
+			if errorReading != nil || !isPlaying || reflection != test.expected {
+				t.Errorf("Expected %+v after setting %s to %v but got %+v %t %v\n", test.expected, test.property, test.value, reflection, isPlaying, errorReading)
+			}
+		}
+
+		videoDetails := bridge.readVideoDetails(context.Background())
+		if videoDetails.Title != "Never Gonna Give You Up" || videoDetails.Author != "Rick Astley" {
+			t.Errorf("Got unexpected video details %+v\n", videoDetails)
+		}
+
+		fake.setProperty("idle-active", true)
+		if _, isPlaying, errorReading := bridge.readReflection(context.Background()); isPlaying || errorReading != nil {
+			t.Errorf("Expected nothing to be reflected while mpv is idle but got %t %v\n", isPlaying, errorReading)
+		}
+	})
+}
+
+func TestVideoID(t *testing.T) {
+	tests := map[string]string{
+		"https://www.youtube.com/watch?v=dQw4w9WgXcQ":      "dQw4w9WgXcQ",
+		"https://youtube.com/watch?list=LL&v=dQw4w9WgXcQ":  "dQw4w9WgXcQ",
+		"https://music.youtube.com/watch?v=dQw4w9WgXcQ":    "dQw4w9WgXcQ",
+		"https://youtu.be/dQw4w9WgXcQ":                     "dQw4w9WgXcQ",
+		"ytdl://dQw4w9WgXcQ":                               "dQw4w9WgXcQ",
+		"https://vimeo.com/76979871":                       "https://vimeo.com/76979871",
+		"https://www.youtube.com/playlist?list=PL12345678": "https://www.youtube.com/playlist?list=PL12345678",
+	}
+
+	for path, expected := range tests {
+		if id := videoID(path); id != expected {
+			t.Errorf("Expected %q to be reflected as %q but got %q\n", path, expected, id)
+		}
+
+		if id := videoID(videoURL(expected)); id != expected {
+			t.Errorf("Expected the url of %q to be reflected as it but got %q\n", expected, id)
+		}
+	}
+}
+
+// fakeMpv stands in for mpv's JSON IPC socket, keeping properties and recording every command it receives.
+type fakeMpv struct {
+	listener net.Listener
+
+	mutex      sync.Mutex
+	properties map[string]interface{}
+	commands   [][]interface{}
+	connection net.Conn
+}
+
+func startFakeMpv(t *testing.T, properties map[string]interface{}) (*fakeMpv, *mpvIPC) {
+	t.Helper()
+
+	// Unix socket paths are limited to around a hundred bytes, too short for t.TempDir on some systems
+	directory, errorCreating := os.MkdirTemp("", "mpv")
+	if errorCreating != nil {
+		t.Fatalf("Failed to create the socket's directory: %s\n", errorCreating)
+	}
+	t.Cleanup(func() { os.RemoveAll(directory) })
+
+	socketPath := filepath.Join(directory, "socket")
+	listener, errorListening := net.Listen("unix", socketPath)
+	if errorListening != nil {
+		t.Fatalf("Failed to listen: %s\n", errorListening)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	if properties == nil {
+		properties = make(map[string]interface{})
+	}
+
+	fake := &fakeMpv{listener: listener, properties: properties}
+	go fake.serve()
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+
+	mpv, errorDialing := dialMpv(ctx, socketPath)
+	if errorDialing != nil {
+		t.Fatalf("Failed to dial the fake mpv: %s\n", errorDialing)
+	}
+	t.Cleanup(func() { mpv.Close() })
+
+	return fake, mpv
+}
+
+func (fake *fakeMpv) serve() {
+	connection, errorAccepting := fake.listener.Accept()
+	if errorAccepting != nil {
+		return
+	}
+
+	fake.mutex.Lock()
+	fake.connection = connection
+	fake.mutex.Unlock()
+
+	// Real mpv sends events whenever something happens, the bridge has to skip them
+	fmt.Fprintf(connection, "{\"event\":\"idle\"}\n")
+
+	scanner := bufio.NewScanner(connection)
+	for scanner.Scan() {
+		var command struct {
+			Command   []interface{} `json:"command"`
+			RequestID int64         `json:"request_id"`
+		}
+		if json.Unmarshal(scanner.Bytes(), &command) != nil || len(command.Command) == 0 {
+			continue
+		}
+
+		reply := map[string]interface{}{"request_id": command.RequestID, "error": fake.run(command.Command)}
+		if data, exists := fake.getReplyData(command.Command); exists {
+			reply["data"] = data
+		}
+
+		line, _ := json.Marshal(reply)
+		connection.Write(append(line, '\n'))
+	}
+}
+
+// Runs a command like mpv would, returning the error of the reply.
+func (fake *fakeMpv) run(command []interface{}) string {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.commands = append(fake.commands, command)
+
+	switch command[0] {
+	case "get_property":
+		if _, exists := fake.properties[command[1].(string)]; !exists {
+			return "property unavailable"
+		}
+	case "set_property":
+		fake.properties[command[1].(string)] = command[2]
+	case "seek":
+		fake.properties["time-pos"] = command[1]
+	case "loadfile":
+		fake.properties["path"] = command[1]
+		delete(fake.properties, "time-pos") // Still loading
+	case "show-text":
+	default:
+		return "invalid parameter"
+	}
+
+	return "success"
+}
+
+func (fake *fakeMpv) getReplyData(command []interface{}) (interface{}, bool) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if command[0] != "get_property" {
+		return nil, false
+	}
+
+	value, exists := fake.properties[command[1].(string)]
+	return value, exists
+}
+
+func (fake *fakeMpv) setProperty(name string, value interface{}) {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	fake.properties[name] = value
+}
+
+func (fake *fakeMpv) getCommands() [][]interface{} {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	commands := fake.commands
+	fake.commands = nil
+	return commands
+}
+
+func (fake *fakeMpv) quit() {
+	fake.mutex.Lock()
+	defer fake.mutex.Unlock()
+
+	if fake.connection != nil {
+		fake.connection.Close()
+	}
+	fake.listener.Close()
+}
@@ -0,0 +1,111 @@
+// cowatch-mpv bridges a local mpv to a room, to watch along from a desktop player instead of the browser.
+// Viewers have mpv follow the host's playback, hosts reflect what mpv plays to the room.
+// mpv has to be started with it's JSON IPC socket enabled, youtube videos need yt-dlp installed.
+//
+//	$ mpv --idle --input-ipc-server=/tmp/mpvsocket &
+//	$ go run ./cmd/cowatch-mpv -join 1a2b3c4d
+//	$ go run ./cmd/cowatch-mpv -host "Movie night"
+package main
+
+import (
+	"context"
+	"flag"
+	"os"
+	"os/signal"
+	"time"
+
+	"github.com/cowatch/client"
+	"github.com/cowatch/logger"
+	"github.com/cowatch/protocol"
+)
+
+type bridgeOptions struct {
+	URL                string
+	ServerVersion      string
+	Name               string
+	HostRoom           string
+	JoinRoom           string
+	Socket             string
+	ReflectionInterval time.Duration // How often hosts reflect and viewers check mpv's playback
+	MaxDrift           time.Duration // Viewers seek once mpv is further than this from the host
+}
+
+func main() {
+	var options bridgeOptions
+	var logLevel string
+
+	flag.StringVar(&options.URL, "url", "ws://localhost:8080/reflect", "The reflect endpoint of the server")
+	flag.StringVar(&options.ServerVersion, "server-version", "0.0.5", "The server version the bridge claims to speak")
+	flag.StringVar(&options.Name, "name", "mpv", "The name shown to the other members of the room")
+	flag.StringVar(&options.HostRoom, "host", "", "Host a room with the given name, reflecting what mpv plays")
+	flag.StringVar(&options.JoinRoom, "join", "", "Join the room with the given id, having mpv follow the host")
+	flag.StringVar(&options.Socket, "socket", "/tmp/mpvsocket", "The path mpv's --input-ipc-server listens on")
+	flag.DurationVar(&options.ReflectionInterval, "reflection-interval", 500*time.Millisecond, "How often the playback is synced, the extension's default is 500ms")
+	flag.DurationVar(&options.MaxDrift, "max-drift", 2*time.Second, "How far mpv can drift from the host before seeking")
+	flag.StringVar(&logLevel, "log-level", logger.LogLevelInfo, "The level of the messages logged while running")
+	flag.Parse()
+
+	if !logger.SetLevel(logger.LogLevel(logLevel)) {
+		logger.Error("Unknown log level %q\n", logLevel)
+		os.Exit(2)
+	}
+
+	if (options.HostRoom == "") == (options.JoinRoom == "") {
+		logger.Error("Exactly one of -host and -join has to be used\n")
+		os.Exit(2)
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+
+	if errorBridging := runBridge(ctx, options); errorBridging != nil {
+		logger.Error("[Bridge] %s\n", errorBridging)
+		os.Exit(1)
+	}
+}
+
+// Connects to mpv and the server, enters the room and syncs until either side goes away.
+func runBridge(ctx context.Context, options bridgeOptions) error {
+	setupCtx, cancel := context.WithTimeout(ctx, RequestTimeout)
+	defer cancel()
+
+	mpv, errorDialingMpv := dialMpv(setupCtx, options.Socket)
+	if errorDialingMpv != nil {
+		return errorDialingMpv
+	}
+	defer mpv.Close()
+
+	bridge := newBridge(options, mpv)
+
+	cowatch, errorDialing := client.Dial(setupCtx, options.URL, client.Options{ServerVersion: options.ServerVersion})
+	if errorDialing != nil {
+		return errorDialing
+	}
+	defer cowatch.Close()
+	bridge.attach(cowatch)
+
+	if _, errorAuthorizing := cowatch.Authorize(setupCtx, protocol.ClientRequestAuthorizeRoom{Name: options.Name}); errorAuthorizing != nil {
+		return errorAuthorizing
+	}
+
+	if options.HostRoom != "" {
+		record, errorHosting := cowatch.HostRoom(setupCtx, protocol.RoomSettings{Name: options.HostRoom})
+		if errorHosting != nil {
+			return errorHosting
+		}
+
+		bridge.setClientType(protocol.ClientTypeHost)
+		logger.Info("[Bridge] Hosting room %s, share it's id with the viewers\n", record.RoomID)
+	} else {
+		joinRoom, errorJoining := cowatch.JoinRoom(setupCtx, protocol.RoomID(options.JoinRoom))
+		if errorJoining != nil {
+			return errorJoining
+		}
+
+		bridge.setClientType(joinRoom.Type)
+		logger.Info("[Bridge] Joined room %q hosted by %s\n", joinRoom.Room.Settings.Name, joinRoom.Room.Host.Name)
+	}
+
+	bridge.run(ctx)
+	return nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"sync/atomic"
+)
+
+var ErrMpvClosed = errors.New("The connection to mpv was closed")
+var ErrPropertyUnavailable = errors.New("property unavailable")
+
+// mpvCommand is a line sent over mpv's JSON IPC, see https://mpv.io/manual/stable/#json-ipc.
+type mpvCommand struct {
+	Command   []interface{} `json:"command"`
+	RequestID int64         `json:"request_id"`
+}
+
+// mpvReply is a line received from mpv, either the reply to a command or an event.
+type mpvReply struct {
+	RequestID int64           `json:"request_id"`
+	Error     string          `json:"error"`
+	Data      json.RawMessage `json:"data"`
+	Event     string          `json:"event"`
+}
+
+// mpvIPC is a connection to the socket mpv listens on when started with --input-ipc-server.
+// It's safe for concurrent use.
+type mpvIPC struct {
+	socket        net.Conn
+	writeMutex    sync.Mutex
+	nextRequestID atomic.Int64
+
+	mutex           sync.Mutex
+	pendingCommands map[int64]chan mpvReply
+
+	done chan struct{}
+	err  error // Why the connection ended, set before done is closed
+}
+
+func dialMpv(ctx context.Context, socketPath string) (*mpvIPC, error) {
+	var dialer net.Dialer
+	socket, errorDialing := dialer.DialContext(ctx, "unix", socketPath)
+	if errorDialing != nil {
+		return nil, errorDialing
+	}
+
+	mpv := &mpvIPC{
+		socket:          socket,
+		pendingCommands: make(map[int64]chan mpvReply),
+		done:            make(chan struct{}),
+	}
+
+	go mpv.readReplies()
+	return mpv, nil
+}
+
+func (mpv *mpvIPC) Close() error {
+	return mpv.socket.Close()
+}
+
+// Done is closed when mpv quits or the connection is closed.
+func (mpv *mpvIPC) Done() <-chan struct{} {
+	return mpv.done
+}
+
+// Reads every reply until the connection ends, events aren't needed by the bridge and are dropped.
+func (mpv *mpvIPC) readReplies() {
+	scanner := bufio.NewScanner(mpv.socket)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		var reply mpvReply
+		if json.Unmarshal(scanner.Bytes(), &reply) != nil || reply.Event != "" {
+			continue
+		}
+
+		mpv.mutex.Lock()
+		pendingCommand, exists := mpv.pendingCommands[reply.RequestID]
+		delete(mpv.pendingCommands, reply.RequestID)
+		mpv.mutex.Unlock()
+
+		if exists {
+			pendingCommand <- reply
+		}
+	}
+
+	mpv.err = ErrMpvClosed
+	if scanner.Err() != nil {
+		mpv.err = fmt.Errorf("%w: %w", ErrMpvClosed, scanner.Err())
+	}
+	close(mpv.done)
+}
+
+// Command runs an mpv input command and returns the data of it's reply.
+func (mpv *mpvIPC) Command(ctx context.Context, arguments ...interface{}) (json.RawMessage, error) {
+	requestID := mpv.nextRequestID.Add(1)
+	reply := make(chan mpvReply, 1)
+
+	mpv.mutex.Lock()
+	mpv.pendingCommands[requestID] = reply
+	mpv.mutex.Unlock()
+
+	defer func() {
+		mpv.mutex.Lock()
+		delete(mpv.pendingCommands, requestID)
+		mpv.mutex.Unlock()
+	}()
+
+	line, errorEncoding := json.Marshal(mpvCommand{Command: arguments, RequestID: requestID})
+	if errorEncoding != nil {
+		return nil, errorEncoding
+	}
+
+	mpv.writeMutex.Lock()
+	_, errorWriting := mpv.socket.Write(append(line, '\n'))
+	mpv.writeMutex.Unlock()
+
+	if errorWriting != nil {
+		return nil, errorWriting
+	}
+
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-mpv.done:
+		return nil, mpv.err
+	case reply := <-reply:
+		if reply.Error == ErrPropertyUnavailable.Error() {
+			return nil, ErrPropertyUnavailable
+		}
+
+		if reply.Error != "success" {
+			return nil, fmt.Errorf("mpv failed to run %v: %s", arguments[0], reply.Error)
+		}
+
+		return reply.Data, nil
+	}
+}
+
+// GetProperty decodes the value of a property, ErrPropertyUnavailable is returned e.g. for time-pos while nothing is playing.
+func (mpv *mpvIPC) GetProperty(ctx context.Context, name string, value interface{}) error {
+	data, errorGetting := mpv.Command(ctx, "get_property", name)
+	if errorGetting != nil {
+		return errorGetting
+	}
+
+	return json.Unmarshal(data, value)
+}
+
+func (mpv *mpvIPC) SetProperty(ctx context.Context, name string, value interface{}) error {
+	_, errorSetting := mpv.Command(ctx, "set_property", name, value)
+	return errorSetting
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/websocket"
+)
+
+func TestCodecNegotiation(t *testing.T) {
+	t.Run("client requesting no subprotocol receives json text frames", func(t *testing.T) {
+		gorillaConnectionManager := NewGorillaConnectionManager()
+		mockServer := setupServer(func(w http.ResponseWriter, r *http.Request) {
+			conn, _ := gorillaConnectionManager.NewConnection(w, r)
+
+			if conn.GetCodec().GetSubprotocol() != SubprotocolJSON {
+				t.Errorf("Expected codec %q but got %q\n", SubprotocolJSON, conn.GetCodec().GetSubprotocol())
+			}
+
+			conn.WriteMessage(ServerMessage{MessageType: ServerMessageTypePong, Status: ServerMessageStatusOk})
+		})
+		defer mockServer.Close()
+
+		ws, err := connectToServer(mockServer)
+		if err != nil {
+			t.Fatalf("Failed to open a ws connection: %v\n", err)
+		}
+		defer ws.Close()
+
+		frameType, _, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read message from server: %v\n", err)
+		}
+
+		if frameType != websocket.TextMessage {
+			t.Errorf("Expected a text frame but got %d\n", frameType)
+		}
+	})
+
+	t.Run("client requesting msgpack sends and receives nested binary frames", func(t *testing.T) {
+		reflection := RoomReflection{ID: "video", State: 1, CurrentTime: 12.5}
+		reflectionDetails, _ := json.Marshal(reflection)
+
+		received := make(chan ClientMessage, 1)
+		gorillaConnectionManager := NewGorillaConnectionManager()
+		mockServer := setupServer(func(w http.ResponseWriter, r *http.Request) {
+			conn, _ := gorillaConnectionManager.NewConnection(w, r)
+
+			msg, err := conn.ReadMessage()
+			if err != nil {
+				t.Errorf("Failed for server to read user message: %v\n", err)
+			}
+			received <- msg
+
+			conn.WriteMessage(ServerMessage{
+				MessageType:    ServerMessageTypeReflectRoom,
+				MessageDetails: reflectionDetails,
+				Status:         ServerMessageStatusOk,
+				RequestID:      msg.RequestID,
+			})
+		})
+		defer mockServer.Close()
+
+		ws, err := connectToServerWithSubprotocols(mockServer, []string{SubprotocolMsgpack})
+		if err != nil {
+			t.Fatalf("Failed to open a ws connection: %v\n", err)
+		}
+		defer ws.Close()
+
+		if ws.Subprotocol() != SubprotocolMsgpack {
+			t.Fatalf("Expected negotiated subprotocol %q but got %q\n", SubprotocolMsgpack, ws.Subprotocol())
+		}
+
+		clientMessage := ClientMessage{
+			ServerVersion: serverVersion,
+			MessageType:   ClientMessageTypeSendReflection,
+			Message:       string(reflectionDetails),
+			RequestID:     "request-1",
+		}
+		encodedClientMessage, _ := MsgpackCodec{}.Marshal(clientMessage)
+		ws.WriteMessage(websocket.BinaryMessage, encodedClientMessage)
+
+		var nestedClientMessage map[string]interface{}
+		MsgpackCodec{}.Unmarshal(encodedClientMessage, &nestedClientMessage)
+		if _, isNested := nestedClientMessage["action"].(map[string]interface{}); !isNested {
+			t.Errorf("Expected the action to be sent nested but got %T\n", nestedClientMessage["action"])
+		}
+
+		gotClientMessage := <-received
+		var gotReflection RoomReflection
+		json.Unmarshal([]byte(gotClientMessage.Message), &gotReflection)
+		if !reflect.DeepEqual(gotReflection, reflection) || gotClientMessage.RequestID != clientMessage.RequestID {
+			t.Errorf("Server didn't decode expected message\nGot %+v Want %+v\n", gotClientMessage, clientMessage)
+		}
+
+		frameType, rawServerMessage, err := ws.ReadMessage()
+		if err != nil {
+			t.Fatalf("Failed to read message from server: %v\n", err)
+		}
+
+		if frameType != websocket.BinaryMessage {
+			t.Errorf("Expected a binary frame but got %d\n", frameType)
+		}
+
+		var serverMessage ServerMessage
+		if err := (MsgpackCodec{}).Unmarshal(rawServerMessage, &serverMessage); err != nil {
+			t.Fatalf("Failed to decode server message: %v\n", err)
+		}
+
+		json.Unmarshal(serverMessage.MessageDetails, &gotReflection)
+		if !reflect.DeepEqual(gotReflection, reflection) || serverMessage.RequestID != clientMessage.RequestID {
+			t.Errorf("Client didn't decode expected message\nGot %+v Want %+v\n", serverMessage, reflection)
+		}
+	})
+}
+
+func TestMsgpackCodec(t *testing.T) {
+	t.Run("encoding the details of a fan-out the same for every member", func(t *testing.T) {
+		details, _ := json.Marshal(RoomReflection{ID: "dQw4w9WgXcQ", State: 1, CurrentTime: 42.25, StartAt: 1714593600})
+		message := ServerMessage{MessageType: ServerMessageTypeReflectRoom, MessageDetails: details, Status: ServerMessageStatusOk}
+
+		first, errFirst := (MsgpackCodec{}).Marshal(message)
+		second, errSecond := (MsgpackCodec{}).Marshal(message)
+		if errFirst != nil || errSecond != nil || string(first) != string(second) {
+			t.Fatalf("Expected the same encoding for every member but got %x %x %v %v\n", first, second, errFirst, errSecond)
+		}
+
+		// Pushes the details out of the cache, converting them again
+		for index := range 100 {
+			(MsgpackCodec{}).Marshal(ServerMessage{MessageDetails: json.RawMessage(strconv.Itoa(index))})
+		}
+
+		third, _ := (MsgpackCodec{}).Marshal(message)
+		var decodedMessage ServerMessage
+		var decodedReflection RoomReflection
+		errDecoding := (MsgpackCodec{}).Unmarshal(third, &decodedMessage)
+		json.Unmarshal(decodedMessage.MessageDetails, &decodedReflection)
+		if errDecoding != nil || len(third) != len(first) || decodedReflection.StartAt != 1714593600 || decodedReflection.CurrentTime != 42.25 {
+			t.Errorf("Expected the details %s to be converted again but got %s %v\n", details, decodedMessage.MessageDetails, errDecoding)
+		}
+	})
+}
+
+func BenchmarkReflectRoomFanOut(b *testing.B) {
+	const viewerCount = DEFAULT_ROOM_SIZE
+
+	for _, codec := range []Codec{JSONCodec{}, MsgpackCodec{}} {
+		b.Run(codec.GetSubprotocol(), func(b *testing.B) {
+			mockManager := NewManager(serverVersion, NewGorillaConnectionManager())
+			mockHost := NewClient(mockManager.GenerateToken())
+			mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Benchmark"}, mockManager.clock.Now())
+			mockManager.RegisterRoom(mockRoom)
+			mockHost.Type = ClientTypeHost
+			mockHost.RoomID = mockRoom.RoomID
+
+			for range viewerCount {
+				mockRoom.AddViewer(NewClient(mockManager.GenerateToken()))
+			}
+
+			reflectionDetails, _ := json.Marshal(RoomReflection{ID: "dQw4w9WgXcQ", State: 1, CurrentTime: 42.25})
+			encodedClientMessage, _ := codec.Marshal(ClientMessage{
+				ServerVersion: serverVersion,
+				MessageType:   ClientMessageTypeSendReflection,
+				Message:       string(reflectionDetails),
+			})
+
+			bytesSent := 0
+			b.ReportAllocs()
+			b.ResetTimer()
+
+			for range b.N {
+				var clientMessage ClientMessage
+				if err := codec.Unmarshal(encodedClientMessage, &clientMessage); err != nil {
+					b.Fatalf("Failed to decode client message: %v\n", err)
+				}
+
+				for _, directedMessage := range ReflectRoomHandler(mockHost, mockManager, clientMessage.Message) {
+					encodedServerMessage, err := codec.Marshal(directedMessage.message)
+					if err != nil {
+						b.Fatalf("Failed to encode server message: %v\n", err)
+					}
+
+					bytesSent += len(encodedServerMessage)
+				}
+			}
+
+			b.ReportMetric(float64(len(encodedClientMessage)), "bytes-in/op")
+			b.ReportMetric(float64(bytesSent)/float64(b.N), "bytes-out/op")
+		})
+	}
+}
+
+func connectToServerWithSubprotocols(mockServer *httptest.Server, subprotocols []string) (*websocket.Conn, error) {
+	dialer := websocket.Dialer{Subprotocols: subprotocols}
+	wsURL := "ws" + strings.TrimPrefix(mockServer.URL, "http") + EndpointReflect
+
+	ws, _, err := dialer.Dial(wsURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return ws, nil
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/cowatch/logger"
+)
+
+const EndpointHealthz = "/healthz"
+const EndpointReadyz = "/readyz"
+
+// The longest a health check waits for the manager before considering it stuck.
+const HealthCheckTimeout = 2 * time.Second
+
+const (
+	HealthStatusOk          = "ok"
+	HealthStatusUnavailable = "unavailable"
+)
+
+// HealthChecker answers the probes of a container orchestrator.
+//
+// Liveness only fails when the manager is stuck, as restarting is the only way out of it.
+// Readiness also fails while any dependency is unavailable or the server is shutting down,
+// so traffic is routed elsewhere without restarting the server.
+type HealthChecker struct {
+	manager       *Manager
+	serverVersion string
+	startedAt     time.Time
+	timeout       time.Duration
+
+	isShuttingDown atomic.Bool
+}
+
+func NewHealthChecker(manager *Manager, serverVersion string) *HealthChecker {
+	return &HealthChecker{
+		manager:       manager,
+		serverVersion: serverVersion,
+		startedAt:     manager.clock.Now(),
+		timeout:       HealthCheckTimeout,
+	}
+}
+
+// HealthReport describes the state of the server, every failing check makes it unavailable.
+type HealthReport struct {
+	Status        string            `json:"status"`
+	ServerVersion string            `json:"serverVersion"`
+	UptimeSeconds int64             `json:"uptimeSeconds"`
+	Rooms         int               `json:"rooms"`
+	Clients       int               `json:"clients"`
+	Connections   int               `json:"connections"`
+	Checks        map[string]string `json:"checks"`
+}
+
+// BeginShutdown makes the server unready so no new traffic is routed to it while it drains.
+func (health *HealthChecker) BeginShutdown() {
+	health.isShuttingDown.Store(true)
+}
+
+// HandleHealthz responds whether the process is alive.
+func (health *HealthChecker) HandleHealthz(w http.ResponseWriter, r *http.Request) {
+	report := health.newReport()
+	health.writeReport(w, report)
+}
+
+// HandleReadyz responds whether the server can accept new clients.
+func (health *HealthChecker) HandleReadyz(w http.ResponseWriter, r *http.Request) {
+	report := health.newReport()
+
+	report.Checks["shutdown"] = HealthStatusOk
+	if health.isShuttingDown.Load() {
+		report.Checks["shutdown"] = "shutting down"
+	}
+
+	report.Checks["store"] = describeHealthCheck(health.manager.backplane.PingStore())
+	report.Checks["backplane"] = describeHealthCheck(health.manager.backplane.PingSubscription())
+
+	_, maxConnections := health.manager.GetConnectionCount()
+	report.Checks["connections"] = HealthStatusOk
+	if maxConnections > 0 && report.Connections >= maxConnections {
+		report.Checks["connections"] = "at capacity"
+	}
+
+	health.writeReport(w, report)
+}
+
+// Collects the counts every probe reports along with whether the manager responded in time.
+func (health *HealthChecker) newReport() HealthReport {
+	report := HealthReport{
+		ServerVersion: health.serverVersion,
+		UptimeSeconds: int64(health.manager.clock.Now().Sub(health.startedAt).Seconds()),
+		Checks:        map[string]string{"manager": HealthStatusOk},
+	}
+
+	report.Connections, _ = health.manager.GetConnectionCount()
+
+	rooms, clients, isResponsive := health.manager.getCountsWithin(health.timeout)
+	if !isResponsive {
+		report.Checks["manager"] = "unresponsive"
+		return report
+	}
+
+	report.Rooms = rooms
+	report.Clients = clients
+	return report
+}
+
+func (health *HealthChecker) writeReport(w http.ResponseWriter, report HealthReport) {
+	report.Status = HealthStatusOk
+	for check, status := range report.Checks {
+		if status != HealthStatusOk {
+			logger.Warn("[Health] Check %q failed: %s\n", check, status)
+			report.Status = HealthStatusUnavailable
+		}
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status != HealthStatusOk {
+		w.Header().Add("Content-Type", "application/json")
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+
+	writeJSONResponse(w, report)
+}
+
+func describeHealthCheck(errorChecking error) string {
+	if errorChecking != nil {
+		return errorChecking.Error()
+	}
+
+	return HealthStatusOk
+}
+
+// Counts the rooms and clients of the node, giving up if the manager stays locked for longer than the timeout.
+//
+// The counts are taken by waiting on the lock like any handler does, so a busy manager still gets it's turn.
+// The channel is buffered so a count finishing after the timeout doesn't keep it's goroutine around.
+func (manager *Manager) getCountsWithin(timeout time.Duration) (int, int, bool) {
+	counts := make(chan [2]int, 1)
+	isTimedOut := make(chan struct{})
+	timer := manager.clock.AfterFunc(timeout, func() { close(isTimedOut) })
+	defer timer.Stop()
+
+	go func() {
+		manager.mutex.Lock()
+		defer manager.mutex.Unlock()
+
+		counts <- [2]int{len(manager.activeRooms), len(manager.clients)}
+	}()
+
+	select {
+	case roomsAndClients := <-counts:
+		return roomsAndClients[0], roomsAndClients[1], true
+	case <-isTimedOut:
+		return 0, 0, false
+	}
+}
@@ -0,0 +1,177 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+func TestHealthChecker(t *testing.T) {
+	t.Run("reporting a healthy and ready server", func(t *testing.T) {
+		manager := NewManager(serverVersion, NewGorillaConnectionManager())
+		mockServer, _ := newTestServer(t, testServerOptions{manager: manager, healthChecker: NewHealthChecker(manager, serverVersion)})
+
+		ws, err := connectToServer(mockServer)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v\n", err)
+		}
+		defer ws.Close()
+
+		sendClientMessage(t, ws, ClientMessageTypeAuthorize, ClientRequestAuthorizeRoom{Name: "Host"})
+		readServerMessage(t, ws, ServerMessageTypeAuthorize, ServerMessageStatusOk)
+		sendClientMessage(t, ws, ClientMessageTypeHostRoom, RoomSettings{Name: "Health"})
+		readServerMessage(t, ws, ServerMessageTypeHostRoom, ServerMessageStatusOk)
+
+		for _, endpoint := range []string{EndpointHealthz, EndpointReadyz} {
+			response, report := getHealthReport(t, mockServer, endpoint)
+
+			if response.StatusCode != http.StatusOK ||
+				report.Status != HealthStatusOk ||
+				report.ServerVersion != serverVersion ||
+				report.Rooms != 1 || report.Clients != 1 || report.Connections != 1 {
+
+				t.Errorf("Got %s %d %+v\n", endpoint, response.StatusCode, report)
+			}
+		}
+	})
+
+	t.Run("reporting unready while shutting down", func(t *testing.T) {
+		manager := NewManager(serverVersion, NewGorillaConnectionManager())
+		healthChecker := NewHealthChecker(manager, serverVersion)
+		mockServer, _ := newTestServer(t, testServerOptions{manager: manager, healthChecker: healthChecker})
+		healthChecker.BeginShutdown()
+
+		assertHealthStatus(t, mockServer, EndpointHealthz, http.StatusOK)
+		if report := assertHealthStatus(t, mockServer, EndpointReadyz, http.StatusServiceUnavailable); report.Checks["shutdown"] == HealthStatusOk {
+			t.Errorf("Expected the shutdown check to fail but got %+v\n", report.Checks)
+		}
+	})
+
+	t.Run("reporting unready at the connection limit", func(t *testing.T) {
+		manager := NewManager(serverVersion, NewGorillaConnectionManager())
+		manager.SetMaxConnections(1)
+		mockServer, _ := newTestServer(t, testServerOptions{manager: manager, healthChecker: NewHealthChecker(manager, serverVersion)})
+
+		ws, err := connectToServer(mockServer)
+		if err != nil {
+			t.Fatalf("Failed to connect: %v\n", err)
+		}
+		defer ws.Close()
+
+		if report := assertHealthStatus(t, mockServer, EndpointReadyz, http.StatusServiceUnavailable); report.Checks["connections"] == HealthStatusOk {
+			t.Errorf("Expected the connections check to fail but got %+v\n", report.Checks)
+		}
+
+		_, response, err := dialServer(mockServer, nil)
+		if err == nil || response == nil || response.StatusCode != http.StatusServiceUnavailable {
+			t.Errorf("Expected a connection above the limit to be rejected but got %v\n", err)
+		}
+
+		ws.Close()
+		for range 100 {
+			if connectionCount, _ := manager.GetConnectionCount(); connectionCount == 0 {
+				break
+			}
+
+			time.Sleep(10 * time.Millisecond)
+		}
+
+		assertHealthStatus(t, mockServer, EndpointReadyz, http.StatusOK)
+	})
+
+	t.Run("reporting a stuck manager", func(t *testing.T) {
+		manager := NewManager(serverVersion, NewGorillaConnectionManager())
+		healthChecker := NewHealthChecker(manager, serverVersion)
+		mockServer, _ := newTestServer(t, testServerOptions{manager: manager, healthChecker: healthChecker})
+		healthChecker.timeout = 50 * time.Millisecond
+
+		manager.mutex.Lock()
+		defer manager.mutex.Unlock()
+
+		if report := assertHealthStatus(t, mockServer, EndpointHealthz, http.StatusServiceUnavailable); report.Checks["manager"] == HealthStatusOk {
+			t.Errorf("Expected the manager check to fail but got %+v\n", report.Checks)
+		}
+	})
+
+	t.Run("reporting a busy manager as healthy", func(t *testing.T) {
+		manager := NewManager(serverVersion, NewGorillaConnectionManager())
+		healthChecker := NewHealthChecker(manager, serverVersion)
+		mockServer, _ := newTestServer(t, testServerOptions{manager: manager, healthChecker: healthChecker})
+		healthChecker.timeout = time.Second
+
+		// The lock is only free for an instant between the handlers
+		stop := make(chan struct{})
+		defer close(stop)
+		go func() {
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+				}
+
+				manager.mutex.Lock()
+				time.Sleep(time.Millisecond)
+				manager.mutex.Unlock()
+			}
+		}()
+
+		assertHealthStatus(t, mockServer, EndpointHealthz, http.StatusOK)
+	})
+
+	t.Run("reporting unready with a closed backplane", func(t *testing.T) {
+		backplane := NewInProcessBackplane(NewInProcessBackplaneHub(), StandaloneNodeID)
+		manager := NewManagerWithBackplane(serverVersion, NewGorillaConnectionManager(), backplane)
+		mockServer, _ := newTestServer(t, testServerOptions{manager: manager, healthChecker: NewHealthChecker(manager, serverVersion)})
+
+		backplane.Close()
+
+		report := assertHealthStatus(t, mockServer, EndpointReadyz, http.StatusServiceUnavailable)
+		if report.Checks["store"] != ErrBackplaneClosed.Error() || report.Checks["backplane"] != ErrBackplaneClosed.Error() {
+			t.Errorf("Expected the backplane checks to fail but got %+v\n", report.Checks)
+		}
+	})
+
+	t.Run("reporting unready with an unreachable redis", func(t *testing.T) {
+		redisServer := miniredis.RunT(t)
+		backplane := newTestRedisBackplane(t, redisServer, "A")
+		manager := NewManagerWithBackplane(serverVersion, NewGorillaConnectionManager(), backplane)
+		mockServer, _ := newTestServer(t, testServerOptions{manager: manager, healthChecker: NewHealthChecker(manager, serverVersion)})
+
+		assertHealthStatus(t, mockServer, EndpointReadyz, http.StatusOK)
+
+		redisServer.Close()
+
+		if report := assertHealthStatus(t, mockServer, EndpointReadyz, http.StatusServiceUnavailable); report.Checks["store"] == HealthStatusOk {
+			t.Errorf("Expected the store check to fail but got %+v\n", report.Checks)
+		}
+	})
+}
+
+func getHealthReport(t *testing.T, mockServer *httptest.Server, endpoint string) (*http.Response, HealthReport) {
+	t.Helper()
+
+	response, body := getTestEndpoint(t, mockServer, endpoint)
+
+	var report HealthReport
+	if err := json.Unmarshal(body, &report); err != nil {
+		t.Fatalf("Failed to parse %q: %v\n", body, err)
+	}
+
+	return response, report
+}
+
+func assertHealthStatus(t *testing.T, mockServer *httptest.Server, endpoint string, expectedStatus int) HealthReport {
+	t.Helper()
+
+	response, report := getHealthReport(t, mockServer, endpoint)
+	if response.StatusCode != expectedStatus {
+		t.Errorf("Expected %s to be %d but got %d %+v\n", endpoint, expectedStatus, response.StatusCode, report)
+	}
+
+	return report
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const testAdminToken = "admin-secret"
+
+// testServerOptions picks the routes a test server serves besides the websocket endpoint of it's manager.
+type testServerOptions struct {
+	manager       *Manager         // The manager behind the websocket endpoint, a fresh one if nil
+	isAdmin       bool             // Serves the admin api, guarded by testAdminToken
+	healthChecker *HealthChecker   // Serves the health endpoints
+	releases      *ReleaseRegistry // Serves the releases along with their download metrics
+	updates       *UpdateManifests // Serves the update manifests
+}
+
+// Serves a manager with the routes main registers for the options, closing the server along with the test.
+func newTestServer(t *testing.T, options testServerOptions) (*httptest.Server, *Manager) {
+	t.Helper()
+
+	manager := options.manager
+	if manager == nil {
+		manager = NewManager(serverVersion, NewGorillaConnectionManager())
+	}
+
+	router := http.NewServeMux()
+	router.HandleFunc(EndpointReflect, manager.HandleMessages)
+
+	if options.healthChecker != nil {
+		router.HandleFunc("GET "+EndpointHealthz, options.healthChecker.HandleHealthz)
+		router.HandleFunc("GET "+EndpointReadyz, options.healthChecker.HandleReadyz)
+	}
+
+	if options.releases != nil {
+		router.HandleFunc("GET "+EndpointReleases, options.releases.HandleListReleases)
+		router.HandleFunc("GET "+EndpointLatestRelease, options.releases.HandleLatestRelease)
+		router.HandleFunc("GET "+EndpointDownloadLatest, options.releases.HandleDownloadLatest)
+		router.HandleFunc("GET "+EndpointDownloadVersion, options.releases.HandleDownloadVersion)
+	}
+
+	if options.updates != nil {
+		options.updates.RegisterRoutes(router)
+	}
+
+	if options.isAdmin || options.releases != nil {
+		adminAPI, err := NewAdminAPI(manager, testAdminToken)
+		if err != nil {
+			t.Fatalf("Failed to create admin api: %v\n", err)
+		}
+
+		if options.isAdmin {
+			adminAPI.RegisterRoutes(router)
+		}
+
+		if options.releases != nil {
+			adminAPI.RegisterDownloadMetrics(router, options.releases.GetDownloadCounter())
+		}
+	}
+
+	mockServer := httptest.NewServer(router)
+	t.Cleanup(mockServer.Close)
+
+	return mockServer, manager
+}
+
+// Reads messages until one of the type arrives, skipping any other updates, and fails unless it has the status.
+// Without a type it reads the very next message.
+func readServerMessage(t *testing.T, ws *websocket.Conn, messageType ServerMessageType, status ServerMessageStatus) ServerMessage {
+	t.Helper()
+
+	ws.SetReadDeadline(time.Now().Add(2 * time.Second))
+	defer ws.SetReadDeadline(time.Time{})
+
+	for {
+		var serverMessage ServerMessage
+		if err := ws.ReadJSON(&serverMessage); err != nil {
+			t.Fatalf("Failed while waiting for %q message: %v\n", messageType, err)
+		}
+
+		if messageType != "" && serverMessage.MessageType != messageType {
+			continue
+		}
+
+		if serverMessage.Status != status {
+			t.Fatalf("Expected %q with the status %q but got %+v\n", serverMessage.MessageType, status, serverMessage)
+		}
+
+		return serverMessage
+	}
+}
+
+// Hosts a room for an authorized client the way a HostRoom message would, without sending the response.
+func hostTestRoom(t *testing.T, manager *Manager, hostToken Token) RoomRecord {
+	t.Helper()
+
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	host, exists := manager.GetClient(hostToken)
+	if !exists {
+		t.Fatalf("Failed to host: client %s isn't registered\n", hostToken)
+	}
+
+	serverMessages := manager.handleClientMessage(host, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeHostRoom, Message: `{"name":"Test"}`})
+	if len(serverMessages) != 1 || serverMessages[0].message.Status != ServerMessageStatusOk {
+		t.Fatalf("Failed to host: %+v\n", serverMessages)
+	}
+
+	var roomRecord RoomRecord
+	json.Unmarshal(serverMessages[0].message.MessageDetails, &roomRecord)
+
+	return roomRecord
+}
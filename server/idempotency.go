@@ -0,0 +1,72 @@
+package main
+
+import (
+	"time"
+
+	"github.com/cowatch/logger"
+)
+
+// RequestIdempotencyWindow is the amount of time the responses of a create-style request are kept.
+// A retried request with the same [RequestID] inside the window is answered with the stored
+// responses instead of being handled a second time.
+const RequestIdempotencyWindow = 30 * time.Second
+
+type idempotencyKey struct {
+	privateToken Token
+	requestID    RequestID
+}
+
+type idempotentResponse struct {
+	serverMessages []DirectedServerMessage
+	handledAt      time.Time
+}
+
+// Collects the stored responses of an already handled create-style request.
+func (manager *Manager) getIdempotentResponse(client *Client, clientMessage ClientMessage) ([]DirectedServerMessage, bool) {
+	if clientMessage.RequestID == "" || !manager.idempotentMessageTypes[clientMessage.MessageType] {
+		return nil, false
+	}
+
+	response, exists := manager.idempotentResponses[idempotencyKey{client.PrivateToken, clientMessage.RequestID}]
+	if !exists || manager.clock.Now().Sub(response.handledAt) > RequestIdempotencyWindow {
+		return nil, false
+	}
+
+	return response.serverMessages, true
+}
+
+// Stores the responses of a create-style request that were directed to the requesting client.
+// Messages sent to other clients are left out as they have already been delivered.
+func (manager *Manager) saveIdempotentResponse(client *Client, clientMessage ClientMessage, serverMessages []DirectedServerMessage) {
+	if clientMessage.RequestID == "" || !manager.idempotentMessageTypes[clientMessage.MessageType] {
+		return
+	}
+
+	clientMessages := make([]DirectedServerMessage, 0, len(serverMessages))
+	for _, serverMessage := range serverMessages {
+		if serverMessage.token == client.PrivateToken {
+			clientMessages = append(clientMessages, serverMessage)
+		}
+	}
+
+	manager.idempotentResponses[idempotencyKey{client.PrivateToken, clientMessage.RequestID}] = idempotentResponse{
+		serverMessages: clientMessages,
+		handledAt:      manager.clock.Now(),
+	}
+}
+
+// Removes every stored response that's older than the [RequestIdempotencyWindow].
+func (manager *Manager) CleanupExpiredRequests() {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	now := manager.clock.Now()
+	for key, response := range manager.idempotentResponses {
+		if now.Sub(response.handledAt) <= RequestIdempotencyWindow {
+			continue
+		}
+
+		logger.Debug("[%s] Removing expired request %q\n", key.privateToken, key.requestID)
+		delete(manager.idempotentResponses, key)
+	}
+}
@@ -0,0 +1,119 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/cowatch/protocol"
+)
+
+// Locale is a BCP 47 language tag such as "en" or "fr-CA" sent by the client.
+type Locale = protocol.Locale
+
+const DEFAULT_LOCALE Locale = "en"
+
+// Error message translations keyed by the base language of a [Locale].
+// The english table is the source of truth, every other table may be partial.
+var serverErrorMessageTranslations = map[Locale]map[ServerErrorCode]ServerErrorMessage{
+	"en": {
+		ServerErrorCodeOldServerVersion:    ServerErrorMessageOldServerVersion,
+		ServerErrorCodeInternalServerError: ServerErrorMessageInternalServerError,
+		ServerErrorCodeBadJson:             ServerErrorMessageBadJson,
+		ServerErrorCodeShortRoomName:       ServerErrorMessageShortRoomName,
+		ServerErrorCodeLongRoomName:        ServerErrorMessageLongRoomName,
+		ServerErrorCodeNoRoom:              ServerErrorMessageNoRoom,
+		ServerErrorCodeFullRoom:            ServerErrorMessageFullRoom,
+		ServerErrorCodeRoomRedirect:        ServerErrorMessageRoomRedirect,
+		ServerErrorCodeClientNotHost:       ServerErrorMessageClientNotHost,
+		ServerErrorCodeControlNotAllowed:   ServerErrorMessageControlNotAllowed,
+		ServerErrorCodeControlConflict:     ServerErrorMessageControlConflict,
+		ServerErrorCodeMissingPermission:   ServerErrorMessageMissingPermission,
+		ServerErrorCodeNoViewer:            ServerErrorMessageNoViewer,
+		ServerErrorCodeMaintenance:         ServerErrorMessageMaintenance,
+		ServerErrorCodeInvalidSchedule:     ServerErrorMessageInvalidSchedule,
+		ServerErrorCodeVoteInProgress:      ServerErrorMessageVoteInProgress,
+		ServerErrorCodeNoVote:              ServerErrorMessageNoVote,
+		ServerErrorCodeUnknownMessageType:  ServerErrorMessageUnknownMessageType,
+		ServerErrorCodeUnauthorized:        ServerErrorMessageUnauthorized,
+	},
+	"es": {
+		ServerErrorCodeOldServerVersion:    "El cliente usa una versión más antigua de la esperada",
+		ServerErrorCodeInternalServerError: "Error interno del servidor.",
+		ServerErrorCodeBadJson:             "Solicitud incorrecta, actualiza tu extensión a una versión más reciente",
+		ServerErrorCodeShortRoomName:       "El nombre de la sala debe tener 3 caracteres o más.",
+		ServerErrorCodeLongRoomName:        "El nombre de la sala debe tener 50 caracteres o menos.",
+		ServerErrorCodeNoRoom:              "La sala a la que intentas unirte no existe",
+		ServerErrorCodeFullRoom:            "La sala a la que intentas unirte está llena",
+		ServerErrorCodeRoomRedirect:        "La sala a la que intentas unirte está alojada en otro servidor",
+		ServerErrorCodeClientNotHost:       "No eres el anfitrión",
+		ServerErrorCodeControlNotAllowed:   "No tienes permiso para controlar la reproducción de esta sala",
+		ServerErrorCodeControlConflict:     "Otra persona acaba de cambiar la reproducción, inténtalo de nuevo en un momento",
+		ServerErrorCodeMissingPermission:   "No tienes permiso para hacer esto en esta sala",
+		ServerErrorCodeNoViewer:            "No hay ningún espectador así en esta sala",
+		ServerErrorCodeMaintenance:         "El servidor está en mantenimiento, no se pueden crear salas nuevas en este momento",
+		ServerErrorCodeInvalidSchedule:     "El inicio programado debe estar en el futuro y como máximo a una semana",
+		ServerErrorCodeVoteInProgress:      "Ya hay una votación en curso en esta sala",
+		ServerErrorCodeNoVote:              "La votación en la que intentas votar ya no está en curso",
+		ServerErrorCodeUnknownMessageType:  "El servidor no sabe cómo gestionar esta solicitud",
+		ServerErrorCodeUnauthorized:        "Debes estar autorizado antes de hacer esta solicitud",
+	},
+	"fr": {
+		ServerErrorCodeOldServerVersion:    "Le client utilise une version plus ancienne que prévu",
+		ServerErrorCodeInternalServerError: "Erreur interne du serveur.",
+		ServerErrorCodeBadJson:             "Requête invalide, veuillez mettre à jour votre extension",
+		ServerErrorCodeShortRoomName:       "Le nom du salon doit contenir au moins 3 caractères.",
+		ServerErrorCodeLongRoomName:        "Le nom du salon doit contenir au plus 50 caractères.",
+		ServerErrorCodeNoRoom:              "Le salon que vous essayez de rejoindre n'existe pas",
+		ServerErrorCodeFullRoom:            "Le salon que vous essayez de rejoindre est plein",
+		ServerErrorCodeRoomRedirect:        "Le salon que vous essayez de rejoindre est hébergé sur un autre serveur",
+		ServerErrorCodeClientNotHost:       "Vous n'êtes pas l'hôte",
+		ServerErrorCodeControlNotAllowed:   "Vous n'êtes pas autorisé à contrôler la lecture de ce salon",
+		ServerErrorCodeControlConflict:     "Quelqu'un d'autre vient de modifier la lecture, réessayez dans un instant",
+		ServerErrorCodeMissingPermission:   "Vous n'avez pas la permission de faire cela dans ce salon",
+		ServerErrorCodeNoViewer:            "Ce spectateur n'est pas dans ce salon",
+		ServerErrorCodeMaintenance:         "Le serveur est en maintenance, aucun nouveau salon ne peut être créé pour le moment",
+		ServerErrorCodeInvalidSchedule:     "Le début programmé doit être dans le futur et au plus dans une semaine",
+		ServerErrorCodeVoteInProgress:      "Un vote est déjà en cours dans ce salon",
+		ServerErrorCodeNoVote:              "Le vote auquel vous participez n'est plus en cours",
+		ServerErrorCodeUnknownMessageType:  "Le serveur ne sait pas traiter cette requête",
+		ServerErrorCodeUnauthorized:        "Vous devez être autorisé avant d'effectuer cette requête",
+	},
+	"de": {
+		ServerErrorCodeOldServerVersion:    "Der Client verwendet eine ältere Version als erwartet",
+		ServerErrorCodeInternalServerError: "Interner Serverfehler.",
+		ServerErrorCodeBadJson:             "Ungültige Anfrage, bitte aktualisiere deine Erweiterung",
+		ServerErrorCodeShortRoomName:       "Der Raumname muss mindestens 3 Zeichen lang sein.",
+		ServerErrorCodeLongRoomName:        "Der Raumname darf höchstens 50 Zeichen lang sein.",
+		ServerErrorCodeNoRoom:              "Der Raum, dem du beitreten möchtest, existiert nicht",
+		ServerErrorCodeFullRoom:            "Der Raum, dem du beitreten möchtest, ist voll",
+		ServerErrorCodeRoomRedirect:        "Der Raum, dem du beitreten möchtest, wird auf einem anderen Server gehostet",
+		ServerErrorCodeClientNotHost:       "Du bist nicht der Gastgeber",
+		ServerErrorCodeControlNotAllowed:   "Du darfst die Wiedergabe dieses Raums nicht steuern",
+		ServerErrorCodeControlConflict:     "Jemand anderes hat gerade die Wiedergabe geändert, versuche es gleich noch einmal",
+		ServerErrorCodeMissingPermission:   "Du hast keine Berechtigung, das in diesem Raum zu tun",
+		ServerErrorCodeNoViewer:            "Diesen Zuschauer gibt es in diesem Raum nicht",
+		ServerErrorCodeMaintenance:         "Der Server wird gewartet, neue Räume können gerade nicht erstellt werden",
+		ServerErrorCodeInvalidSchedule:     "Der geplante Start muss in der Zukunft und höchstens eine Woche entfernt liegen",
+		ServerErrorCodeVoteInProgress:      "In diesem Raum läuft bereits eine Abstimmung",
+		ServerErrorCodeNoVote:              "Die Abstimmung, an der du teilnehmen möchtest, läuft nicht mehr",
+		ServerErrorCodeUnknownMessageType:  "Der Server kann diese Anfrage nicht verarbeiten",
+		ServerErrorCodeUnauthorized:        "Du musst autorisiert sein, bevor du diese Anfrage stellst",
+	},
+}
+
+// LocalizeServerError returns the text of an error code in the requested locale.
+//
+// Region specific locales fall back to their base language (e.g. "fr-CA" to "fr") and
+// any missing translation falls back to the [DEFAULT_LOCALE].
+func LocalizeServerError(locale Locale, errorCode ServerErrorCode) (ServerErrorMessage, bool) {
+	normalizedLocale := strings.ReplaceAll(strings.ToLower(string(locale)), "_", "-")
+	baseLanguage, _, _ := strings.Cut(normalizedLocale, "-")
+
+	for _, candidate := range []Locale{Locale(baseLanguage), DEFAULT_LOCALE} {
+		translation, exists := serverErrorMessageTranslations[candidate][errorCode]
+		if exists {
+			return translation, true
+		}
+	}
+
+	return "", false
+}
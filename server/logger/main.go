@@ -5,17 +5,22 @@ import (
 	"os"
 	"runtime/debug"
 	"strings"
+	"sync"
 	"time"
 )
 
 type Logger struct {
 	LogFile *os.File
+	Level   LogLevel // Messages below the level are dropped, every message is logged if empty
 
 	ShouldLogDate  bool
 	ShouldLogLevel bool
 	PrintTraceOnWarnOrError bool
 }
 
+// The level can change while other goroutines are logging.
+var levelMutex sync.Mutex
+
 type LogLevel string
 const (
 	LogLevelDebug = "DEBUG"
@@ -24,6 +29,13 @@ const (
 	LogLevelError = "ERROR"
 )
 
+var logLevelSeverity = map[LogLevel]int{
+	LogLevelDebug: 0,
+	LogLevelInfo:  1,
+	LogLevelWarn:  2,
+	LogLevelError: 3,
+}
+
 var logger = Logger{
 	ShouldLogDate: true,
 	ShouldLogLevel: true,
@@ -38,6 +50,35 @@ func SetLogFile(file *os.File) {
 	logger.LogFile = file
 }
 
+// SetLevel drops every message below the level from now on.
+func SetLevel(level LogLevel) bool {
+	if !IsValidLevel(level) {
+		return false
+	}
+
+	levelMutex.Lock()
+	defer levelMutex.Unlock()
+
+	logger.Level = level
+	return true
+}
+
+func GetLevel() LogLevel {
+	levelMutex.Lock()
+	defer levelMutex.Unlock()
+
+	if logger.Level == "" {
+		return LogLevelDebug
+	}
+
+	return logger.Level
+}
+
+func IsValidLevel(level LogLevel) bool {
+	_, exists := logLevelSeverity[level]
+	return exists
+}
+
 func Debug(format string, args ...any) {
 	Log(LogLevelDebug, format, args...)
 }
@@ -55,6 +96,10 @@ func Error(format string, args ...any) {
 }
 
 func Log(level LogLevel, format string, args ...any) {
+	if logLevelSeverity[level] < logLevelSeverity[GetLevel()] {
+		return
+	}
+
 	output := ""
 
 	if logger.ShouldLogDate {
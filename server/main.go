@@ -1,10 +1,12 @@
 package main
 
 import (
+	"context"
 	"flag"
-	"fmt"
 	"net/http"
 	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/cowatch/logger"
@@ -13,9 +15,25 @@ import (
 var port string
 var ClientCleanupRoutineInterval int
 var ClientInnactivityThreshold string
+var compressionOptions CompressionOptions
+var nodeID string
+var redisAddress string
+var clusterSelf string
+var clusterMembers string
+var clusterGossip bool
+var clusterSecret string
+var clusterDiscovery bool
+var updateManifestOptions UpdateManifestOptions
+var adminToken string
+var startInMaintenance bool
+var maintenanceMessage string
+var maxConnections int
+var shutdownGracePeriod time.Duration
+var recordingDirectory string
+var replayPath string
+var roomPolicies RoomPolicies
 
 const EndpointReflect = "/reflect"
-const EndpointDownload = "/download/{version}"
 const PathDownload = "./downloads"
 
 const tlsPEM = "server.pem"
@@ -34,8 +52,36 @@ func main() {
 	flag.StringVar(&port, "p", "8080", "Port that the server will run on")
 	flag.StringVar(&ClientInnactivityThreshold, "innactivity-threshold", "600", "The amount of time (sec) a client can be innactive before his session is cleaned up")
 	flag.IntVar(&ClientCleanupRoutineInterval, "cleanup-interval", 30, "The amount of time (sec) the client cleanup will take to rerun")
+	flag.BoolVar(&compressionOptions.Enabled, "compression", DefaultCompressionOptions.Enabled, "Negotiate permessage-deflate compression with clients that support it")
+	flag.IntVar(&compressionOptions.Level, "compression-level", DefaultCompressionOptions.Level, "The deflate compression level, from -2 (huffman only) to 9 (best compression)")
+	flag.IntVar(&compressionOptions.Threshold, "compression-threshold", DefaultCompressionOptions.Threshold, "The size (bytes) below which messages are sent uncompressed")
+	flag.StringVar(&nodeID, "node-id", string(StandaloneNodeID), "The id this server uses to identify itself to the other nodes of the backplane")
+	flag.StringVar(&redisAddress, "redis-addr", "", "The address of a redis server used to share rooms between nodes, leave empty to run standalone")
+	flag.StringVar(&clusterSelf, "cluster-self", "", "Enables cluster mode, the id and address of this node formatted as id=address")
+	flag.StringVar(&clusterMembers, "cluster-members", "", "Comma separated list of the cluster's nodes formatted as id=address")
+	flag.BoolVar(&clusterGossip, "cluster-gossip", false, "Track which of the cluster's nodes are alive through gossip, using the cluster members as seeds")
+	flag.StringVar(&clusterSecret, "cluster-secret", os.Getenv("COWATCH_CLUSTER_SECRET"), "The secret shared by the cluster's nodes, required by gossip (defaults to $COWATCH_CLUSTER_SECRET)")
+	flag.BoolVar(&clusterDiscovery, "cluster-discovery", false, "Let gossip add nodes that aren't among the cluster members")
+	flag.StringVar(&updateManifestOptions.PublicURL, "public-url", "", "The public base url of the server used in the extension update manifests, derived from each request if empty")
+	flag.StringVar(&updateManifestOptions.GeckoAddonID, "gecko-addon-id", DEFAULT_GECKO_ADDON_ID, "The firefox add-on id listed in the update manifest")
+	flag.StringVar(&updateManifestOptions.ChromiumAppID, "chromium-app-id", "", "The chrome extension id listed in the update manifest, the manifest isn't served if empty")
+	flag.StringVar(&adminToken, "admin-token", os.Getenv("COWATCH_ADMIN_TOKEN"), "The bearer token required by the admin api, the api is disabled if empty (defaults to $COWATCH_ADMIN_TOKEN)")
+	flag.BoolVar(&startInMaintenance, "maintenance", false, "Start in maintenance mode, rejecting new rooms until it's disabled through SIGUSR2 or the admin api")
+	flag.StringVar(&maintenanceMessage, "maintenance-message", DEFAULT_MAINTENANCE_MESSAGE, "The announcement sent to every client when maintenance mode is entered through SIGUSR1")
+	flag.IntVar(&maxConnections, "max-connections", 0, "The amount of open connections above which new ones are rejected and the server reports it isn't ready, 0 for unlimited")
+	flag.DurationVar(&shutdownGracePeriod, "shutdown-grace", 5*time.Second, "How long the server keeps serving while reporting it isn't ready before shutting down")
+	flag.StringVar(&recordingDirectory, "record-dir", "", "Record the messages of every room hosted on the server to a file per room in the directory, leave empty to disable recording")
+	flag.StringVar(&replayPath, "replay", "", "Replay a room recording through a fresh server, report where it's handled differently and exit")
+	flag.DurationVar(&roomPolicies.IdleTimeout, "room-idle-timeout", DefaultRoomPolicies.IdleTimeout, "Close rooms that have been left without viewers for this long, 0 to keep them open")
+	flag.DurationVar(&roomPolicies.ReflectionTimeout, "room-reflection-timeout", DefaultRoomPolicies.ReflectionTimeout, "Close rooms whose host hasn't reflected their player for this long, 0 to keep them open")
+	flag.DurationVar(&roomPolicies.MaxLifetime, "room-max-lifetime", DefaultRoomPolicies.MaxLifetime, "Close rooms that have been open for this long, 0 to keep them open")
+	flag.DurationVar(&roomPolicies.ClosingWarning, "room-closing-warning", DefaultRoomPolicies.ClosingWarning, "Warn the members of a room this long before closing it")
 	flag.Parse()
 
+	if replayPath != "" {
+		os.Exit(runReplay(replayPath, os.Stdout))
+	}
+
 	logFileName := "log_" + time.Now().Format("2006_01_02_15_04_05.000")
 	logFile, errorOpeningLogFile := os.OpenFile(logFileName, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
 
@@ -56,51 +102,139 @@ func main() {
 
 	logger.Info("Starting cowatch in port %s\n", port)
 
-	connectionManager := NewGorillaConnectionManager()
-	managerInstance := NewManager(serverVersion, connectionManager)
+	connectionManager, errorCreatingConnectionManager := NewGorillaConnectionManagerWithCompression(compressionOptions)
+	if errorCreatingConnectionManager != nil {
+		logger.Error("Failed to setup connections: %s\n", errorCreatingConnectionManager)
+		return
+	}
 
-	http.HandleFunc(EndpointReflect, managerInstance.HandleMessages)
-	http.HandleFunc(EndpointDownload, HandleDownload)
+	var backplane Backplane = NewInProcessBackplane(NewInProcessBackplaneHub(), NodeID(nodeID))
+	if redisAddress != "" {
+		// Claims are renewed every cleanup, a lease outlives a couple of missed ones
+		leaseDuration := 3 * time.Duration(ClientCleanupRoutineInterval) * time.Second
+		redisBackplane, errorConnectingBackplane := NewRedisBackplane(redisAddress, NodeID(nodeID), leaseDuration)
+		if errorConnectingBackplane != nil {
+			logger.Error("Failed to connect to the redis backplane: %s\n", errorConnectingBackplane)
+			return
+		}
 
-	go func() {
-		for {
-			time.Sleep(time.Duration(ClientCleanupRoutineInterval) * time.Second)
-			managerInstance.CleanupInnactiveClients()
+		logger.Info("Connected to the redis backplane at %s as %q\n", redisAddress, nodeID)
+		backplane = redisBackplane
+	}
+	defer backplane.Close()
+
+	managerInstance := NewManagerWithBackplane(serverVersion, connectionManager, backplane)
+
+	if recordingDirectory != "" {
+		recorder, errorCreatingRecorder := NewRecorder(recordingDirectory)
+		if errorCreatingRecorder != nil {
+			logger.Error("Failed to setup the recorder: %s\n", errorCreatingRecorder)
+			return
 		}
-	}()
+		defer recorder.Close()
 
-	// if err := http.ListenAndServeTLS(":"+port, "server.pem", "server.key", nil); err != nil {
-	if err := http.ListenAndServe(":"+port, nil); err != nil {
-		logger.Error("Failed while serving: %s\n", err)
+		logger.Info("Recording rooms to %s\n", recordingDirectory)
+		managerInstance.SetRecorder(recorder)
 	}
-}
 
-func HandleDownload(w http.ResponseWriter, r *http.Request) {
-	version := r.PathValue("version")
-	logger.Info("Requested download for %q\n", version)
-
-	var file = version
-	var fileType = "none"
-	switch version {
-	case "chromium":
-		file = "chromium-latest.crx"
-		fileType = "application/x-chrome-extension"
-		break
-	case "gecko":
-		file = "firefox-latest.xpi"
-		fileType = "application/zip"
-		break
+	if clusterSelf != "" {
+		selfMembers, errorParsingSelf := ParseClusterMembers(clusterSelf)
+		members, errorParsingMembers := ParseClusterMembers(clusterMembers)
+		if errorParsingSelf != nil || errorParsingMembers != nil || len(selfMembers) != 1 {
+			logger.Error("Failed to parse the cluster members: %v %v\n", errorParsingSelf, errorParsingMembers)
+			return
+		}
+
+		var membership ClusterMembership = NewStaticMembership(members)
+		if clusterGossip {
+			if clusterSecret == "" {
+				logger.Error("Gossip requires the cluster secret, set -cluster-secret or $COWATCH_CLUSTER_SECRET\n")
+				return
+			}
+
+			gossipOptions := DefaultGossipOptions
+			gossipOptions.Secret = clusterSecret
+			gossipOptions.Discovery = clusterDiscovery
+
+			gossipMembership := NewGossipMembership(selfMembers[0], members, gossipOptions)
+			http.HandleFunc(EndpointClusterGossip, gossipMembership.HandleGossip)
+			gossipMembership.Start()
+			defer gossipMembership.Stop()
+
+			membership = gossipMembership
+		}
+
+		logger.Info("Running in cluster mode as %q\n", selfMembers[0].ID)
+		managerInstance.SetCluster(NewCluster(selfMembers[0], membership))
 	}
 
-	_, pathError := os.Stat(PathDownload + "/" + file)
-	if os.IsNotExist(pathError) {
-		logger.Debug("Path does not exist: %v", pathError)
-		w.WriteHeader(http.StatusBadRequest)
-		w.Write([]byte(fmt.Sprintf("File %q doesn't exist.", file)))
+	http.HandleFunc(EndpointReflect, managerInstance.HandleMessages)
+	releaseRegistry, errorLoadingReleases := LoadReleaseRegistry(PathDownload, serverVersion)
+	if errorLoadingReleases != nil {
+		logger.Error("Failed to load the release registry: %s\n", errorLoadingReleases)
+		return
+	}
+
+	http.HandleFunc("GET "+EndpointReleases, releaseRegistry.HandleListReleases)
+	http.HandleFunc("GET "+EndpointLatestRelease, releaseRegistry.HandleLatestRelease)
+	http.HandleFunc("GET "+EndpointDownloadLatest, releaseRegistry.HandleDownloadLatest)
+	http.HandleFunc("GET "+EndpointDownloadVersion, releaseRegistry.HandleDownloadVersion)
+
+	NewUpdateManifests(releaseRegistry, updateManifestOptions).RegisterRoutes(http.DefaultServeMux)
+
+	managerInstance.SetMaxConnections(maxConnections)
+	managerInstance.SetRoomPolicies(roomPolicies)
+	managerInstance.SetMaintenanceMode(startInMaintenance, "")
+	stopMaintenanceSignals := ListenForMaintenanceSignals(managerInstance, maintenanceMessage)
+	defer stopMaintenanceSignals()
+
+	if adminToken != "" {
+		adminAPI, _ := NewAdminAPI(managerInstance, adminToken)
+		adminAPI.RegisterRoutes(http.DefaultServeMux)
+		adminAPI.RegisterDownloadMetrics(http.DefaultServeMux, releaseRegistry.GetDownloadCounter())
+		logger.Info("Enabled the admin api\n")
+	}
+
+	innactivityThreshold, errorParsingThreshold := time.ParseDuration(ClientInnactivityThreshold + "s")
+	if errorParsingThreshold != nil {
+		logger.Error("Invalid innactivity threshold %q: %s\n", ClientInnactivityThreshold, errorParsingThreshold)
+		return
+	}
+
+	stopCleanup := managerInstance.StartCleanup(time.Duration(ClientCleanupRoutineInterval)*time.Second, innactivityThreshold)
+	defer stopCleanup()
+
+	healthChecker := NewHealthChecker(managerInstance, serverVersion)
+	http.HandleFunc("GET "+EndpointHealthz, healthChecker.HandleHealthz)
+	http.HandleFunc("GET "+EndpointReadyz, healthChecker.HandleReadyz)
+
+	server := &http.Server{Addr: ":" + port}
+	shutdownContext, stopListeningForShutdown := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stopListeningForShutdown()
+
+	// Keeps serving while reporting it isn't ready so the orchestrator can route traffic elsewhere first.
+	isShutdown := make(chan struct{})
+	go func() {
+		defer close(isShutdown)
+		<-shutdownContext.Done()
+
+		logger.Info("Shutting down in %s\n", shutdownGracePeriod)
+		healthChecker.BeginShutdown()
+		time.Sleep(shutdownGracePeriod)
+
+		timeoutContext, cancel := context.WithTimeout(context.Background(), shutdownGracePeriod)
+		defer cancel()
+
+		if errorShuttingDown := server.Shutdown(timeoutContext); errorShuttingDown != nil {
+			logger.Error("Failed to shut down gracefully: %s\n", errorShuttingDown)
+		}
+	}()
+
+	// if err := server.ListenAndServeTLS("server.pem", "server.key"); err != nil {
+	if err := server.ListenAndServe(); err != http.ErrServerClosed {
+		logger.Error("Failed while serving: %s\n", err)
 		return
 	}
 
-	w.Header().Add("Content-Type", fileType)
-	w.Header().Add("Content-Disposition", fmt.Sprintf("attatchment; filename=%q", file))
-	http.ServeFile(w, r, PathDownload+"/"+file)
+	<-isShutdown
 }
@@ -0,0 +1,88 @@
+package main
+
+import (
+	"encoding/json"
+
+	"github.com/cowatch/logger"
+)
+
+const DEFAULT_MAINTENANCE_MESSAGE = "The server will restart soon, new rooms can't be hosted until then."
+
+// BroadcastAnnouncement sends the announcement to the members of the given rooms hosted on this node,
+// or to every client connected to this node if no rooms are given.
+// It returns the number of clients the announcement was sent to.
+func (manager *Manager) BroadcastAnnouncement(announcement ServerAnnouncement, roomIDs []RoomID) int {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	return manager.broadcastAnnouncement(announcement, roomIDs)
+}
+
+func (manager *Manager) broadcastAnnouncement(announcement ServerAnnouncement, roomIDs []RoomID) int {
+	announcementDetails, errorMarshaling := json.Marshal(announcement)
+	if errorMarshaling != nil {
+		logger.Error("Failed to marshal announcement: %s\n", errorMarshaling)
+		return 0
+	}
+
+	recipients := make([]*Client, 0, len(manager.clients))
+	if len(roomIDs) == 0 {
+		for _, client := range manager.clients {
+			if client.NodeID == "" {
+				recipients = append(recipients, client)
+			}
+		}
+	}
+
+	for _, roomID := range roomIDs {
+		room, exists := manager.GetRegisteredRoom(roomID)
+		if !exists {
+			logger.Info("[%s] Skipping announcement to room that isn't hosted on this node\n", roomID)
+			continue
+		}
+
+		recipients = append(recipients, room.Host)
+		recipients = append(recipients, room.Viewers...)
+	}
+
+	serverMessages := make([]DirectedServerMessage, 0, len(recipients))
+	for _, recipient := range recipients {
+		serverMessages = append(serverMessages, DirectedServerMessage{
+			token: recipient.PrivateToken,
+			message: ServerMessage{
+				MessageType:    ServerMessageTypeServerAnnouncement,
+				MessageDetails: announcementDetails,
+				Status:         ServerMessageStatusOk,
+				ErrorMessage:   "",
+			},
+		})
+	}
+
+	manager.sendDirectedMessages(serverMessages)
+	return len(serverMessages)
+}
+
+// SetMaintenanceMode stops or resumes accepting new rooms on this node, existing rooms are left untouched.
+// Entering maintenance mode with a message announces it to every client connected to this node.
+func (manager *Manager) SetMaintenanceMode(isEnabled bool, message string) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if manager.isInMaintenance == isEnabled {
+		return
+	}
+
+	manager.isInMaintenance = isEnabled
+	logger.Warn("Maintenance mode enabled: %t\n", isEnabled)
+
+	if isEnabled && message != "" {
+		manager.broadcastAnnouncement(ServerAnnouncement{Message: message, Maintenance: true}, nil)
+	}
+}
+
+func (manager *Manager) IsInMaintenanceMode() bool {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	return manager.isInMaintenance
+}
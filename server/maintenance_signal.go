@@ -0,0 +1,30 @@
+//go:build !windows
+
+package main
+
+import (
+	"os"
+	"os/signal"
+	"syscall"
+
+	"github.com/cowatch/logger"
+)
+
+// ListenForMaintenanceSignals enters maintenance mode on SIGUSR1, announcing the message,
+// and leaves it on SIGUSR2 until the returned function is called.
+func ListenForMaintenanceSignals(manager *Manager, message string) func() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+
+	go func() {
+		for receivedSignal := range signals {
+			logger.Info("Received %s\n", receivedSignal)
+			manager.SetMaintenanceMode(receivedSignal == syscall.SIGUSR1, message)
+		}
+	}()
+
+	return func() {
+		signal.Stop(signals)
+		close(signals)
+	}
+}
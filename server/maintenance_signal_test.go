@@ -0,0 +1,37 @@
+//go:build !windows
+
+package main
+
+import (
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestMaintenanceSignals(t *testing.T) {
+	t.Run("toggling maintenance mode through signals", func(t *testing.T) {
+		manager := NewManager(serverVersion, NewGorillaConnectionManager())
+		stopMaintenanceSignals := ListenForMaintenanceSignals(manager, DEFAULT_MAINTENANCE_MESSAGE)
+		defer stopMaintenanceSignals()
+
+		syscall.Kill(syscall.Getpid(), syscall.SIGUSR1)
+		waitForMaintenanceMode(t, manager, true)
+
+		syscall.Kill(syscall.Getpid(), syscall.SIGUSR2)
+		waitForMaintenanceMode(t, manager, false)
+	})
+}
+
+func waitForMaintenanceMode(t *testing.T, manager *Manager, isEnabled bool) {
+	t.Helper()
+
+	for range 100 {
+		if manager.IsInMaintenanceMode() == isEnabled {
+			return
+		}
+
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	t.Fatalf("Expected maintenance mode to be %t\n", isEnabled)
+}
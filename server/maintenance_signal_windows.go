@@ -0,0 +1,10 @@
+package main
+
+import "github.com/cowatch/logger"
+
+// ListenForMaintenanceSignals does nothing as windows has no user defined signals,
+// maintenance mode can only be toggled through the admin api.
+func ListenForMaintenanceSignals(manager *Manager, message string) func() {
+	logger.Warn("Maintenance signals aren't supported on windows\n")
+	return func() {}
+}
@@ -1,11 +1,15 @@
 package main
 
 import (
+	"encoding/json"
 	"errors"
 	"net/http"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cowatch/logger"
+	"github.com/cowatch/protocol"
 	"github.com/google/uuid"
 )
 
@@ -19,7 +23,7 @@ import (
 // If used as a PublicToken, it is the identifier of a client in regards to other clients.
 // It is used as the primary identifier for other clients to interact with a client.
 // A PublicToken is generated using the [Manager.GenerateUniqueClientTokens].
-type Token string
+type Token = protocol.Token
 
 // Connection is responsible of handling the communication between the server and connection.
 type Connection interface {
@@ -30,8 +34,14 @@ type Connection interface {
 	// ReadMessage collects the next message from the connection and respons to the server.
 	ReadMessage() (ClientMessage, error)
 
-	// WriteMessage accepts an arbitrary json object and forwards it to the connection.
+	// WriteMessage accepts an arbitrary object and forwards it to the connection.
 	WriteMessage(interface{}) error
+
+	// GetCodec returns the codec the connection negotiated to encode it's messages.
+	GetCodec() Codec
+
+	// Close terminates the connection, ending the read loop of the client.
+	Close() error
 }
 
 // ConnectionManger manages all incoming connections.
@@ -60,15 +70,42 @@ type ConnectionManager interface {
 }
 
 type Manager struct {
+	mutex sync.Mutex
+
 	connectionManager     ConnectionManager
 	publicToPrivateTokens map[Token]Token
 	clients               map[Token]*Client
 	activeRooms           map[RoomID]*Room
 	clientMessageHandlers map[ClientMessageType]ClientRequestHandler
 	serverVersion         string
+	clock                 Clock
+
+	idempotentMessageTypes map[ClientMessageType]bool
+	idempotentResponses    map[idempotencyKey]idempotentResponse
+
+	backplane        Backplane
+	forwardedClients map[Token]NodeID
+	remoteRooms      map[RoomID]NodeID
+
+	cluster *Cluster
+
+	recorder *Recorder // Records the rooms hosted on the node if set
+
+	roomPolicies RoomPolicies
+
+	isInMaintenance bool // Rejects new rooms while the existing ones keep going
+
+	connectionCount atomic.Int64
+	maxConnections  atomic.Int64 // Connections above the limit are rejected, unlimited if 0
 }
 
+// NewManager creates a manager for a standalone server that doesn't share it's rooms with other nodes.
 func NewManager(serverVersion string, connManager ConnectionManager) *Manager {
+	return NewManagerWithBackplane(serverVersion, connManager, NewInProcessBackplane(NewInProcessBackplaneHub(), StandaloneNodeID))
+}
+
+// NewManagerWithBackplane creates a manager that shares it's rooms with the other nodes of the backplane.
+func NewManagerWithBackplane(serverVersion string, connManager ConnectionManager, backplane Backplane) *Manager {
 	var manager = &Manager{
 		connectionManager:     connManager,
 		publicToPrivateTokens: make(map[Token]Token),
@@ -76,20 +113,44 @@ func NewManager(serverVersion string, connManager ConnectionManager) *Manager {
 		activeRooms:           make(map[RoomID]*Room),
 		clientMessageHandlers: make(map[ClientMessageType]ClientRequestHandler),
 		serverVersion:         serverVersion,
+		clock:                 SystemClock{},
+
+		idempotentMessageTypes: make(map[ClientMessageType]bool),
+		idempotentResponses:    make(map[idempotencyKey]idempotentResponse),
+
+		backplane:        backplane,
+		forwardedClients: make(map[Token]NodeID),
+		remoteRooms:      make(map[RoomID]NodeID),
 	}
 	manager.setupClientMessageHandlers()
+
+	errorSubscribing := backplane.Subscribe(manager.handleBackplaneEnvelope, manager.handleRoomEvent)
+	if errorSubscribing != nil {
+		logger.Error("[%s] Failed to subscribe to the backplane: %s\n", backplane.GetNodeID(), errorSubscribing)
+	}
+
 	return manager
 }
 
 func (manager *Manager) HandleMessages(writer http.ResponseWriter, request *http.Request) {
+	if !manager.acquireConnection() {
+		logger.Warn("[%s] Rejected connection, reached the limit of %d connections\n", request.RemoteAddr, manager.maxConnections.Load())
+		http.Error(writer, "Server is at capacity.", http.StatusServiceUnavailable)
+		return
+	}
+	defer manager.connectionCount.Add(-1)
+
 	connection, errorUpgrading := manager.connectionManager.NewConnection(writer, request)
-	clientAddress := connection.GetAddr()
 	if errorUpgrading != nil {
-		logger.Error("[%s] Failed to upgrade to websocket: %s\n", clientAddress, errorUpgrading)
+		logger.Error("[%s] Failed to upgrade to websocket: %s\n", request.RemoteAddr, errorUpgrading)
+		return
 	}
+	clientAddress := connection.GetAddr()
 
 	tempPrivateToken := manager.GenerateToken()
+	manager.mutex.Lock()
 	manager.connectionManager.RegisterClientConnection(tempPrivateToken, &connection)
+	manager.mutex.Unlock()
 
 	client := NewClient(tempPrivateToken)
 	logger.Info("[%s] Established connection for %q\n", clientAddress, client.PrivateToken)
@@ -99,66 +160,257 @@ func (manager *Manager) HandleMessages(writer http.ResponseWriter, request *http
 			break
 		}
 
-		client.LatestReply = time.Now()
+		manager.processClientMessage(client, clientMessage)
+	}
+}
 
-		if clientMessage.ServerVersion != manager.serverVersion && clientMessage.MessageType != ClientMessageTypePing {
-			logger.Info("[%s] [%s] Client version is misaligned with server version, expected: %q but received %q\n", client.PrivateToken, clientMessage.MessageType, manager.serverVersion, clientMessage.ServerVersion)
-			connection.WriteMessage(ServerMessage{
-				MessageType:    ServerMessageType(clientMessage.MessageType), // Send him whatever he sent back
-				MessageDetails: nil,
-				Status:         ServerMessageStatusError,
-				ErrorMessage:   ServerErrorMessageOldServerVersion,
-			})
+// SetMaxConnections limits the amount of open connections, 0 removes the limit.
+func (manager *Manager) SetMaxConnections(maxConnections int) {
+	manager.maxConnections.Store(int64(maxConnections))
+}
+
+// GetConnectionCount returns the amount of open connections and their limit, which is 0 if unlimited.
+func (manager *Manager) GetConnectionCount() (int, int) {
+	return int(manager.connectionCount.Load()), int(manager.maxConnections.Load())
+}
+
+// Counts a new connection if it fits under the limit.
+func (manager *Manager) acquireConnection() bool {
+	connectionCount := manager.connectionCount.Add(1)
+	maxConnections := manager.maxConnections.Load()
+	if maxConnections > 0 && connectionCount > maxConnections {
+		manager.connectionCount.Add(-1)
+		return false
+	}
+
+	return true
+}
+
+// Handles a client message and collects every message that should be sent as a result.
+// Messages directed to the requesting client are tagged with the RequestID of the client message
+// and every error is localized to the locale of the client receiving it.
+func (manager *Manager) handleClientMessage(client *Client, clientMessage ClientMessage) []DirectedServerMessage {
+	if clientMessage.Locale != "" {
+		client.Locale = clientMessage.Locale
+	}
+
+	senderToken, previousRoomID := client.PrivateToken, client.RoomID
+	serverMessages := manager.routeClientMessage(client, clientMessage)
+	serverMessages = acknowledgeClientMessage(client, clientMessage, serverMessages)
+	manager.localizeServerMessages(client, serverMessages)
+	manager.recordClientMessage(senderToken, previousRoomID, client, clientMessage, serverMessages)
+
+	return serverMessages
+}
+
+// Routes a client message to its handler.
+func (manager *Manager) routeClientMessage(client *Client, clientMessage ClientMessage) []DirectedServerMessage {
+	if clientMessage.ServerVersion != manager.serverVersion && clientMessage.MessageType != ClientMessageTypePing {
+		logger.Info("[%s] [%s] Client version is misaligned with server version, expected: %q but received %q\n", client.PrivateToken, clientMessage.MessageType, manager.serverVersion, clientMessage.ServerVersion)
+		return newClientMessageErrorResponse(
+			client, clientMessage, ServerErrorCodeOldServerVersion,
+			marshalServerErrorDetails(ServerErrorDetailsOldServerVersion{ExpectedVersion: manager.serverVersion}),
+		)
+	}
+
+	logger.Info("[%s] [%s] Handling Request: %s\n", client.PrivateToken, clientMessage.MessageType, clientMessage.Message)
+	clientMessageHandler, foundHandler := manager.clientMessageHandlers[clientMessage.MessageType]
+
+	if !foundHandler {
+		logger.Info("[%s] [%s] Handler for message does not exist\n", client.PrivateToken, clientMessage.MessageType)
+		return newClientMessageErrorResponse(client, clientMessage, ServerErrorCodeUnknownMessageType, nil)
+	}
+
+	if manager.IsClientRegistered(client) == false &&
+		clientMessage.MessageType != ClientMessageTypeAuthorize &&
+		clientMessage.MessageType != ClientMessageTypePing {
+
+		logger.Info("[%s] [%s] User not authorized\n", client.PrivateToken, clientMessage.MessageType)
+		return newClientMessageErrorResponse(client, clientMessage, ServerErrorCodeUnauthorized, nil)
+	}
+
+	if previousResponse, isRetry := manager.getIdempotentResponse(client, clientMessage); isRetry {
+		logger.Info("[%s] [%s] Replaying response for retried request %q\n", client.PrivateToken, clientMessage.MessageType, clientMessage.RequestID)
+		return previousResponse
+	}
+
+	serverMessages := clientMessageHandler(client, manager, clientMessage.Message)
+	manager.saveIdempotentResponse(client, clientMessage, serverMessages)
+
+	return serverMessages
+}
+
+// Replaces the text of every error with its translation in the receiving client's locale.
+func (manager *Manager) localizeServerMessages(client *Client, serverMessages []DirectedServerMessage) {
+	for index := range serverMessages {
+		message := &serverMessages[index].message
+		if message.Status != ServerMessageStatusError || message.ErrorCode == "" {
 			continue
 		}
 
-		logger.Info("[%s] [%s] Handling Request: %s\n", client.PrivateToken, clientMessage.MessageType, clientMessage.Message)
-		clientMessageHandler, foundHandler := manager.clientMessageHandlers[clientMessage.MessageType]
+		locale := client.Locale
+		if serverMessages[index].token != client.PrivateToken {
+			receivingClient, exists := manager.GetClient(serverMessages[index].token)
+			if !exists {
+				continue
+			}
 
-		if !foundHandler {
-			logger.Info("[%s] [%s] Handler for message does not exist\n", client.PrivateToken, clientMessage.MessageType)
-			continue
+			locale = receivingClient.Locale
 		}
 
-		if manager.IsClientRegistered(client) == false &&
-			clientMessage.MessageType != ClientMessageTypeAuthorize &&
-			clientMessage.MessageType != ClientMessageTypePing {
+		localizedErrorMessage, isLocalized := LocalizeServerError(locale, message.ErrorCode)
+		if isLocalized {
+			message.ErrorMessage = localizedErrorMessage
+		}
+	}
+}
 
-			logger.Info("[%s] [%s] User not authorized\n", client.PrivateToken, clientMessage.MessageType)
+// Sends every message to the connection registered under its token.
+// Messages for clients connected to another node are sent through the backplane.
+func (manager *Manager) sendDirectedMessages(serverMessages []DirectedServerMessage) {
+	for _, directedMessage := range serverMessages {
+		if directedMessage.message.MessageType == "" {
 			continue
 		}
 
-		serverMessages := clientMessageHandler(client, manager, clientMessage.Message)
-		for _, directedMessage := range serverMessages {
-			if directedMessage.message.MessageType == "" {
+		connectionToBeSentAMessage, exists := manager.connectionManager.GetConnection(directedMessage.token)
+		if !exists {
+			if client, isRegistered := manager.GetClient(directedMessage.token); isRegistered && client.NodeID != "" {
+				manager.sendRemoteDirectedMessage(client.NodeID, directedMessage)
 				continue
 			}
 
-			connectionToBeSentAMessage, exists := manager.connectionManager.GetConnection(directedMessage.token)
-			if !exists {
-				logger.Warn("[%s] [%s] Get connection does not exist\n", directedMessage.token, directedMessage.message.MessageType)
-				continue
-			}
+			logger.Warn("[%s] [%s] Get connection does not exist\n", directedMessage.token, directedMessage.message.MessageType)
+			continue
+		}
 
-			logger.Info("[%s] [%s] Sending: %q\n", directedMessage.token, directedMessage.message.MessageType, string(directedMessage.message.MessageDetails))
-			(*connectionToBeSentAMessage).WriteMessage(directedMessage.message)
+		logger.Info("[%s] [%s] Sending: %q\n", directedMessage.token, directedMessage.message.MessageType, string(directedMessage.message.MessageDetails))
+		(*connectionToBeSentAMessage).WriteMessage(directedMessage.message)
+	}
+}
+
+// Tags the messages directed to the requesting client with the request's id.
+// If none of the messages were directed to the client an Ack is appended so every identified request gets a reply.
+func acknowledgeClientMessage(client *Client, clientMessage ClientMessage, serverMessages []DirectedServerMessage) []DirectedServerMessage {
+	if clientMessage.RequestID == "" {
+		return serverMessages
+	}
+
+	isAcknowledged := false
+	for index := range serverMessages {
+		if serverMessages[index].token != client.PrivateToken || serverMessages[index].message.MessageType == "" {
+			continue
 		}
+
+		serverMessages[index].message.RequestID = clientMessage.RequestID
+		isAcknowledged = true
+	}
+
+	if isAcknowledged {
+		return serverMessages
+	}
+
+	serverMessageAck, serverMessageAckMarshalError := json.Marshal(ServerResponseAck{MessageType: clientMessage.MessageType})
+	if serverMessageAckMarshalError != nil {
+		logger.Error("[%s] [%s] Failed to marshal ack response: %s\n", client.PrivateToken, clientMessage.MessageType, serverMessageAckMarshalError)
+		return serverMessages
+	}
+
+	return append(serverMessages, DirectedServerMessage{
+		token: client.PrivateToken,
+		message: ServerMessage{
+			MessageType:    ServerMessageTypeAck,
+			MessageDetails: serverMessageAck,
+			Status:         ServerMessageStatusOk,
+			ErrorMessage:   "",
+			RequestID:      clientMessage.RequestID,
+		},
+	})
+}
+
+// Builds an error response for a client message that couldn't reach its handler.
+// The response's type mirrors whatever type the client sent.
+func newClientMessageErrorResponse(client *Client, clientMessage ClientMessage, errorCode ServerErrorCode, errorDetails json.RawMessage) []DirectedServerMessage {
+	errorMessage, _ := LocalizeServerError(DEFAULT_LOCALE, errorCode)
+
+	return []DirectedServerMessage{
+		{
+			token: client.PrivateToken,
+			message: ServerMessage{
+				MessageType:    ServerMessageType(clientMessage.MessageType),
+				MessageDetails: nil,
+				Status:         ServerMessageStatusError,
+				ErrorMessage:   errorMessage,
+				ErrorCode:      errorCode,
+				ErrorDetails:   errorDetails,
+			},
+		},
 	}
 }
 
-func (manager *Manager) CleanupInnactiveClients() {
-	currentDate := time.Now()
-	for _, client := range manager.clients {
-		oldNewDifferenceDuration := currentDate.Sub(client.LatestReply)
-		oldNewDifference := time.Time{}.Add(oldNewDifferenceDuration)
-		disconnectThresholdDuration, _ := time.ParseDuration(ClientInnactivityThreshold + "s")
+// SetClock replaces the clock the manager times clients, rooms and it's cleanup with.
+func (manager *Manager) SetClock(clock Clock) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	manager.clock = clock
+}
+
+// StartCleanup removes innactive clients and expired requests, renews the claims on the rooms and enforces
+// the room policies every interval
+// until the returned function is called.
+// Stopping waits for a running cleanup to finish.
+func (manager *Manager) StartCleanup(interval time.Duration, innactivityThreshold time.Duration) func() {
+	manager.mutex.Lock()
+	ticker := manager.clock.NewTicker(interval)
+	manager.mutex.Unlock()
+
+	stop := make(chan struct{})
+	isStopped := make(chan struct{})
+	go func() {
+		defer close(isStopped)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ticker.C():
+				manager.CleanupInnactiveClients(innactivityThreshold)
+				manager.CleanupExpiredRequests()
+				manager.RenewRoomClaims()
+				manager.EnforceRoomPolicies()
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	var stopOnce sync.Once
+	return func() {
+		stopOnce.Do(func() {
+			close(stop)
+			<-isStopped
+		})
+	}
+}
 
-		disconnectThreshold := time.Time{}.Add(disconnectThresholdDuration)
-		if oldNewDifference.Compare(disconnectThreshold) == -1 {
+// CleanupInnactiveClients removes every client that hasn't sent a message for longer than the threshold,
+// closing the rooms they host.
+func (manager *Manager) CleanupInnactiveClients(innactivityThreshold time.Duration) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	currentDate := manager.clock.Now()
+	for _, client := range manager.clients {
+		if currentDate.Sub(client.LatestReply) < innactivityThreshold {
 			continue
 		}
 
 		logger.Info("Removing innactive client: %s\n", client.PrivateToken)
+		if ownerNode, isForwarded := manager.forwardedClients[client.PrivateToken]; isForwarded {
+			manager.forwardClientMessage(ownerNode, client, ClientMessage{ServerVersion: manager.serverVersion, MessageType: ClientMessageTypeDisconnectRoom})
+			delete(manager.forwardedClients, client.PrivateToken)
+		}
+
 		manager.disconnectClientFromRoom(client)
 		manager.UnregisterClient(client)
 	}
@@ -211,26 +463,84 @@ func (manager *Manager) GetPrivateToken(publicToken Token) (Token, bool) {
 	return privateToken, true
 }
 
+// GenerateUniqueRoomID generates an id that isn't used by any room of the backplane.
+// In cluster mode the id is also pinned to this node, see [Cluster.PinRoomID].
 func (manager *Manager) GenerateUniqueRoomID() RoomID {
-	generatedId, _ := uuid.NewRandom()
-	byteGeneratedId, _ := generatedId.MarshalText()
 	var roomID RoomID
 	var roomAlreadyExists = true
 
 	for roomAlreadyExists {
+		generatedId, _ := uuid.NewRandom()
+		byteGeneratedId, _ := generatedId.MarshalText()
+
 		roomID = RoomID(byteGeneratedId[:8])
+		if manager.cluster != nil {
+			roomID = manager.cluster.PinRoomID(roomID)
+		}
+
 		_, roomAlreadyExists = manager.activeRooms[roomID]
+		if !roomAlreadyExists {
+			_, roomAlreadyExists, _ = manager.backplane.GetRoomOwner(roomID)
+		}
 	}
 
 	return roomID
 }
 
-func (manager *Manager) RegisterRoom(room *Room) {
+// RegisterRoom makes the node the owner of the room and announces it to the rest of the backplane.
+// The room isn't registered if the node can't claim it.
+func (manager *Manager) RegisterRoom(room *Room) error {
+	isClaimed, errorClaiming := manager.backplane.ClaimRoom(room.RoomID)
+	if errorClaiming != nil {
+		return errorClaiming
+	}
+
+	if !isClaimed {
+		return ErrRoomOwnedElsewhere
+	}
+
 	manager.activeRooms[room.RoomID] = room
+	manager.publishRoomEvent(RoomEventTypeCreated, room.RoomID)
+	manager.startRecording(room)
+	return nil
+}
+
+// RenewRoomClaims claims every room of the node again, renewing claims that expire, and closes the rooms
+// another node claimed in the meantime.
+func (manager *Manager) RenewRoomClaims() {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	for _, room := range manager.activeRooms {
+		isClaimed, errorClaiming := manager.backplane.ClaimRoom(room.RoomID)
+		if errorClaiming != nil {
+			logger.Error("[%s] Failed to renew room ownership: %s\n", room.RoomID, errorClaiming)
+			continue
+		}
+
+		if !isClaimed {
+			logger.Error("[%s] Room was claimed by another node, closing it\n", room.RoomID)
+			manager.sendDirectedMessages(manager.disconnectClientFromRoom(room.Host))
+		}
+	}
 }
 
 func (manager *Manager) UnregisterRoom(room *Room) {
 	delete(manager.activeRooms, room.RoomID)
+	room.stopHeldStart()
+	room.stopSchedule()
+	room.stopVote()
+
+	errorReleasing := manager.backplane.ReleaseRoom(room.RoomID)
+	if errorReleasing != nil {
+		logger.Error("[%s] Failed to release room ownership: %s\n", room.RoomID, errorReleasing)
+	}
+
+	manager.publishRoomEvent(RoomEventTypeClosed, room.RoomID)
+
+	if manager.recorder != nil {
+		manager.recorder.finishRecording(room.RoomID)
+	}
 }
 
 func (manager *Manager) GetRegisteredRoom(roomID RoomID) (*Room, bool) {
@@ -254,14 +564,25 @@ func (manager *Manager) disconnectClientFromRoom(client *Client) []DirectedServe
 	serverMessages := make([]DirectedServerMessage, 0, len(room.Viewers)*2+1)
 
 	if client.Type == ClientTypeHost {
+		room.stopHeldStart() // Nobody will play or vote once the room is closed
+		room.stopVote()
+
 		for _, viewer := range room.Viewers {
 			serverMessages = append(serverMessages, manager.disconnectClientFromRoom(viewer)...)
 		}
 
 		manager.UnregisterRoom(room)
-	} else if client.Type == ClientTypeViewer {
-		room.RemoveViewer(client)
-		serverMessages = append(serverMessages, updateRoomClientsWithLatestChanges(*room)...)
+	} else if client.Type == ClientTypeViewer || client.Type == ClientTypeCoHost {
+		if roomDelta, removed := room.RemoveViewer(client); removed {
+			serverMessages = append(serverMessages, updateRoomClientsWithLatestChanges(*room, roomDelta)...)
+
+			if len(room.Viewers) == 0 {
+				room.emptySince = manager.clock.Now()
+			}
+
+			serverMessages = append(serverMessages, manager.forgetViewerReadiness(room, client)...)
+			serverMessages = append(serverMessages, manager.tallyVote(room)...)
+		}
 	}
 
 	client.UpdateClientDetails(Client{Type: ClientTypeInnactive, RoomID: ""})
@@ -285,8 +606,18 @@ func (manager *Manager) setupClientMessageHandlers() {
 	manager.clientMessageHandlers[ClientMessageTypeHostRoom] = HostRoomHandler
 	manager.clientMessageHandlers[ClientMessageTypeJoinRoom] = JoinRoomHandler
 	manager.clientMessageHandlers[ClientMessageTypeDisconnectRoom] = DisconnectRoomHandler
+	manager.clientMessageHandlers[ClientMessageTypeResyncRoom] = ResyncRoomHandler
+	manager.clientMessageHandlers[ClientMessageTypeUpdateRoomSettings] = UpdateRoomSettingsHandler
 
 	manager.clientMessageHandlers[ClientMessageTypeAttemptReconnect] = AttemptReconnectionHandler
 	manager.clientMessageHandlers[ClientMessageTypeSendReflection] = ReflectRoomHandler
+	manager.clientMessageHandlers[ClientMessageTypeSendReadiness] = ViewerReadinessHandler
+	manager.clientMessageHandlers[ClientMessageTypeSendIntent] = IntentHandler
+	manager.clientMessageHandlers[ClientMessageTypeStartVote] = StartVoteHandler
+	manager.clientMessageHandlers[ClientMessageTypeCastVote] = CastVoteHandler
+	manager.clientMessageHandlers[ClientMessageTypeAssignPermissions] = AssignPermissionsHandler
+	manager.clientMessageHandlers[ClientMessageTypeKickViewer] = KickViewerHandler
 	manager.clientMessageHandlers[ClientMessageTypeSendVideoDetails] = ReflectDetailsHandler
+
+	manager.idempotentMessageTypes[ClientMessageTypeHostRoom] = true
 }
@@ -0,0 +1,435 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestHandleClientMessage(t *testing.T) {
+	t.Run("client sending an unknown message type", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+
+		receivedServerMessages := mockManager.handleClientMessage(mockClient, ClientMessage{
+			ServerVersion: serverVersion,
+			MessageType:   "DoesNotExist",
+			RequestID:     "request-1",
+		})
+
+		assertExpectedMessageCount(t, 1, receivedServerMessages)
+		assertExpectedMessages(
+			t,
+			[]DirectedServerMessage{
+				{
+					token: mockClient.PrivateToken,
+					message: ServerMessage{
+						MessageType:  "DoesNotExist",
+						Status:       ServerMessageStatusError,
+						ErrorMessage: ServerErrorMessageUnknownMessageType,
+					},
+				},
+			},
+			receivedServerMessages,
+			func(a, b json.RawMessage) bool { return true },
+		)
+		assertRequestID(t, "request-1", receivedServerMessages)
+	})
+
+	t.Run("unauthorized client sending a request", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+
+		receivedServerMessages := mockManager.handleClientMessage(mockClient, ClientMessage{
+			ServerVersion: serverVersion,
+			MessageType:   ClientMessageTypeHostRoom,
+			Message:       `{"name":"Test"}`,
+			RequestID:     "request-1",
+		})
+
+		assertExpectedMessageCount(t, 1, receivedServerMessages)
+		assertExpectedMessages(
+			t,
+			[]DirectedServerMessage{
+				{
+					token: mockClient.PrivateToken,
+					message: ServerMessage{
+						MessageType:  ServerMessageTypeHostRoom,
+						Status:       ServerMessageStatusError,
+						ErrorMessage: ServerErrorMessageUnauthorized,
+					},
+				},
+			},
+			receivedServerMessages,
+			func(a, b json.RawMessage) bool { return true },
+		)
+		assertRequestID(t, "request-1", receivedServerMessages)
+
+		if len(mockManager.activeRooms) != 0 {
+			t.Errorf("Expected no rooms to be created but found %d\n", len(mockManager.activeRooms))
+		}
+	})
+
+	t.Run("client sending a request with an id", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockManager.RegisterClient(mockClient)
+
+		receivedServerMessages := mockManager.handleClientMessage(mockClient, ClientMessage{
+			ServerVersion: serverVersion,
+			MessageType:   ClientMessageTypeHostRoom,
+			Message:       `{"name":"Test"}`,
+			RequestID:     "request-1",
+		})
+
+		assertExpectedMessageCount(t, 1, receivedServerMessages)
+		assertRequestID(t, "request-1", receivedServerMessages)
+	})
+
+	t.Run("client retrying a host room request", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockManager.RegisterClient(mockClient)
+
+		clientMessage := ClientMessage{
+			ServerVersion: serverVersion,
+			MessageType:   ClientMessageTypeHostRoom,
+			Message:       `{"name":"Test"}`,
+			RequestID:     "request-1",
+		}
+
+		receivedServerMessagesFirst := mockManager.handleClientMessage(mockClient, clientMessage)
+		receivedServerMessagesSecond := mockManager.handleClientMessage(mockClient, clientMessage)
+
+		assertExpectedMessageCount(t, 1, receivedServerMessagesFirst)
+		assertExpectedMessageCount(t, 1, receivedServerMessagesSecond)
+
+		var roomRecordFirst RoomRecord
+		json.Unmarshal(receivedServerMessagesFirst[0].message.MessageDetails, &roomRecordFirst)
+
+		var roomRecordSecond RoomRecord
+		json.Unmarshal(receivedServerMessagesSecond[0].message.MessageDetails, &roomRecordSecond)
+
+		if roomRecordFirst.RoomID != roomRecordSecond.RoomID {
+			t.Errorf("Retried request created a new room: First(%q) Second(%q)\n", roomRecordFirst.RoomID, roomRecordSecond.RoomID)
+		}
+
+		if len(mockManager.activeRooms) != 1 {
+			t.Errorf("Expected 1 room to be registered but found %d\n", len(mockManager.activeRooms))
+		}
+	})
+
+	t.Run("client sending a new host room request with a different id", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockManager.RegisterClient(mockClient)
+
+		receivedServerMessagesFirst := mockManager.handleClientMessage(mockClient, ClientMessage{
+			ServerVersion: serverVersion,
+			MessageType:   ClientMessageTypeHostRoom,
+			Message:       `{"name":"Test"}`,
+			RequestID:     "request-1",
+		})
+		receivedServerMessagesSecond := mockManager.handleClientMessage(mockClient, ClientMessage{
+			ServerVersion: serverVersion,
+			MessageType:   ClientMessageTypeHostRoom,
+			Message:       `{"name":"Test"}`,
+			RequestID:     "request-2",
+		})
+
+		assertExpectedMessageCount(t, 1, receivedServerMessagesFirst)
+		assertExpectedMessageCount(t, 2, receivedServerMessagesSecond)
+		assertRequestID(t, "request-2", receivedServerMessagesSecond)
+	})
+
+	t.Run("client sending a request with an id that produces no response", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockManager.RegisterClient(mockClient)
+
+		receivedServerMessages := mockManager.handleClientMessage(mockClient, ClientMessage{
+			ServerVersion: serverVersion,
+			MessageType:   ClientMessageTypeDisconnectRoom,
+			RequestID:     "request-1",
+		})
+
+		assertExpectedMessageCount(t, 1, receivedServerMessages)
+		assertExpectedMessages(
+			t,
+			[]DirectedServerMessage{
+				{
+					token: mockClient.PrivateToken,
+					message: ServerMessage{
+						MessageType:  ServerMessageTypeAck,
+						Status:       ServerMessageStatusOk,
+						ErrorMessage: "",
+					},
+				},
+			},
+			receivedServerMessages,
+			func(a, b json.RawMessage) bool { return true },
+		)
+		assertRequestID(t, "request-1", receivedServerMessages)
+	})
+
+	t.Run("client sending a request without an id that produces no response", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockManager.RegisterClient(mockClient)
+
+		receivedServerMessages := mockManager.handleClientMessage(mockClient, ClientMessage{
+			ServerVersion: serverVersion,
+			MessageType:   ClientMessageTypeDisconnectRoom,
+		})
+
+		assertExpectedMessageCount(t, 0, receivedServerMessages)
+	})
+}
+
+func TestHandleClientMessageErrors(t *testing.T) {
+	t.Run("client receiving an error code with structured details", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockManager.RegisterClient(mockClient)
+
+		receivedServerMessages := mockManager.handleClientMessage(mockClient, ClientMessage{
+			ServerVersion: serverVersion,
+			MessageType:   ClientMessageTypeHostRoom,
+			Message:       `{"name":"A"}`,
+		})
+
+		assertExpectedMessageCount(t, 1, receivedServerMessages)
+		assertExpectedMessages(
+			t,
+			[]DirectedServerMessage{
+				{
+					token: mockClient.PrivateToken,
+					message: ServerMessage{
+						MessageType:  ServerMessageTypeHostRoom,
+						Status:       ServerMessageStatusError,
+						ErrorMessage: ServerErrorMessageShortRoomName,
+					},
+				},
+			},
+			receivedServerMessages,
+			func(a, b json.RawMessage) bool { return true },
+		)
+
+		if receivedServerMessages[0].message.ErrorCode != ServerErrorCodeShortRoomName {
+			t.Errorf("Expected error code %q but got %q\n", ServerErrorCodeShortRoomName, receivedServerMessages[0].message.ErrorCode)
+		}
+
+		var errorDetails ServerErrorDetailsRoomName
+		json.Unmarshal(receivedServerMessages[0].message.ErrorDetails, &errorDetails)
+		if errorDetails.MinLength != MIN_ROOM_NAME_LENGTH || errorDetails.MaxLength != MAX_ROOM_NAME_LENGTH {
+			t.Errorf("Expected error details to contain the room name limits but got %+v\n", errorDetails)
+		}
+	})
+
+	t.Run("client receiving an error in their requested locale", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockManager.RegisterClient(mockClient)
+
+		receivedServerMessages := mockManager.handleClientMessage(mockClient, ClientMessage{
+			ServerVersion: serverVersion,
+			MessageType:   ClientMessageTypeJoinRoom,
+			Message:       `{"roomID":"missing"}`,
+			Locale:        "fr-CA",
+		})
+
+		expectedErrorMessage := serverErrorMessageTranslations["fr"][ServerErrorCodeNoRoom]
+
+		assertExpectedMessageCount(t, 1, receivedServerMessages)
+		assertExpectedMessages(
+			t,
+			[]DirectedServerMessage{
+				{
+					token: mockClient.PrivateToken,
+					message: ServerMessage{
+						MessageType:  ServerMessageTypeJoinRoom,
+						Status:       ServerMessageStatusError,
+						ErrorMessage: expectedErrorMessage,
+					},
+				},
+			},
+			receivedServerMessages,
+			func(a, b json.RawMessage) bool { return true },
+		)
+	})
+
+	t.Run("client requesting a locale without translations", func(t *testing.T) {
+		errorMessage, isLocalized := LocalizeServerError("xx-YY", ServerErrorCodeFullRoom)
+
+		if !isLocalized || errorMessage != ServerErrorMessageFullRoom {
+			t.Errorf("Expected fallback to %q but got %q (localized: %t)\n", ServerErrorMessageFullRoom, errorMessage, isLocalized)
+		}
+	})
+}
+
+func assertRequestID(t *testing.T, expected RequestID, received []DirectedServerMessage) {
+	t.Helper()
+
+	for _, receivedServerMessage := range received {
+		if receivedServerMessage.message.RequestID != expected {
+			t.Errorf("Expected message %q to echo request id %q but got %q\n", receivedServerMessage.message.MessageType, expected, receivedServerMessage.message.RequestID)
+		}
+	}
+}
+
+func TestCleanup(t *testing.T) {
+	t.Run("removing clients once they reach the innactivity threshold", func(t *testing.T) {
+		mockManager, clock := newTestManagerWithFakeClock()
+		activeClient := NewClient(mockManager.GenerateToken())
+		innactiveClient := NewClient(mockManager.GenerateToken())
+		activeClient.LatestReply, innactiveClient.LatestReply = clock.Now(), clock.Now()
+		mockManager.RegisterClient(activeClient)
+		mockManager.RegisterClient(innactiveClient)
+
+		clock.Advance(599 * time.Second)
+		mockManager.CleanupInnactiveClients(600 * time.Second)
+
+		if !mockManager.IsClientRegistered(activeClient) || !mockManager.IsClientRegistered(innactiveClient) {
+			t.Fatalf("Expected clients under the threshold to be kept\n")
+		}
+
+		activeClient.LatestReply = clock.Now()
+		clock.Advance(time.Second)
+		mockManager.CleanupInnactiveClients(600 * time.Second)
+
+		if !mockManager.IsClientRegistered(activeClient) || mockManager.IsClientRegistered(innactiveClient) {
+			t.Errorf("Expected only the client that reached the threshold to be removed\n")
+		}
+	})
+
+	t.Run("keeping the clients that send messages active", func(t *testing.T) {
+		mockManager, clock := newTestManagerWithFakeClock()
+		mockClient := NewClient(mockManager.GenerateToken())
+
+		mockManager.processClientMessage(mockClient, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeAuthorize, Message: `{"name":"Client"}`})
+		clock.Advance(9 * time.Minute)
+		mockManager.processClientMessage(mockClient, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeDisconnectRoom})
+
+		clock.Advance(9 * time.Minute)
+		mockManager.CleanupInnactiveClients(10 * time.Minute)
+		if !mockManager.IsClientRegistered(mockClient) || !mockClient.LatestReply.Equal(clock.Now().Add(-9*time.Minute)) {
+			t.Fatalf("Expected the client to be active since it's latest message but got %s\n", mockClient.LatestReply)
+		}
+
+		clock.Advance(time.Minute)
+		mockManager.CleanupInnactiveClients(10 * time.Minute)
+		if mockManager.IsClientRegistered(mockClient) {
+			t.Errorf("Expected the client to be removed 10 minutes after it's latest message\n")
+		}
+	})
+
+	t.Run("closing the room of an innactive host", func(t *testing.T) {
+		mockManager, clock := newTestManagerWithFakeClock()
+		hostClient := newTestAuthorizedClient(t, mockManager, clock, "Host")
+		viewerClient := newTestAuthorizedClient(t, mockManager, clock, "Viewer")
+
+		mockManager.handleClientMessage(hostClient, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeHostRoom, Message: `{"name":"Expiring"}`})
+		roomID := hostClient.RoomID
+
+		room, _ := mockManager.GetRegisteredRoom(roomID)
+		if room == nil || room.CreatedAt != Timestamp(clock.Now().Unix()) {
+			t.Fatalf("Expected the room to be created at the fake time but got %+v\n", room)
+		}
+
+		joinRoom, _ := json.Marshal(ClientRequestJoinRoom{RoomID: roomID})
+		mockManager.handleClientMessage(viewerClient, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeJoinRoom, Message: string(joinRoom)})
+
+		clock.Advance(5 * time.Minute)
+		viewerClient.LatestReply = clock.Now()
+		clock.Advance(5 * time.Minute)
+		mockManager.CleanupInnactiveClients(10 * time.Minute)
+
+		if _, exists := mockManager.GetRegisteredRoom(roomID); exists {
+			t.Errorf("Expected the room to be closed with it's host\n")
+		}
+
+		if !mockManager.IsClientRegistered(viewerClient) || viewerClient.Type != ClientTypeInnactive {
+			t.Errorf("Expected the active viewer to be kept outside of the room but got %+v\n", viewerClient)
+		}
+	})
+
+	t.Run("expiring stored requests after the idempotency window", func(t *testing.T) {
+		mockManager, clock := newTestManagerWithFakeClock()
+		hostClient := newTestAuthorizedClient(t, mockManager, clock, "Host")
+
+		hostRoom := ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeHostRoom, Message: `{"name":"Retried"}`, RequestID: "request-1"}
+		mockManager.handleClientMessage(hostClient, hostRoom)
+
+		clock.Advance(RequestIdempotencyWindow)
+		mockManager.CleanupExpiredRequests()
+		if _, isStored := mockManager.getIdempotentResponse(hostClient, hostRoom); !isStored {
+			t.Fatalf("Expected the response to be kept for the whole window\n")
+		}
+
+		clock.Advance(time.Millisecond)
+		mockManager.CleanupExpiredRequests()
+		if len(mockManager.idempotentResponses) != 0 {
+			t.Errorf("Expected the response to be removed after the window\n")
+		}
+	})
+
+	t.Run("running the cleanup every interval until stopped", func(t *testing.T) {
+		mockManager, clock := newTestManagerWithFakeClock()
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockClient.LatestReply = clock.Now()
+		mockManager.RegisterClient(mockClient)
+
+		stopCleanup := mockManager.StartCleanup(30*time.Second, 60*time.Second)
+
+		clock.Advance(30 * time.Second)
+		clock.Advance(30 * time.Second) // Delivered once the first cleanup finished
+		stopCleanup()
+
+		if mockManager.IsClientRegistered(mockClient) {
+			t.Errorf("Expected the cleanup to remove the client after 60 seconds\n")
+		}
+
+		stopCleanup()
+		secondClient := NewClient(mockManager.GenerateToken())
+		secondClient.LatestReply = clock.Now()
+		mockManager.RegisterClient(secondClient)
+
+		clock.Advance(time.Hour)
+		if !mockManager.IsClientRegistered(secondClient) {
+			t.Errorf("Expected a stopped cleanup to not run anymore\n")
+		}
+	})
+}
+
+func newTestManagerWithFakeClock() (*Manager, *FakeClock) {
+	clock := NewFakeClock(time.Date(2024, time.May, 1, 20, 0, 0, 0, time.UTC))
+	manager := NewManager(serverVersion, NewGorillaConnectionManager())
+	manager.SetClock(clock)
+
+	return manager, clock
+}
+
+// Authorizes a client the way a connection would, having it's latest reply at the fake time.
+func newTestAuthorizedClient(t *testing.T, manager *Manager, clock *FakeClock, name string) *Client {
+	t.Helper()
+
+	client := NewClient(manager.GenerateToken())
+	client.LatestReply = clock.Now()
+
+	authorize, _ := json.Marshal(ClientRequestAuthorizeRoom{Name: name})
+	serverMessages := manager.handleClientMessage(client, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeAuthorize, Message: string(authorize)})
+	if len(serverMessages) != 1 || serverMessages[0].message.Status != ServerMessageStatusOk {
+		t.Fatalf("Failed to authorize %s: %+v\n", name, serverMessages)
+	}
+
+	return client
+}
@@ -2,25 +2,12 @@ package main
 
 import (
 	"encoding/json"
+	"slices"
 	"strings"
-	"time"
 
 	"github.com/cowatch/logger"
 )
 
-type ClientRequestAuthorizeRoom struct {
-	Name         string `json:"name"`
-	Image        string `json:"image"`
-	PrivateToken Token  `json:"privateToken"`
-}
-
-type ServerResponseAuthorizeRoom struct {
-	Name         string `json:"name"`
-	Image        string `json:"image"`
-	PrivateToken Token  `json:"privateToken"`
-	PublicToken  Token  `json:"publicToken"`
-}
-
 func AuthorizeHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
 	logger.Info("[%s] [Authorize] Autorizing client\n", client.PrivateToken)
 	var requestAuthorize ClientRequestAuthorizeRoom
@@ -36,6 +23,7 @@ func AuthorizeHandler(client *Client, manager *Manager, clientRequest string) []
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
 					ErrorMessage:   ServerErrorMessageBadJson,
+					ErrorCode:      ServerErrorCodeBadJson,
 				},
 			},
 		}
@@ -61,7 +49,10 @@ func AuthorizeHandler(client *Client, manager *Manager, clientRequest string) []
 		}
 	}
 
-	clientDetails.PublicToken = manager.GenerateToken()
+	// A known client keeps it's public token, so the room it's in still recognizes it, e.g. as a co-host
+	if !isClientAuthorized || clientDetails.PublicToken == "" {
+		clientDetails.PublicToken = manager.GenerateToken()
+	}
 
 	if isClientAuthorized {
 		logger.Info("[%s] [Authorize] Unregistering previous client\n", client.PrivateToken)
@@ -79,6 +70,7 @@ func AuthorizeHandler(client *Client, manager *Manager, clientRequest string) []
 						MessageDetails: nil,
 						Status:         ServerMessageStatusError,
 						ErrorMessage:   ServerErrorMessageInternalServerError,
+						ErrorCode:      ServerErrorCodeInternalServerError,
 					},
 				},
 			}
@@ -113,6 +105,7 @@ func AuthorizeHandler(client *Client, manager *Manager, clientRequest string) []
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
 					ErrorMessage:   ServerErrorMessageInternalServerError,
+					ErrorCode:      ServerErrorCodeInternalServerError,
 				},
 			},
 		}
@@ -167,6 +160,7 @@ func HostRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 				MessageDetails: nil,
 				Status:         ServerMessageStatusError,
 				ErrorMessage:   ServerErrorMessageBadJson,
+				ErrorCode:      ServerErrorCodeBadJson,
 			},
 		})
 
@@ -183,6 +177,23 @@ func HostRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
 					ErrorMessage:   ServerErrorMessageInternalServerError,
+					ErrorCode:      ServerErrorCodeInternalServerError,
+				},
+			},
+		}
+	}
+
+	if manager.isInMaintenance {
+		logger.Info("[%s] [HostRoom] Rejected room while in maintenance mode\n", client.PrivateToken)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageTypeHostRoom,
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageMaintenance,
+					ErrorCode:      ServerErrorCodeMaintenance,
 				},
 			},
 		}
@@ -192,9 +203,8 @@ func HostRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 		serverResponses = append(serverResponses, manager.disconnectClientFromRoom(client)...)
 	}
 
-	requestRoomSettings.Name = strings.Trim(requestRoomSettings.Name, " ")
-	if len(requestRoomSettings.Name) < 3 {
-		logger.Warn("[%s] [HostRoom] Expected room name to be > 3 chars but got %q %d\n", client.PrivateToken, requestRoomSettings.Name, len(requestRoomSettings.Name))
+	if errorMessage, errorCode, isValid := validateRoomSettings(&requestRoomSettings); !isValid {
+		logger.Warn("[%s] [HostRoom] Expected room name to be between %d and %d chars but got %q %d\n", client.PrivateToken, MIN_ROOM_NAME_LENGTH, MAX_ROOM_NAME_LENGTH, requestRoomSettings.Name, len(requestRoomSettings.Name))
 		return []DirectedServerMessage{
 			{
 				token: client.PrivateToken,
@@ -202,14 +212,19 @@ func HostRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 					MessageType:    ServerMessageTypeHostRoom,
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
-					ErrorMessage:   ServerErrorMessageShortRoomName,
+					ErrorMessage:   errorMessage,
+					ErrorCode:      errorCode,
+					ErrorDetails: marshalServerErrorDetails(ServerErrorDetailsRoomName{
+						MinLength: MIN_ROOM_NAME_LENGTH,
+						MaxLength: MAX_ROOM_NAME_LENGTH,
+					}),
 				},
 			},
 		}
 	}
 
-	if len(requestRoomSettings.Name) > 50 {
-		logger.Warn("[%s] [HostRoom] Expected room name to be < 50 chars but got %q %d\n", client.PrivateToken, requestRoomSettings.Name, len(requestRoomSettings.Name))
+	if requestRoomSettings.ScheduledStart != 0 && !validateScheduledStart(requestRoomSettings.ScheduledStart, manager.clock.Now()) {
+		logger.Warn("[%s] [HostRoom] Expected the scheduled start to be within %s but got %d\n", client.PrivateToken, MaxScheduleAhead, requestRoomSettings.ScheduledStart)
 		return []DirectedServerMessage{
 			{
 				token: client.PrivateToken,
@@ -217,14 +232,19 @@ func HostRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 					MessageType:    ServerMessageTypeHostRoom,
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
-					ErrorMessage:   ServerErrorMessageLongRoomName,
+					ErrorMessage:   ServerErrorMessageInvalidSchedule,
+					ErrorCode:      ServerErrorCodeInvalidSchedule,
+					ErrorDetails: marshalServerErrorDetails(ServerErrorDetailsInvalidSchedule{
+						MaxSecondsAhead: int(MaxScheduleAhead.Seconds()),
+					}),
 				},
 			},
 		}
 	}
 
-	if len(requestRoomSettings.Name) == 0 {
-		logger.Warn("[%s] [HostRoom] Expected room name to be > 3 chars but got %q %d\n", client.PrivateToken, requestRoomSettings.Name, len(requestRoomSettings.Name))
+	room, errNewRoom := NewRoom(manager.GenerateUniqueRoomID(), client, requestRoomSettings, manager.clock.Now())
+	if errNewRoom != nil {
+		logger.Error("[%s] [HostRoom] Failed to create a room: %s\n", client.PrivateToken, errNewRoom)
 		return []DirectedServerMessage{
 			{
 				token: client.PrivateToken,
@@ -232,15 +252,17 @@ func HostRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 					MessageType:    ServerMessageTypeHostRoom,
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
-					ErrorMessage:   ServerErrorMessageLongRoomName,
+					ErrorMessage:   ServerErrorMessageInternalServerError,
+					ErrorCode:      ServerErrorCodeInternalServerError,
 				},
 			},
 		}
 	}
 
-	room, errNewRoom := NewRoom(manager.GenerateUniqueRoomID(), client, requestRoomSettings)
-	if errNewRoom != nil {
-		logger.Error("[%s] [HostRoom] Failed to create a room: %s\n", client.PrivateToken, errNewRoom)
+	room.assignSettingsCoHosts(nil, room.Settings.CoHosts)
+	room.Settings.CoHosts = room.getSettingsCoHosts()
+	if errorRegistering := manager.RegisterRoom(room); errorRegistering != nil {
+		logger.Error("[%s] [HostRoom] Failed to claim room %s: %s\n", client.PrivateToken, room.RoomID, errorRegistering)
 		return []DirectedServerMessage{
 			{
 				token: client.PrivateToken,
@@ -249,13 +271,13 @@ func HostRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
 					ErrorMessage:   ServerErrorMessageInternalServerError,
+					ErrorCode:      ServerErrorCodeInternalServerError,
 				},
 			},
 		}
 	}
-
-	manager.RegisterRoom(room)
 	logger.Info("[%s] [HostRoom] Created room with id: %s\n", client.PrivateToken, room.RoomID)
+	manager.scheduleStart(room)
 
 	client.UpdateClientDetails(Client{Type: ClientTypeHost, RoomID: room.RoomID})
 	filteredRoom := room.GetFilteredRoom()
@@ -271,6 +293,7 @@ func HostRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
 					ErrorMessage:   ServerErrorMessageInternalServerError,
+					ErrorCode:      ServerErrorCodeInternalServerError,
 				},
 			},
 		}
@@ -289,10 +312,6 @@ func HostRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 	return serverResponses
 }
 
-type ClientRequestJoinRoom struct {
-	RoomID RoomID `json:"roomID"`
-}
-
 func JoinRoomHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
 	serverResponses := make([]DirectedServerMessage, 0, 10)
 
@@ -307,6 +326,7 @@ func JoinRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 				MessageDetails: nil,
 				Status:         ServerMessageStatusError,
 				ErrorMessage:   ServerErrorMessageBadJson,
+				ErrorCode:      ServerErrorCodeBadJson,
 			},
 		})
 
@@ -314,6 +334,26 @@ func JoinRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 	}
 
 	room, exists := manager.GetRegisteredRoom(requestJoinRoom.RoomID)
+	if ownerMember, isForeign := manager.getClusterRoomOwner(requestJoinRoom.RoomID); !exists && isForeign {
+		logger.Info("[%s] [JoinRoom] Redirecting to %q which owns room: %s\n", client.PrivateToken, ownerMember.ID, requestJoinRoom.RoomID)
+		serverResponses = append(serverResponses, DirectedServerMessage{
+			token: client.PrivateToken,
+			message: ServerMessage{
+				MessageType:    ServerMessageTypeJoinRoom,
+				MessageDetails: nil,
+				Status:         ServerMessageStatusError,
+				ErrorMessage:   ServerErrorMessageRoomRedirect,
+				ErrorCode:      ServerErrorCodeRoomRedirect,
+				ErrorDetails: marshalServerErrorDetails(ServerErrorDetailsRoomRedirect{
+					NodeID:   ownerMember.ID,
+					Endpoint: ownerMember.GetReflectEndpoint(),
+				}),
+			},
+		})
+
+		return serverResponses
+	}
+
 	if !exists {
 		logger.Info("[%s] [JoinRoom] No room found with id: %s\n", client.PrivateToken, requestJoinRoom.RoomID)
 		serverResponses = append(serverResponses, DirectedServerMessage{
@@ -323,6 +363,7 @@ func JoinRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 				MessageDetails: nil,
 				Status:         ServerMessageStatusError,
 				ErrorMessage:   ServerErrorMessageNoRoom,
+				ErrorCode:      ServerErrorCodeNoRoom,
 			},
 		})
 
@@ -338,37 +379,42 @@ func JoinRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 				MessageDetails: nil,
 				Status:         ServerMessageStatusError,
 				ErrorMessage:   ServerErrorMessageFullRoom,
+				ErrorCode:      ServerErrorCodeFullRoom,
+				ErrorDetails:   marshalServerErrorDetails(ServerErrorDetailsFullRoom{MaxCapacity: DEFAULT_ROOM_SIZE}),
 			},
 		})
 
 		return serverResponses
 	}
 
+	roomDeltas := make([]RoomDelta, 0, 2)
+
 	if client.Type == ClientTypeHost {
-		room.Host = client
+		roomDeltas = append(roomDeltas, room.UpdateHost(client))
 	}
 
-	if client.Type == ClientTypeViewer {
+	if client.Type == ClientTypeViewer || client.Type == ClientTypeCoHost {
 		for _, possibleOldClient := range room.Viewers {
-			if client.PrivateToken == possibleOldClient.PrivateToken {
-				room.RemoveViewer(possibleOldClient)
+			if client.PrivateToken != possibleOldClient.PrivateToken {
+				continue
+			}
+
+			if roomDelta, removed := room.RemoveViewer(possibleOldClient); removed {
+				roomDeltas = append(roomDeltas, roomDelta)
 			}
 		}
 	}
 
-	if client.Type == ClientTypeInnactive || client.Type == ClientTypeViewer {
-		client.Type = ClientTypeViewer
-		room.AddViewer(client)
+	if client.Type == ClientTypeInnactive || client.Type == ClientTypeViewer || client.Type == ClientTypeCoHost {
+		client.Type = room.getViewerType(client)
+		roomDeltas = append(roomDeltas, room.AddViewer(client))
 	}
 
 	client.UpdateClientDetails(Client{Type: client.Type, RoomID: requestJoinRoom.RoomID})
 
 	filteredRoom := room.GetFilteredRoom()
 
-	serverMessageJoinRoom, serverMessageJoinRoomMarshalError := json.Marshal(struct {
-		Room RoomRecord `json:"room"`
-		Type ClientType `json:"clientType"`
-	}{
+	serverMessageJoinRoom, serverMessageJoinRoomMarshalError := json.Marshal(ServerResponseJoinRoom{
 		Room: filteredRoom,
 		Type: client.Type,
 	})
@@ -382,6 +428,7 @@ func JoinRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 				MessageDetails: nil,
 				Status:         ServerMessageStatusError,
 				ErrorMessage:   ServerErrorMessageInternalServerError,
+				ErrorCode:      ServerErrorCodeInternalServerError,
 			},
 		})
 
@@ -415,7 +462,9 @@ func JoinRoomHandler(client *Client, manager *Manager, clientRequest string) []D
 		}
 	}
 
-	serverResponses = append(serverResponses, updateRoomClientsWithLatestChanges(*room)...)
+	for _, roomDelta := range roomDeltas {
+		serverResponses = append(serverResponses, updateRoomClientsWithLatestChanges(*room, roomDelta)...)
+	}
 
 	return serverResponses
 }
@@ -424,25 +473,96 @@ func DisconnectRoomHandler(client *Client, manager *Manager, clientRequest strin
 	return manager.disconnectClientFromRoom(client)
 }
 
-type RoomReflection struct {
-	ID          string  `json:"id"`
-	State       int     `json:"state"`
-	CurrentTime float32 `json:"time"`
+func ResyncRoomHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
+	var requestResyncRoom ClientRequestResyncRoom
+	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &requestResyncRoom)
+	if errorParsingRequest != nil {
+		logger.Warn("[%s] [ResyncRoom] Client sent bad json object: %s\n", client.PrivateToken, errorParsingRequest)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageTypeResyncRoom,
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageBadJson,
+					ErrorCode:      ServerErrorCodeBadJson,
+				},
+			},
+		}
+	}
+
+	room, exists := manager.GetRegisteredRoom(client.RoomID)
+	if !exists {
+		logger.Info("[%s] [ResyncRoom] No room found with id: %s\n", client.PrivateToken, client.RoomID)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageTypeResyncRoom,
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageNoRoom,
+					ErrorCode:      ServerErrorCodeNoRoom,
+				},
+			},
+		}
+	}
+
+	var responseResyncRoom ServerResponseResyncRoom
+	roomDeltas, hasDeltas := room.GetDeltasSince(requestResyncRoom.Revision)
+	if hasDeltas {
+		responseResyncRoom.Deltas = roomDeltas
+	} else {
+		logger.Info("[%s] [ResyncRoom] Revision %d is no longer available, sending snapshot of revision %d\n", client.PrivateToken, requestResyncRoom.Revision, room.Revision)
+		filteredRoom := room.GetFilteredRoom()
+		responseResyncRoom.Room = &filteredRoom
+	}
+
+	serverMessageResyncRoom, serverMessageMarshalError := json.Marshal(responseResyncRoom)
+	if serverMessageMarshalError != nil {
+		logger.Error("[%s] [ResyncRoom] Failed to marshal resync response: %s\n", client.PrivateToken, serverMessageMarshalError)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageTypeResyncRoom,
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageInternalServerError,
+					ErrorCode:      ServerErrorCodeInternalServerError,
+				},
+			},
+		}
+	}
+
+	return []DirectedServerMessage{
+		{
+			token: client.PrivateToken,
+			message: ServerMessage{
+				MessageType:    ServerMessageTypeResyncRoom,
+				MessageDetails: serverMessageResyncRoom,
+				Status:         ServerMessageStatusOk,
+				ErrorMessage:   "",
+			},
+		},
+	}
 }
 
-func ReflectRoomHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
-	var reflection RoomReflection
-	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &reflection)
+func UpdateRoomSettingsHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
+	var requestRoomSettings RoomSettings
+	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &requestRoomSettings)
 	if errorParsingRequest != nil {
-		logger.Error("[%s] [ReflectRoom] Client sent bad json object: %s\n", client.IPAddress, errorParsingRequest)
+		logger.Warn("[%s] [UpdateRoomSettings] Client sent bad json object: %s\n", client.PrivateToken, errorParsingRequest)
 		return []DirectedServerMessage{
 			{
 				token: client.PrivateToken,
 				message: ServerMessage{
-					MessageType:    ServerMessageTypeReflectRoom,
+					MessageType:    ServerMessageTypeUpdateRoomSettings,
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
 					ErrorMessage:   ServerErrorMessageBadJson,
+					ErrorCode:      ServerErrorCodeBadJson,
 				},
 			},
 		}
@@ -450,89 +570,129 @@ func ReflectRoomHandler(client *Client, manager *Manager, clientRequest string)
 
 	room, exists := manager.GetRegisteredRoom(client.RoomID)
 	if !exists {
-		logger.Info("[%s] [ReflectRoom] No room found with id: %s\n", client.IPAddress, client.RoomID)
+		logger.Info("[%s] [UpdateRoomSettings] No room found with id: %s\n", client.PrivateToken, client.RoomID)
 		return []DirectedServerMessage{
 			{
 				token: client.PrivateToken,
 				message: ServerMessage{
-					MessageType:    ServerMessageTypeReflectRoom,
+					MessageType:    ServerMessageTypeUpdateRoomSettings,
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
 					ErrorMessage:   ServerErrorMessageNoRoom,
+					ErrorCode:      ServerErrorCodeNoRoom,
 				},
 			},
 		}
 	}
 
-	if client.Type != ClientTypeHost {
-		logger.Info("[%s] [ReflectRoom] Client isn't a host\n", client.IPAddress)
+	if !room.hasPermission(client, RoomPermissionChangeSettings) {
+		logger.Info("[%s] [UpdateRoomSettings] Client isn't allowed to change the settings\n", client.PrivateToken)
+		return newMissingPermissionMessages(client, ServerMessageTypeUpdateRoomSettings, RoomPermissionChangeSettings)
+	}
+
+	// Settings left out of the request keep their current value, so a client can change them one at a time.
+	// The co-hosts are cloned since unmarshalling reuses the slice they're in.
+	requestRoomSettings = room.Settings
+	requestRoomSettings.CoHosts = slices.Clone(room.Settings.CoHosts)
+	json.Unmarshal([]byte(clientRequest), &requestRoomSettings)
+
+	if errorMessage, errorCode, isValid := validateRoomSettings(&requestRoomSettings); !isValid {
+		logger.Warn("[%s] [UpdateRoomSettings] Expected room name to be between %d and %d chars but got %q %d\n", client.PrivateToken, MIN_ROOM_NAME_LENGTH, MAX_ROOM_NAME_LENGTH, requestRoomSettings.Name, len(requestRoomSettings.Name))
 		return []DirectedServerMessage{
 			{
 				token: client.PrivateToken,
 				message: ServerMessage{
-					MessageType:    ServerMessageTypeReflectRoom,
+					MessageType:    ServerMessageTypeUpdateRoomSettings,
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
-					ErrorMessage:   ServerErrorMessageClientNotHost,
+					ErrorMessage:   errorMessage,
+					ErrorCode:      errorCode,
+					ErrorDetails: marshalServerErrorDetails(ServerErrorDetailsRoomName{
+						MinLength: MIN_ROOM_NAME_LENGTH,
+						MaxLength: MAX_ROOM_NAME_LENGTH,
+					}),
 				},
 			},
 		}
 	}
 
-	serverMessageReflection, serverMessageMarshalError := json.Marshal(reflection)
-	if serverMessageMarshalError != nil {
-		logger.Error("[%s] [ReflectRoom] Bad json: %s\n", client.IPAddress, client.RoomID)
+	isRescheduled := requestRoomSettings.ScheduledStart != room.Settings.ScheduledStart
+	if requestRoomSettings.ScheduledStart != 0 && isRescheduled && !validateScheduledStart(requestRoomSettings.ScheduledStart, manager.clock.Now()) {
+		logger.Warn("[%s] [UpdateRoomSettings] Expected the scheduled start to be within %s but got %d\n", client.PrivateToken, MaxScheduleAhead, requestRoomSettings.ScheduledStart)
 		return []DirectedServerMessage{
 			{
 				token: client.PrivateToken,
 				message: ServerMessage{
-					MessageType:    ServerMessageTypeReflectRoom,
+					MessageType:    ServerMessageTypeUpdateRoomSettings,
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
-					ErrorMessage:   ServerErrorMessageInternalServerError,
+					ErrorMessage:   ServerErrorMessageInvalidSchedule,
+					ErrorCode:      ServerErrorCodeInvalidSchedule,
+					ErrorDetails: marshalServerErrorDetails(ServerErrorDetailsInvalidSchedule{
+						MaxSecondsAhead: int(MaxScheduleAhead.Seconds()),
+					}),
 				},
 			},
 		}
 	}
 
-	serverMessages := make([]DirectedServerMessage, 0, len(room.Viewers))
+	roleDeltas := room.assignSettingsCoHosts(room.Settings.CoHosts, requestRoomSettings.CoHosts)
+	requestRoomSettings.CoHosts = room.getSettingsCoHosts()
+	roomDelta := room.UpdateSettings(requestRoomSettings)
+	logger.Info("[%s] [UpdateRoomSettings] Updated settings of room %s: %+v\n", client.PrivateToken, room.RoomID, requestRoomSettings)
 
-	for _, viewer := range room.Viewers {
-		serverMessages = append(serverMessages, DirectedServerMessage{
-			token: viewer.PrivateToken,
-			message: ServerMessage{
-				MessageType:    ServerMessageTypeReflectRoom,
-				MessageDetails: serverMessageReflection,
-				Status:         ServerMessageStatusOk,
-				ErrorMessage:   "",
-			},
-		})
+	manager.scheduleStart(room)
+
+	serverMessages := make([]DirectedServerMessage, 0, len(room.Viewers)+1)
+	for _, roleDelta := range roleDeltas {
+		serverMessages = append(serverMessages, updateRoomClientsWithLatestChanges(*room, roleDelta)...)
+	}
+	serverMessages = append(serverMessages, updateRoomClientsWithLatestChanges(*room, roomDelta)...)
+	if !requestRoomSettings.WaitForViewers {
+		serverMessages = append(serverMessages, manager.releaseHeldStart(room)...)
 	}
 
 	return serverMessages
 }
 
-type VideoDetails struct {
-	Title           string `json:"title"`
-	Author          string `json:"author"`
-	AuthorImage     string `json:"authorImage"`
-	SubscriberCount string `json:"subscriberCount"`
-	LikeCount       string `json:"likeCount"`
+// Trims the room settings and checks that they're within the allowed limits.
+func validateRoomSettings(settings *RoomSettings) (ServerErrorMessage, ServerErrorCode, bool) {
+	settings.Name = strings.Trim(settings.Name, " ")
+
+	if len(settings.Name) < MIN_ROOM_NAME_LENGTH {
+		return ServerErrorMessageShortRoomName, ServerErrorCodeShortRoomName, false
+	}
+
+	if len(settings.Name) > MAX_ROOM_NAME_LENGTH {
+		return ServerErrorMessageLongRoomName, ServerErrorCodeLongRoomName, false
+	}
+
+	// Votes can't need more than every member nor last longer than the server allows
+	settings.VoteThreshold = min(max(settings.VoteThreshold, 0), 100)
+	settings.VoteDuration = min(max(settings.VoteDuration, 0), int(MaxVoteDuration.Seconds()))
+
+	// Unknown modes fall back to leaving the host in control
+	if !slices.Contains([]RoomControlMode{RoomControlModeHost, RoomControlModeCoHosts, RoomControlModeEveryone}, settings.ControlMode) {
+		settings.ControlMode = ""
+	}
+
+	return "", "", true
 }
 
-func ReflectDetailsHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
-	var videoDetails VideoDetails
-	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &videoDetails)
+func ReflectRoomHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
+	var reflection RoomReflection
+	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &reflection)
 	if errorParsingRequest != nil {
-		logger.Error("[%s] [ReflectVideoDetails] Client sent bad json object: %s\n", client.PrivateToken, errorParsingRequest)
+		logger.Error("[%s] [ReflectRoom] Client sent bad json object: %s\n", client.IPAddress, errorParsingRequest)
 		return []DirectedServerMessage{
 			{
 				token: client.PrivateToken,
 				message: ServerMessage{
-					MessageType:    ServerMessageTypeReflectVideoDetails,
+					MessageType:    ServerMessageTypeReflectRoom,
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
 					ErrorMessage:   ServerErrorMessageBadJson,
+					ErrorCode:      ServerErrorCodeBadJson,
 				},
 			},
 		}
@@ -540,35 +700,90 @@ func ReflectDetailsHandler(client *Client, manager *Manager, clientRequest strin
 
 	room, exists := manager.GetRegisteredRoom(client.RoomID)
 	if !exists {
-		logger.Info("[%s] [ReflectVideoDetails] No room found with id: %s\n", client.PrivateToken, client.RoomID)
+		logger.Info("[%s] [ReflectRoom] No room found with id: %s\n", client.IPAddress, client.RoomID)
 		return []DirectedServerMessage{
 			{
 				token: client.PrivateToken,
 				message: ServerMessage{
-					MessageType:    ServerMessageTypeReflectVideoDetails,
+					MessageType:    ServerMessageTypeReflectRoom,
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
 					ErrorMessage:   ServerErrorMessageNoRoom,
+					ErrorCode:      ServerErrorCodeNoRoom,
 				},
 			},
 		}
 	}
 
+	// Co-hosts control the playback through intents, which resolve their conflicts with the other members
 	if client.Type != ClientTypeHost {
-		logger.Info("[%s] [ReflectVideoDetails] Client isn't a host\n", client.PrivateToken)
+		logger.Info("[%s] [ReflectRoom] Client isn't a host\n", client.IPAddress)
 		return []DirectedServerMessage{
 			{
 				token: client.PrivateToken,
 				message: ServerMessage{
-					MessageType:    ServerMessageTypeReflectVideoDetails,
+					MessageType:    ServerMessageTypeReflectRoom,
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
 					ErrorMessage:   ServerErrorMessageClientNotHost,
+					ErrorCode:      ServerErrorCodeClientNotHost,
+				},
+			},
+		}
+	}
+
+	now := manager.clock.Now()
+	room.latestReflectionAt = now
+	if room.isStaleHostReflection(reflection, now) {
+		logger.Info("[%s] [ReflectRoom] Ignoring the reflection, the host's player hasn't followed the intent of %s yet\n", client.IPAddress, room.controlledBy)
+		return []DirectedServerMessage{}
+	}
+
+	return manager.reflectPlayback(room, reflection, client)
+}
+
+func ReflectDetailsHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
+	var videoDetails VideoDetails
+	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &videoDetails)
+	if errorParsingRequest != nil {
+		logger.Error("[%s] [ReflectVideoDetails] Client sent bad json object: %s\n", client.PrivateToken, errorParsingRequest)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageTypeReflectVideoDetails,
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageBadJson,
+					ErrorCode:      ServerErrorCodeBadJson,
+				},
+			},
+		}
+	}
+
+	room, exists := manager.GetRegisteredRoom(client.RoomID)
+	if !exists {
+		logger.Info("[%s] [ReflectVideoDetails] No room found with id: %s\n", client.PrivateToken, client.RoomID)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageTypeReflectVideoDetails,
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageNoRoom,
+					ErrorCode:      ServerErrorCodeNoRoom,
 				},
 			},
 		}
 	}
 
+	// The details don't change the playback, so co-hosts controlling it may describe the video as well
+	if !room.hasPermission(client, RoomPermissionControlPlayback) {
+		logger.Info("[%s] [ReflectVideoDetails] Client isn't allowed to control the playback\n", client.PrivateToken)
+		return newMissingPermissionMessages(client, ServerMessageTypeReflectVideoDetails, RoomPermissionControlPlayback)
+	}
+
 	if videoDetails.Title == "" || videoDetails.Author == "" || videoDetails.AuthorImage == "" ||
 		videoDetails.SubscriberCount == "" || videoDetails.LikeCount == "" {
 
@@ -588,15 +803,21 @@ func ReflectDetailsHandler(client *Client, manager *Manager, clientRequest strin
 					MessageDetails: nil,
 					Status:         ServerMessageStatusError,
 					ErrorMessage:   ServerErrorMessageInternalServerError,
+					ErrorCode:      ServerErrorCodeInternalServerError,
 				},
 			},
 		}
 	}
 
-	serverMessages := make([]DirectedServerMessage, 0, len(room.Viewers))
-	for _, viewer := range room.Viewers {
+	members := append([]*Client{room.Host}, room.Viewers...)
+	serverMessages := make([]DirectedServerMessage, 0, len(members))
+	for _, member := range members {
+		if member.PrivateToken == client.PrivateToken {
+			continue
+		}
+
 		serverMessages = append(serverMessages, DirectedServerMessage{
-			token: viewer.PrivateToken,
+			token: member.PrivateToken,
 			message: ServerMessage{
 				MessageType:    ServerMessageTypeReflectVideoDetails,
 				MessageDetails: serverMessageRoomDetails,
@@ -609,12 +830,6 @@ func ReflectDetailsHandler(client *Client, manager *Manager, clientRequest strin
 	return serverMessages
 }
 
-type Timestamp int64
-
-type PingPong struct {
-	Timestamp Timestamp `json:"timestamp"`
-}
-
 func PingHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
 	serverMessages := make([]DirectedServerMessage, 0, 1)
 
@@ -630,6 +845,7 @@ func PingHandler(client *Client, manager *Manager, clientRequest string) []Direc
 				MessageDetails: nil,
 				Status:         ServerMessageStatusError,
 				ErrorMessage:   ServerErrorMessageBadJson,
+				ErrorCode:      ServerErrorCodeBadJson,
 			},
 		})
 
@@ -637,7 +853,7 @@ func PingHandler(client *Client, manager *Manager, clientRequest string) []Direc
 	}
 
 	pong := PingPong{
-		Timestamp: Timestamp(time.Now().UnixMilli()),
+		Timestamp: Timestamp(manager.clock.Now().UnixMilli()),
 	}
 
 	serverMessagePong, serverMessageMarshalError := json.Marshal(pong)
@@ -650,6 +866,7 @@ func PingHandler(client *Client, manager *Manager, clientRequest string) []Direc
 				MessageDetails: nil,
 				Status:         ServerMessageStatusError,
 				ErrorMessage:   ServerErrorMessageInternalServerError,
+				ErrorCode:      ServerErrorCodeInternalServerError,
 			},
 		})
 
@@ -668,11 +885,11 @@ func PingHandler(client *Client, manager *Manager, clientRequest string) []Direc
 	return serverMessages
 }
 
-func updateRoomClientsWithLatestChanges(room Room) []DirectedServerMessage {
+// Sends a change made to the room to every member of the room.
+func updateRoomClientsWithLatestChanges(room Room, roomDelta RoomDelta) []DirectedServerMessage {
 	serverMessages := make([]DirectedServerMessage, 0, len(room.Viewers)+1)
 
-	filteredRoom := room.GetFilteredRoom()
-	serverMessageUpdateRoom, serverMessageUpdateRoomMarshalError := json.Marshal(filteredRoom)
+	serverMessageUpdateRoom, serverMessageUpdateRoomMarshalError := json.Marshal(roomDelta)
 	if serverMessageUpdateRoomMarshalError != nil {
 		logger.Error("[UpdateRoom] Bad json: %s\n", serverMessageUpdateRoomMarshalError)
 	}
@@ -684,6 +901,7 @@ func updateRoomClientsWithLatestChanges(room Room) []DirectedServerMessage {
 			MessageDetails: nil,
 			Status:         ServerMessageStatusError,
 			ErrorMessage:   ServerErrorMessageInternalServerError,
+			ErrorCode:      ServerErrorCodeInternalServerError,
 		}
 	} else {
 		serverMessage = ServerMessage{
@@ -708,3 +926,15 @@ func updateRoomClientsWithLatestChanges(room Room) []DirectedServerMessage {
 
 	return serverMessages
 }
+
+// Marshals the structured details of an error response.
+// Details are optional so a failure is logged and results in no details being sent.
+func marshalServerErrorDetails(details any) json.RawMessage {
+	serverErrorDetails, marshalError := json.Marshal(details)
+	if marshalError != nil {
+		logger.Error("Failed to marshal error details %+v: %s\n", details, marshalError)
+		return nil
+	}
+
+	return serverErrorDetails
+}
@@ -39,7 +39,7 @@ func TestAuthorizationHandler(t *testing.T) {
 			[]TokenExistence{
 				{privateToken: mockClientPrivateID, exists: false},
 			},
-			*mockManager,
+			mockManager,
 		)
 	})
 
@@ -102,7 +102,7 @@ func TestAuthorizationHandler(t *testing.T) {
 			[]TokenExistence{
 				{privateToken: mockClientPrivateID, exists: true},
 			},
-			*mockManager,
+			mockManager,
 		)
 	})
 
@@ -179,7 +179,7 @@ func TestAuthorizationHandler(t *testing.T) {
 				{privateToken: tempPrivateID, exists: false},
 				{privateToken: existingPrivateID, exists: true},
 			},
-			*mockManager,
+			mockManager,
 		)
 	})
 }
@@ -194,7 +194,7 @@ func TestHostRoomHandler(t *testing.T) {
 		mockConnectionManager.RegisterClientConnection(mockClientPrivateID, nil)
 		mockManager.RegisterClient(mockClient)
 
-		receivedServerMessages := HostRoomHandler(mockClient, mockManager, "")
+		receivedServerMessages := HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
 
 		response, _ := json.Marshal(RoomRecord{
 			RoomID:  "",
@@ -242,7 +242,7 @@ func TestHostRoomHandler(t *testing.T) {
 		mockConnectionManager.RegisterClientConnection(mockClientPrivateID, nil)
 		mockManager.RegisterClient(mockClient)
 
-		receivedServerMessages := HostRoomHandler(mockClient, mockManager, "")
+		receivedServerMessages := HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
 
 		response, _ := json.Marshal(RoomRecord{
 			RoomID:  "",
@@ -307,8 +307,8 @@ func TestHostRoomHandler(t *testing.T) {
 		mockConnectionManager.RegisterClientConnection(mockClientPrivateID, nil)
 		mockManager.RegisterClient(mockClient)
 
-		receivedServerMessagesFirst := HostRoomHandler(mockClient, mockManager, "")
-		receivedServerMessagesSecond := HostRoomHandler(mockClient, mockManager, "")
+		receivedServerMessagesFirst := HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
+		receivedServerMessagesSecond := HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
 
 		response, _ := json.Marshal(RoomRecord{
 			RoomID:  "",
@@ -394,6 +394,51 @@ func TestHostRoomHandler(t *testing.T) {
 			t.Errorf("Second created room with id %q should exist but doesn't", roomRecordSecond.RoomID)
 		}
 	})
+
+	t.Run("client hosting a room while in maintenance mode", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClientPrivateID := mockManager.GenerateToken()
+		mockClient := NewClient(mockClientPrivateID)
+
+		mockConnectionManager.RegisterClientConnection(mockClientPrivateID, nil)
+		mockManager.RegisterClient(mockClient)
+
+		existingRoomMessages := HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
+		var existingRoom RoomRecord
+		json.Unmarshal(existingRoomMessages[0].message.MessageDetails, &existingRoom)
+
+		mockManager.SetMaintenanceMode(true, "")
+		receivedServerMessages := HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
+
+		assertExpectedMessageCount(t, 1, receivedServerMessages)
+		assertExpectedMessages(
+			t,
+			[]DirectedServerMessage{
+				{
+					token: mockClientPrivateID,
+					message: ServerMessage{
+						MessageType:  ServerMessageTypeHostRoom,
+						Status:       ServerMessageStatusError,
+						ErrorMessage: ServerErrorMessageMaintenance,
+						ErrorCode:    ServerErrorCodeMaintenance,
+					},
+				},
+			},
+			receivedServerMessages,
+			func(a, b json.RawMessage) bool { return true },
+		)
+
+		if _, exists := mockManager.GetRegisteredRoom(existingRoom.RoomID); !exists || len(mockManager.activeRooms) != 1 {
+			t.Errorf("Expected only the existing room %q to be kept but found %d rooms\n", existingRoom.RoomID, len(mockManager.activeRooms))
+		}
+
+		mockManager.SetMaintenanceMode(false, "")
+		receivedServerMessages = HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
+		if receivedServerMessages[len(receivedServerMessages)-1].message.Status != ServerMessageStatusOk {
+			t.Errorf("Expected hosting to work after leaving maintenance mode but got %+v\n", receivedServerMessages)
+		}
+	})
 }
 
 func TestUpdateRoomClientsWithLatestChange(t *testing.T) {
@@ -404,14 +449,15 @@ func TestUpdateRoomClientsWithLatestChange(t *testing.T) {
 		hostClient := NewClient(mockManager.GenerateToken())
 
 		roomID := mockManager.GenerateUniqueRoomID()
-		testRoom, _ := NewRoom(roomID, hostClient, RoomSettings{Name: "Test"})
+		testRoom, _ := NewRoom(roomID, hostClient, RoomSettings{Name: "Test"}, mockManager.clock.Now())
 
-		receivedChanges := updateRoomClientsWithLatestChanges(*testRoom)
+		roomDelta := testRoom.UpdateSettings(RoomSettings{Name: "Renamed"})
+		receivedChanges := updateRoomClientsWithLatestChanges(*testRoom, roomDelta)
 
-		successfulUpdate := RoomRecord{
-			RoomID:  roomID,
-			Host:    hostClient.GetFilteredClient(),
-			Viewers: []ClientRecord{},
+		successfulUpdate := RoomDelta{
+			Revision: 1,
+			Type:     RoomDeltaTypeSettingsChanged,
+			Settings: &RoomSettings{Name: "Renamed"},
 		}
 
 		successfulUpdateRawMessage, _ := json.Marshal(successfulUpdate)
@@ -432,8 +478,8 @@ func TestUpdateRoomClientsWithLatestChange(t *testing.T) {
 			},
 			receivedChanges,
 			func(a json.RawMessage, b json.RawMessage) bool {
-				var aRes RoomRecord
-				var bRes RoomRecord
+				var aRes RoomDelta
+				var bRes RoomDelta
 
 				json.Unmarshal(a, &aRes)
 				json.Unmarshal(b, &bRes)
@@ -452,20 +498,18 @@ func TestUpdateRoomClientsWithLatestChange(t *testing.T) {
 		viewer2Client := NewClient(mockManager.GenerateToken())
 
 		roomID := mockManager.GenerateUniqueRoomID()
-		testRoom, _ := NewRoom(roomID, hostClient, RoomSettings{Name: "Test"})
+		testRoom, _ := NewRoom(roomID, hostClient, RoomSettings{Name: "Test"}, mockManager.clock.Now())
 
-		testRoom.Viewers = append(testRoom.Viewers, viewer1Client)
-		testRoom.Viewers = append(testRoom.Viewers, viewer2Client)
+		testRoom.AddViewer(viewer1Client)
+		roomDelta := testRoom.AddViewer(viewer2Client)
 
-		receivedChanges := updateRoomClientsWithLatestChanges(*testRoom)
+		receivedChanges := updateRoomClientsWithLatestChanges(*testRoom, roomDelta)
 
-		successfulUpdate := RoomRecord{
-			RoomID: roomID,
-			Host:   hostClient.GetFilteredClient(),
-			Viewers: []ClientRecord{
-				viewer1Client.GetFilteredClient(),
-				viewer2Client.GetFilteredClient(),
-			},
+		viewer2Record := viewer2Client.GetFilteredClient()
+		successfulUpdate := RoomDelta{
+			Revision: 2,
+			Type:     RoomDeltaTypeViewerJoined,
+			Client:   &viewer2Record,
 		}
 
 		successfulUpdateRawMessage, _ := json.Marshal(successfulUpdate)
@@ -504,8 +548,8 @@ func TestUpdateRoomClientsWithLatestChange(t *testing.T) {
 			},
 			receivedChanges,
 			func(a json.RawMessage, b json.RawMessage) bool {
-				var aRes RoomRecord
-				var bRes RoomRecord
+				var aRes RoomDelta
+				var bRes RoomDelta
 
 				json.Unmarshal(a, &aRes)
 				json.Unmarshal(b, &bRes)
@@ -522,7 +566,7 @@ func TestJoinRoomHandler(t *testing.T) {
 		mockManager := NewManager(serverVersion, mockConnectionManager)
 
 		mockHost := NewClient(mockManager.GenerateToken())
-		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"})
+		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"}, mockManager.clock.Now())
 		mockManager.RegisterRoom(mockRoom)
 
 		mockViewer := NewClient(mockManager.GenerateToken())
@@ -587,7 +631,7 @@ func TestJoinRoomHandler(t *testing.T) {
 		mockManager := NewManager(serverVersion, mockConnectionManager)
 
 		mockHost := NewClient(mockManager.GenerateToken())
-		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"})
+		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"}, mockManager.clock.Now())
 		mockManager.RegisterRoom(mockRoom)
 		mockRoom.VideoDetails = VideoDetails{
 			Title:           "Title",
@@ -705,7 +749,7 @@ func TestJoinRoomHandler(t *testing.T) {
 		mockManager := NewManager(serverVersion, mockConnectionManager)
 
 		mockHost := NewClient(mockManager.GenerateToken())
-		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"})
+		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"}, mockManager.clock.Now())
 		for i := 0; i < 10; i++ {
 			mockRoom.Viewers = append(mockRoom.Viewers, mockHost)
 		}
@@ -770,7 +814,7 @@ func TestDisconnectRoomHandler(t *testing.T) {
 		mockManager := NewManager(serverVersion, mockConnectionManager)
 
 		mockHost := NewClient(mockManager.GenerateToken())
-		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"})
+		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"}, mockManager.clock.Now())
 		mockManager.RegisterRoom(mockRoom)
 
 		mockViewer := NewClient(mockManager.GenerateToken())
@@ -832,7 +876,7 @@ func TestDisconnectRoomHandler(t *testing.T) {
 		mockManager := NewManager(serverVersion, mockConnectionManager)
 
 		mockHost := NewClient(mockManager.GenerateToken())
-		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"})
+		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"}, mockManager.clock.Now())
 		mockManager.RegisterRoom(mockRoom)
 
 		mockHost.RoomID = mockRoom.RoomID
@@ -874,7 +918,7 @@ func TestDisconnectRoomHandler(t *testing.T) {
 		mockManager := NewManager(serverVersion, mockConnectionManager)
 
 		mockHost := NewClient(mockManager.GenerateToken())
-		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"})
+		mockRoom, _ := NewRoom(mockManager.GenerateUniqueRoomID(), mockHost, RoomSettings{Name: "Test"}, mockManager.clock.Now())
 		mockManager.RegisterRoom(mockRoom)
 
 		mockViewer := NewClient(mockManager.GenerateToken())
@@ -949,7 +993,7 @@ func TestReflectRoomHandler(t *testing.T) {
 		mockManager := NewManager(serverVersion, mockConnectionManager)
 		mockClient := NewClient(mockManager.GenerateToken())
 
-		HostRoomHandler(mockClient, mockManager, "")
+		HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
 
 		roomReflection, _ := json.Marshal(RoomReflection{
 			ID:          "123",
@@ -966,7 +1010,7 @@ func TestReflectRoomHandler(t *testing.T) {
 		mockClient := NewClient(mockManager.GenerateToken())
 		mockViewer := NewClient(mockManager.GenerateToken())
 
-		HostRoomHandler(mockClient, mockManager, "")
+		HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
 
 		requestJoin, _ := json.Marshal(ClientRequestJoinRoom{
 			RoomID: mockClient.RoomID,
@@ -1007,7 +1051,7 @@ func TestReflectRoomHandler(t *testing.T) {
 		mockClient := NewClient(mockManager.GenerateToken())
 		mockViewer := NewClient(mockManager.GenerateToken())
 
-		HostRoomHandler(mockClient, mockManager, "")
+		HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
 
 		requestJoin, _ := json.Marshal(ClientRequestJoinRoom{
 			RoomID: mockClient.RoomID,
@@ -1081,7 +1125,7 @@ func TestReflectRoomDetailsHandler(t *testing.T) {
 		mockManager := NewManager(serverVersion, mockConnectionManager)
 		mockClient := NewClient(mockManager.GenerateToken())
 
-		HostRoomHandler(mockClient, mockManager, "")
+		HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
 
 		requestRoomReflection, _ := json.Marshal(VideoDetails{
 			Title:           "Title",
@@ -1100,7 +1144,7 @@ func TestReflectRoomDetailsHandler(t *testing.T) {
 		mockClient := NewClient(mockManager.GenerateToken())
 		mockViewer := NewClient(mockManager.GenerateToken())
 
-		HostRoomHandler(mockClient, mockManager, "")
+		HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
 
 		requestJoin, _ := json.Marshal(ClientRequestJoinRoom{
 			RoomID: mockClient.RoomID,
@@ -1142,7 +1186,7 @@ func TestReflectRoomDetailsHandler(t *testing.T) {
 		mockClient := NewClient(mockManager.GenerateToken())
 		mockViewer := NewClient(mockManager.GenerateToken())
 
-		HostRoomHandler(mockClient, mockManager, "")
+		HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
 
 		requestJoin, _ := json.Marshal(ClientRequestJoinRoom{
 			RoomID: mockClient.RoomID,
@@ -1213,6 +1257,236 @@ func TestReflectRoomDetailsHandler(t *testing.T) {
 	})
 }
 
+func TestResyncRoomHandler(t *testing.T) {
+	t.Run("viewer resyncing from a revision that's still in the history", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockViewer := NewClient(mockManager.GenerateToken())
+		mockLateViewer := NewClient(mockManager.GenerateToken())
+
+		HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
+
+		requestJoin, _ := json.Marshal(ClientRequestJoinRoom{
+			RoomID: mockClient.RoomID,
+		})
+		JoinRoomHandler(mockViewer, mockManager, string(requestJoin))
+		JoinRoomHandler(mockLateViewer, mockManager, string(requestJoin))
+		UpdateRoomSettingsHandler(mockClient, mockManager, `{"name":"Renamed"}`)
+
+		requestResync, _ := json.Marshal(ClientRequestResyncRoom{Revision: 1})
+		receivedResponse := ResyncRoomHandler(mockViewer, mockManager, string(requestResync))
+
+		assertExpectedMessageCount(t, 1, receivedResponse)
+		assertExpectedMessages(
+			t,
+			[]DirectedServerMessage{
+				{
+					token: mockViewer.PrivateToken,
+					message: ServerMessage{
+						MessageType:  ServerMessageTypeResyncRoom,
+						Status:       ServerMessageStatusOk,
+						ErrorMessage: "",
+					},
+				},
+			},
+			receivedResponse,
+			func(a, b json.RawMessage) bool { return true },
+		)
+
+		var responseResync ServerResponseResyncRoom
+		json.Unmarshal(receivedResponse[0].message.MessageDetails, &responseResync)
+
+		if responseResync.Room != nil {
+			t.Errorf("Expected deltas but received a full snapshot\n")
+		}
+
+		expectedDeltaTypes := []RoomDeltaType{RoomDeltaTypeViewerJoined, RoomDeltaTypeSettingsChanged}
+		if len(responseResync.Deltas) != len(expectedDeltaTypes) {
+			t.Fatalf("Expected %d deltas but got %d\n", len(expectedDeltaTypes), len(responseResync.Deltas))
+		}
+
+		for index, roomDelta := range responseResync.Deltas {
+			if roomDelta.Type != expectedDeltaTypes[index] || roomDelta.Revision != RoomRevision(index+2) {
+				t.Errorf("Expected delta %q at revision %d but got %q at revision %d\n", expectedDeltaTypes[index], index+2, roomDelta.Type, roomDelta.Revision)
+			}
+		}
+	})
+
+	t.Run("viewer resyncing from a revision that's no longer in the history", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockViewer := NewClient(mockManager.GenerateToken())
+
+		HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
+
+		requestJoin, _ := json.Marshal(ClientRequestJoinRoom{
+			RoomID: mockClient.RoomID,
+		})
+		JoinRoomHandler(mockViewer, mockManager, string(requestJoin))
+
+		room, _ := mockManager.GetRegisteredRoom(mockClient.RoomID)
+		for range ROOM_DELTA_HISTORY_SIZE + 1 {
+			room.UpdateSettings(RoomSettings{Name: "Renamed"})
+		}
+
+		requestResync, _ := json.Marshal(ClientRequestResyncRoom{Revision: 1})
+		receivedResponse := ResyncRoomHandler(mockViewer, mockManager, string(requestResync))
+
+		assertExpectedMessageCount(t, 1, receivedResponse)
+
+		var responseResync ServerResponseResyncRoom
+		json.Unmarshal(receivedResponse[0].message.MessageDetails, &responseResync)
+
+		if responseResync.Room == nil {
+			t.Fatalf("Expected a full snapshot but received %d deltas\n", len(responseResync.Deltas))
+		}
+
+		if responseResync.Room.Revision != room.Revision || len(responseResync.Room.Viewers) != 1 {
+			t.Errorf("Snapshot doesn't match the room\nGot %+v\n", responseResync.Room)
+		}
+	})
+
+	t.Run("client resyncing outside of a room", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+
+		receivedResponse := ResyncRoomHandler(mockClient, mockManager, `{"revision":0}`)
+
+		assertExpectedMessageCount(t, 1, receivedResponse)
+		assertExpectedMessages(
+			t,
+			[]DirectedServerMessage{
+				{
+					token: mockClient.PrivateToken,
+					message: ServerMessage{
+						MessageType:  ServerMessageTypeResyncRoom,
+						Status:       ServerMessageStatusError,
+						ErrorMessage: ServerErrorMessageNoRoom,
+					},
+				},
+			},
+			receivedResponse,
+			func(a, b json.RawMessage) bool { return true },
+		)
+	})
+}
+
+func TestUpdateRoomSettingsHandler(t *testing.T) {
+	t.Run("host updating the room settings", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockViewer := NewClient(mockManager.GenerateToken())
+
+		HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
+
+		requestJoin, _ := json.Marshal(ClientRequestJoinRoom{
+			RoomID: mockClient.RoomID,
+		})
+		JoinRoomHandler(mockViewer, mockManager, string(requestJoin))
+
+		receivedResponse := UpdateRoomSettingsHandler(mockClient, mockManager, `{"name":"  Renamed  "}`)
+
+		expectedDelta, _ := json.Marshal(RoomDelta{
+			Revision: 2,
+			Type:     RoomDeltaTypeSettingsChanged,
+			Settings: &RoomSettings{Name: "Renamed"},
+		})
+
+		assertExpectedMessageCount(t, 2, receivedResponse)
+		assertExpectedMessages(
+			t,
+			[]DirectedServerMessage{
+				{
+					token: mockClient.PrivateToken,
+					message: ServerMessage{
+						MessageType:    ServerMessageTypeUpdateRoom,
+						MessageDetails: expectedDelta,
+						Status:         ServerMessageStatusOk,
+						ErrorMessage:   "",
+					},
+				},
+				{
+					token: mockViewer.PrivateToken,
+					message: ServerMessage{
+						MessageType:    ServerMessageTypeUpdateRoom,
+						MessageDetails: expectedDelta,
+						Status:         ServerMessageStatusOk,
+						ErrorMessage:   "",
+					},
+				},
+			},
+			receivedResponse,
+			func(a, b json.RawMessage) bool {
+				var aRes RoomDelta
+				var bRes RoomDelta
+
+				json.Unmarshal(a, &aRes)
+				json.Unmarshal(b, &bRes)
+
+				return reflect.DeepEqual(aRes, bRes)
+			},
+		)
+	})
+
+	t.Run("host updating only some of the room settings", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+
+		HostRoomHandler(mockClient, mockManager, `{"name":"Test","waitForViewers":true,"controlMode":"EVERYONE","coHosts":["Alice"],"voteThreshold":75,"voteDuration":60}`)
+		room, _ := mockManager.GetRegisteredRoom(mockClient.RoomID)
+
+		UpdateRoomSettingsHandler(mockClient, mockManager, `{"name":"Renamed"}`)
+		expectedSettings := RoomSettings{Name: "Renamed", WaitForViewers: true, ControlMode: RoomControlModeEveryone, CoHosts: []Token{"Alice"}, VoteThreshold: 75, VoteDuration: 60}
+		if !reflect.DeepEqual(room.Settings, expectedSettings) {
+			t.Errorf("Expected a name only update to keep the other settings %+v but got %+v\n", expectedSettings, room.Settings)
+		}
+
+		UpdateRoomSettingsHandler(mockClient, mockManager, `{"waitForViewers":false,"voteThreshold":0}`)
+		expectedSettings = RoomSettings{Name: "Renamed", ControlMode: RoomControlModeEveryone, CoHosts: []Token{"Alice"}, VoteDuration: 60}
+		if !reflect.DeepEqual(room.Settings, expectedSettings) {
+			t.Errorf("Expected the settings sent to be cleared %+v but got %+v\n", expectedSettings, room.Settings)
+		}
+	})
+
+	t.Run("viewer updating the room settings", func(t *testing.T) {
+		mockConnectionManager := NewGorillaConnectionManager()
+		mockManager := NewManager(serverVersion, mockConnectionManager)
+		mockClient := NewClient(mockManager.GenerateToken())
+		mockViewer := NewClient(mockManager.GenerateToken())
+
+		HostRoomHandler(mockClient, mockManager, `{"name":"Test"}`)
+
+		requestJoin, _ := json.Marshal(ClientRequestJoinRoom{
+			RoomID: mockClient.RoomID,
+		})
+		JoinRoomHandler(mockViewer, mockManager, string(requestJoin))
+
+		receivedResponse := UpdateRoomSettingsHandler(mockViewer, mockManager, `{"name":"Renamed"}`)
+
+		assertExpectedMessageCount(t, 1, receivedResponse)
+		assertExpectedMessages(
+			t,
+			[]DirectedServerMessage{
+				{
+					token: mockViewer.PrivateToken,
+					message: ServerMessage{
+						MessageType:  ServerMessageTypeUpdateRoomSettings,
+						Status:       ServerMessageStatusError,
+						ErrorMessage: ServerErrorMessageClientNotHost,
+					},
+				},
+			},
+			receivedResponse,
+			func(a, b json.RawMessage) bool { return true },
+		)
+	})
+}
+
 func assertExpectedMessageCount(t *testing.T, expected int, received []DirectedServerMessage) {
 	t.Helper()
 
@@ -1262,7 +1536,7 @@ type TokenExistence struct {
 	exists       bool
 }
 
-func assertManagerState(t *testing.T, tokenStates []TokenExistence, manager Manager) {
+func assertManagerState(t *testing.T, tokenStates []TokenExistence, manager *Manager) {
 	t.Helper()
 
 	for _, tokenState := range tokenStates {
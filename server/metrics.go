@@ -0,0 +1,75 @@
+package main
+
+import (
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+)
+
+const EndpointDownloadMetrics = "/metrics/downloads"
+
+type downloadKey struct {
+	browser Browser
+	version string
+}
+
+// DownloadCount is the number of complete downloads of a release.
+type DownloadCount struct {
+	Browser Browser `json:"browser"`
+	Version string  `json:"version"`
+	Count   uint64  `json:"count"`
+}
+
+// DownloadCounter counts the downloads of every release since the server started.
+type DownloadCounter struct {
+	mutex  sync.Mutex
+	counts map[downloadKey]uint64
+}
+
+func NewDownloadCounter() *DownloadCounter {
+	return &DownloadCounter{counts: make(map[downloadKey]uint64)}
+}
+
+func (counter *DownloadCounter) Increment(browser Browser, version string) {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	counter.counts[downloadKey{browser: browser, version: version}]++
+}
+
+func (counter *DownloadCounter) GetCount(browser Browser, version string) uint64 {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	return counter.counts[downloadKey{browser: browser, version: version}]
+}
+
+// GetCounts returns the count of every downloaded release, grouped by browser with the newest versions first.
+func (counter *DownloadCounter) GetCounts() []DownloadCount {
+	counter.mutex.Lock()
+	defer counter.mutex.Unlock()
+
+	counts := make([]DownloadCount, 0, len(counter.counts))
+	for key, count := range counter.counts {
+		counts = append(counts, DownloadCount{Browser: key.browser, Version: key.version, Count: count})
+	}
+
+	slices.SortFunc(counts, func(a, b DownloadCount) int {
+		if a.Browser != b.Browser {
+			return strings.Compare(string(a.Browser), string(b.Browser))
+		}
+
+		comparison, _ := CompareVersions(b.Version, a.Version)
+		return comparison
+	})
+
+	return counts
+}
+
+// HandleDownloadMetrics responds with the download count of every release as JSON.
+// It's only served through the admin api, see [AdminAPI.RegisterDownloadMetrics].
+func (counter *DownloadCounter) HandleDownloadMetrics(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	writeJSONResponse(w, counter.GetCounts())
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+
+	"github.com/cowatch/logger"
+)
+
+var roomPermissions = []RoomPermission{
+	RoomPermissionControlPlayback,
+	RoomPermissionKick,
+	RoomPermissionChangeSettings,
+}
+
+// Handles the host making a viewer a co-host with some of their permissions, or a viewer again without any.
+func AssignPermissionsHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
+	var requestAssignPermissions ClientRequestAssignPermissions
+	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &requestAssignPermissions)
+	areKnownPermissions := !slices.ContainsFunc(requestAssignPermissions.Permissions, func(permission RoomPermission) bool {
+		return !slices.Contains(roomPermissions, permission)
+	})
+	if errorParsingRequest != nil || !areKnownPermissions {
+		logger.Warn("[%s] [AssignPermissions] Client sent bad json object: %v %q\n", client.PrivateToken, errorParsingRequest, requestAssignPermissions.Permissions)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeAssignPermissions),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageBadJson,
+					ErrorCode:      ServerErrorCodeBadJson,
+				},
+			},
+		}
+	}
+
+	room, exists := manager.GetRegisteredRoom(client.RoomID)
+	if !exists {
+		logger.Info("[%s] [AssignPermissions] No room found with id: %s\n", client.PrivateToken, client.RoomID)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeAssignPermissions),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageNoRoom,
+					ErrorCode:      ServerErrorCodeNoRoom,
+				},
+			},
+		}
+	}
+
+	// Co-hosts can't hand out permissions, or they could grant themselves every one of them
+	if client.Type != ClientTypeHost {
+		logger.Info("[%s] [AssignPermissions] Client isn't a host\n", client.PrivateToken)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeAssignPermissions),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageClientNotHost,
+					ErrorCode:      ServerErrorCodeClientNotHost,
+				},
+			},
+		}
+	}
+
+	viewer, isViewer := room.findViewer(requestAssignPermissions.PublicToken)
+	if !isViewer {
+		logger.Info("[%s] [AssignPermissions] No viewer found with public token: %s\n", client.PrivateToken, requestAssignPermissions.PublicToken)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeAssignPermissions),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageNoViewer,
+					ErrorCode:      ServerErrorCodeNoViewer,
+				},
+			},
+		}
+	}
+
+	if len(requestAssignPermissions.Permissions) == 0 {
+		delete(room.permissions, viewer.PublicToken)
+	} else {
+		permissions := slices.Clone(requestAssignPermissions.Permissions)
+		slices.Sort(permissions)
+		room.permissions[viewer.PublicToken] = slices.Compact(permissions)
+	}
+
+	viewer.Type = room.getViewerType(viewer)
+	logger.Info("[%s] [AssignPermissions] Viewer %s of room %s has the permissions: %v\n", client.PrivateToken, viewer.PublicToken, room.RoomID, room.permissions[viewer.PublicToken])
+
+	serverMessages := updateRoomClientsWithLatestChanges(*room, room.UpdateRole(viewer))
+	return append(serverMessages, room.syncSettingsCoHosts()...)
+}
+
+// Handles a member removing a viewer from the room, which needs the permission to kick.
+func KickViewerHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
+	var requestKickViewer ClientRequestKickViewer
+	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &requestKickViewer)
+	if errorParsingRequest != nil {
+		logger.Warn("[%s] [KickViewer] Client sent bad json object: %s\n", client.PrivateToken, errorParsingRequest)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeKickViewer),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageBadJson,
+					ErrorCode:      ServerErrorCodeBadJson,
+				},
+			},
+		}
+	}
+
+	room, exists := manager.GetRegisteredRoom(client.RoomID)
+	if !exists {
+		logger.Info("[%s] [KickViewer] No room found with id: %s\n", client.PrivateToken, client.RoomID)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeKickViewer),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageNoRoom,
+					ErrorCode:      ServerErrorCodeNoRoom,
+				},
+			},
+		}
+	}
+
+	if !room.hasPermission(client, RoomPermissionKick) {
+		logger.Info("[%s] [KickViewer] Client isn't allowed to kick viewers\n", client.PrivateToken)
+		return newMissingPermissionMessages(client, ServerMessageType(ClientMessageTypeKickViewer), RoomPermissionKick)
+	}
+
+	viewer, isViewer := room.findViewer(requestKickViewer.PublicToken)
+	if !isViewer {
+		logger.Info("[%s] [KickViewer] No viewer found with public token: %s\n", client.PrivateToken, requestKickViewer.PublicToken)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeKickViewer),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageNoViewer,
+					ErrorCode:      ServerErrorCodeNoViewer,
+				},
+			},
+		}
+	}
+
+	// A kicked co-host doesn't get their permissions back by joining again
+	delete(room.permissions, viewer.PublicToken)
+
+	logger.Info("[%s] [KickViewer] Kicking viewer %s from room %s\n", client.PrivateToken, viewer.PublicToken, room.RoomID)
+	serverMessages := manager.disconnectClientFromRoom(viewer)
+	return append(serverMessages, room.syncSettingsCoHosts()...)
+}
+
+// Checks whether a member may act with a permission in the room, the host has every permission.
+func (room *Room) hasPermission(client *Client, permission RoomPermission) bool {
+	switch client.Type {
+	case ClientTypeHost:
+		return true
+	case ClientTypeCoHost:
+		return slices.Contains(room.permissions[client.PublicToken], permission)
+	default:
+		return false
+	}
+}
+
+// Viewers are still told they aren't the host like before co-hosts, co-hosts which permission they miss.
+func newMissingPermissionMessages(client *Client, messageType ServerMessageType, permission RoomPermission) []DirectedServerMessage {
+	if client.Type != ClientTypeCoHost {
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    messageType,
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageClientNotHost,
+					ErrorCode:      ServerErrorCodeClientNotHost,
+				},
+			},
+		}
+	}
+
+	return []DirectedServerMessage{
+		{
+			token: client.PrivateToken,
+			message: ServerMessage{
+				MessageType:    messageType,
+				MessageDetails: nil,
+				Status:         ServerMessageStatusError,
+				ErrorMessage:   ServerErrorMessageMissingPermission,
+				ErrorCode:      ServerErrorCodeMissingPermission,
+				ErrorDetails:   marshalServerErrorDetails(ServerErrorDetailsMissingPermission{Permission: permission}),
+			},
+		},
+	}
+}
+
+// Maps the co-hosts listed in the settings, from before co-hosts had permissions, onto the permission to
+// control the playback. Viewers added to the list get it and the ones removed from it lose it.
+func (room *Room) assignSettingsCoHosts(previousCoHosts []Token, coHosts []Token) []RoomDelta {
+	roomDeltas := make([]RoomDelta, 0)
+	for _, publicToken := range previousCoHosts {
+		if !slices.Contains(coHosts, publicToken) {
+			roomDeltas = append(roomDeltas, room.setPlaybackControl(publicToken, false)...)
+		}
+	}
+
+	for _, publicToken := range coHosts {
+		if !slices.Contains(previousCoHosts, publicToken) && publicToken != room.Host.PublicToken {
+			roomDeltas = append(roomDeltas, room.setPlaybackControl(publicToken, true)...)
+		}
+	}
+
+	return roomDeltas
+}
+
+// The permissions are the only record of the co-hosts, the settings just list the ones allowed to control the playback.
+func (room *Room) getSettingsCoHosts() []Token {
+	var coHosts []Token
+	for publicToken, permissions := range room.permissions {
+		if slices.Contains(permissions, RoomPermissionControlPlayback) {
+			coHosts = append(coHosts, publicToken)
+		}
+	}
+
+	slices.Sort(coHosts)
+	return coHosts
+}
+
+// Lists the co-hosts in the settings again after their permissions changed, letting every member know if they did.
+func (room *Room) syncSettingsCoHosts() []DirectedServerMessage {
+	coHosts := room.getSettingsCoHosts()
+	if slices.Equal(coHosts, room.Settings.CoHosts) {
+		return nil
+	}
+
+	settings := room.Settings
+	settings.CoHosts = coHosts
+	return updateRoomClientsWithLatestChanges(*room, room.UpdateSettings(settings))
+}
+
+// Grants or takes the permission to control the playback, returning the role change of the viewer if they're in the room.
+func (room *Room) setPlaybackControl(publicToken Token, canControl bool) []RoomDelta {
+	permissions := slices.DeleteFunc(slices.Clone(room.permissions[publicToken]), func(permission RoomPermission) bool {
+		return permission == RoomPermissionControlPlayback
+	})
+	if canControl {
+		permissions = append(permissions, RoomPermissionControlPlayback)
+		slices.Sort(permissions)
+	}
+
+	if slices.Equal(permissions, room.permissions[publicToken]) {
+		return nil
+	}
+
+	if len(permissions) == 0 {
+		delete(room.permissions, publicToken)
+	} else {
+		room.permissions[publicToken] = permissions
+	}
+
+	viewer, isViewer := room.findViewer(publicToken)
+	if !isViewer {
+		return nil
+	}
+
+	viewer.Type = room.getViewerType(viewer)
+	return []RoomDelta{room.UpdateRole(viewer)}
+}
+
+// Viewers the host granted permissions to are co-hosts.
+func (room *Room) getViewerType(viewer *Client) ClientType {
+	if len(room.permissions[viewer.PublicToken]) > 0 {
+		return ClientTypeCoHost
+	}
+
+	return ClientTypeViewer
+}
+
+func (room *Room) findViewer(publicToken Token) (*Client, bool) {
+	for _, viewer := range room.Viewers {
+		if viewer.PublicToken == publicToken {
+			return viewer, true
+		}
+	}
+
+	return nil, false
+}
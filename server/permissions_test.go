@@ -0,0 +1,229 @@
+package main
+
+import (
+	"encoding/json"
+	"slices"
+	"testing"
+)
+
+func TestPermissions(t *testing.T) {
+	t.Run("making a viewer a co-host shows their role to every member", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test"}, "Alice", "Bob")
+		room.assignPermissions(t, "Alice", RoomPermissionKick, RoomPermissionControlPlayback, RoomPermissionKick)
+		room.assertMessages(t, "Host", "Alice is co-host CONTROL_PLAYBACK,KICK", "Settings changed")
+		room.assertMessages(t, "Bob", "Alice is co-host CONTROL_PLAYBACK,KICK", "Settings changed")
+
+		if room.members["Alice"].Type != ClientTypeCoHost {
+			t.Errorf("Expected Alice to be a co-host but got %d\n", room.members["Alice"].Type)
+		}
+
+		registeredRoom, _ := room.manager.GetRegisteredRoom(room.members["Host"].RoomID)
+		viewers := registeredRoom.GetFilteredRoom().Viewers
+		aliceIndex := slices.IndexFunc(viewers, func(viewer ClientRecord) bool { return viewer.Name == "Alice" })
+		if aliceIndex < 0 || viewers[aliceIndex].Role != ClientTypeCoHost || len(viewers[aliceIndex].Permissions) != 2 {
+			t.Errorf("Expected the room to describe Alice as a co-host but got %+v\n", viewers)
+		}
+
+		room.assignPermissions(t, "Alice")
+		room.assertMessages(t, "Bob", "Alice is viewer", "Settings changed")
+
+		if room.members["Alice"].Type != ClientTypeViewer {
+			t.Errorf("Expected Alice to be a viewer again but got %d\n", room.members["Alice"].Type)
+		}
+	})
+
+	t.Run("rejecting permissions assigned by anyone but the host", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test"}, "Alice", "Bob")
+		room.assignPermissions(t, "Alice", RoomPermissionChangeSettings, RoomPermissionKick)
+
+		serverMessages := room.handleMessages("Alice", ClientMessageTypeAssignPermissions, ClientRequestAssignPermissions{PublicToken: room.members["Bob"].PublicToken, Permissions: []RoomPermission{RoomPermissionKick}})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeClientNotHost {
+			t.Errorf("Expected a co-host to not be able to assign permissions but got %+v\n", serverMessages)
+		}
+
+		serverMessages = room.handleMessages("Host", ClientMessageTypeAssignPermissions, ClientRequestAssignPermissions{PublicToken: room.members["Bob"].PublicToken, Permissions: []RoomPermission{"FLY"}})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeBadJson {
+			t.Errorf("Expected an unknown permission to be rejected but got %+v\n", serverMessages)
+		}
+
+		serverMessages = room.handleMessages("Host", ClientMessageTypeAssignPermissions, ClientRequestAssignPermissions{PublicToken: room.members["Host"].PublicToken, Permissions: []RoomPermission{RoomPermissionKick}})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeNoViewer {
+			t.Errorf("Expected only viewers to be assigned permissions but got %+v\n", serverMessages)
+		}
+	})
+
+	t.Run("letting co-hosts act only with the permissions they were assigned", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test"}, "Alice", "Bob")
+		room.assignPermissions(t, "Alice", RoomPermissionControlPlayback)
+
+		serverMessages := room.handleMessages("Alice", ClientMessageTypeUpdateRoomSettings, RoomSettings{Name: "Renamed"})
+		var errorDetails ServerErrorDetailsMissingPermission
+		if len(serverMessages) == 1 {
+			json.Unmarshal(serverMessages[0].message.ErrorDetails, &errorDetails)
+		}
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeMissingPermission || errorDetails.Permission != RoomPermissionChangeSettings {
+			t.Errorf("Expected a co-host without the permission to change the settings to be rejected but got %+v\n", serverMessages)
+		}
+
+		serverMessages = room.handleMessages("Bob", ClientMessageTypeUpdateRoomSettings, RoomSettings{Name: "Renamed"})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeClientNotHost {
+			t.Errorf("Expected a viewer to still be told they aren't the host but got %+v\n", serverMessages)
+		}
+
+		serverMessages = room.handleMessages("Alice", ClientMessageTypeSendReflection, RoomReflection{ID: "Video", State: PlayerStatePaused, CurrentTime: 20})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeClientNotHost {
+			t.Errorf("Expected only the host to reflect the room but got %+v\n", serverMessages)
+		}
+
+		videoDetails := VideoDetails{Title: "Title", Author: "Author", AuthorImage: "Image", SubscriberCount: "1", LikeCount: "2"}
+		serverMessages = room.handleMessages("Alice", ClientMessageTypeSendVideoDetails, videoDetails)
+		if len(serverMessages) != 2 || serverMessages[0].token != room.members["Host"].PrivateToken || serverMessages[1].token != room.members["Bob"].PrivateToken {
+			t.Errorf("Expected the video details of a co-host to reach the host and Bob but got %+v\n", serverMessages)
+		}
+
+		serverMessages = room.handleMessages("Bob", ClientMessageTypeSendVideoDetails, videoDetails)
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeClientNotHost {
+			t.Errorf("Expected the video details of a viewer to be rejected but got %+v\n", serverMessages)
+		}
+	})
+
+	t.Run("holding the intents of co-hosts to the interval between changes", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test", ControlMode: RoomControlModeCoHosts}, "Alice", "Bob")
+		room.assignPermissions(t, "Alice", RoomPermissionControlPlayback)
+		room.reflect(t, PlayerStatePlaying, 10)
+
+		serverMessages := room.handleMessages("Alice", ClientMessageTypeSendIntent, ClientRequestIntent{Action: PlaybackActionPause, Time: 10})
+		if len(serverMessages) != 2 || serverMessages[0].message.ErrorCode != ServerErrorCodeControlConflict {
+			t.Errorf("Expected the intent to lose to the host's reflection but got %+v\n", serverMessages)
+		}
+		room.assertMessages(t, "Host", "Alice is co-host CONTROL_PLAYBACK", "Settings changed")
+
+		room.clock.Advance(ControlIntentInterval)
+		room.sendIntent(t, "Alice", PlaybackActionPause, 11)
+		room.assertMessages(t, "Host", "ReflectRoom 2 11")
+		room.assertMessages(t, "Bob", "Alice is co-host CONTROL_PLAYBACK", "Settings changed", "ReflectRoom 1 10", "ReflectRoom 2 11")
+	})
+
+	t.Run("kicking a viewer with the permission to kick", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test"}, "Alice", "Bob", "Carol")
+		room.assignPermissions(t, "Alice", RoomPermissionKick)
+
+		serverMessages := room.handleMessages("Bob", ClientMessageTypeKickViewer, ClientRequestKickViewer{PublicToken: room.members["Carol"].PublicToken})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeClientNotHost {
+			t.Errorf("Expected a viewer to not be able to kick but got %+v\n", serverMessages)
+		}
+
+		serverMessages = room.handleMessages("Alice", ClientMessageTypeKickViewer, ClientRequestKickViewer{PublicToken: room.members["Host"].PublicToken})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeNoViewer {
+			t.Errorf("Expected the host to not be kicked but got %+v\n", serverMessages)
+		}
+
+		room.connections["Bob"].getMessages()
+		kick, _ := json.Marshal(ClientRequestKickViewer{PublicToken: room.members["Bob"].PublicToken})
+		room.handle(t, "Alice", ClientMessageTypeKickViewer, string(kick))
+		room.assertMessages(t, "Bob", "DisconnectRoom")
+		room.assertMessages(t, "Carol", "Alice is co-host KICK", "Bob left")
+
+		if room.members["Bob"].Type != ClientTypeInnactive {
+			t.Errorf("Expected Bob to have left the room but got %d\n", room.members["Bob"].Type)
+		}
+	})
+
+	t.Run("restoring the role of a co-host that joins again", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test"}, "Alice", "Bob")
+		room.assignPermissions(t, "Alice", RoomPermissionKick)
+		roomID := room.members["Host"].RoomID
+
+		room.handle(t, "Alice", ClientMessageTypeDisconnectRoom, "")
+		joinRoom, _ := json.Marshal(ClientRequestJoinRoom{RoomID: roomID})
+		room.handle(t, "Alice", ClientMessageTypeJoinRoom, string(joinRoom))
+
+		if room.members["Alice"].Type != ClientTypeCoHost {
+			t.Errorf("Expected Alice to be a co-host again but got %d\n", room.members["Alice"].Type)
+		}
+	})
+}
+
+func TestCoHostsInSettings(t *testing.T) {
+	room := newTestControlledRoom(t, RoomSettings{Name: "Test", ControlMode: RoomControlModeCoHosts}, "Alice", "Bob")
+	registeredRoom, _ := room.manager.GetRegisteredRoom(room.members["Host"].RoomID)
+	aliceToken, bobToken := room.members["Alice"].PublicToken, room.members["Bob"].PublicToken
+
+	room.assignPermissions(t, "Alice", RoomPermissionControlPlayback, RoomPermissionKick)
+	if !slices.Equal(registeredRoom.Settings.CoHosts, []Token{aliceToken}) {
+		t.Errorf("Expected the settings to list Alice as a co-host but got %v\n", registeredRoom.Settings.CoHosts)
+	}
+
+	room.handle(t, "Host", ClientMessageTypeUpdateRoomSettings, `{"name":"Renamed"}`)
+	if !slices.Equal(registeredRoom.Settings.CoHosts, []Token{aliceToken}) || !room.hasPermission(t, "Alice", RoomPermissionControlPlayback) {
+		t.Errorf("Expected Alice to stay a co-host when the co-hosts are left out but got %v\n", registeredRoom.Settings.CoHosts)
+	}
+
+	room.handle(t, "Host", ClientMessageTypeUpdateRoomSettings, `{"coHosts":["`+string(bobToken)+`"]}`)
+	room.assertMessages(t, "Bob", "Alice is co-host CONTROL_PLAYBACK,KICK", "Settings changed", "Settings changed", "Alice is co-host KICK", "Bob is co-host CONTROL_PLAYBACK", "Settings changed")
+	if !slices.Equal(registeredRoom.Settings.CoHosts, []Token{bobToken}) {
+		t.Errorf("Expected the settings to list only Bob as a co-host but got %v\n", registeredRoom.Settings.CoHosts)
+	}
+
+	joinRoom, _ := json.Marshal(ClientRequestJoinRoom{RoomID: registeredRoom.RoomID})
+	for _, name := range []string{"Alice", "Bob"} {
+		room.handle(t, name, ClientMessageTypeDisconnectRoom, "")
+		room.handle(t, name, ClientMessageTypeJoinRoom, string(joinRoom))
+
+		if room.members[name].Type != ClientTypeCoHost {
+			t.Errorf("Expected %s to be a co-host again but got %d\n", name, room.members[name].Type)
+		}
+	}
+
+	if !room.hasPermission(t, "Alice", RoomPermissionKick) || room.hasPermission(t, "Alice", RoomPermissionControlPlayback) || !room.hasPermission(t, "Bob", RoomPermissionControlPlayback) {
+		t.Errorf("Expected Alice to only kick and Bob to control the playback but got %+v\n", registeredRoom.permissions)
+	}
+
+	if !slices.Equal(registeredRoom.Settings.CoHosts, []Token{bobToken}) {
+		t.Errorf("Expected the settings to still list Bob as a co-host but got %v\n", registeredRoom.Settings.CoHosts)
+	}
+}
+
+func TestCoHostReconnection(t *testing.T) {
+	room := newTestControlledRoom(t, RoomSettings{Name: "Test"}, "Alice", "Bob")
+	room.assignPermissions(t, "Alice", RoomPermissionKick)
+	previousClient := room.members["Alice"]
+
+	// The client reconnects with a new temporary client and authorizes as the previous one
+	reconnectedClient := NewClient(room.manager.GenerateToken())
+	var connection Connection = &testConnection{}
+	room.manager.connectionManager.RegisterClientConnection(reconnectedClient.PrivateToken, &connection)
+	room.manager.RegisterClient(reconnectedClient)
+	room.members["Alice"], room.connections["Alice"] = reconnectedClient, connection.(*testConnection)
+
+	authorize, _ := json.Marshal(ClientRequestAuthorizeRoom{Name: "Alice", PrivateToken: previousClient.PrivateToken})
+	room.handle(t, "Alice", ClientMessageTypeAuthorize, string(authorize))
+	room.handle(t, "Alice", ClientMessageTypeAttemptReconnect, "")
+
+	if reconnectedClient.PublicToken != previousClient.PublicToken {
+		t.Errorf("Expected Alice to keep the public token %s but got %s\n", previousClient.PublicToken, reconnectedClient.PublicToken)
+	}
+
+	if reconnectedClient.Type != ClientTypeCoHost {
+		t.Errorf("Expected Alice to still be a co-host but got %d\n", reconnectedClient.Type)
+	}
+
+	registeredRoom, _ := room.manager.GetRegisteredRoom(reconnectedClient.RoomID)
+	if len(registeredRoom.permissions) != 1 || !room.hasPermission(t, "Alice", RoomPermissionKick) {
+		t.Errorf("Expected only Alice's permissions to be kept but got %+v\n", registeredRoom.permissions)
+	}
+}
+
+func (room *testWaitingRoom) assignPermissions(t *testing.T, name string, permissions ...RoomPermission) {
+	t.Helper()
+
+	request, _ := json.Marshal(ClientRequestAssignPermissions{PublicToken: room.members[name].PublicToken, Permissions: permissions})
+	room.handle(t, "Host", ClientMessageTypeAssignPermissions, string(request))
+}
+
+func (room *testWaitingRoom) hasPermission(t *testing.T, name string, permission RoomPermission) bool {
+	t.Helper()
+
+	registeredRoom, exists := room.manager.GetRegisteredRoom(room.members[name].RoomID)
+	return exists && registeredRoom.hasPermission(room.members[name], permission)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/cowatch/logger"
+)
+
+// ControlIntentInterval is the shortest time between playback changes of different members.
+// An intent arriving sooner after someone else's change loses to it, and it's sender is told so.
+const ControlIntentInterval = time.Second
+
+// ControlIntentFollowTimeout is how long the host's player has to follow an intent. Until then the host's
+// reflections are stale and ignored, after it they're applied again so a host that can't follow isn't locked out.
+const ControlIntentFollowTimeout = 5 * time.Second
+
+// How far a reflected time may drift from the expected one before the reflection counts as a seek.
+const reflectionSeekTolerance = 2.0
+
+// Handles a member asking to play, pause or seek, reflecting the resolved playback to every member.
+func IntentHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
+	var requestIntent ClientRequestIntent
+	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &requestIntent)
+	isKnownAction := slices.Contains([]PlaybackAction{PlaybackActionPlay, PlaybackActionPause, PlaybackActionSeek}, requestIntent.Action)
+	if errorParsingRequest != nil || !isKnownAction {
+		logger.Warn("[%s] [SendIntent] Client sent bad json object: %v %q\n", client.PrivateToken, errorParsingRequest, requestIntent.Action)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeSendIntent),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageBadJson,
+					ErrorCode:      ServerErrorCodeBadJson,
+				},
+			},
+		}
+	}
+
+	room, exists := manager.GetRegisteredRoom(client.RoomID)
+	if !exists {
+		logger.Info("[%s] [SendIntent] No room found with id: %s\n", client.PrivateToken, client.RoomID)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeSendIntent),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageNoRoom,
+					ErrorCode:      ServerErrorCodeNoRoom,
+				},
+			},
+		}
+	}
+
+	if !room.canControlPlayback(client) {
+		logger.Info("[%s] [SendIntent] Client isn't allowed to control the playback of room %s\n", client.PrivateToken, room.RoomID)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeSendIntent),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageControlNotAllowed,
+					ErrorCode:      ServerErrorCodeControlNotAllowed,
+				},
+			},
+		}
+	}
+
+	now := manager.clock.Now()
+	if room.controlledBy != client.PrivateToken && now.Sub(room.controlledAt) < ControlIntentInterval {
+		logger.Info("[%s] [SendIntent] Intent lost to the change of %s, reflecting the room back\n", client.PrivateToken, room.controlledBy)
+		serverMessages := []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeSendIntent),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageControlConflict,
+					ErrorCode:      ServerErrorCodeControlConflict,
+				},
+			},
+		}
+		return append(serverMessages, newReflectionMessages([]*Client{client}, room.getPlaybackAt(now))...)
+	}
+
+	reflection := room.latestReflection
+	reflection.CurrentTime = requestIntent.Time
+	reflection.StartAt = 0
+	switch requestIntent.Action {
+	case PlaybackActionPlay:
+		reflection.State = PlayerStatePlaying
+	case PlaybackActionPause:
+		reflection.State = PlayerStatePaused
+	}
+
+	logger.Debug("[%s] [SendIntent] Applying %s at %g to room %s\n", client.PrivateToken, requestIntent.Action, requestIntent.Time, room.RoomID)
+	serverMessages := manager.cancelHeldStart(room)
+	room.updatePlayback(reflection, client, now)
+	room.playbackState = reflection.State
+	room.isHostBehind = true
+
+	members := append([]*Client{room.Host}, room.Viewers...)
+	serverMessages = append(serverMessages, newReflectionMessages(members, room.getWaitingReflection(reflection))...)
+	return serverMessages
+}
+
+// Applies a reflection of the room's playback the way a reflection of the host is, on behalf of the member
+// that changed it, and reflects it to the viewers. Expects the manager to be locked.
+func (manager *Manager) reflectPlayback(room *Room, reflection RoomReflection, controlledBy *Client) []DirectedServerMessage {
+	room.updatePlayback(reflection, controlledBy, manager.clock.Now())
+	reflection = room.getWaitingReflection(reflection)
+
+	heldMessages, isHeld := manager.holdReflection(room, reflection)
+	if isHeld {
+		return heldMessages
+	}
+
+	return append(heldMessages, newReflectionMessages(room.Viewers, reflection)...)
+}
+
+// Checks whether a reflection of the host is stale, coming from a player that hasn't followed the latest
+// intent yet. Reflections of another video are never stale, the host moved on to it.
+func (room *Room) isStaleHostReflection(reflection RoomReflection, now time.Time) bool {
+	if !room.isHostBehind {
+		return false
+	}
+
+	isStale := reflection.ID == room.latestReflection.ID && room.isPlaybackChange(reflection, now) &&
+		now.Sub(room.controlledAt) < ControlIntentFollowTimeout
+	room.isHostBehind = isStale
+	return isStale
+}
+
+// The host is always in control, the viewers and co-hosts depend on the room's control mode.
+func (room *Room) canControlPlayback(client *Client) bool {
+	if client.Type == ClientTypeHost {
+		return true
+	}
+
+	switch room.Settings.ControlMode {
+	case RoomControlModeEveryone:
+		return client.Type == ClientTypeViewer || client.Type == ClientTypeCoHost
+	case RoomControlModeCoHosts:
+		return room.hasPermission(client, RoomPermissionControlPlayback)
+	default:
+		return false
+	}
+}
+
+// Keeps the latest playback of the room, recording who changed it if the reflection isn't just a progress update.
+func (room *Room) updatePlayback(reflection RoomReflection, client *Client, now time.Time) {
+	if room.isPlaybackChange(reflection, now) {
+		room.controlledBy = client.PrivateToken
+		room.controlledAt = now
+	}
+
+	room.latestReflection = reflection
+	room.playbackUpdatedAt = now
+}
+
+// Checks whether a reflection changes the video, the state or the time the room's playback is expected at.
+func (room *Room) isPlaybackChange(reflection RoomReflection, now time.Time) bool {
+	previous := room.latestReflection
+	if previous.ID != reflection.ID {
+		return true
+	}
+
+	isBuffering := previous.State == PlayerStateBuffering || reflection.State == PlayerStateBuffering
+	if !isBuffering && previous.State != reflection.State {
+		return true
+	}
+
+	expectedTime := previous.GetExtrapolatedTime(now.Sub(room.playbackUpdatedAt))
+	return math.Abs(float64(reflection.CurrentTime-expectedTime)) > reflectionSeekTolerance
+}
+
+// Estimates the room's playback at the given time from it's latest reflection.
+func (room *Room) getPlaybackAt(now time.Time) RoomReflection {
+	reflection := room.latestReflection
+	reflection.CurrentTime = reflection.GetExtrapolatedTime(now.Sub(room.playbackUpdatedAt))
+	reflection.StartAt = 0
+
+	return room.getWaitingReflection(reflection)
+}
@@ -0,0 +1,159 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestPlaybackIntents(t *testing.T) {
+	t.Run("rejecting the intents of viewers in rooms only the host controls", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test"}, "Alice")
+
+		serverMessages := room.handleMessages("Alice", ClientMessageTypeSendIntent, ClientRequestIntent{Action: PlaybackActionPause, Time: 10})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeControlNotAllowed {
+			t.Errorf("Expected the intent to be rejected but got %+v\n", serverMessages)
+		}
+	})
+
+	t.Run("reflecting intents to every member including the host", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test", ControlMode: RoomControlModeEveryone}, "Alice", "Bob")
+		room.reflect(t, PlayerStatePlaying, 10)
+		room.clock.Advance(5 * time.Second)
+
+		room.sendIntent(t, "Alice", PlaybackActionPause, 15)
+		room.assertMessages(t, "Host", "ReflectRoom 2 15")
+		room.assertMessages(t, "Alice", "ReflectRoom 1 10", "ReflectRoom 2 15")
+		room.assertMessages(t, "Bob", "ReflectRoom 1 10", "ReflectRoom 2 15")
+
+		room.sendIntent(t, "Alice", PlaybackActionSeek, 40)
+		room.sendIntent(t, "Alice", PlaybackActionPlay, 40)
+		room.assertMessages(t, "Host", "ReflectRoom 2 40", "ReflectRoom 1 40")
+	})
+
+	t.Run("letting only the co-hosts control in rooms controlled by co-hosts", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test"}, "Alice", "Bob")
+		room.updateSettings(t, RoomSettings{Name: "Test", ControlMode: RoomControlModeCoHosts})
+		room.assignPermissions(t, "Alice", RoomPermissionControlPlayback)
+
+		serverMessages := room.handleMessages("Bob", ClientMessageTypeSendIntent, ClientRequestIntent{Action: PlaybackActionPause, Time: 10})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeControlNotAllowed {
+			t.Errorf("Expected the intent of a viewer that isn't a co-host to be rejected but got %+v\n", serverMessages)
+		}
+
+		room.sendIntent(t, "Alice", PlaybackActionPause, 10)
+		room.assertMessages(t, "Bob", "Settings changed", "Alice is co-host CONTROL_PLAYBACK", "Settings changed", "ReflectRoom 2 10")
+	})
+
+	t.Run("letting the viewers listed as co-hosts in the settings control", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test"}, "Alice", "Bob")
+		room.updateSettings(t, RoomSettings{Name: "Test", ControlMode: RoomControlModeCoHosts, CoHosts: []Token{room.members["Alice"].PublicToken}})
+		room.assertMessages(t, "Bob", "Alice is co-host CONTROL_PLAYBACK", "Settings changed")
+
+		room.sendIntent(t, "Alice", PlaybackActionPause, 10)
+		room.assertMessages(t, "Bob", "ReflectRoom 2 10")
+
+		room.updateSettings(t, RoomSettings{Name: "Test", ControlMode: RoomControlModeCoHosts, CoHosts: []Token{room.members["Bob"].PublicToken}})
+		room.assertMessages(t, "Host", "Alice is co-host CONTROL_PLAYBACK", "Settings changed", "ReflectRoom 2 10", "Alice is viewer", "Bob is co-host CONTROL_PLAYBACK", "Settings changed")
+
+		serverMessages := room.handleMessages("Alice", ClientMessageTypeSendIntent, ClientRequestIntent{Action: PlaybackActionPlay, Time: 10})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeControlNotAllowed {
+			t.Errorf("Expected the intent of a viewer removed from the co-hosts to be rejected but got %+v\n", serverMessages)
+		}
+	})
+
+	t.Run("reflecting the room back to intents that come too soon after someone else's", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test", ControlMode: RoomControlModeEveryone}, "Alice", "Bob")
+		room.sendIntent(t, "Alice", PlaybackActionPause, 10)
+		room.assertMessages(t, "Alice", "ReflectRoom 2 10")
+		room.assertMessages(t, "Bob", "ReflectRoom 2 10")
+
+		room.clock.Advance(ControlIntentInterval / 2)
+		serverMessages := room.handleMessages("Bob", ClientMessageTypeSendIntent, ClientRequestIntent{Action: PlaybackActionPlay, Time: 10})
+		if len(serverMessages) != 2 || serverMessages[0].message.ErrorCode != ServerErrorCodeControlConflict ||
+			serverMessages[1].token != room.members["Bob"].PrivateToken || serverMessages[1].message.MessageType != ServerMessageTypeReflectRoom {
+
+			t.Errorf("Expected Bob to be told his intent lost and get the room reflected back but got %+v\n", serverMessages)
+		}
+		room.assertMessages(t, "Alice")
+
+		room.clock.Advance(ControlIntentInterval / 2)
+		room.sendIntent(t, "Bob", PlaybackActionPlay, 10)
+		room.assertMessages(t, "Alice", "ReflectRoom 1 10")
+	})
+
+	t.Run("keeping an intent over the reflections of a host that hasn't followed it", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test", ControlMode: RoomControlModeEveryone}, "Alice")
+		room.reflect(t, PlayerStatePlaying, 10)
+		room.clock.Advance(2 * time.Second)
+		room.sendIntent(t, "Alice", PlaybackActionPause, 12)
+		room.assertMessages(t, "Alice", "ReflectRoom 1 10", "ReflectRoom 2 12")
+
+		// The host's player reflects it's playback from before the intent reached it
+		room.clock.Advance(ControlIntentInterval)
+		room.reflect(t, PlayerStatePlaying, 13)
+		room.assertMessages(t, "Alice")
+
+		room.reflect(t, PlayerStatePaused, 12)
+		room.assertMessages(t, "Alice", "ReflectRoom 2 12")
+
+		// Once followed, the host is back in control
+		room.reflect(t, PlayerStatePlaying, 12)
+		room.assertMessages(t, "Alice", "ReflectRoom 1 12")
+	})
+
+	t.Run("applying the host's reflections again when it can't follow an intent", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test", ControlMode: RoomControlModeEveryone}, "Alice")
+		room.reflect(t, PlayerStatePlaying, 10)
+		room.clock.Advance(ControlIntentInterval)
+		room.sendIntent(t, "Alice", PlaybackActionPause, 11)
+		room.reflect(t, PlayerStatePlaying, 20)
+		room.assertMessages(t, "Alice", "ReflectRoom 1 10", "ReflectRoom 2 11")
+
+		room.clock.Advance(ControlIntentFollowTimeout)
+		room.reflect(t, PlayerStatePlaying, 25)
+		room.assertMessages(t, "Alice", "ReflectRoom 1 25")
+	})
+
+	t.Run("following the host to another video right away", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test", ControlMode: RoomControlModeEveryone}, "Alice")
+		room.reflect(t, PlayerStatePlaying, 10)
+		room.clock.Advance(ControlIntentInterval)
+		room.sendIntent(t, "Alice", PlaybackActionPause, 11)
+
+		reflection, _ := json.Marshal(RoomReflection{ID: "Next", State: PlayerStatePlaying, CurrentTime: 0})
+		room.handle(t, "Host", ClientMessageTypeSendReflection, string(reflection))
+		room.assertMessages(t, "Alice", "ReflectRoom 1 10", "ReflectRoom 2 11", "ReflectRoom 1 0")
+	})
+}
+
+// Hosts a room with the settings, leaving the viewers with the messages they receive from then on.
+func newTestControlledRoom(t *testing.T, settings RoomSettings, viewerNames ...string) *testWaitingRoom {
+	t.Helper()
+
+	room := newTestWaitingRoom(t, viewerNames...)
+	room.updateSettings(t, settings)
+
+	for name := range room.connections {
+		room.connections[name].getMessages()
+	}
+
+	return room
+}
+
+func (room *testWaitingRoom) sendIntent(t *testing.T, name string, action PlaybackAction, playbackTime float32) {
+	t.Helper()
+
+	intent, _ := json.Marshal(ClientRequestIntent{Action: action, Time: playbackTime})
+	room.handle(t, name, ClientMessageTypeSendIntent, string(intent))
+}
+
+// Handles a request of a member without sending the responses, for requests that are expected to fail.
+func (room *testWaitingRoom) handleMessages(name string, messageType ClientMessageType, request interface{}) []DirectedServerMessage {
+	message, _ := json.Marshal(request)
+
+	room.manager.mutex.Lock()
+	defer room.manager.mutex.Unlock()
+
+	return room.manager.handleClientMessage(room.members[name], ClientMessage{ServerVersion: serverVersion, MessageType: messageType, Message: string(message)})
+}
@@ -0,0 +1,216 @@
+package main
+
+import "github.com/cowatch/protocol"
+
+// The wire types are defined in the protocol package so clients can share them with the server.
+
+type RequestID = protocol.RequestID
+type ClientType = protocol.ClientType
+type ClientMessageType = protocol.ClientMessageType
+type ClientMessage = protocol.ClientMessage
+type ServerMessageType = protocol.ServerMessageType
+type ServerMessageStatus = protocol.ServerMessageStatus
+type ServerErrorMessage = protocol.ServerErrorMessage
+type ServerErrorCode = protocol.ServerErrorCode
+type ServerMessage = protocol.ServerMessage
+type ServerResponseAck = protocol.ServerResponseAck
+type ServerAnnouncement = protocol.ServerAnnouncement
+type RoomClosingReason = protocol.RoomClosingReason
+type ServerRoomClosing = protocol.ServerRoomClosing
+type ServerCountdown = protocol.ServerCountdown
+
+type ServerErrorDetailsOldServerVersion = protocol.ServerErrorDetailsOldServerVersion
+type ServerErrorDetailsRoomName = protocol.ServerErrorDetailsRoomName
+type ServerErrorDetailsFullRoom = protocol.ServerErrorDetailsFullRoom
+type ServerErrorDetailsMissingPermission = protocol.ServerErrorDetailsMissingPermission
+type ServerErrorDetailsInvalidSchedule = protocol.ServerErrorDetailsInvalidSchedule
+type ServerErrorDetailsRoomRedirect = protocol.ServerErrorDetailsRoomRedirect
+
+type RoomID = protocol.RoomID
+type RoomRevision = protocol.RoomRevision
+type Timestamp = protocol.Timestamp
+type ClientRecord = protocol.ClientRecord
+type RoomSettings = protocol.RoomSettings
+type RoomRecord = protocol.RoomRecord
+type RoomDeltaType = protocol.RoomDeltaType
+type RoomDelta = protocol.RoomDelta
+type RoomReflection = protocol.RoomReflection
+type VideoDetails = protocol.VideoDetails
+type PingPong = protocol.PingPong
+
+type ClientRequestAuthorizeRoom = protocol.ClientRequestAuthorizeRoom
+type ServerResponseAuthorizeRoom = protocol.ServerResponseAuthorizeRoom
+type ClientRequestJoinRoom = protocol.ClientRequestJoinRoom
+type ServerResponseJoinRoom = protocol.ServerResponseJoinRoom
+type ClientRequestResyncRoom = protocol.ClientRequestResyncRoom
+type ServerResponseResyncRoom = protocol.ServerResponseResyncRoom
+type ClientRequestReadiness = protocol.ClientRequestReadiness
+type ClientRequestIntent = protocol.ClientRequestIntent
+type PlaybackAction = protocol.PlaybackAction
+type RoomControlMode = protocol.RoomControlMode
+type VoteID = protocol.VoteID
+type VoteAction = protocol.VoteAction
+type VoteResult = protocol.VoteResult
+type ClientRequestStartVote = protocol.ClientRequestStartVote
+type ClientRequestCastVote = protocol.ClientRequestCastVote
+type RoomPermission = protocol.RoomPermission
+type ClientRequestAssignPermissions = protocol.ClientRequestAssignPermissions
+type ClientRequestKickViewer = protocol.ClientRequestKickViewer
+type ServerVote = protocol.ServerVote
+
+type Codec = protocol.Codec
+type JSONCodec = protocol.JSONCodec
+type MsgpackCodec = protocol.MsgpackCodec
+
+const (
+	SubprotocolJSON    = protocol.SubprotocolJSON
+	SubprotocolMsgpack = protocol.SubprotocolMsgpack
+)
+
+var GetCodec = protocol.GetCodec
+
+const (
+	ClientTypeInnactive = protocol.ClientTypeInnactive
+	ClientTypeHost      = protocol.ClientTypeHost
+	ClientTypeViewer    = protocol.ClientTypeViewer
+	ClientTypeCoHost    = protocol.ClientTypeCoHost
+)
+
+const (
+	ClientMessageTypeAuthorize          = protocol.ClientMessageTypeAuthorize
+	ClientMessageTypeHostRoom           = protocol.ClientMessageTypeHostRoom
+	ClientMessageTypeJoinRoom           = protocol.ClientMessageTypeJoinRoom
+	ClientMessageTypeDisconnectRoom     = protocol.ClientMessageTypeDisconnectRoom
+	ClientMessageTypeSendReflection     = protocol.ClientMessageTypeSendReflection
+	ClientMessageTypeSendVideoDetails   = protocol.ClientMessageTypeSendVideoDetails
+	ClientMessageTypePing               = protocol.ClientMessageTypePing
+	ClientMessageTypeAttemptReconnect   = protocol.ClientMessageTypeAttemptReconnect
+	ClientMessageTypeResyncRoom         = protocol.ClientMessageTypeResyncRoom
+	ClientMessageTypeUpdateRoomSettings = protocol.ClientMessageTypeUpdateRoomSettings
+	ClientMessageTypeSendReadiness      = protocol.ClientMessageTypeSendReadiness
+	ClientMessageTypeSendIntent         = protocol.ClientMessageTypeSendIntent
+	ClientMessageTypeStartVote          = protocol.ClientMessageTypeStartVote
+	ClientMessageTypeCastVote           = protocol.ClientMessageTypeCastVote
+	ClientMessageTypeAssignPermissions  = protocol.ClientMessageTypeAssignPermissions
+	ClientMessageTypeKickViewer         = protocol.ClientMessageTypeKickViewer
+)
+
+const (
+	ServerMessageTypeAuthorize           = protocol.ServerMessageTypeAuthorize
+	ServerMessageTypeHostRoom            = protocol.ServerMessageTypeHostRoom
+	ServerMessageTypeJoinRoom            = protocol.ServerMessageTypeJoinRoom
+	ServerMessageTypeUpdateRoom          = protocol.ServerMessageTypeUpdateRoom
+	ServerMessageTypeDisconnectRoom      = protocol.ServerMessageTypeDisconnectRoom
+	ServerMessageTypeReflectRoom         = protocol.ServerMessageTypeReflectRoom
+	ServerMessageTypeReflectVideoDetails = protocol.ServerMessageTypeReflectVideoDetails
+	ServerMessageTypePong                = protocol.ServerMessageTypePong
+	ServerMessageTypeAck                 = protocol.ServerMessageTypeAck
+	ServerMessageTypeResyncRoom          = protocol.ServerMessageTypeResyncRoom
+	ServerMessageTypeUpdateRoomSettings  = protocol.ServerMessageTypeUpdateRoomSettings
+	ServerMessageTypeServerAnnouncement  = protocol.ServerMessageTypeServerAnnouncement
+	ServerMessageTypeRoomClosing         = protocol.ServerMessageTypeRoomClosing
+	ServerMessageTypeCountdown           = protocol.ServerMessageTypeCountdown
+	ServerMessageTypeVote                = protocol.ServerMessageTypeVote
+)
+
+const (
+	RoomClosingReasonIdle         = protocol.RoomClosingReasonIdle
+	RoomClosingReasonNoReflection = protocol.RoomClosingReasonNoReflection
+	RoomClosingReasonMaxLifetime  = protocol.RoomClosingReasonMaxLifetime
+)
+
+const (
+	ServerMessageStatusOk    = protocol.ServerMessageStatusOk
+	ServerMessageStatusError = protocol.ServerMessageStatusError
+)
+
+const (
+	ServerErrorMessageOldServerVersion    = protocol.ServerErrorMessageOldServerVersion
+	ServerErrorMessageInternalServerError = protocol.ServerErrorMessageInternalServerError
+	ServerErrorMessageBadJson             = protocol.ServerErrorMessageBadJson
+	ServerErrorMessageShortRoomName       = protocol.ServerErrorMessageShortRoomName
+	ServerErrorMessageLongRoomName        = protocol.ServerErrorMessageLongRoomName
+	ServerErrorMessageNoRoom              = protocol.ServerErrorMessageNoRoom
+	ServerErrorMessageFullRoom            = protocol.ServerErrorMessageFullRoom
+	ServerErrorMessageRoomRedirect        = protocol.ServerErrorMessageRoomRedirect
+	ServerErrorMessageClientNotHost       = protocol.ServerErrorMessageClientNotHost
+	ServerErrorMessageControlNotAllowed   = protocol.ServerErrorMessageControlNotAllowed
+	ServerErrorMessageControlConflict     = protocol.ServerErrorMessageControlConflict
+	ServerErrorMessageMissingPermission   = protocol.ServerErrorMessageMissingPermission
+	ServerErrorMessageNoViewer            = protocol.ServerErrorMessageNoViewer
+	ServerErrorMessageMaintenance         = protocol.ServerErrorMessageMaintenance
+	ServerErrorMessageInvalidSchedule     = protocol.ServerErrorMessageInvalidSchedule
+	ServerErrorMessageVoteInProgress      = protocol.ServerErrorMessageVoteInProgress
+	ServerErrorMessageNoVote              = protocol.ServerErrorMessageNoVote
+	ServerErrorMessageUnknownMessageType  = protocol.ServerErrorMessageUnknownMessageType
+	ServerErrorMessageUnauthorized        = protocol.ServerErrorMessageUnauthorized
+)
+
+const (
+	ServerErrorCodeOldServerVersion    = protocol.ServerErrorCodeOldServerVersion
+	ServerErrorCodeInternalServerError = protocol.ServerErrorCodeInternalServerError
+	ServerErrorCodeBadJson             = protocol.ServerErrorCodeBadJson
+	ServerErrorCodeShortRoomName       = protocol.ServerErrorCodeShortRoomName
+	ServerErrorCodeLongRoomName        = protocol.ServerErrorCodeLongRoomName
+	ServerErrorCodeNoRoom              = protocol.ServerErrorCodeNoRoom
+	ServerErrorCodeFullRoom            = protocol.ServerErrorCodeFullRoom
+	ServerErrorCodeRoomRedirect        = protocol.ServerErrorCodeRoomRedirect
+	ServerErrorCodeClientNotHost       = protocol.ServerErrorCodeClientNotHost
+	ServerErrorCodeControlNotAllowed   = protocol.ServerErrorCodeControlNotAllowed
+	ServerErrorCodeControlConflict     = protocol.ServerErrorCodeControlConflict
+	ServerErrorCodeMissingPermission   = protocol.ServerErrorCodeMissingPermission
+	ServerErrorCodeNoViewer            = protocol.ServerErrorCodeNoViewer
+	ServerErrorCodeMaintenance         = protocol.ServerErrorCodeMaintenance
+	ServerErrorCodeInvalidSchedule     = protocol.ServerErrorCodeInvalidSchedule
+	ServerErrorCodeVoteInProgress      = protocol.ServerErrorCodeVoteInProgress
+	ServerErrorCodeNoVote              = protocol.ServerErrorCodeNoVote
+	ServerErrorCodeUnknownMessageType  = protocol.ServerErrorCodeUnknownMessageType
+	ServerErrorCodeUnauthorized        = protocol.ServerErrorCodeUnauthorized
+)
+
+const (
+	RoomControlModeHost     = protocol.RoomControlModeHost
+	RoomControlModeCoHosts  = protocol.RoomControlModeCoHosts
+	RoomControlModeEveryone = protocol.RoomControlModeEveryone
+)
+
+const (
+	PlaybackActionPlay  = protocol.PlaybackActionPlay
+	PlaybackActionPause = protocol.PlaybackActionPause
+	PlaybackActionSeek  = protocol.PlaybackActionSeek
+)
+
+const (
+	RoomPermissionControlPlayback = protocol.RoomPermissionControlPlayback
+	RoomPermissionKick            = protocol.RoomPermissionKick
+	RoomPermissionChangeSettings  = protocol.RoomPermissionChangeSettings
+)
+
+const (
+	VoteActionSkip  = protocol.VoteActionSkip
+	VoteActionPause = protocol.VoteActionPause
+	VoteActionSeek  = protocol.VoteActionSeek
+)
+
+const (
+	VoteResultPassed = protocol.VoteResultPassed
+	VoteResultFailed = protocol.VoteResultFailed
+)
+
+const (
+	RoomDeltaTypeViewerJoined    = protocol.RoomDeltaTypeViewerJoined
+	RoomDeltaTypeViewerLeft      = protocol.RoomDeltaTypeViewerLeft
+	RoomDeltaTypeHostChanged     = protocol.RoomDeltaTypeHostChanged
+	RoomDeltaTypeSettingsChanged = protocol.RoomDeltaTypeSettingsChanged
+	RoomDeltaTypeWaitingChanged  = protocol.RoomDeltaTypeWaitingChanged
+	RoomDeltaTypeRoleChanged     = protocol.RoomDeltaTypeRoleChanged
+)
+
+const (
+	PlayerStateUnstarted = protocol.PlayerStateUnstarted
+	PlayerStateEnded     = protocol.PlayerStateEnded
+	PlayerStatePlaying   = protocol.PlayerStatePlaying
+	PlayerStatePaused    = protocol.PlayerStatePaused
+	PlayerStateBuffering = protocol.PlayerStateBuffering
+	PlayerStateVideoCued = protocol.PlayerStateVideoCued
+)
@@ -0,0 +1,304 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"sync"
+
+	"github.com/gorilla/websocket"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// Codec describes how messages are serialized over a connection.
+//
+// A codec is negotiated during the websocket handshake through the Sec-WebSocket-Protocol header.
+// Clients that don't request any of the supported subprotocols are served with the [JSONCodec].
+type Codec interface {
+
+	// GetSubprotocol returns the websocket subprotocol that negotiates the codec.
+	GetSubprotocol() string
+
+	// GetFrameType returns the websocket frame type the encoded messages are sent with.
+	GetFrameType() int
+
+	// Marshal encodes an arbitrary object.
+	Marshal(v interface{}) ([]byte, error)
+
+	// Unmarshal decodes data into the object pointed to by v.
+	Unmarshal(data []byte, v interface{}) error
+}
+
+const SubprotocolJSON = "cowatch.json"
+const SubprotocolMsgpack = "cowatch.msgpack"
+
+// Subprotocols in order of server preference.
+var SupportedSubprotocols = []string{SubprotocolMsgpack, SubprotocolJSON}
+
+// GetCodec returns the codec negotiated by the subprotocol, defaulting to JSON.
+func GetCodec(subprotocol string) Codec {
+	switch subprotocol {
+	case SubprotocolMsgpack:
+		return MsgpackCodec{}
+	default:
+		return JSONCodec{}
+	}
+}
+
+// JSONCodec sends messages as text frames. It's the default and the format the extension speaks.
+type JSONCodec struct{}
+
+func (JSONCodec) GetSubprotocol() string { return SubprotocolJSON }
+
+func (JSONCodec) GetFrameType() int { return websocket.TextMessage }
+
+func (JSONCodec) Marshal(v interface{}) ([]byte, error) { return json.Marshal(v) }
+
+func (JSONCodec) Unmarshal(data []byte, v interface{}) error { return json.Unmarshal(data, v) }
+
+// MsgpackCodec sends messages as MessagePack binary frames.
+//
+// Unlike JSON, where a ClientMessage's action is a json encoded string, payloads are sent nested
+// inside the message. Struct fields are named after their json tags so both formats share a schema.
+type MsgpackCodec struct{}
+
+func (MsgpackCodec) GetSubprotocol() string { return SubprotocolMsgpack }
+
+func (MsgpackCodec) GetFrameType() int { return websocket.BinaryMessage }
+
+func (MsgpackCodec) Marshal(v interface{}) ([]byte, error) {
+	var buffer bytes.Buffer
+
+	err := encodeMsgpack(&buffer, v)
+	return buffer.Bytes(), err
+}
+
+// Encodes with a pooled encoder, sparing an encoder per message in a fan-out.
+func encodeMsgpack(buffer *bytes.Buffer, v interface{}) error {
+	encoder := msgpack.GetEncoder()
+	defer msgpack.PutEncoder(encoder)
+
+	encoder.Reset(buffer)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+
+	return encoder.Encode(v)
+}
+
+func (MsgpackCodec) Unmarshal(data []byte, v interface{}) error {
+	decoder := msgpack.NewDecoder(bytes.NewReader(data))
+	decoder.SetCustomStructTag("json")
+
+	return decoder.Decode(v)
+}
+
+type msgpackClientMessage struct {
+	ServerVersion string            `json:"version"`
+	MessageType   ClientMessageType `json:"actionType"`
+	Message       interface{}       `json:"action"`
+	RequestID     RequestID         `json:"requestId,omitempty"`
+	Locale        Locale            `json:"locale,omitempty"`
+}
+
+// Encodes the json action of the message as a nested object.
+func (clientMessage ClientMessage) EncodeMsgpack(encoder *msgpack.Encoder) error {
+	var message interface{} = clientMessage.Message
+	if nestedMessage, errorConverting := rawJSONToValue(json.RawMessage(clientMessage.Message)); errorConverting == nil {
+		message = nestedMessage
+	}
+
+	return encoder.Encode(msgpackClientMessage{
+		ServerVersion: clientMessage.ServerVersion,
+		MessageType:   clientMessage.MessageType,
+		Message:       message,
+		RequestID:     clientMessage.RequestID,
+		Locale:        clientMessage.Locale,
+	})
+}
+
+// Decodes a nested action back into the json string the message handlers expect.
+// Actions sent as plain strings are kept as is.
+func (clientMessage *ClientMessage) DecodeMsgpack(decoder *msgpack.Decoder) error {
+	var wireMessage msgpackClientMessage
+	if err := decoder.Decode(&wireMessage); err != nil {
+		return err
+	}
+
+	*clientMessage = ClientMessage{
+		ServerVersion: wireMessage.ServerVersion,
+		MessageType:   wireMessage.MessageType,
+		RequestID:     wireMessage.RequestID,
+		Locale:        wireMessage.Locale,
+	}
+
+	switch message := wireMessage.Message.(type) {
+	case nil:
+	case string:
+		clientMessage.Message = message
+	default:
+		jsonMessage, err := json.Marshal(message)
+		if err != nil {
+			return err
+		}
+
+		clientMessage.Message = string(jsonMessage)
+	}
+
+	return nil
+}
+
+type msgpackServerMessage struct {
+	MessageType    ServerMessageType   `json:"actionType"`
+	MessageDetails interface{}         `json:"action"`
+	Status         ServerMessageStatus `json:"status"`
+	ErrorMessage   ServerErrorMessage  `json:"errorMessage"`
+	ErrorCode      ServerErrorCode     `json:"errorCode,omitempty"`
+	ErrorDetails   interface{}         `json:"errorDetails,omitempty"`
+	RequestID      RequestID           `json:"requestId,omitempty"`
+}
+
+// Encodes the json details of the message as nested objects.
+func (serverMessage ServerMessage) EncodeMsgpack(encoder *msgpack.Encoder) error {
+	messageDetails, err := msgpackPayloads.get(serverMessage.MessageDetails)
+	if err != nil {
+		return err
+	}
+
+	errorDetails, err := msgpackPayloads.get(serverMessage.ErrorDetails)
+	if err != nil {
+		return err
+	}
+
+	return encoder.Encode(msgpackServerMessage{
+		MessageType:    serverMessage.MessageType,
+		MessageDetails: messageDetails,
+		Status:         serverMessage.Status,
+		ErrorMessage:   serverMessage.ErrorMessage,
+		ErrorCode:      serverMessage.ErrorCode,
+		ErrorDetails:   errorDetails,
+		RequestID:      serverMessage.RequestID,
+	})
+}
+
+// Decodes the nested details of the message back into json.
+func (serverMessage *ServerMessage) DecodeMsgpack(decoder *msgpack.Decoder) error {
+	var wireMessage msgpackServerMessage
+	if err := decoder.Decode(&wireMessage); err != nil {
+		return err
+	}
+
+	*serverMessage = ServerMessage{
+		MessageType:  wireMessage.MessageType,
+		Status:       wireMessage.Status,
+		ErrorMessage: wireMessage.ErrorMessage,
+		ErrorCode:    wireMessage.ErrorCode,
+		RequestID:    wireMessage.RequestID,
+	}
+
+	var err error
+	serverMessage.MessageDetails, err = valueToRawJSON(wireMessage.MessageDetails)
+	if err != nil {
+		return err
+	}
+
+	serverMessage.ErrorDetails, err = valueToRawJSON(wireMessage.ErrorDetails)
+	return err
+}
+
+// The details of a message sent to every member of a room are the same json for each of them, so the
+// latest conversions are kept and the details are converted once per fan-out rather than once per member.
+var msgpackPayloads = &msgpackPayloadCache{payloads: make(map[string]msgpack.RawMessage)}
+
+const msgpackPayloadCacheSize = 64
+
+type msgpackPayloadCache struct {
+	mutex    sync.Mutex
+	payloads map[string]msgpack.RawMessage // Encoded payloads by the json they were converted from
+	order    []string                      // The json of the cached payloads, oldest first
+}
+
+// Converts raw json into an encoded msgpack value, or nil if there's no json.
+func (cache *msgpackPayloadCache) get(rawJSON json.RawMessage) (interface{}, error) {
+	if len(rawJSON) == 0 {
+		return nil, nil
+	}
+
+	cache.mutex.Lock()
+	payload, isCached := cache.payloads[string(rawJSON)]
+	cache.mutex.Unlock()
+	if isCached {
+		return payload, nil
+	}
+
+	value, err := rawJSONToValue(rawJSON)
+	if err != nil {
+		return nil, err
+	}
+
+	var buffer bytes.Buffer
+	if err := encodeMsgpack(&buffer, value); err != nil {
+		return nil, err
+	}
+	payload = msgpack.RawMessage(buffer.Bytes())
+
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+
+	if _, isCached := cache.payloads[string(rawJSON)]; !isCached {
+		if len(cache.order) == msgpackPayloadCacheSize {
+			delete(cache.payloads, cache.order[0])
+			cache.order = cache.order[1:]
+		}
+
+		cache.payloads[string(rawJSON)] = payload
+		cache.order = append(cache.order, string(rawJSON))
+	}
+
+	return payload, nil
+}
+
+// Converts raw json into plain go values keeping integers as integers.
+func rawJSONToValue(rawJSON json.RawMessage) (interface{}, error) {
+	if len(rawJSON) == 0 {
+		return nil, nil
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(rawJSON))
+	decoder.UseNumber()
+
+	var value interface{}
+	if err := decoder.Decode(&value); err != nil {
+		return nil, err
+	}
+
+	return normalizeJSONNumbers(value), nil
+}
+
+func normalizeJSONNumbers(value interface{}) interface{} {
+	switch typedValue := value.(type) {
+	case json.Number:
+		if integer, err := typedValue.Int64(); err == nil {
+			return integer
+		}
+
+		float, _ := typedValue.Float64()
+		return float
+	case map[string]interface{}:
+		for key, nestedValue := range typedValue {
+			typedValue[key] = normalizeJSONNumbers(nestedValue)
+		}
+	case []interface{}:
+		for index, nestedValue := range typedValue {
+			typedValue[index] = normalizeJSONNumbers(nestedValue)
+		}
+	}
+
+	return value
+}
+
+func valueToRawJSON(value interface{}) (json.RawMessage, error) {
+	if value == nil {
+		return nil, nil
+	}
+
+	return json.Marshal(value)
+}
@@ -0,0 +1,248 @@
+// Package protocol defines the messages exchanged between the cowatch server and its clients.
+//
+// Every message is a [ClientMessage] or [ServerMessage] envelope. Their action carries the json
+// encoded request or response as a string, so a client wraps a request by encoding it twice.
+package protocol
+
+import (
+	"encoding/json"
+)
+
+type Token string
+
+// RequestID is an optional client generated identifier used to correlate a [ClientMessage]
+// with the [ServerMessage]s produced while handling it.
+type RequestID string
+
+// Locale is a BCP 47 language tag such as "en" or "fr-CA".
+type Locale string
+
+// NodeID identifies a server of a cluster.
+type NodeID string
+
+type ClientType int
+
+const (
+	ClientTypeInnactive = iota
+	ClientTypeHost
+	ClientTypeViewer
+	ClientTypeCoHost // A viewer the host granted some of their permissions to
+)
+
+type ClientMessageType string
+
+type ClientMessage struct {
+	ServerVersion string            `json:"version"`
+	MessageType   ClientMessageType `json:"actionType"`
+	Message       string            `json:"action"`
+	RequestID     RequestID         `json:"requestId,omitempty"`
+	Locale        Locale            `json:"locale,omitempty"`
+}
+
+const (
+	ClientMessageTypeAuthorize          = "Authorize"
+	ClientMessageTypeHostRoom           = "HostRoom"
+	ClientMessageTypeJoinRoom           = "JoinRoom"
+	ClientMessageTypeDisconnectRoom     = "DisconnectRoom"
+	ClientMessageTypeSendReflection     = "SendReflection"
+	ClientMessageTypeSendVideoDetails   = "SendVideoDetails"
+	ClientMessageTypePing               = "Ping"
+	ClientMessageTypeAttemptReconnect   = "AttemptReconnect"
+	ClientMessageTypeResyncRoom         = "ResyncRoom"
+	ClientMessageTypeUpdateRoomSettings = "UpdateRoomSettings"
+	ClientMessageTypeSendReadiness      = "SendReadiness"
+	ClientMessageTypeSendIntent         = "SendIntent"
+	ClientMessageTypeStartVote          = "StartVote"
+	ClientMessageTypeCastVote           = "CastVote"
+	ClientMessageTypeAssignPermissions  = "AssignPermissions"
+	ClientMessageTypeKickViewer         = "KickViewer"
+)
+
+type ServerMessageType string
+
+const (
+	ServerMessageTypeAuthorize           = "Authorize"
+	ServerMessageTypeHostRoom            = "HostRoom"
+	ServerMessageTypeJoinRoom            = "JoinRoom"
+	ServerMessageTypeUpdateRoom          = "UpdateRoom"
+	ServerMessageTypeDisconnectRoom      = "DisconnectRoom"
+	ServerMessageTypeReflectRoom         = "ReflectRoom"
+	ServerMessageTypeReflectVideoDetails = "ReflectVideoDetails"
+	ServerMessageTypePong                = "Pong"
+	ServerMessageTypeAck                 = "Ack"
+	ServerMessageTypeResyncRoom          = "ResyncRoom"
+	ServerMessageTypeUpdateRoomSettings  = "UpdateRoomSettings"
+	ServerMessageTypeServerAnnouncement  = "ServerAnnouncement"
+	ServerMessageTypeRoomClosing         = "RoomClosing"
+	ServerMessageTypeCountdown           = "Countdown"
+	ServerMessageTypeVote                = "Vote"
+)
+
+type ServerMessageStatus string
+
+const (
+	ServerMessageStatusOk    = "ok"
+	ServerMessageStatusError = "error"
+)
+
+type ServerErrorMessage string
+
+const (
+	ServerErrorMessageOldServerVersion = "Client running older version than expected"
+
+	ServerErrorMessageInternalServerError = "Internal server error."
+	ServerErrorMessageBadJson             = "Bad request, please upgrade your extension to a newer version"
+
+	ServerErrorMessageShortRoomName = "The room name must be 3 characters or more."
+	ServerErrorMessageLongRoomName  = "The room name must be 50 characters or less."
+
+	ServerErrorMessageNoRoom       = "The room you're trying to join doesn't exist"
+	ServerErrorMessageFullRoom     = "The room you're trying to join is full"
+	ServerErrorMessageRoomRedirect = "The room you're trying to join is hosted on another server"
+
+	ServerErrorMessageClientNotHost     = "You're not a host"
+	ServerErrorMessageControlNotAllowed = "You're not allowed to control the playback of this room"
+	ServerErrorMessageControlConflict   = "Someone else just changed the playback, try again in a moment"
+	ServerErrorMessageMissingPermission = "You don't have the permission to do this in this room"
+	ServerErrorMessageNoViewer          = "There's no such viewer in this room"
+
+	ServerErrorMessageMaintenance = "The server is under maintenance, new rooms can't be hosted right now"
+
+	ServerErrorMessageInvalidSchedule = "The scheduled start must be in the future and at most a week away"
+
+	ServerErrorMessageVoteInProgress = "There's already a vote in progress in this room"
+	ServerErrorMessageNoVote         = "The vote you're voting on is no longer in progress"
+
+	ServerErrorMessageUnknownMessageType = "The server doesn't know how to handle this request"
+	ServerErrorMessageUnauthorized       = "You must be authorized before making this request"
+)
+
+// ServerErrorCode is the stable, machine-readable counterpart of a [ServerErrorMessage].
+// Clients should rely on the code rather than the text which may be localized.
+type ServerErrorCode string
+
+const (
+	ServerErrorCodeOldServerVersion = "OLD_SERVER_VERSION"
+
+	ServerErrorCodeInternalServerError = "INTERNAL_SERVER_ERROR"
+	ServerErrorCodeBadJson             = "BAD_JSON"
+
+	ServerErrorCodeShortRoomName = "SHORT_ROOM_NAME"
+	ServerErrorCodeLongRoomName  = "LONG_ROOM_NAME"
+
+	ServerErrorCodeNoRoom       = "NO_ROOM"
+	ServerErrorCodeFullRoom     = "FULL_ROOM"
+	ServerErrorCodeRoomRedirect = "ROOM_REDIRECT"
+
+	ServerErrorCodeClientNotHost     = "CLIENT_NOT_HOST"
+	ServerErrorCodeControlNotAllowed = "CONTROL_NOT_ALLOWED"
+	ServerErrorCodeControlConflict   = "CONTROL_CONFLICT"
+	ServerErrorCodeMissingPermission = "MISSING_PERMISSION"
+	ServerErrorCodeNoViewer          = "NO_VIEWER"
+
+	ServerErrorCodeMaintenance = "MAINTENANCE"
+
+	ServerErrorCodeInvalidSchedule = "INVALID_SCHEDULE"
+
+	ServerErrorCodeVoteInProgress = "VOTE_IN_PROGRESS"
+	ServerErrorCodeNoVote         = "NO_VOTE"
+
+	ServerErrorCodeUnknownMessageType = "UNKNOWN_MESSAGE_TYPE"
+	ServerErrorCodeUnauthorized       = "UNAUTHORIZED"
+)
+
+type ServerErrorDetailsOldServerVersion struct {
+	ExpectedVersion string `json:"expectedVersion"`
+}
+
+type ServerErrorDetailsRoomName struct {
+	MinLength int `json:"minLength"`
+	MaxLength int `json:"maxLength"`
+}
+
+type ServerErrorDetailsInvalidSchedule struct {
+	MaxSecondsAhead int `json:"maxSecondsAhead"`
+}
+
+// ServerErrorDetailsMissingPermission names the permission a co-host needs for their request.
+type ServerErrorDetailsMissingPermission struct {
+	Permission RoomPermission `json:"permission"`
+}
+
+type ServerErrorDetailsFullRoom struct {
+	MaxCapacity int `json:"maxCapacity"`
+}
+
+// ServerErrorDetailsRoomRedirect points the client to the node that owns the room,
+// the client should reconnect to the endpoint and send the request again.
+type ServerErrorDetailsRoomRedirect struct {
+	NodeID   NodeID `json:"nodeID"`
+	Endpoint string `json:"endpoint"`
+}
+
+type ServerMessage struct {
+	MessageType    ServerMessageType   `json:"actionType"`
+	MessageDetails json.RawMessage     `json:"action"`
+	Status         ServerMessageStatus `json:"status"`                 // Returns 'ok' or 'error'
+	ErrorMessage   ServerErrorMessage  `json:"errorMessage"`           // Populated only if there's an error
+	ErrorCode      ServerErrorCode     `json:"errorCode,omitempty"`    // Populated only if there's an error
+	ErrorDetails   json.RawMessage     `json:"errorDetails,omitempty"` // Optional structured data describing the error
+	RequestID      RequestID           `json:"requestId,omitempty"`    // Echoes the RequestID of the ClientMessage that produced it
+}
+
+// ServerResponseAck is sent to a client that supplied a [RequestID] whenever handling
+// their message didn't produce any other response directed to them.
+type ServerResponseAck struct {
+	MessageType ClientMessageType `json:"actionType"`
+}
+
+// ServerAnnouncement is a message from the server's operators shown to every client receiving it.
+type ServerAnnouncement struct {
+	Message     string `json:"message"`
+	Maintenance bool   `json:"maintenance,omitempty"` // Set when the server stopped accepting new rooms
+}
+
+// RoomClosingReason is the policy a room is being closed by.
+type RoomClosingReason string
+
+const (
+	RoomClosingReasonIdle         = "IDLE"          // Nobody joined the host for too long
+	RoomClosingReasonNoReflection = "NO_REFLECTION" // The host stopped reflecting their player
+	RoomClosingReasonMaxLifetime  = "MAX_LIFETIME"  // The room reached the longest time a room may stay open
+)
+
+// ServerRoomClosing warns the members of a room that the server will close it, so they can count down to it.
+// A warning that's cancelled because the room no longer breaks the policy is sent again with Cancelled set.
+type ServerRoomClosing struct {
+	Reason      RoomClosingReason `json:"reason"`
+	ClosesAt    Timestamp         `json:"closesAt"`    // Unix time in seconds
+	SecondsLeft int               `json:"secondsLeft"` // Seconds left when the warning was sent
+	Cancelled   bool              `json:"cancelled,omitempty"`
+}
+
+// ServerCountdown ticks down to the scheduled start of a room, more often the closer it gets.
+type ServerCountdown struct {
+	StartsAt    Timestamp `json:"startsAt"`    // Unix time in seconds
+	SecondsLeft int       `json:"secondsLeft"` // Seconds left when the tick was sent
+}
+
+type VoteResult string
+
+const (
+	VoteResultPassed = "PASSED"
+	VoteResultFailed = "FAILED"
+)
+
+// ServerVote is the live tally of a room's vote, sent to every member whenever it changes.
+// The result is set on the last tally of the vote, once it passed or can no longer pass.
+type ServerVote struct {
+	VoteID    VoteID       `json:"voteID"`
+	Action    VoteAction   `json:"action"`
+	Time      float32      `json:"time,omitempty"` // The time a seek vote seeks to
+	StartedBy ClientRecord `json:"startedBy"`
+	EndsAt    Timestamp    `json:"endsAt"` // Unix time in seconds
+	InFavor   int          `json:"inFavor"`
+	Against   int          `json:"against"`
+	Required  int          `json:"required"` // The votes in favor the vote needs to pass
+	Result    VoteResult   `json:"result,omitempty"`
+}
@@ -0,0 +1,86 @@
+package protocol
+
+type ClientRequestAuthorizeRoom struct {
+	Name         string `json:"name"`
+	Image        string `json:"image"`
+	PrivateToken Token  `json:"privateToken"`
+}
+
+type ServerResponseAuthorizeRoom struct {
+	Name         string `json:"name"`
+	Image        string `json:"image"`
+	PrivateToken Token  `json:"privateToken"`
+	PublicToken  Token  `json:"publicToken"`
+}
+
+type ClientRequestJoinRoom struct {
+	RoomID RoomID `json:"roomID"`
+}
+
+type ServerResponseJoinRoom struct {
+	Room RoomRecord `json:"room"`
+	Type ClientType `json:"clientType"`
+}
+
+type ClientRequestResyncRoom struct {
+	Revision RoomRevision `json:"revision"`
+}
+
+type ServerResponseResyncRoom struct {
+	Deltas []RoomDelta `json:"deltas,omitempty"` // The changes made after the client's revision
+	Room   *RoomRecord `json:"room,omitempty"`   // Populated only if the changes are no longer available
+}
+
+// ClientRequestReadiness reports whether a viewer can play the room's video from it's current time
+// without buffering, which a room waiting for it's viewers holds the start of the playback on.
+type ClientRequestReadiness struct {
+	Ready bool `json:"ready"`
+}
+
+type PlaybackAction string
+
+const (
+	PlaybackActionPlay  = "PLAY"
+	PlaybackActionPause = "PAUSE"
+	PlaybackActionSeek  = "SEEK"
+)
+
+// ClientRequestIntent asks to change the playback of a room the client is allowed to control.
+// The server resolves it against the room's latest state and reflects the result to every member.
+type ClientRequestIntent struct {
+	Action PlaybackAction `json:"action"`
+	Time   float32        `json:"time"` // The time to play, pause or seek at
+}
+
+// VoteID identifies a vote within it's room.
+type VoteID uint64
+
+type VoteAction string
+
+const (
+	VoteActionSkip  = "SKIP"  // Ends the current video
+	VoteActionPause = "PAUSE" // Pauses the playback
+	VoteActionSeek  = "SEEK"  // Seeks to the vote's time
+)
+
+// ClientRequestStartVote starts a vote on an action in the room, counting the client in favor of it.
+type ClientRequestStartVote struct {
+	Action VoteAction `json:"action"`
+	Time   float32    `json:"time,omitempty"` // The time to seek to
+}
+
+type ClientRequestCastVote struct {
+	VoteID  VoteID `json:"voteID"`
+	InFavor bool   `json:"inFavor"`
+}
+
+// ClientRequestAssignPermissions makes a viewer a co-host with the permissions, or a viewer again without any.
+// The permissions are kept by the viewer's public token, so a co-host rejoining the room stays one.
+type ClientRequestAssignPermissions struct {
+	PublicToken Token            `json:"publicToken"`
+	Permissions []RoomPermission `json:"permissions"`
+}
+
+type ClientRequestKickViewer struct {
+	PublicToken Token `json:"publicToken"`
+}
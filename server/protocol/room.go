@@ -0,0 +1,181 @@
+package protocol
+
+import (
+	"slices"
+	"time"
+)
+
+type RoomID string
+
+// RoomRevision increases by one with every change made to a room's members or settings.
+type RoomRevision uint64
+
+type Timestamp int64
+
+type ClientRecord struct {
+	Name        string `json:"name"`
+	Image       string `json:"image"`
+	PublicToken Token  `json:"publicToken"`
+
+	// Set for co-hosts, the host and the viewers are told apart by where their record is.
+	Role        ClientType       `json:"role,omitempty"`
+	Permissions []RoomPermission `json:"permissions,omitempty"`
+}
+
+// RoomPermission is something the host can do in their room and may let co-hosts do as well.
+type RoomPermission string
+
+const (
+	RoomPermissionControlPlayback = "CONTROL_PLAYBACK" // Send intents in CO_HOSTS rooms and the video details, only the host reflects the player
+	RoomPermissionKick            = "KICK"             // Remove viewers from the room
+	RoomPermissionChangeSettings  = "CHANGE_SETTINGS"  // Update the room's settings
+)
+
+// RoomSettings are sent in full by the server, while hosts may update only some of them,
+// leaving out the ones that should keep their current value.
+type RoomSettings = struct {
+	Name string `json:"name"`
+
+	// Holds the start of the playback whenever the host hits play until every viewer reporting
+	// their readiness is ready to play, or a timeout passes.
+	WaitForViewers bool `json:"waitForViewers"`
+
+	// Unix time in seconds the playback of a scheduled watch party starts at. Until then the room
+	// is waiting, the viewers can join but stay paused, and the server clears it once it started.
+	ScheduledStart Timestamp `json:"scheduledStart"`
+
+	// Who besides the host can control the playback, host only if it's empty.
+	ControlMode RoomControlMode `json:"controlMode"`
+	CoHosts     []Token         `json:"coHosts"` // The viewers with CONTROL_PLAYBACK, listing others grants it to them
+
+	VoteThreshold int `json:"voteThreshold"` // The percentage of members a vote needs to pass, a majority if it's 0
+	VoteDuration  int `json:"voteDuration"`  // The seconds a vote lasts, the server's default if it's 0
+}
+
+// RoomControlMode decides which members of a room may send playback intents.
+type RoomControlMode string
+
+const (
+	RoomControlModeHost     = "HOST"
+	RoomControlModeCoHosts  = "CO_HOSTS"
+	RoomControlModeEveryone = "EVERYONE"
+)
+
+type RoomRecord struct {
+	RoomID    RoomID         `json:"roomID"`
+	Host      ClientRecord   `json:"host"`
+	Viewers   []ClientRecord `json:"viewers"`
+	Settings  RoomSettings   `json:"settings"`
+	CreatedAt Timestamp      `json:"createdAt"`
+	Revision  RoomRevision   `json:"revision"`
+
+	WaitingFor []ClientRecord `json:"waitingFor,omitempty"` // The viewers holding the start of the playback
+}
+
+type RoomDeltaType string
+
+const (
+	RoomDeltaTypeViewerJoined    = "ViewerJoined"
+	RoomDeltaTypeViewerLeft      = "ViewerLeft"
+	RoomDeltaTypeHostChanged     = "HostChanged"
+	RoomDeltaTypeSettingsChanged = "SettingsChanged"
+	RoomDeltaTypeWaitingChanged  = "WaitingChanged"
+	RoomDeltaTypeRoleChanged     = "RoleChanged"
+)
+
+// RoomDelta describes a single change made to a room.
+//
+// Clients apply deltas in order of their revision. A client that receives a delta which isn't
+// the revision following their own has missed an update and should request a resync.
+type RoomDelta struct {
+	Revision RoomRevision  `json:"revision"`
+	Type     RoomDeltaType `json:"type"`
+	Client   *ClientRecord `json:"client,omitempty"`   // The viewer that joined, left or changed role, or the new host
+	Settings *RoomSettings `json:"settings,omitempty"` // Populated only when the settings changed
+
+	WaitingFor []ClientRecord `json:"waitingFor,omitempty"` // The viewers still holding the start, empty once it's released
+}
+
+// ApplyDelta brings a record up to date with a change made to the room.
+// It returns false without changing the record if the delta isn't the revision following the record's,
+// in which case the client should resync the room.
+func (record *RoomRecord) ApplyDelta(delta RoomDelta) bool {
+	if delta.Revision != record.Revision+1 {
+		return false
+	}
+
+	switch delta.Type {
+	case RoomDeltaTypeViewerJoined:
+		if delta.Client != nil {
+			record.Viewers = append(record.Viewers, *delta.Client)
+		}
+	case RoomDeltaTypeViewerLeft:
+		if delta.Client != nil {
+			record.Viewers = slices.DeleteFunc(record.Viewers, func(viewer ClientRecord) bool {
+				return viewer.PublicToken == delta.Client.PublicToken
+			})
+		}
+	case RoomDeltaTypeHostChanged:
+		if delta.Client != nil {
+			record.Host = *delta.Client
+		}
+	case RoomDeltaTypeRoleChanged:
+		if delta.Client != nil {
+			for index, viewer := range record.Viewers {
+				if viewer.PublicToken == delta.Client.PublicToken {
+					record.Viewers[index] = *delta.Client
+				}
+			}
+		}
+	case RoomDeltaTypeSettingsChanged:
+		if delta.Settings != nil {
+			record.Settings = *delta.Settings
+		}
+	case RoomDeltaTypeWaitingChanged:
+		record.WaitingFor = delta.WaitingFor
+	}
+
+	record.Revision = delta.Revision
+	return true
+}
+
+// The states of the youtube player a [RoomReflection] carries.
+const (
+	PlayerStateUnstarted = -1
+	PlayerStateEnded     = 0
+	PlayerStatePlaying   = 1
+	PlayerStatePaused    = 2
+	PlayerStateBuffering = 3
+	PlayerStateVideoCued = 5
+)
+
+type RoomReflection struct {
+	ID          string  `json:"id"`
+	State       int     `json:"state"`
+	CurrentTime float32 `json:"time"`
+
+	// Set on the reflection releasing a held or scheduled start, the unix time in milliseconds
+	// every member starts playing from the reflected time at.
+	StartAt Timestamp `json:"startAt,omitempty"`
+}
+
+// GetExtrapolatedTime estimates the host's playback time once elapsed has passed since the reflection was sent.
+func (reflection RoomReflection) GetExtrapolatedTime(elapsed time.Duration) float32 {
+	if reflection.State != PlayerStatePlaying {
+		return reflection.CurrentTime
+	}
+
+	return reflection.CurrentTime + float32(elapsed.Seconds())
+}
+
+type VideoDetails struct {
+	Title           string `json:"title"`
+	Author          string `json:"author"`
+	AuthorImage     string `json:"authorImage"`
+	SubscriberCount string `json:"subscriberCount"`
+	LikeCount       string `json:"likeCount"`
+}
+
+type PingPong struct {
+	Timestamp Timestamp `json:"timestamp"`
+}
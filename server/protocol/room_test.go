@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestApplyDelta(t *testing.T) {
+	alice := ClientRecord{Name: "Alice", PublicToken: "A"}
+	bob := ClientRecord{Name: "Bob", PublicToken: "B"}
+
+	t.Run("applying every type of delta in order", func(t *testing.T) {
+		record := RoomRecord{RoomID: "Room", Host: alice, Viewers: []ClientRecord{}, Settings: RoomSettings{Name: "Before"}}
+
+		deltas := []RoomDelta{
+			{Revision: 1, Type: RoomDeltaTypeViewerJoined, Client: &bob},
+			{Revision: 2, Type: RoomDeltaTypeSettingsChanged, Settings: &RoomSettings{Name: "After"}},
+			{Revision: 3, Type: RoomDeltaTypeHostChanged, Client: &bob},
+			{Revision: 4, Type: RoomDeltaTypeWaitingChanged, WaitingFor: []ClientRecord{bob}},
+			{Revision: 5, Type: RoomDeltaTypeViewerLeft, Client: &bob},
+		}
+
+		for _, delta := range deltas {
+			if !record.ApplyDelta(delta) {
+				t.Fatalf("Expected delta %+v to be applied to %+v\n", delta, record)
+			}
+		}
+
+		if record.Revision != 5 || !reflect.DeepEqual(record.Host, bob) || len(record.Viewers) != 0 || record.Settings.Name != "After" || len(record.WaitingFor) != 1 {
+			t.Errorf("Got unexpected record %+v\n", record)
+		}
+	})
+
+	t.Run("replacing the record of a viewer that changed role", func(t *testing.T) {
+		record := RoomRecord{Host: alice, Viewers: []ClientRecord{bob}}
+		coHost := ClientRecord{Name: "Bob", PublicToken: "B", Role: ClientTypeCoHost, Permissions: []RoomPermission{RoomPermissionKick}}
+
+		if !record.ApplyDelta(RoomDelta{Revision: 1, Type: RoomDeltaTypeRoleChanged, Client: &coHost}) {
+			t.Fatalf("Expected the delta to be applied to %+v\n", record)
+		}
+
+		if len(record.Viewers) != 1 || !reflect.DeepEqual(record.Viewers[0], coHost) {
+			t.Errorf("Expected Bob to be a co-host but got %+v\n", record.Viewers)
+		}
+	})
+
+	t.Run("rejecting a delta that skips a revision", func(t *testing.T) {
+		record := RoomRecord{Host: alice, Revision: 2}
+
+		if record.ApplyDelta(RoomDelta{Revision: 4, Type: RoomDeltaTypeViewerJoined, Client: &bob}) {
+			t.Errorf("Expected the delta to be rejected\n")
+		}
+
+		if record.ApplyDelta(RoomDelta{Revision: 2, Type: RoomDeltaTypeViewerJoined, Client: &bob}) {
+			t.Errorf("Expected an already applied delta to be rejected\n")
+		}
+
+		if record.Revision != 2 || len(record.Viewers) != 0 {
+			t.Errorf("Expected the record to stay unchanged but got %+v\n", record)
+		}
+	})
+}
+
+func TestGetExtrapolatedTime(t *testing.T) {
+	tests := []struct {
+		state    int
+		expected float32
+	}{
+		{PlayerStatePlaying, 12.5},
+		{PlayerStatePaused, 10},
+		{PlayerStateBuffering, 10},
+		{PlayerStateEnded, 10},
+	}
+
+	for _, test := range tests {
+		reflection := RoomReflection{ID: "Video", State: test.state, CurrentTime: 10}
+		if extrapolated := reflection.GetExtrapolatedTime(2500 * time.Millisecond); extrapolated != test.expected {
+			t.Errorf("Expected state %d to extrapolate to %v but got %v\n", test.state, test.expected, extrapolated)
+		}
+	}
+}
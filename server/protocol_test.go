@@ -0,0 +1,119 @@
+package main
+
+import (
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cowatch/client"
+)
+
+func TestClientLibrary(t *testing.T) {
+	t.Run("hosting, joining and reflecting through the client library", func(t *testing.T) {
+		mockServer, _ := newTestServer(t, testServerOptions{})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		host := dialClientLibrary(t, ctx, mockServer, "Host")
+		room, err := host.HostRoom(ctx, RoomSettings{Name: "Library"})
+		if err != nil {
+			t.Fatalf("Failed to host: %v\n", err)
+		}
+
+		roomUpdates := make(chan RoomDelta, 1)
+		host.OnRoomUpdate(func(delta RoomDelta) { roomUpdates <- delta })
+
+		viewer := dialClientLibrary(t, ctx, mockServer, "Viewer")
+		reflections := make(chan RoomReflection, 1)
+		viewer.OnReflect(func(reflection RoomReflection) { reflections <- reflection })
+
+		joinRoom, err := viewer.JoinRoom(ctx, room.RoomID)
+		if err != nil || joinRoom.Room.RoomID != room.RoomID || joinRoom.Type != ClientTypeViewer {
+			t.Fatalf("Expected to join %q as a viewer but got %+v %v\n", room.RoomID, joinRoom, err)
+		}
+
+		if delta := <-roomUpdates; delta.Type != RoomDeltaTypeViewerJoined || delta.Client.Name != "Viewer" {
+			t.Errorf("Expected the host to see the viewer join but got %+v\n", delta)
+		}
+
+		if err := host.Reflect(ctx, RoomReflection{ID: "Video", State: 1, CurrentTime: 12}); err != nil {
+			t.Fatalf("Failed to reflect: %v\n", err)
+		}
+
+		if reflection := <-reflections; reflection.ID != "Video" || reflection.CurrentTime != 12 {
+			t.Errorf("Got unexpected reflection %+v\n", reflection)
+		}
+
+		if err := viewer.Reflect(ctx, RoomReflection{ID: "Video"}); !client.IsServerError(err, ServerErrorCodeClientNotHost) {
+			t.Errorf("Expected a viewer's reflection to be rejected but got %v\n", err)
+		}
+	})
+
+	t.Run("restoring the session when reconnecting", func(t *testing.T) {
+		mockServer, _ := newTestServer(t, testServerOptions{})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		host := dialClientLibrary(t, ctx, mockServer, "Host")
+		room, err := host.HostRoom(ctx, RoomSettings{Name: "Library"})
+		if err != nil {
+			t.Fatalf("Failed to host: %v\n", err)
+		}
+
+		viewer := dialClientLibrary(t, ctx, mockServer, "Viewer")
+		if _, err := viewer.JoinRoom(ctx, room.RoomID); err != nil {
+			t.Fatalf("Failed to join: %v\n", err)
+		}
+
+		authorization, _ := viewer.GetAuthorization()
+		reflections := make(chan RoomReflection, 1)
+		viewer.OnReflect(func(reflection RoomReflection) { reflections <- reflection })
+
+		joinRoom, err := viewer.AttemptReconnect(ctx)
+		if err != nil || joinRoom == nil || joinRoom.Room.RoomID != room.RoomID {
+			t.Fatalf("Expected to rejoin %q but got %+v %v\n", room.RoomID, joinRoom, err)
+		}
+
+		if reconnectedAuthorization, _ := viewer.GetAuthorization(); reconnectedAuthorization.PrivateToken != authorization.PrivateToken {
+			t.Errorf("Expected to keep private token %q but got %q\n", authorization.PrivateToken, reconnectedAuthorization.PrivateToken)
+		}
+
+		if err := host.Reflect(ctx, RoomReflection{ID: "Video", State: 1, CurrentTime: 3}); err != nil {
+			t.Fatalf("Failed to reflect: %v\n", err)
+		}
+
+		if reflection := <-reflections; reflection.CurrentTime != 3 {
+			t.Errorf("Got unexpected reflection %+v\n", reflection)
+		}
+	})
+
+	t.Run("reconnecting outside of a room", func(t *testing.T) {
+		mockServer, _ := newTestServer(t, testServerOptions{})
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		viewer := dialClientLibrary(t, ctx, mockServer, "Viewer")
+		if joinRoom, err := viewer.AttemptReconnect(ctx); err != nil || joinRoom != nil {
+			t.Errorf("Expected to reconnect without a room but got %+v %v\n", joinRoom, err)
+		}
+	})
+}
+
+func dialClientLibrary(t *testing.T, ctx context.Context, mockServer *httptest.Server, name string) *client.Client {
+	t.Helper()
+
+	url := "ws" + strings.TrimPrefix(mockServer.URL, "http") + EndpointReflect
+	cowatch, err := client.Dial(ctx, url, client.Options{ServerVersion: serverVersion})
+	if err != nil {
+		t.Fatalf("Failed to dial: %v\n", err)
+	}
+	t.Cleanup(func() { cowatch.Close() })
+
+	if _, err := cowatch.Authorize(ctx, ClientRequestAuthorizeRoom{Name: name}); err != nil {
+		t.Fatalf("Failed to authorize: %v\n", err)
+	}
+
+	return cowatch
+}
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/cowatch/logger"
+)
+
+// ViewerReadinessTimeout is the longest a room waiting for it's viewers holds the start of the playback.
+const ViewerReadinessTimeout = 10 * time.Second
+
+// SynchronizedStartDelay is how far in the future a released start is scheduled,
+// so every member receives it before it's time to play.
+const SynchronizedStartDelay = 300 * time.Millisecond
+
+// heldStart is a play transition of the host held until the viewers are ready.
+type heldStart struct {
+	reflection RoomReflection // The latest reflection of the host playing, released to every member
+	timeout    Timer          // Releases the start if the viewers aren't ready in time
+}
+
+// Handles a viewer reporting whether they can play, releasing a held start once nobody is waited on.
+func ViewerReadinessHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
+	var requestReadiness ClientRequestReadiness
+	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &requestReadiness)
+	if errorParsingRequest != nil {
+		logger.Warn("[%s] [SendReadiness] Client sent bad json object: %s\n", client.PrivateToken, errorParsingRequest)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeSendReadiness),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageBadJson,
+					ErrorCode:      ServerErrorCodeBadJson,
+				},
+			},
+		}
+	}
+
+	room, exists := manager.GetRegisteredRoom(client.RoomID)
+	if !exists {
+		logger.Info("[%s] [SendReadiness] No room found with id: %s\n", client.PrivateToken, client.RoomID)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeSendReadiness),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageNoRoom,
+					ErrorCode:      ServerErrorCodeNoRoom,
+				},
+			},
+		}
+	}
+
+	// The host's readiness is part of their reflections
+	if client.Type == ClientTypeHost {
+		return []DirectedServerMessage{}
+	}
+
+	logger.Debug("[%s] [SendReadiness] Viewer is ready: %t\n", client.PrivateToken, requestReadiness.Ready)
+	wasReady, hasReported := room.viewerReadiness[client.PrivateToken]
+	room.viewerReadiness[client.PrivateToken] = requestReadiness.Ready
+
+	if room.heldStart == nil || !requestReadiness.Ready || (hasReported && wasReady) {
+		return []DirectedServerMessage{}
+	}
+
+	return manager.updateHeldStart(room)
+}
+
+// Holds a play transition of the host in a room waiting for it's viewers, expects the manager to be locked.
+//
+// The members, host included, are paused at the host's time until every viewer that reports it's readiness
+// is ready or the timeout passes, at which point every member is told to start playing at the same time.
+// Reflections of a held start are consumed, it returns false for the ones that should be reflected as usual.
+func (manager *Manager) holdReflection(room *Room, reflection RoomReflection) ([]DirectedServerMessage, bool) {
+	// The host's player pausing at the held time is it following the hold rather than the host pausing
+	if room.heldStart != nil && room.heldStart.isFollowedBy(reflection) {
+		room.heldStart.reflection.CurrentTime = reflection.CurrentTime
+		return []DirectedServerMessage{}, true
+	}
+
+	previousPlaybackState := room.playbackState
+	if reflection.State != PlayerStateBuffering {
+		room.playbackState = reflection.State
+	}
+
+	if room.heldStart != nil {
+		if reflection.State == PlayerStatePlaying || reflection.State == PlayerStateBuffering {
+			if reflection.State == PlayerStatePlaying {
+				room.heldStart.reflection = reflection
+			}
+
+			return []DirectedServerMessage{}, true
+		}
+
+		logger.Info("[%s] [ReflectRoom] Host stopped playing, cancelling the held start\n", room.RoomID)
+		return manager.cancelHeldStart(room), false
+	}
+
+	isPlayTransition := reflection.State == PlayerStatePlaying && previousPlaybackState != PlayerStatePlaying
+	if !room.Settings.WaitForViewers || !isPlayTransition || len(room.viewerReadiness) == 0 {
+		return nil, false
+	}
+
+	for token := range room.viewerReadiness {
+		room.viewerReadiness[token] = false
+	}
+
+	hold := &heldStart{reflection: reflection}
+	hold.timeout = manager.clock.AfterFunc(ViewerReadinessTimeout, func() {
+		manager.releaseHeldStartOnTimeout(room, hold)
+	})
+	room.heldStart = hold
+
+	waitingViewers := room.getWaitingViewers()
+	logger.Info("[%s] [ReflectRoom] Holding the start for %d viewers\n", room.RoomID, len(waitingViewers))
+
+	pausedReflection := reflection
+	pausedReflection.State = PlayerStatePaused
+
+	members := append([]*Client{room.Host}, room.Viewers...)
+	serverMessages := newReflectionMessages(members, pausedReflection)
+	serverMessages = append(serverMessages, updateRoomClientsWithLatestChanges(*room, room.UpdateWaitingFor(waitingViewers))...)
+	return serverMessages, true
+}
+
+func (hold *heldStart) isFollowedBy(reflection RoomReflection) bool {
+	return reflection.State == PlayerStatePaused && reflection.ID == hold.reflection.ID &&
+		math.Abs(float64(reflection.CurrentTime-hold.reflection.CurrentTime)) <= reflectionSeekTolerance
+}
+
+// Releases a held start once nobody is waited on, or tells the members who still is.
+func (manager *Manager) updateHeldStart(room *Room) []DirectedServerMessage {
+	waitingViewers := room.getWaitingViewers()
+	if len(waitingViewers) == 0 {
+		return manager.releaseHeldStart(room)
+	}
+
+	return updateRoomClientsWithLatestChanges(*room, room.UpdateWaitingFor(waitingViewers))
+}
+
+// Starts the playback of every member at the same time, expects the manager to be locked.
+func (manager *Manager) releaseHeldStart(room *Room) []DirectedServerMessage {
+	if room.heldStart == nil {
+		return []DirectedServerMessage{}
+	}
+
+	reflection := room.heldStart.reflection
+	reflection.StartAt = Timestamp(manager.clock.Now().Add(SynchronizedStartDelay).UnixMilli())
+	room.stopHeldStart()
+
+	logger.Info("[%s] [ReflectRoom] Releasing the held start at %d\n", room.RoomID, reflection.StartAt)
+	members := append([]*Client{room.Host}, room.Viewers...)
+	serverMessages := newReflectionMessages(members, reflection)
+	serverMessages = append(serverMessages, updateRoomClientsWithLatestChanges(*room, room.UpdateWaitingFor(nil))...)
+	return serverMessages
+}
+
+// Drops a held start without playing, e.g. because the host paused in the meantime.
+func (manager *Manager) cancelHeldStart(room *Room) []DirectedServerMessage {
+	if room.heldStart == nil {
+		return []DirectedServerMessage{}
+	}
+
+	room.stopHeldStart()
+	return updateRoomClientsWithLatestChanges(*room, room.UpdateWaitingFor(nil))
+}
+
+// Forgets the readiness of a viewer leaving the room, releasing a start only they were holding.
+func (manager *Manager) forgetViewerReadiness(room *Room, viewer *Client) []DirectedServerMessage {
+	delete(room.viewerReadiness, viewer.PrivateToken)
+
+	if room.heldStart == nil {
+		return []DirectedServerMessage{}
+	}
+
+	return manager.updateHeldStart(room)
+}
+
+func (manager *Manager) releaseHeldStartOnTimeout(room *Room, hold *heldStart) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if room.heldStart != hold {
+		return
+	}
+
+	logger.Info("[%s] [ReflectRoom] Viewers weren't ready in time, releasing the held start\n", room.RoomID)
+	manager.sendDirectedMessages(manager.releaseHeldStart(room))
+}
+
+// Collects the viewers that reported they aren't ready, in the order they joined.
+func (room *Room) getWaitingViewers() []*Client {
+	waitingViewers := make([]*Client, 0, len(room.viewerReadiness))
+	for _, viewer := range room.Viewers {
+		if isReady, hasReported := room.viewerReadiness[viewer.PrivateToken]; hasReported && !isReady {
+			waitingViewers = append(waitingViewers, viewer)
+		}
+	}
+
+	return waitingViewers
+}
+
+func (room *Room) stopHeldStart() {
+	if room.heldStart == nil {
+		return
+	}
+
+	room.heldStart.timeout.Stop()
+	room.heldStart = nil
+}
+
+func newReflectionMessages(recipients []*Client, reflection RoomReflection) []DirectedServerMessage {
+	serverMessageReflection, errorMarshaling := json.Marshal(reflection)
+	if errorMarshaling != nil {
+		logger.Error("[ReflectRoom] Bad json: %s\n", errorMarshaling)
+		return []DirectedServerMessage{}
+	}
+
+	serverMessages := make([]DirectedServerMessage, 0, len(recipients))
+	for _, recipient := range recipients {
+		serverMessages = append(serverMessages, DirectedServerMessage{
+			token: recipient.PrivateToken,
+			message: ServerMessage{
+				MessageType:    ServerMessageTypeReflectRoom,
+				MessageDetails: serverMessageReflection,
+				Status:         ServerMessageStatusOk,
+				ErrorMessage:   "",
+			},
+		})
+	}
+
+	return serverMessages
+}
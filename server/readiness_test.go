@@ -0,0 +1,307 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestViewerReadiness(t *testing.T) {
+	t.Run("holding the start until every viewer is ready", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice", "Bob")
+		room.sendReadiness(t, "Alice", true)
+		room.sendReadiness(t, "Bob", true)
+
+		room.reflect(t, PlayerStatePaused, 30)
+		room.assertMessages(t, "Alice", "ReflectRoom 2 30")
+		room.assertMessages(t, "Bob", "ReflectRoom 2 30")
+		room.reflect(t, PlayerStatePlaying, 30)
+
+		room.assertMessages(t, "Host", "ReflectRoom 2 30", "Waiting for Alice, Bob")
+		room.assertMessages(t, "Alice", "ReflectRoom 2 30", "Waiting for Alice, Bob")
+		room.assertMessages(t, "Bob", "ReflectRoom 2 30", "Waiting for Alice, Bob")
+
+		room.reflect(t, PlayerStatePlaying, 31)
+		room.reflect(t, PlayerStateBuffering, 31)
+		room.sendReadiness(t, "Alice", true)
+		room.assertMessages(t, "Bob", "Waiting for Bob")
+
+		room.clock.Advance(time.Second)
+		room.sendReadiness(t, "Bob", true)
+
+		startAt := room.clock.Now().Add(SynchronizedStartDelay).UnixMilli()
+		released := fmt.Sprintf("ReflectRoom 1 31 startAt %d", startAt)
+		room.assertMessages(t, "Host", "Waiting for Bob", released, "Nobody is waited for")
+		room.assertMessages(t, "Alice", "Waiting for Bob", released, "Nobody is waited for")
+		room.assertMessages(t, "Bob", released, "Nobody is waited for")
+
+		room.reflect(t, PlayerStatePlaying, 32)
+		room.assertMessages(t, "Bob", "ReflectRoom 1 32")
+	})
+
+	t.Run("releasing the start once the timeout passes", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice")
+		room.sendReadiness(t, "Alice", false)
+		room.reflect(t, PlayerStatePlaying, 0)
+		room.assertMessages(t, "Alice", "ReflectRoom 2 0", "Waiting for Alice")
+
+		room.clock.Advance(ViewerReadinessTimeout - time.Millisecond)
+		room.assertMessages(t, "Alice")
+
+		room.clock.Advance(time.Millisecond)
+		startAt := room.clock.Now().Add(SynchronizedStartDelay).UnixMilli()
+		room.waitForMessages(t, "Alice", fmt.Sprintf("ReflectRoom 1 0 startAt %d", startAt), "Nobody is waited for")
+	})
+
+	t.Run("reflecting as usual to viewers that don't report their readiness", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice")
+		room.reflect(t, PlayerStatePlaying, 12)
+		room.assertMessages(t, "Alice", "ReflectRoom 1 12")
+	})
+
+	t.Run("reflecting as usual in rooms that don't wait", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice")
+		room.updateSettings(t, RoomSettings{Name: "Test", WaitForViewers: false})
+		room.sendReadiness(t, "Alice", false)
+
+		room.reflect(t, PlayerStatePlaying, 12)
+		room.assertMessages(t, "Alice", "Settings changed", "ReflectRoom 1 12")
+	})
+
+	t.Run("keeping the host paused along with the viewers until the start", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice")
+		room.sendReadiness(t, "Alice", false)
+		room.reflect(t, PlayerStatePlaying, 12)
+		room.assertMessages(t, "Host", "ReflectRoom 2 12", "Waiting for Alice")
+
+		room.reflect(t, PlayerStatePlaying, 12.5)
+		room.reflect(t, PlayerStatePaused, 12.5)
+		room.assertMessages(t, "Alice", "ReflectRoom 2 12", "Waiting for Alice")
+
+		room.sendReadiness(t, "Alice", true)
+		startAt := room.clock.Now().Add(SynchronizedStartDelay).UnixMilli()
+		released := fmt.Sprintf("ReflectRoom 1 12.5 startAt %d", startAt)
+		room.assertMessages(t, "Host", released, "Nobody is waited for")
+		room.assertMessages(t, "Alice", released, "Nobody is waited for")
+
+		room.reflect(t, PlayerStatePlaying, 12.5)
+		room.assertMessages(t, "Alice", "ReflectRoom 1 12.5")
+	})
+
+	t.Run("cancelling the start once the host pauses elsewhere", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice")
+		room.sendReadiness(t, "Alice", false)
+		room.reflect(t, PlayerStatePlaying, 12)
+		room.assertMessages(t, "Alice", "ReflectRoom 2 12", "Waiting for Alice")
+
+		room.reflect(t, PlayerStatePaused, 40)
+		room.assertMessages(t, "Alice", "Nobody is waited for", "ReflectRoom 2 40")
+
+		room.clock.Advance(time.Minute)
+		room.assertMessages(t, "Alice")
+	})
+
+	t.Run("releasing the start once the viewers holding it leave", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice", "Bob")
+		room.sendReadiness(t, "Alice", false)
+		room.sendReadiness(t, "Bob", false)
+		room.reflect(t, PlayerStatePlaying, 12)
+		room.sendReadiness(t, "Alice", true)
+		room.assertMessages(t, "Alice", "ReflectRoom 2 12", "Waiting for Alice, Bob", "Waiting for Bob")
+
+		room.handle(t, "Bob", ClientMessageTypeDisconnectRoom, "")
+
+		startAt := room.clock.Now().Add(SynchronizedStartDelay).UnixMilli()
+		room.assertMessages(t, "Alice", "Bob left", fmt.Sprintf("ReflectRoom 1 12 startAt %d", startAt), "Nobody is waited for")
+	})
+
+	t.Run("releasing the start once the room stops waiting", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice")
+		room.sendReadiness(t, "Alice", false)
+		room.reflect(t, PlayerStatePlaying, 12)
+		room.assertMessages(t, "Alice", "ReflectRoom 2 12", "Waiting for Alice")
+
+		room.updateSettings(t, RoomSettings{Name: "Test", WaitForViewers: false})
+
+		startAt := room.clock.Now().Add(SynchronizedStartDelay).UnixMilli()
+		room.assertMessages(t, "Alice", "Settings changed", fmt.Sprintf("ReflectRoom 1 12 startAt %d", startAt), "Nobody is waited for")
+	})
+
+	t.Run("including the viewers holding the start in the room's record", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice", "Bob")
+		room.sendReadiness(t, "Alice", false)
+		room.reflect(t, PlayerStatePlaying, 12)
+
+		roomRecord := room.manager.activeRooms[room.members["Host"].RoomID].GetFilteredRoom()
+		if len(roomRecord.WaitingFor) != 1 || roomRecord.WaitingFor[0].Name != "Alice" {
+			t.Errorf("Expected the record to wait for Alice but got %+v\n", roomRecord.WaitingFor)
+		}
+	})
+}
+
+// testWaitingRoom is a room waiting for it's viewers, with the connections of it's members by name.
+type testWaitingRoom struct {
+	manager     *Manager
+	clock       *FakeClock
+	members     map[string]*Client
+	connections map[string]*testConnection
+}
+
+func newTestWaitingRoom(t *testing.T, viewerNames ...string) *testWaitingRoom {
+	t.Helper()
+
+	manager, clock := newTestManagerWithFakeClock()
+	room := &testWaitingRoom{manager: manager, clock: clock, members: make(map[string]*Client), connections: make(map[string]*testConnection)}
+
+	for _, name := range append([]string{"Host"}, viewerNames...) {
+		room.members[name], room.connections[name] = newTestRoomMember(t, manager, clock, name)
+	}
+
+	roomID := hostTestRoom(t, manager, room.members["Host"].PrivateToken).RoomID
+	room.updateSettings(t, RoomSettings{Name: "Test", WaitForViewers: true})
+
+	joinRoom, _ := json.Marshal(ClientRequestJoinRoom{RoomID: roomID})
+	for _, name := range viewerNames {
+		room.handle(t, name, ClientMessageTypeJoinRoom, string(joinRoom))
+	}
+
+	for name := range room.connections {
+		room.connections[name].getMessages()
+	}
+
+	return room
+}
+
+// Handles a client message of a member and sends the responses, like a connection would.
+func (room *testWaitingRoom) handle(t *testing.T, name string, messageType ClientMessageType, message string) {
+	t.Helper()
+
+	room.manager.mutex.Lock()
+	defer room.manager.mutex.Unlock()
+
+	serverMessages := room.manager.handleClientMessage(room.members[name], ClientMessage{ServerVersion: serverVersion, MessageType: messageType, Message: message})
+	for _, serverMessage := range serverMessages {
+		if serverMessage.message.Status != ServerMessageStatusOk {
+			t.Fatalf("Failed to handle %s of %s: %+v\n", messageType, name, serverMessage.message)
+		}
+	}
+
+	room.manager.sendDirectedMessages(serverMessages)
+}
+
+func (room *testWaitingRoom) reflect(t *testing.T, state int, currentTime float32) {
+	t.Helper()
+
+	reflection, _ := json.Marshal(RoomReflection{ID: "Video", State: state, CurrentTime: currentTime})
+	room.handle(t, "Host", ClientMessageTypeSendReflection, string(reflection))
+}
+
+func (room *testWaitingRoom) sendReadiness(t *testing.T, name string, isReady bool) {
+	t.Helper()
+
+	readiness, _ := json.Marshal(ClientRequestReadiness{Ready: isReady})
+	room.handle(t, name, ClientMessageTypeSendReadiness, string(readiness))
+}
+
+func (room *testWaitingRoom) updateSettings(t *testing.T, settings RoomSettings) {
+	t.Helper()
+
+	requestSettings, _ := json.Marshal(settings)
+	room.handle(t, "Host", ClientMessageTypeUpdateRoomSettings, string(requestSettings))
+}
+
+// Expects the messages a member received since the last check.
+func (room *testWaitingRoom) assertMessages(t *testing.T, name string, expected ...string) {
+	t.Helper()
+
+	received := describeReadinessMessages(room.connections[name].getMessages())
+	if strings.Join(received, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %s to receive %q but got %q\n", name, expected, received)
+	}
+}
+
+// Waits for the messages a member receives from the timeout's goroutine.
+func (room *testWaitingRoom) waitForMessages(t *testing.T, name string, expected ...string) {
+	t.Helper()
+
+	received := make([]string, 0)
+	for deadline := time.Now().Add(time.Second); len(received) < len(expected) && time.Now().Before(deadline); {
+		received = append(received, describeReadinessMessages(room.connections[name].getMessages())...)
+		time.Sleep(time.Millisecond)
+	}
+
+	if strings.Join(received, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected %s to receive %q but got %q\n", name, expected, received)
+	}
+}
+
+// Describes reflections by their state, time and start, countdowns by the seconds left, votes by their tally
+// and the room's updates by who it's waiting for.
+func describeReadinessMessages(messages []ServerMessage) []string {
+	descriptions := make([]string, 0, len(messages))
+	for _, message := range messages {
+		switch message.MessageType {
+		case ServerMessageTypeReflectRoom:
+			var reflection RoomReflection
+			json.Unmarshal(message.MessageDetails, &reflection)
+
+			description := fmt.Sprintf("ReflectRoom %d %g", reflection.State, reflection.CurrentTime)
+			if reflection.StartAt != 0 {
+				description += fmt.Sprintf(" startAt %d", reflection.StartAt)
+			}
+			descriptions = append(descriptions, description)
+		case ServerMessageTypeVote:
+			var vote ServerVote
+			json.Unmarshal(message.MessageDetails, &vote)
+
+			description := fmt.Sprintf("Vote %d %s %d-%d of %d", vote.VoteID, vote.Action, vote.InFavor, vote.Against, vote.Required)
+			if vote.Result != "" {
+				description += " " + string(vote.Result)
+			}
+			descriptions = append(descriptions, description)
+		case ServerMessageTypeCountdown:
+			var countdown ServerCountdown
+			json.Unmarshal(message.MessageDetails, &countdown)
+
+			descriptions = append(descriptions, fmt.Sprintf("Countdown %d", countdown.SecondsLeft))
+		case ServerMessageTypeUpdateRoom:
+			var delta RoomDelta
+			json.Unmarshal(message.MessageDetails, &delta)
+
+			switch delta.Type {
+			case RoomDeltaTypeWaitingChanged:
+				if len(delta.WaitingFor) == 0 {
+					descriptions = append(descriptions, "Nobody is waited for")
+					continue
+				}
+
+				names := make([]string, 0, len(delta.WaitingFor))
+				for _, viewer := range delta.WaitingFor {
+					names = append(names, viewer.Name)
+				}
+				descriptions = append(descriptions, "Waiting for "+strings.Join(names, ", "))
+			case RoomDeltaTypeViewerLeft:
+				descriptions = append(descriptions, delta.Client.Name+" left")
+			case RoomDeltaTypeSettingsChanged:
+				descriptions = append(descriptions, "Settings changed")
+			case RoomDeltaTypeRoleChanged:
+				if delta.Client.Role != ClientTypeCoHost {
+					descriptions = append(descriptions, delta.Client.Name+" is viewer")
+					continue
+				}
+
+				permissions := make([]string, 0, len(delta.Client.Permissions))
+				for _, permission := range delta.Client.Permissions {
+					permissions = append(permissions, string(permission))
+				}
+				descriptions = append(descriptions, delta.Client.Name+" is co-host "+strings.Join(permissions, ","))
+			}
+		default:
+			descriptions = append(descriptions, string(message.MessageType))
+		}
+	}
+
+	return descriptions
+}
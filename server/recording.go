@@ -0,0 +1,383 @@
+package main
+
+import (
+	"bufio"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cowatch/logger"
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+// RecordingFileExtension is the extension of the files a [Recorder] writes.
+const RecordingFileExtension = ".cwrec"
+
+type RecordingEntryType string
+
+const (
+	RecordingEntryTypeHeader        = "header"
+	RecordingEntryTypeClientMessage = "in"
+	RecordingEntryTypeServerMessage = "out"
+)
+
+// RecordingEntry is a single entry of a room's recording.
+// A recording starts with a header, followed by every client message handled for a member of the room
+// and the server messages that were sent as a result of it.
+type RecordingEntry struct {
+	Type   RecordingEntryType `json:"t"`
+	Offset time.Duration      `json:"o"`           // Monotonic time since the recording started
+	Token  Token              `json:"k,omitempty"` // The sender of a client message or the recipient of a server message
+
+	Header        *RecordingHeader `json:"h,omitempty"`
+	Client        *RecordedClient  `json:"c,omitempty"` // The sender as it was once it's message was handled
+	ClientMessage *ClientMessage   `json:"i,omitempty"`
+	ServerMessage *ServerMessage   `json:"s,omitempty"`
+}
+
+type RecordingHeader struct {
+	RoomID        RoomID    `json:"roomID"`
+	ServerVersion string    `json:"serverVersion"`
+	NodeID        NodeID    `json:"nodeID"`
+	StartedAt     time.Time `json:"startedAt"`
+}
+
+// RecordedClient is the state of a client the replay needs to stand in for it.
+//
+// Private tokens are live credentials, so every private token of a recording is replaced by an alias.
+type RecordedClient struct {
+	PrivateToken Token      `json:"privateToken"`
+	PublicToken  Token      `json:"publicToken"`
+	Name         string     `json:"name"`
+	Image        string     `json:"image"`
+	Locale       Locale     `json:"locale,omitempty"`
+	Type         ClientType `json:"type"`
+	RoomID       RoomID     `json:"roomID,omitempty"`
+}
+
+// Recorder writes the messages exchanged in every room hosted on the node to a file per room,
+// so issues reported in a room can be reproduced with [ReplayRecording].
+//
+// Only messages handled for clients are recorded, messages sent on behalf of the server (e.g. announcements
+// or a room closed through the admin api) aren't part of the recording.
+type Recorder struct {
+	directory string
+
+	mutex      sync.Mutex
+	recordings map[RoomID]*roomRecording
+}
+
+type roomRecording struct {
+	file       *os.File
+	writer     *bufio.Writer
+	encoder    *msgpack.Encoder
+	startedAt  time.Time
+	isFinished bool // The room was closed, the recording is closed once the message closing it is recorded
+
+	aliasSalt []byte          // Makes the aliases of the private tokens unique to the recording
+	aliases   map[Token]Token // The private tokens of the recorded clients and the aliases they're recorded as
+}
+
+// NewRecorder creates a recorder writing to the directory, creating it if it doesn't exist.
+func NewRecorder(directory string) (*Recorder, error) {
+	if errorCreating := os.MkdirAll(directory, 0700); errorCreating != nil {
+		return nil, errorCreating
+	}
+
+	return &Recorder{directory: directory, recordings: make(map[RoomID]*roomRecording)}, nil
+}
+
+func newRecordingEncoder(writer io.Writer) *msgpack.Encoder {
+	encoder := msgpack.NewEncoder(writer)
+	encoder.SetCustomStructTag("json")
+	encoder.UseCompactInts(true)
+
+	return encoder
+}
+
+// Starts a new recording for the room, named after the room and the time it started.
+func (recorder *Recorder) startRecording(header RecordingHeader) error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	fileName := fmt.Sprintf("room_%s_%s%s", header.RoomID, header.StartedAt.Format("2006_01_02_15_04_05.000"), RecordingFileExtension)
+	file, errorCreating := os.OpenFile(filepath.Join(recorder.directory, fileName), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if errorCreating != nil {
+		return errorCreating
+	}
+
+	aliasSalt := make([]byte, 16)
+	rand.Read(aliasSalt)
+
+	writer := bufio.NewWriter(file)
+	recording := &roomRecording{
+		file:      file,
+		writer:    writer,
+		encoder:   newRecordingEncoder(writer),
+		startedAt: header.StartedAt,
+		aliasSalt: aliasSalt,
+		aliases:   make(map[Token]Token),
+	}
+	recorder.recordings[header.RoomID] = recording
+
+	return recording.write(RecordingEntry{Type: RecordingEntryTypeHeader, Header: &header})
+}
+
+// Appends the entries to the recording of the room if it's being recorded, as recorded at the given time.
+func (recorder *Recorder) record(roomID RoomID, entries []RecordingEntry, now time.Time) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	recording, exists := recorder.recordings[roomID]
+	if !exists {
+		return
+	}
+
+	offset := now.Sub(recording.startedAt)
+	for _, entry := range recording.aliasPrivateTokens(entries) {
+		entry.Offset = offset
+		if errorWriting := recording.write(entry); errorWriting != nil {
+			logger.Error("[%s] [Recorder] Failed to record, stopping the recording: %s\n", roomID, errorWriting)
+			recording.close()
+			delete(recorder.recordings, roomID)
+			return
+		}
+	}
+}
+
+// Marks the recording of a closed room as finished.
+func (recorder *Recorder) finishRecording(roomID RoomID) {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if recording, exists := recorder.recordings[roomID]; exists {
+		recording.isFinished = true
+	}
+}
+
+// Closes the recordings of every closed room.
+func (recorder *Recorder) closeFinishedRecordings() {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	for roomID, recording := range recorder.recordings {
+		if !recording.isFinished {
+			continue
+		}
+
+		if errorClosing := recording.close(); errorClosing != nil {
+			logger.Error("[%s] [Recorder] Failed to close the recording: %s\n", roomID, errorClosing)
+		}
+		delete(recorder.recordings, roomID)
+	}
+}
+
+// Close stops every recording, the recordings of rooms that are still open end where they were.
+func (recorder *Recorder) Close() error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	var errorsClosing []error
+	for roomID, recording := range recorder.recordings {
+		errorsClosing = append(errorsClosing, recording.close())
+		delete(recorder.recordings, roomID)
+	}
+
+	return errors.Join(errorsClosing...)
+}
+
+// Copies the entries with every private token they hold replaced by it's alias, including the ones in messages
+// like the response to an authorization.
+func (recording *roomRecording) aliasPrivateTokens(entries []RecordingEntry) []RecordingEntry {
+	for _, entry := range entries {
+		recording.learnAlias(entry.Token)
+		if entry.Client != nil {
+			recording.learnAlias(entry.Client.PrivateToken)
+		}
+
+		var requestAuthorize ClientRequestAuthorizeRoom
+		if entry.ClientMessage != nil && entry.ClientMessage.MessageType == ClientMessageTypeAuthorize &&
+			json.Unmarshal([]byte(entry.ClientMessage.Message), &requestAuthorize) == nil {
+
+			recording.learnAlias(requestAuthorize.PrivateToken)
+		}
+	}
+
+	replacements := make([]string, 0, len(recording.aliases)*2)
+	for privateToken, alias := range recording.aliases {
+		replacements = append(replacements, string(privateToken), string(alias))
+	}
+	replacer := strings.NewReplacer(replacements...)
+
+	aliasedEntries := make([]RecordingEntry, 0, len(entries))
+	for _, entry := range entries {
+		if entry.Token != "" {
+			entry.Token = recording.aliases[entry.Token]
+		}
+
+		if entry.Client != nil {
+			client := *entry.Client
+			client.PrivateToken = recording.aliases[client.PrivateToken]
+			entry.Client = &client
+		}
+
+		if entry.ClientMessage != nil {
+			clientMessage := *entry.ClientMessage
+			clientMessage.Message = replacer.Replace(clientMessage.Message)
+			entry.ClientMessage = &clientMessage
+		}
+
+		if entry.ServerMessage != nil {
+			serverMessage := *entry.ServerMessage
+			serverMessage.MessageDetails = json.RawMessage(replacer.Replace(string(serverMessage.MessageDetails)))
+			serverMessage.ErrorDetails = json.RawMessage(replacer.Replace(string(serverMessage.ErrorDetails)))
+			entry.ServerMessage = &serverMessage
+		}
+
+		aliasedEntries = append(aliasedEntries, entry)
+	}
+
+	return aliasedEntries
+}
+
+// Aliases are salted hashes, so they have the same length and can't be told apart from a private token
+// without the salt, which is never written.
+func (recording *roomRecording) learnAlias(privateToken Token) {
+	if _, isKnown := recording.aliases[privateToken]; isKnown || privateToken == "" {
+		return
+	}
+
+	hash := sha256.Sum256(append(slices.Clone(recording.aliasSalt), privateToken...))
+	recording.aliases[privateToken] = Token(hex.EncodeToString(hash[:16]))
+}
+
+// Writes an entry, flushing it right away so the recording of a crashed server is complete.
+func (recording *roomRecording) write(entry RecordingEntry) error {
+	if errorEncoding := recording.encoder.Encode(entry); errorEncoding != nil {
+		return errorEncoding
+	}
+
+	return recording.writer.Flush()
+}
+
+func (recording *roomRecording) close() error {
+	errorFlushing := recording.writer.Flush()
+	errorClosing := recording.file.Close()
+
+	return errors.Join(errorFlushing, errorClosing)
+}
+
+// ReadRecording decodes every entry of a recording written by a [Recorder].
+// A recording cut off by a crash is read up to it's last complete entry.
+func ReadRecording(reader io.Reader) (RecordingHeader, []RecordingEntry, error) {
+	decoder := msgpack.NewDecoder(bufio.NewReader(reader))
+	decoder.SetCustomStructTag("json")
+
+	var headerEntry RecordingEntry
+	if errorDecoding := decoder.Decode(&headerEntry); errorDecoding != nil {
+		return RecordingHeader{}, nil, fmt.Errorf("Failed to read the recording's header: %w", errorDecoding)
+	}
+
+	if headerEntry.Type != RecordingEntryTypeHeader || headerEntry.Header == nil {
+		return RecordingHeader{}, nil, fmt.Errorf("The recording doesn't start with a header but with %q", headerEntry.Type)
+	}
+
+	entries := make([]RecordingEntry, 0)
+	for {
+		var entry RecordingEntry
+		errorDecoding := decoder.Decode(&entry)
+		if errors.Is(errorDecoding, io.EOF) || errors.Is(errorDecoding, io.ErrUnexpectedEOF) {
+			break
+		}
+
+		if errorDecoding != nil {
+			return *headerEntry.Header, entries, errorDecoding
+		}
+
+		entries = append(entries, entry)
+	}
+
+	return *headerEntry.Header, entries, nil
+}
+
+// SetRecorder starts recording every room created from now on, nil stops recording.
+func (manager *Manager) SetRecorder(recorder *Recorder) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	manager.recorder = recorder
+}
+
+// Starts recording a room that was just created, expects the manager to be locked.
+func (manager *Manager) startRecording(room *Room) {
+	if manager.recorder == nil {
+		return
+	}
+
+	errorStarting := manager.recorder.startRecording(RecordingHeader{
+		RoomID:        room.RoomID,
+		ServerVersion: manager.serverVersion,
+		NodeID:        manager.backplane.GetNodeID(),
+		StartedAt:     manager.clock.Now(),
+	})
+
+	if errorStarting != nil {
+		logger.Error("[%s] [Recorder] Failed to start recording: %s\n", room.RoomID, errorStarting)
+	}
+}
+
+// Records a handled client message along with it's responses in the recordings of the rooms the client
+// was in before and after it, expects the manager to be locked.
+func (manager *Manager) recordClientMessage(senderToken Token, previousRoomID RoomID, client *Client, clientMessage ClientMessage, serverMessages []DirectedServerMessage) {
+	if manager.recorder == nil {
+		return
+	}
+
+	entries := make([]RecordingEntry, 0, len(serverMessages)+1)
+	entries = append(entries, RecordingEntry{
+		Type:  RecordingEntryTypeClientMessage,
+		Token: senderToken,
+		Client: &RecordedClient{
+			PrivateToken: client.PrivateToken,
+			PublicToken:  client.PublicToken,
+			Name:         client.Name,
+			Image:        client.Image,
+			Locale:       client.Locale,
+			Type:         client.Type,
+			RoomID:       client.RoomID,
+		},
+		ClientMessage: &clientMessage,
+	})
+
+	for index := range serverMessages {
+		if serverMessages[index].message.MessageType == "" {
+			continue
+		}
+
+		entries = append(entries, RecordingEntry{
+			Type:          RecordingEntryTypeServerMessage,
+			Token:         serverMessages[index].token,
+			ServerMessage: &serverMessages[index].message,
+		})
+	}
+
+	if previousRoomID != "" {
+		manager.recorder.record(previousRoomID, entries, manager.clock.Now())
+	}
+
+	if client.RoomID != "" && client.RoomID != previousRoomID {
+		manager.recorder.record(client.RoomID, entries, manager.clock.Now())
+	}
+
+	manager.recorder.closeFinishedRecordings()
+}
@@ -0,0 +1,261 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/cowatch/client"
+)
+
+func TestRecording(t *testing.T) {
+	t.Run("recording every message of a room until it's closed", func(t *testing.T) {
+		recordingPath, room := recordTestRoom(t)
+
+		recording, err := os.ReadFile(recordingPath)
+		if err != nil {
+			t.Fatalf("Failed to read the recording: %v\n", err)
+		}
+
+		header, entries, err := ReadRecording(bytes.NewReader(recording))
+		if err != nil || header.RoomID != room.RoomID || header.ServerVersion != serverVersion {
+			t.Fatalf("Expected the recording of room %q but got %+v %v\n", room.RoomID, header, err)
+		}
+
+		if entries[0].Type != RecordingEntryTypeClientMessage || entries[0].ClientMessage.MessageType != ClientMessageTypeHostRoom {
+			t.Errorf("Expected the recording to start with the room being hosted but got %+v\n", entries[0])
+		}
+
+		lastEntry := entries[len(entries)-1]
+		if lastEntry.Type != RecordingEntryTypeServerMessage || lastEntry.ServerMessage.MessageType != ServerMessageTypeDisconnectRoom {
+			t.Errorf("Expected the recording to end with the room being closed but got %+v\n", lastEntry)
+		}
+
+		messageTypes := make([]string, 0)
+		for index, entry := range entries {
+			if index > 0 && entry.Offset < entries[index-1].Offset {
+				t.Errorf("Expected monotonic offsets but entry %d went from %s to %s\n", index, entries[index-1].Offset, entry.Offset)
+			}
+
+			if entry.Type == RecordingEntryTypeClientMessage {
+				messageTypes = append(messageTypes, string(entry.ClientMessage.MessageType))
+			}
+		}
+
+		expectedMessageTypes := "HostRoom JoinRoom SendReflection SendReflection UpdateRoomSettings Authorize AttemptReconnect SendReflection DisconnectRoom DisconnectRoom"
+		if strings.Join(messageTypes, " ") != expectedMessageTypes {
+			t.Errorf("Expected the client messages %q but got %q\n", expectedMessageTypes, strings.Join(messageTypes, " "))
+		}
+
+		_, truncatedEntries, err := ReadRecording(bytes.NewReader(recording[:len(recording)-3]))
+		if err != nil || len(truncatedEntries) != len(entries)-1 {
+			t.Errorf("Expected a truncated recording to be read up to it's last entry but got %d of %d entries %v\n", len(truncatedEntries), len(entries), err)
+		}
+	})
+
+	t.Run("offsetting the entries by the manager's clock", func(t *testing.T) {
+		recordingDirectory := t.TempDir()
+		recorder, _ := NewRecorder(recordingDirectory)
+		manager, clock := newTestManagerWithFakeClock()
+		manager.SetRecorder(recorder)
+
+		host := newTestAuthorizedClient(t, manager, clock, "Host")
+		manager.handleClientMessage(host, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeHostRoom, Message: `{"name":"Recorded"}`})
+		clock.Advance(12 * time.Minute)
+		manager.handleClientMessage(host, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeSendReflection, Message: `{"id":"Video","state":1,"time":720}`})
+		recorder.Close()
+
+		recordingPaths, _ := filepath.Glob(filepath.Join(recordingDirectory, "*"+RecordingFileExtension))
+		recording, _ := os.ReadFile(recordingPaths[0])
+		_, entries, err := ReadRecording(bytes.NewReader(recording))
+		if err != nil || len(entries) != 3 || entries[0].Offset != 0 || entries[2].Offset != 12*time.Minute {
+			t.Errorf("Expected the reflection to be recorded 12 minutes in but got %+v %v\n", entries, err)
+		}
+	})
+
+	t.Run("replaying the time between messages", func(t *testing.T) {
+		recordingDirectory := t.TempDir()
+		recorder, _ := NewRecorder(recordingDirectory)
+		manager, clock := newTestManagerWithFakeClock()
+		manager.SetRecorder(recorder)
+
+		host := newTestAuthorizedClient(t, manager, clock, "Host")
+		viewer := newTestAuthorizedClient(t, manager, clock, "Viewer")
+		manager.handleClientMessage(host, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeHostRoom, Message: `{"name":"Recorded","controlMode":"EVERYONE"}`})
+		joinRoom, _ := json.Marshal(ClientRequestJoinRoom{RoomID: host.RoomID})
+		manager.handleClientMessage(viewer, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeJoinRoom, Message: string(joinRoom)})
+
+		// Replayed back to back, the host's intent would come too soon after the viewer's
+		manager.handleClientMessage(viewer, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeSendIntent, Message: `{"action":"PAUSE","time":10}`})
+		clock.Advance(2 * ControlIntentInterval)
+		manager.handleClientMessage(host, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeSendIntent, Message: `{"action":"PLAY","time":10}`})
+		recorder.Close()
+
+		recordingPaths, _ := filepath.Glob(filepath.Join(recordingDirectory, "*"+RecordingFileExtension))
+		recording, _ := os.ReadFile(recordingPaths[0])
+		result, err := ReplayRecording(bytes.NewReader(recording))
+		if err != nil || result.ClientMessages != 4 || len(result.Mismatches) != 0 {
+			t.Errorf("Expected the replay to match the recording but got %+v %v\n", result, err)
+		}
+	})
+
+	t.Run("keeping the private tokens out of recordings", func(t *testing.T) {
+		recordingDirectory := t.TempDir()
+		recorder, _ := NewRecorder(recordingDirectory)
+		manager, clock := newTestManagerWithFakeClock()
+		manager.SetRecorder(recorder)
+
+		host := newTestAuthorizedClient(t, manager, clock, "Host")
+		viewer, _ := newTestRoomMember(t, manager, clock, "Viewer")
+		manager.handleClientMessage(host, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeHostRoom, Message: `{"name":"Recorded"}`})
+		joinRoom, _ := json.Marshal(ClientRequestJoinRoom{RoomID: host.RoomID})
+		manager.handleClientMessage(viewer, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeJoinRoom, Message: string(joinRoom)})
+
+		// The viewer reconnects, sending it's private token and getting it back
+		reconnectedViewer := NewClient(manager.GenerateToken())
+		var connection Connection = &testConnection{}
+		manager.connectionManager.RegisterClientConnection(reconnectedViewer.PrivateToken, &connection)
+		manager.RegisterClient(reconnectedViewer)
+		authorize, _ := json.Marshal(ClientRequestAuthorizeRoom{Name: "Viewer", PrivateToken: viewer.PrivateToken})
+		manager.handleClientMessage(reconnectedViewer, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeAuthorize, Message: string(authorize)})
+		manager.handleClientMessage(reconnectedViewer, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeAttemptReconnect})
+		recorder.Close()
+
+		recordingPaths, _ := filepath.Glob(filepath.Join(recordingDirectory, "*"+RecordingFileExtension))
+		recording, _ := os.ReadFile(recordingPaths[0])
+		for _, privateToken := range []Token{host.PrivateToken, viewer.PrivateToken, reconnectedViewer.PrivateToken} {
+			if bytes.Contains(recording, []byte(privateToken)) {
+				t.Errorf("Expected the private token %s to be left out of the recording\n", privateToken)
+			}
+		}
+
+		result, err := ReplayRecording(bytes.NewReader(recording))
+		if err != nil || result.ClientMessages != 4 || len(result.Mismatches) != 0 {
+			t.Errorf("Expected the replay to match the recording but got %+v %v\n", result, err)
+		}
+	})
+
+	t.Run("replaying a recording as it was recorded", func(t *testing.T) {
+		recordingPath, _ := recordTestRoom(t)
+
+		var report bytes.Buffer
+		if exitCode := runReplay(recordingPath, &report); exitCode != 0 {
+			t.Fatalf("Expected the replay to match the recording but got:\n%s", report.String())
+		}
+
+		if !strings.Contains(report.String(), "10 client messages") {
+			t.Errorf("Expected every client message to be replayed but got:\n%s", report.String())
+		}
+	})
+
+	t.Run("reporting messages handled differently than recorded", func(t *testing.T) {
+		recordingPath, _ := recordTestRoom(t)
+
+		recording, _ := os.ReadFile(recordingPath)
+		header, entries, _ := ReadRecording(bytes.NewReader(recording))
+
+		for _, entry := range entries {
+			if entry.Type == RecordingEntryTypeServerMessage && entry.ServerMessage.MessageType == ServerMessageTypeReflectRoom {
+				entry.ServerMessage.MessageDetails, _ = json.Marshal(RoomReflection{ID: "Tampered", State: 1, CurrentTime: 1})
+				break
+			}
+		}
+
+		var tampered bytes.Buffer
+		encoder := newRecordingEncoder(&tampered)
+		encoder.Encode(RecordingEntry{Type: RecordingEntryTypeHeader, Header: &header})
+		for _, entry := range entries {
+			encoder.Encode(entry)
+		}
+
+		result, err := ReplayRecording(&tampered)
+		if err != nil || len(result.Mismatches) != 1 {
+			t.Fatalf("Expected a single mismatch but got %+v %v\n", result.Mismatches, err)
+		}
+
+		mismatch := result.Mismatches[0]
+		if mismatch.ClientMessage.MessageType != ClientMessageTypeSendReflection ||
+			!strings.Contains(strings.Join(mismatch.Expected, "\n"), "Tampered") ||
+			!strings.Contains(strings.Join(mismatch.Received, "\n"), "Video") {
+			t.Errorf("Got unexpected mismatch %+v\n", mismatch)
+		}
+	})
+}
+
+// Records a room where a viewer joins, gets rejected reflecting, reconnects and leaves before the host closes it.
+func recordTestRoom(t *testing.T) (string, RoomRecord) {
+	t.Helper()
+
+	recordingDirectory := t.TempDir()
+	recorder, err := NewRecorder(recordingDirectory)
+	if err != nil {
+		t.Fatalf("Failed to create the recorder: %v\n", err)
+	}
+	t.Cleanup(func() { recorder.Close() })
+
+	manager := NewManager(serverVersion, NewGorillaConnectionManager())
+	manager.SetRecorder(recorder)
+
+	mockServer, _ := newTestServer(t, testServerOptions{manager: manager})
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	host := dialClientLibrary(t, ctx, mockServer, "Host")
+	room, err := host.HostRoom(ctx, RoomSettings{Name: "Recorded"})
+	if err != nil {
+		t.Fatalf("Failed to host: %v\n", err)
+	}
+
+	viewer := dialClientLibrary(t, ctx, mockServer, "Viewer")
+	if _, err := viewer.JoinRoom(ctx, room.RoomID); err != nil {
+		t.Fatalf("Failed to join: %v\n", err)
+	}
+
+	if err := host.Reflect(ctx, RoomReflection{ID: "Video", State: 1, CurrentTime: 12.5}); err != nil {
+		t.Fatalf("Failed to reflect: %v\n", err)
+	}
+
+	if err := viewer.Reflect(ctx, RoomReflection{ID: "Video"}); !client.IsServerError(err, ServerErrorCodeClientNotHost) {
+		t.Fatalf("Expected the viewer's reflection to be rejected but got %v\n", err)
+	}
+
+	if _, err := host.UpdateRoomSettings(ctx, RoomSettings{Name: "Renamed"}); err != nil {
+		t.Fatalf("Failed to rename: %v\n", err)
+	}
+
+	if joinRoom, err := viewer.AttemptReconnect(ctx); err != nil || joinRoom == nil {
+		t.Fatalf("Failed to reconnect: %+v %v\n", joinRoom, err)
+	}
+
+	if err := host.Reflect(ctx, RoomReflection{ID: "Video", State: 2, CurrentTime: 20}); err != nil {
+		t.Fatalf("Failed to reflect: %v\n", err)
+	}
+
+	if err := viewer.DisconnectRoom(ctx); err != nil {
+		t.Fatalf("Failed to leave: %v\n", err)
+	}
+
+	if err := host.DisconnectRoom(ctx); err != nil {
+		t.Fatalf("Failed to close the room: %v\n", err)
+	}
+
+	recordingPaths, _ := filepath.Glob(filepath.Join(recordingDirectory, "room_"+string(room.RoomID)+"_*"+RecordingFileExtension))
+	if len(recordingPaths) != 1 {
+		t.Fatalf("Expected a single recording of room %q but got %v\n", room.RoomID, recordingPaths)
+	}
+
+	recorder.mutex.Lock()
+	_, isRecording := recorder.recordings[room.RoomID]
+	recorder.mutex.Unlock()
+
+	if isRecording {
+		t.Errorf("Expected the recording to be closed with the room\n")
+	}
+
+	return recordingPaths[0], room
+}
@@ -0,0 +1,352 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/cowatch/logger"
+)
+
+const EndpointReleases = "/releases"
+const EndpointLatestRelease = "/releases/{browser}/latest"
+const EndpointDownloadLatest = "/download/{browser}"
+const EndpointDownloadVersion = "/download/{browser}/{version}"
+
+// The manifest listing every release, found inside the download directory.
+const FileReleaseManifest = "releases.json"
+
+// A specific version never changes once released, while the latest release and the listings
+// change with every release so caches must revalidate them.
+const CacheControlVersionedRelease = "public, max-age=31536000, immutable"
+const CacheControlLatestRelease = "no-cache"
+
+type Browser string
+
+const (
+	BrowserChromium Browser = "chromium"
+	BrowserGecko    Browser = "gecko"
+)
+
+var browserContentTypes = map[Browser]string{
+	BrowserChromium: "application/x-chrome-extension",
+	BrowserGecko:    "application/x-xpinstall",
+}
+
+// Filenames may only contain a flat name with a known package extension, so a release
+// can never point outside of the download directory.
+var releaseFilenamePattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]*\.(crx|xpi|zip)$`)
+
+var ErrInvalidReleaseFilename = errors.New("Release filename must be a plain .crx, .xpi or .zip file name")
+var ErrInvalidReleaseBrowser = errors.New("Release browser must be either chromium or gecko")
+var ErrInvalidReleaseVersion = errors.New("Release version must be a dot separated list of numbers")
+var ErrInvalidReleaseSHA256 = errors.New("Release sha256 must be 64 hexadecimal characters")
+var ErrDuplicateRelease = errors.New("Release version is listed more than once for the same browser")
+var ErrReleaseSHA256Mismatch = errors.New("Release sha256 doesn't match the hash of it's file")
+
+// Release describes a packaged version of the extension for a single browser.
+type Release struct {
+	Version           string  `json:"version"`
+	Browser           Browser `json:"browser"`
+	Filename          string  `json:"filename"`
+	SHA256            string  `json:"sha256"`
+	ReleaseNotes      string  `json:"releaseNotes"`
+	MinServerProtocol string  `json:"minServerProtocol"` // The oldest server version the release can talk to
+}
+
+type ReleaseManifest struct {
+	Releases []Release `json:"releases"`
+}
+
+// ReleaseRegistry serves the extension releases listed in the manifest of a directory.
+type ReleaseRegistry struct {
+	directory     string
+	serverVersion string
+	releases      []Release
+	downloads     *DownloadCounter
+}
+
+// LoadReleaseRegistry reads and validates the release manifest of the directory.
+// A directory without a manifest results in an empty registry.
+func LoadReleaseRegistry(directory string, serverVersion string) (*ReleaseRegistry, error) {
+	registry := &ReleaseRegistry{
+		directory:     directory,
+		serverVersion: serverVersion,
+		releases:      make([]Release, 0),
+		downloads:     NewDownloadCounter(),
+	}
+
+	rawManifest, errorReading := os.ReadFile(filepath.Join(directory, FileReleaseManifest))
+	if os.IsNotExist(errorReading) {
+		logger.Warn("No release manifest found in %q\n", directory)
+		return registry, nil
+	}
+
+	if errorReading != nil {
+		return nil, errorReading
+	}
+
+	var manifest ReleaseManifest
+	if errorParsing := json.Unmarshal(rawManifest, &manifest); errorParsing != nil {
+		return nil, errorParsing
+	}
+
+	for _, release := range manifest.Releases {
+		if errorValidating := validateRelease(release); errorValidating != nil {
+			return nil, fmt.Errorf("%s %s: %w", release.Browser, release.Version, errorValidating)
+		}
+
+		if _, exists := registry.GetRelease(release.Browser, release.Version); exists {
+			return nil, fmt.Errorf("%s %s: %w", release.Browser, release.Version, ErrDuplicateRelease)
+		}
+
+		release.SHA256 = strings.ToLower(release.SHA256)
+		if errorVerifying := verifyReleaseFile(directory, release); errorVerifying != nil {
+			return nil, fmt.Errorf("%s %s: %w", release.Browser, release.Version, errorVerifying)
+		}
+
+		registry.releases = append(registry.releases, release)
+	}
+
+	// Newest releases first, as that's what both clients and browsers are looking for.
+	slices.SortStableFunc(registry.releases, func(a, b Release) int {
+		if a.Browser != b.Browser {
+			return strings.Compare(string(a.Browser), string(b.Browser))
+		}
+
+		comparison, _ := CompareVersions(b.Version, a.Version)
+		return comparison
+	})
+
+	logger.Info("Loaded %d releases from %q\n", len(registry.releases), directory)
+	return registry, nil
+}
+
+func validateRelease(release Release) error {
+	if _, isKnownBrowser := browserContentTypes[release.Browser]; !isKnownBrowser {
+		return ErrInvalidReleaseBrowser
+	}
+
+	if _, isValidVersion := parseVersion(release.Version); !isValidVersion {
+		return ErrInvalidReleaseVersion
+	}
+
+	if release.MinServerProtocol != "" {
+		if _, isValidVersion := parseVersion(release.MinServerProtocol); !isValidVersion {
+			return ErrInvalidReleaseVersion
+		}
+	}
+
+	if !IsValidReleaseFilename(release.Filename) {
+		return ErrInvalidReleaseFilename
+	}
+
+	if decodedHash, errorDecoding := hex.DecodeString(release.SHA256); errorDecoding != nil || len(decodedHash) != 32 {
+		return ErrInvalidReleaseSHA256
+	}
+
+	return nil
+}
+
+// Hashes the file of a release, as the digests and update manifests advertised for it come from it's sha256.
+func verifyReleaseFile(directory string, release Release) error {
+	releaseFile, errorOpening := os.Open(filepath.Join(directory, release.Filename))
+	if errorOpening != nil {
+		return errorOpening
+	}
+	defer releaseFile.Close()
+
+	hash := sha256.New()
+	if _, errorHashing := io.Copy(hash, releaseFile); errorHashing != nil {
+		return errorHashing
+	}
+
+	if hex.EncodeToString(hash.Sum(nil)) != release.SHA256 {
+		return ErrReleaseSHA256Mismatch
+	}
+
+	return nil
+}
+
+// IsValidReleaseFilename reports whether the filename is a plain package name without any path.
+func IsValidReleaseFilename(filename string) bool {
+	return releaseFilenamePattern.MatchString(filename) &&
+		!strings.Contains(filename, "..") &&
+		filepath.Base(filename) == filename
+}
+
+// ListReleases returns every release, grouped by browser with the newest versions first.
+func (registry *ReleaseRegistry) ListReleases() []Release {
+	return slices.Clone(registry.releases)
+}
+
+func (registry *ReleaseRegistry) GetRelease(browser Browser, version string) (Release, bool) {
+	for _, release := range registry.releases {
+		if release.Browser != browser {
+			continue
+		}
+
+		if comparison, isValid := CompareVersions(release.Version, version); isValid && comparison == 0 {
+			return release, true
+		}
+	}
+
+	return Release{}, false
+}
+
+// GetLatestRelease returns the newest release of the browser that can talk to this server.
+func (registry *ReleaseRegistry) GetLatestRelease(browser Browser) (Release, bool) {
+	compatibleReleases := registry.GetCompatibleReleases(browser)
+	if len(compatibleReleases) == 0 {
+		return Release{}, false
+	}
+
+	return compatibleReleases[0], true
+}
+
+// GetCompatibleReleases returns every release of the browser that can talk to this server,
+// with the newest versions first.
+func (registry *ReleaseRegistry) GetCompatibleReleases(browser Browser) []Release {
+	compatibleReleases := make([]Release, 0)
+	for _, release := range registry.releases {
+		if release.Browser == browser && registry.isCompatible(release) {
+			compatibleReleases = append(compatibleReleases, release)
+		}
+	}
+
+	return compatibleReleases
+}
+
+func (registry *ReleaseRegistry) isCompatible(release Release) bool {
+	if release.MinServerProtocol == "" {
+		return true
+	}
+
+	comparison, isValid := CompareVersions(release.MinServerProtocol, registry.serverVersion)
+	return isValid && comparison <= 0
+}
+
+// HandleListReleases responds with every release as JSON.
+func (registry *ReleaseRegistry) HandleListReleases(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", CacheControlLatestRelease)
+	writeJSONResponse(w, registry.ListReleases())
+}
+
+// HandleLatestRelease responds with the details of the latest release of a browser as JSON.
+func (registry *ReleaseRegistry) HandleLatestRelease(w http.ResponseWriter, r *http.Request) {
+	release, exists := registry.GetLatestRelease(Browser(r.PathValue("browser")))
+	if !exists {
+		http.Error(w, "No release found.", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Cache-Control", CacheControlLatestRelease)
+	writeJSONResponse(w, release)
+}
+
+// HandleDownloadLatest serves the package of the latest release of a browser.
+func (registry *ReleaseRegistry) HandleDownloadLatest(w http.ResponseWriter, r *http.Request) {
+	browser := Browser(r.PathValue("browser"))
+	logger.Info("Requested latest download for %q\n", browser)
+
+	release, exists := registry.GetLatestRelease(browser)
+	if !exists {
+		http.Error(w, fmt.Sprintf("No release found for %q.", browser), http.StatusNotFound)
+		return
+	}
+
+	registry.serveRelease(w, r, release, CacheControlLatestRelease)
+}
+
+// HandleDownloadVersion serves the package of a specific release of a browser.
+func (registry *ReleaseRegistry) HandleDownloadVersion(w http.ResponseWriter, r *http.Request) {
+	browser := Browser(r.PathValue("browser"))
+	version := r.PathValue("version")
+	logger.Info("Requested download for %q %q\n", browser, version)
+
+	release, exists := registry.GetRelease(browser, version)
+	if !exists {
+		http.Error(w, fmt.Sprintf("Release %q doesn't exist.", version), http.StatusNotFound)
+		return
+	}
+
+	registry.serveRelease(w, r, release, CacheControlVersionedRelease)
+}
+
+// Serves the package of a release with the headers browsers need to cache, resume and verify it.
+// Conditional and range requests are handled by [http.ServeContent] based on the ETag and modification time.
+func (registry *ReleaseRegistry) serveRelease(w http.ResponseWriter, r *http.Request, release Release, cacheControl string) {
+	// The filename was validated while loading, this guards against registries built any other way.
+	if !IsValidReleaseFilename(release.Filename) {
+		logger.Error("Refusing to serve invalid release filename %q\n", release.Filename)
+		http.Error(w, "Release unavailable.", http.StatusNotFound)
+		return
+	}
+
+	releasePath := filepath.Join(registry.directory, release.Filename)
+	releaseFile, errorOpening := os.Open(releasePath)
+	if errorOpening != nil {
+		logger.Error("Release file %q is missing: %v\n", releasePath, errorOpening)
+		http.Error(w, "Release unavailable.", http.StatusNotFound)
+		return
+	}
+	defer releaseFile.Close()
+
+	releaseFileInfo, errorStating := releaseFile.Stat()
+	if errorStating != nil || releaseFileInfo.IsDir() {
+		logger.Error("Release file %q is unreadable: %v\n", releasePath, errorStating)
+		http.Error(w, "Release unavailable.", http.StatusNotFound)
+		return
+	}
+
+	rawHash, _ := hex.DecodeString(release.SHA256)
+	encodedHash := base64.StdEncoding.EncodeToString(rawHash)
+
+	w.Header().Set("Content-Type", browserContentTypes[release.Browser])
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", release.Filename))
+	w.Header().Set("Cache-Control", cacheControl)
+	w.Header().Set("ETag", fmt.Sprintf("%q", release.SHA256))
+	w.Header().Set("Digest", "sha-256="+encodedHash)
+	w.Header().Set("Repr-Digest", "sha-256=:"+encodedHash+":")
+
+	statusRecorder := &statusRecordingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+	http.ServeContent(statusRecorder, r, release.Filename, releaseFileInfo.ModTime(), releaseFile)
+
+	// Only complete downloads are counted so resumed downloads and revalidations aren't counted twice.
+	if r.Method == http.MethodGet && statusRecorder.status == http.StatusOK {
+		registry.downloads.Increment(release.Browser, release.Version)
+	}
+}
+
+// GetDownloadCounter returns the counter of the complete downloads of every release.
+func (registry *ReleaseRegistry) GetDownloadCounter() *DownloadCounter {
+	return registry.downloads
+}
+
+// Remembers the status written so the handler can tell how a request was answered.
+type statusRecordingResponseWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (writer *statusRecordingResponseWriter) WriteHeader(status int) {
+	writer.status = status
+	writer.ResponseWriter.WriteHeader(status)
+}
+
+func writeJSONResponse(w http.ResponseWriter, response any) {
+	w.Header().Add("Content-Type", "application/json")
+	if errorEncoding := json.NewEncoder(w).Encode(response); errorEncoding != nil {
+		logger.Error("Failed to encode response: %s\n", errorEncoding)
+	}
+}
@@ -0,0 +1,372 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestReleaseRegistry(t *testing.T) {
+	t.Run("loading a directory without a manifest", func(t *testing.T) {
+		registry, err := LoadReleaseRegistry(t.TempDir(), serverVersion)
+		if err != nil {
+			t.Fatalf("Failed to load registry: %v\n", err)
+		}
+
+		if len(registry.ListReleases()) != 0 {
+			t.Errorf("Expected no releases but got %+v\n", registry.ListReleases())
+		}
+	})
+
+	t.Run("rejecting invalid releases", func(t *testing.T) {
+		validRelease := newTestRelease(BrowserGecko, "0.0.5", "cowatch-0.0.5.xpi", "")
+
+		mutations := []struct {
+			name    string
+			mutate  func(release *Release)
+			wantErr error
+		}{
+			{"parent directory", func(release *Release) { release.Filename = "../main.go.xpi" }, ErrInvalidReleaseFilename},
+			{"nested path", func(release *Release) { release.Filename = "nested/cowatch.xpi" }, ErrInvalidReleaseFilename},
+			{"absolute path", func(release *Release) { release.Filename = "/etc/passwd.xpi" }, ErrInvalidReleaseFilename},
+			{"hidden file", func(release *Release) { release.Filename = ".cowatch.xpi" }, ErrInvalidReleaseFilename},
+			{"unknown extension", func(release *Release) { release.Filename = "cowatch.exe" }, ErrInvalidReleaseFilename},
+			{"unknown browser", func(release *Release) { release.Browser = "webkit" }, ErrInvalidReleaseBrowser},
+			{"malformed version", func(release *Release) { release.Version = "latest" }, ErrInvalidReleaseVersion},
+			{"malformed sha256", func(release *Release) { release.SHA256 = "abc" }, ErrInvalidReleaseSHA256},
+		}
+
+		for _, mutation := range mutations {
+			release := validRelease
+			mutation.mutate(&release)
+
+			_, err := LoadReleaseRegistry(writeReleaseDirectory(t, []Release{release}, nil), serverVersion)
+			if !errors.Is(err, mutation.wantErr) {
+				t.Errorf("%s: expected %v but got %v\n", mutation.name, mutation.wantErr, err)
+			}
+		}
+
+		_, err := LoadReleaseRegistry(writeReleaseDirectory(t, []Release{validRelease, validRelease}, nil), serverVersion)
+		if !errors.Is(err, ErrDuplicateRelease) {
+			t.Errorf("duplicate release: expected %v but got %v\n", ErrDuplicateRelease, err)
+		}
+
+		corruptedDirectory := writeReleaseDirectory(t, []Release{validRelease}, map[string]string{validRelease.Filename: "corrupted package"})
+		_, err = LoadReleaseRegistry(corruptedDirectory, serverVersion)
+		if !errors.Is(err, ErrReleaseSHA256Mismatch) {
+			t.Errorf("corrupted release: expected %v but got %v\n", ErrReleaseSHA256Mismatch, err)
+		}
+
+		os.Remove(filepath.Join(corruptedDirectory, validRelease.Filename))
+		_, err = LoadReleaseRegistry(corruptedDirectory, serverVersion)
+		if !errors.Is(err, os.ErrNotExist) {
+			t.Errorf("missing release file: expected %v but got %v\n", os.ErrNotExist, err)
+		}
+	})
+
+	t.Run("finding the latest compatible release of a browser", func(t *testing.T) {
+		directory := writeReleaseDirectory(t, []Release{
+			newTestRelease(BrowserGecko, "0.0.9", "cowatch-0.0.9.xpi", "0.0.1"),
+			newTestRelease(BrowserGecko, "0.0.10", "cowatch-0.0.10.xpi", "0.0.5"),
+			newTestRelease(BrowserGecko, "0.1.0", "cowatch-0.1.0.xpi", "0.1.0"),
+			newTestRelease(BrowserChromium, "0.0.4", "cowatch-0.0.4.crx", ""),
+		}, nil)
+
+		registry, err := LoadReleaseRegistry(directory, "0.0.5")
+		if err != nil {
+			t.Fatalf("Failed to load registry: %v\n", err)
+		}
+
+		if release, _ := registry.GetLatestRelease(BrowserGecko); release.Version != "0.0.10" {
+			t.Errorf("Expected latest gecko release to be 0.0.10 but got %q\n", release.Version)
+		}
+
+		if release, _ := registry.GetLatestRelease(BrowserChromium); release.Version != "0.0.4" {
+			t.Errorf("Expected latest chromium release to be 0.0.4 but got %q\n", release.Version)
+		}
+
+		gotVersions := make([]string, 0)
+		for _, release := range registry.ListReleases() {
+			gotVersions = append(gotVersions, string(release.Browser)+"@"+release.Version)
+		}
+
+		wantVersions := []string{"chromium@0.0.4", "gecko@0.1.0", "gecko@0.0.10", "gecko@0.0.9"}
+		if !reflect.DeepEqual(gotVersions, wantVersions) {
+			t.Errorf("Got order %v Want %v\n", gotVersions, wantVersions)
+		}
+	})
+}
+
+func TestReleaseEndpoints(t *testing.T) {
+	geckoPackage := "gecko package"
+	chromiumPackage := "chromium package"
+
+	directory := writeReleaseDirectory(t, []Release{
+		withTestPackage(newTestRelease(BrowserGecko, "0.0.4", "cowatch-0.0.4.xpi", ""), "old "+geckoPackage),
+		withTestPackage(newTestRelease(BrowserGecko, "0.0.5", "cowatch-0.0.5.xpi", ""), geckoPackage),
+		withTestPackage(newTestRelease(BrowserChromium, "0.0.5", "cowatch-0.0.5.crx", ""), chromiumPackage),
+	}, map[string]string{
+		"cowatch-0.0.4.xpi": "old " + geckoPackage,
+		"cowatch-0.0.5.xpi": geckoPackage,
+		"cowatch-0.0.5.crx": chromiumPackage,
+		"secret.txt":        "secret",
+	})
+
+	registry, err := LoadReleaseRegistry(directory, serverVersion)
+	if err != nil {
+		t.Fatalf("Failed to load registry: %v\n", err)
+	}
+
+	mockServer, _ := newTestServer(t, testServerOptions{releases: registry})
+
+	t.Run("listing every release", func(t *testing.T) {
+		response, body := getTestEndpoint(t, mockServer, EndpointReleases)
+
+		var releases []Release
+		json.Unmarshal(body, &releases)
+		if response.StatusCode != http.StatusOK || !reflect.DeepEqual(releases, registry.ListReleases()) {
+			t.Errorf("Got %d %+v\n", response.StatusCode, releases)
+		}
+	})
+
+	t.Run("getting the latest release of a browser", func(t *testing.T) {
+		_, body := getTestEndpoint(t, mockServer, "/releases/gecko/latest")
+
+		var release Release
+		json.Unmarshal(body, &release)
+		if release.Version != "0.0.5" || release.Filename != "cowatch-0.0.5.xpi" {
+			t.Errorf("Got %+v\n", release)
+		}
+	})
+
+	t.Run("downloading the latest release of a browser", func(t *testing.T) {
+		response, body := getTestEndpoint(t, mockServer, "/download/chromium")
+		if string(body) != chromiumPackage {
+			t.Errorf("Got %q Want %q\n", body, chromiumPackage)
+		}
+
+		if contentType := response.Header.Get("Content-Type"); contentType != browserContentTypes[BrowserChromium] {
+			t.Errorf("Got content type %q\n", contentType)
+		}
+	})
+
+	t.Run("downloading a specific release", func(t *testing.T) {
+		_, body := getTestEndpoint(t, mockServer, "/download/gecko/0.0.4")
+		if string(body) != "old "+geckoPackage {
+			t.Errorf("Got %q\n", body)
+		}
+	})
+
+	t.Run("downloading files that aren't releases", func(t *testing.T) {
+		paths := []string{
+			"/download/secret.txt",
+			"/download/gecko/secret.txt",
+			"/download/gecko/..%2Fsecret.txt",
+			"/download/gecko/0.0.6",
+			"/download/webkit",
+			"/releases/webkit/latest",
+		}
+
+		for _, path := range paths {
+			response, body := getTestEndpoint(t, mockServer, path)
+			if response.StatusCode != http.StatusNotFound {
+				t.Errorf("%s: expected %d but got %d %q\n", path, http.StatusNotFound, response.StatusCode, body)
+			}
+		}
+	})
+}
+
+// Builds a release whose package is it's filename, unless another package is given with [withTestPackage].
+func newTestRelease(browser Browser, version string, filename string, minServerProtocol string) Release {
+	hash := sha256.Sum256([]byte(filename))
+
+	return Release{
+		Version:           version,
+		Browser:           browser,
+		Filename:          filename,
+		SHA256:            hex.EncodeToString(hash[:]),
+		ReleaseNotes:      "Release " + version,
+		MinServerProtocol: minServerProtocol,
+	}
+}
+
+func withTestPackage(release Release, releasePackage string) Release {
+	hash := sha256.Sum256([]byte(releasePackage))
+	release.SHA256 = hex.EncodeToString(hash[:])
+
+	return release
+}
+
+// Writes a manifest of the releases and the files into a temporary directory,
+// along with the default package of every release that isn't among the files.
+func writeReleaseDirectory(t *testing.T, releases []Release, files map[string]string) string {
+	t.Helper()
+
+	directory := t.TempDir()
+	rawManifest, _ := json.Marshal(ReleaseManifest{Releases: releases})
+	if err := os.WriteFile(filepath.Join(directory, FileReleaseManifest), rawManifest, 0600); err != nil {
+		t.Fatalf("Failed to write manifest: %v\n", err)
+	}
+
+	for _, release := range releases {
+		if _, hasFile := files[release.Filename]; !hasFile && IsValidReleaseFilename(release.Filename) {
+			if err := os.WriteFile(filepath.Join(directory, release.Filename), []byte(release.Filename), 0600); err != nil {
+				t.Fatalf("Failed to write %q: %v\n", release.Filename, err)
+			}
+		}
+	}
+
+	for filename, content := range files {
+		if err := os.WriteFile(filepath.Join(directory, filename), []byte(content), 0600); err != nil {
+			t.Fatalf("Failed to write %q: %v\n", filename, err)
+		}
+	}
+
+	return directory
+}
+
+func getTestEndpoint(t *testing.T, mockServer *httptest.Server, path string) (*http.Response, []byte) {
+	t.Helper()
+
+	response, err := http.Get(mockServer.URL + path)
+	if err != nil {
+		t.Fatalf("Failed to request %q: %v\n", path, err)
+	}
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(response.Body)
+	return response, body
+}
+
+func TestReleaseDownloadHeaders(t *testing.T) {
+	releasePackage := "0123456789abcdef"
+	release := withTestPackage(newTestRelease(BrowserGecko, "0.0.5", "cowatch-0.0.5.xpi", ""), releasePackage)
+
+	directory := writeReleaseDirectory(t, []Release{release}, map[string]string{release.Filename: releasePackage})
+	registry, err := LoadReleaseRegistry(directory, serverVersion)
+	if err != nil {
+		t.Fatalf("Failed to load registry: %v\n", err)
+	}
+
+	mockServer, _ := newTestServer(t, testServerOptions{releases: registry})
+
+	rawHash, _ := hex.DecodeString(release.SHA256)
+	encodedHash := base64.StdEncoding.EncodeToString(rawHash)
+
+	t.Run("describing the release in the headers", func(t *testing.T) {
+		response, _ := getTestEndpoint(t, mockServer, "/download/gecko/0.0.5")
+
+		wantHeaders := map[string]string{
+			"Content-Disposition": `attachment; filename="cowatch-0.0.5.xpi"`,
+			"Cache-Control":       CacheControlVersionedRelease,
+			"Etag":                `"` + release.SHA256 + `"`,
+			"Digest":              "sha-256=" + encodedHash,
+			"Repr-Digest":         "sha-256=:" + encodedHash + ":",
+			"Accept-Ranges":       "bytes",
+		}
+
+		for header, want := range wantHeaders {
+			if got := response.Header.Get(header); got != want {
+				t.Errorf("%s: Got %q Want %q\n", header, got, want)
+			}
+		}
+
+		if response.Header.Get("Last-Modified") == "" {
+			t.Errorf("Expected a Last-Modified header\n")
+		}
+
+		latestResponse, _ := getTestEndpoint(t, mockServer, "/download/gecko")
+		if got := latestResponse.Header.Get("Cache-Control"); got != CacheControlLatestRelease {
+			t.Errorf("Latest release: Got Cache-Control %q Want %q\n", got, CacheControlLatestRelease)
+		}
+	})
+
+	t.Run("answering conditional requests", func(t *testing.T) {
+		response, _ := getTestEndpoint(t, mockServer, "/download/gecko/0.0.5")
+
+		conditions := []map[string]string{
+			{"If-None-Match": response.Header.Get("Etag")},
+			{"If-Modified-Since": response.Header.Get("Last-Modified")},
+		}
+
+		for _, condition := range conditions {
+			conditionalResponse, body := requestTestEndpoint(t, mockServer, "/download/gecko/0.0.5", condition)
+			if conditionalResponse.StatusCode != http.StatusNotModified || len(body) != 0 {
+				t.Errorf("%v: Got %d %q\n", condition, conditionalResponse.StatusCode, body)
+			}
+		}
+	})
+
+	t.Run("resuming a download", func(t *testing.T) {
+		response, body := requestTestEndpoint(t, mockServer, "/download/gecko/0.0.5", map[string]string{"Range": "bytes=10-"})
+		if response.StatusCode != http.StatusPartialContent || string(body) != releasePackage[10:] {
+			t.Errorf("Got %d %q\n", response.StatusCode, body)
+		}
+
+		wantContentRange := fmt.Sprintf("bytes 10-%d/%d", len(releasePackage)-1, len(releasePackage))
+		if got := response.Header.Get("Content-Range"); got != wantContentRange {
+			t.Errorf("Got Content-Range %q Want %q\n", got, wantContentRange)
+		}
+
+		staleResponse, staleBody := requestTestEndpoint(t, mockServer, "/download/gecko/0.0.5", map[string]string{
+			"Range":    "bytes=10-",
+			"If-Range": `"stale"`,
+		})
+
+		if staleResponse.StatusCode != http.StatusOK || string(staleBody) != releasePackage {
+			t.Errorf("Stale If-Range: Got %d %q\n", staleResponse.StatusCode, staleBody)
+		}
+	})
+
+	t.Run("counting complete downloads", func(t *testing.T) {
+		countingRegistry, _ := LoadReleaseRegistry(directory, serverVersion)
+		countingServer, _ := newTestServer(t, testServerOptions{releases: countingRegistry})
+
+		getTestEndpoint(t, countingServer, "/download/gecko/0.0.5")
+		getTestEndpoint(t, countingServer, "/download/gecko")
+		requestTestEndpoint(t, countingServer, "/download/gecko/0.0.5", map[string]string{"Range": "bytes=10-"})
+		requestTestEndpoint(t, countingServer, "/download/gecko/0.0.5", map[string]string{"If-None-Match": `"` + release.SHA256 + `"`})
+
+		if response, _ := getTestEndpoint(t, countingServer, EndpointDownloadMetrics); response.StatusCode != http.StatusUnauthorized {
+			t.Errorf("Expected the counts to require the admin token but got %d\n", response.StatusCode)
+		}
+
+		_, body := requestTestEndpoint(t, countingServer, EndpointDownloadMetrics, map[string]string{"Authorization": "Bearer " + testAdminToken})
+
+		var got []DownloadCount
+		json.Unmarshal(body, &got)
+
+		want := []DownloadCount{{Browser: BrowserGecko, Version: "0.0.5", Count: 2}}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Got %+v Want %+v\n", got, want)
+		}
+	})
+}
+
+func requestTestEndpoint(t *testing.T, mockServer *httptest.Server, path string, headers map[string]string) (*http.Response, []byte) {
+	t.Helper()
+
+	request, _ := http.NewRequest(http.MethodGet, mockServer.URL+path, nil)
+	for header, value := range headers {
+		request.Header.Set(header, value)
+	}
+
+	response, err := http.DefaultClient.Do(request)
+	if err != nil {
+		t.Fatalf("Failed to request %q: %v\n", path, err)
+	}
+	defer response.Body.Close()
+
+	body, _ := io.ReadAll(response.Body)
+	return response, body
+}
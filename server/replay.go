@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/cowatch/logger"
+)
+
+// Fields holding the wall clock time a message was sent, they can't match between a recording and it's replay.
+var replayIgnoredFields = []string{"createdAt", "timestamp", "startAt"}
+
+// ReplayMismatch is a client message whose handling produced different server messages than it did when recorded.
+type ReplayMismatch struct {
+	Offset        time.Duration
+	Token         Token
+	ClientMessage ClientMessage
+	Expected      []string
+	Received      []string
+}
+
+type ReplayResult struct {
+	Header         RecordingHeader
+	ClientMessages int
+	ServerMessages int
+	Mismatches     []ReplayMismatch
+}
+
+// recordingReplay feeds a recording through a fresh manager, standing in for every recorded client.
+//
+// Tokens and room ids are generated anew while replaying, so every id of the recording is translated
+// to the one generated in it's place before the messages are compared.
+type recordingReplay struct {
+	header            RecordingHeader
+	manager           *Manager
+	clock             *FakeClock // Starts when the recording did, and is advanced to the offset of every client message
+	connectionManager *replayConnectionManager
+
+	clients      map[Token]*Client // The replayed clients by the token they were recorded with
+	translations map[string]string // Recorded ids to their replayed counterpart
+}
+
+// ReplayRecording handles every client message of a recording with a fresh [Manager] in the order they
+// were recorded, and reports the ones whose responses differ from the recorded ones.
+// The manager runs on a [FakeClock] advanced to the offset of every message, so the timeouts and intervals
+// between the messages pass like they did without waiting for them.
+func ReplayRecording(reader io.Reader) (ReplayResult, error) {
+	header, entries, errorReading := ReadRecording(reader)
+	if errorReading != nil {
+		return ReplayResult{}, errorReading
+	}
+
+	connectionManager := newReplayConnectionManager()
+	clock := NewFakeClock(header.StartedAt)
+	manager := NewManager(header.ServerVersion, connectionManager)
+	manager.SetClock(clock)
+
+	replay := &recordingReplay{
+		header:            header,
+		manager:           manager,
+		clock:             clock,
+		connectionManager: connectionManager,
+		clients:           make(map[Token]*Client),
+		translations:      make(map[string]string),
+	}
+
+	result := ReplayResult{Header: header}
+	for index := 0; index < len(entries); {
+		entry := entries[index]
+		index++
+
+		if entry.Type != RecordingEntryTypeClientMessage || entry.ClientMessage == nil || entry.Client == nil {
+			continue
+		}
+
+		expectedMessages := make([]RecordingEntry, 0)
+		for ; index < len(entries) && entries[index].Type == RecordingEntryTypeServerMessage; index++ {
+			expectedMessages = append(expectedMessages, entries[index])
+		}
+
+		result.ClientMessages++
+		result.ServerMessages += len(expectedMessages)
+
+		// Outside of the manager's lock, the timers that are due take it themselves
+		if sentAt := header.StartedAt.Add(entry.Offset); sentAt.After(clock.Now()) {
+			clock.Advance(sentAt.Sub(clock.Now()))
+		}
+
+		if mismatch, isMismatch := replay.replayClientMessage(entry, expectedMessages); isMismatch {
+			result.Mismatches = append(result.Mismatches, mismatch)
+		}
+	}
+
+	return result, nil
+}
+
+// Handles a recorded client message and compares it's responses to the recorded ones.
+func (replay *recordingReplay) replayClientMessage(entry RecordingEntry, expectedMessages []RecordingEntry) (ReplayMismatch, bool) {
+	client := replay.getClient(entry)
+
+	clientMessage := *entry.ClientMessage
+	clientMessage.Message = replay.translate(clientMessage.Message, false)
+
+	replay.manager.mutex.Lock()
+	serverMessages := replay.manager.handleClientMessage(client, clientMessage)
+	replay.manager.sendDirectedMessages(serverMessages)
+	replay.manager.mutex.Unlock()
+
+	replay.learnTranslations(entry.Client, client)
+
+	expected := make([]string, 0, len(expectedMessages))
+	for _, expectedMessage := range expectedMessages {
+		if expectedMessage.ServerMessage != nil {
+			expected = append(expected, describeReplayedMessage(expectedMessage.Token, *expectedMessage.ServerMessage))
+		}
+	}
+
+	received := make([]string, 0, len(serverMessages))
+	for _, serverMessage := range serverMessages {
+		if serverMessage.message.MessageType == "" {
+			continue
+		}
+
+		message := serverMessage.message
+		message.MessageDetails = json.RawMessage(replay.translate(string(message.MessageDetails), true))
+		message.ErrorDetails = json.RawMessage(replay.translate(string(message.ErrorDetails), true))
+		received = append(received, describeReplayedMessage(Token(replay.translate(string(serverMessage.token), true)), message))
+	}
+
+	if slices.Equal(expected, received) {
+		return ReplayMismatch{}, false
+	}
+
+	return ReplayMismatch{
+		Offset:        entry.Offset,
+		Token:         entry.Token,
+		ClientMessage: *entry.ClientMessage,
+		Expected:      expected,
+		Received:      received,
+	}, true
+}
+
+// Collects the client standing in for the sender of a recorded message.
+// Clients seen for the first time are connected, and authorized unless their message is the authorization.
+func (replay *recordingReplay) getClient(entry RecordingEntry) *Client {
+	if client, exists := replay.clients[entry.Token]; exists {
+		return client
+	}
+
+	privateToken := replay.manager.GenerateToken()
+	client := NewClient(privateToken)
+
+	var connection Connection = &replayConnection{token: entry.Token}
+	replay.connectionManager.RegisterClientConnection(privateToken, &connection)
+	replay.clients[entry.Token] = client
+	replay.translations[string(entry.Token)] = string(privateToken)
+
+	if entry.ClientMessage.MessageType == ClientMessageTypeAuthorize {
+		return client
+	}
+
+	requestAuthorize, _ := json.Marshal(ClientRequestAuthorizeRoom{Name: entry.Client.Name, Image: entry.Client.Image})
+	replay.manager.mutex.Lock()
+	replay.manager.handleClientMessage(client, ClientMessage{
+		ServerVersion: replay.header.ServerVersion,
+		MessageType:   ClientMessageTypeAuthorize,
+		Message:       string(requestAuthorize),
+		Locale:        entry.Client.Locale,
+	})
+	replay.manager.mutex.Unlock()
+
+	replay.translations[string(entry.Client.PublicToken)] = string(client.PublicToken)
+	return client
+}
+
+// Maps the ids the recorded client had once it's message was handled to the ones of the replayed client.
+func (replay *recordingReplay) learnTranslations(recordedClient *RecordedClient, client *Client) {
+	replay.clients[recordedClient.PrivateToken] = client
+	replay.translations[string(recordedClient.PrivateToken)] = string(client.PrivateToken)
+
+	if recordedClient.PublicToken != "" {
+		replay.translations[string(recordedClient.PublicToken)] = string(client.PublicToken)
+	}
+
+	if recordedClient.RoomID != "" && client.RoomID != "" {
+		replay.translations[string(recordedClient.RoomID)] = string(client.RoomID)
+	}
+}
+
+// Replaces the recorded ids of a text with the replayed ones, or the other way around if reversed.
+func (replay *recordingReplay) translate(text string, isReversed bool) string {
+	replacements := make([]string, 0, len(replay.translations)*2)
+	for recorded, replayed := range replay.translations {
+		if recorded == "" || replayed == "" {
+			continue
+		}
+
+		if isReversed {
+			replacements = append(replacements, replayed, recorded)
+		} else {
+			replacements = append(replacements, recorded, replayed)
+		}
+	}
+
+	return strings.NewReplacer(replacements...).Replace(text)
+}
+
+// Describes a server message as it's compared, leaving out the wall clock times it holds.
+func describeReplayedMessage(token Token, message ServerMessage) string {
+	description := fmt.Sprintf("%s %s %s", token, message.MessageType, message.Status)
+	if message.ErrorCode != "" {
+		description += " " + string(message.ErrorCode)
+	}
+
+	if message.RequestID != "" {
+		description += fmt.Sprintf(" #%s", message.RequestID)
+	}
+
+	if len(message.MessageDetails) > 0 {
+		description += " " + string(withoutReplayIgnoredFields(message.MessageDetails))
+	}
+
+	if len(message.ErrorDetails) > 0 {
+		description += " " + string(withoutReplayIgnoredFields(message.ErrorDetails))
+	}
+
+	return description
+}
+
+// Removes the ignored fields at any depth of a json value.
+func withoutReplayIgnoredFields(rawJSON json.RawMessage) json.RawMessage {
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(rawJSON))
+	decoder.UseNumber()
+	if decoder.Decode(&value) != nil {
+		return rawJSON
+	}
+
+	var removeFields func(value interface{})
+	removeFields = func(value interface{}) {
+		switch typedValue := value.(type) {
+		case map[string]interface{}:
+			for _, field := range replayIgnoredFields {
+				delete(typedValue, field)
+			}
+
+			for _, nestedValue := range typedValue {
+				removeFields(nestedValue)
+			}
+		case []interface{}:
+			for _, nestedValue := range typedValue {
+				removeFields(nestedValue)
+			}
+		}
+	}
+	removeFields(value)
+
+	cleanJSON, errorMarshaling := json.Marshal(value)
+	if errorMarshaling != nil {
+		return rawJSON
+	}
+
+	return cleanJSON
+}
+
+// Replays the recording at the path and prints every mismatch, returning the exit code of the replay.
+func runReplay(path string, out io.Writer) int {
+	file, errorOpening := os.Open(path)
+	if errorOpening != nil {
+		logger.Error("Failed to open the recording: %s\n", errorOpening)
+		return 1
+	}
+	defer file.Close()
+
+	// The replayed manager logs every message it handles, which would bury the report
+	previousLevel := logger.GetLevel()
+	logger.SetLevel(logger.LogLevelError)
+	result, errorReplaying := ReplayRecording(file)
+	logger.SetLevel(previousLevel)
+
+	if errorReplaying != nil {
+		logger.Error("Failed to replay the recording: %s\n", errorReplaying)
+		return 1
+	}
+
+	fmt.Fprintf(out, "Replayed room %s recorded by %q at %s: %d client messages, %d server messages\n",
+		result.Header.RoomID, result.Header.NodeID, result.Header.StartedAt.Format(time.RFC3339),
+		result.ClientMessages, result.ServerMessages,
+	)
+
+	for _, mismatch := range result.Mismatches {
+		fmt.Fprintf(out, "\nMismatch at %s handling %s from %s: %s\n", mismatch.Offset.Round(time.Millisecond), mismatch.ClientMessage.MessageType, mismatch.Token, mismatch.ClientMessage.Message)
+		fmt.Fprintf(out, "  Recorded:\n")
+		for _, description := range mismatch.Expected {
+			fmt.Fprintf(out, "    %s\n", description)
+		}
+
+		fmt.Fprintf(out, "  Replayed:\n")
+		for _, description := range mismatch.Received {
+			fmt.Fprintf(out, "    %s\n", description)
+		}
+	}
+
+	if len(result.Mismatches) > 0 {
+		fmt.Fprintf(out, "\n%d of %d client messages were handled differently\n", len(result.Mismatches), result.ClientMessages)
+		return 1
+	}
+
+	fmt.Fprintf(out, "Every client message was handled as recorded\n")
+	return 0
+}
+
+// replayConnectionManager stands in for the websocket connections of the replayed clients.
+// The messages sent to them are compared as they're returned by the manager, so the connections drop them.
+type replayConnectionManager struct {
+	connections map[Token]*Connection
+}
+
+func newReplayConnectionManager() *replayConnectionManager {
+	return &replayConnectionManager{connections: make(map[Token]*Connection)}
+}
+
+func (connectionManager *replayConnectionManager) NewConnection(w http.ResponseWriter, r *http.Request) (Connection, error) {
+	return nil, errors.New("Replayed clients can't connect")
+}
+
+func (connectionManager *replayConnectionManager) RegisterClientConnection(privateToken Token, connection *Connection) {
+	connectionManager.connections[privateToken] = connection
+}
+
+func (connectionManager *replayConnectionManager) UnregisterClientConnection(privateToken Token) error {
+	if _, exists := connectionManager.connections[privateToken]; !exists {
+		return ErrConnectionNotExists
+	}
+
+	delete(connectionManager.connections, privateToken)
+	return nil
+}
+
+func (connectionManager *replayConnectionManager) GetConnection(privateToken Token) (*Connection, bool) {
+	connection, exists := connectionManager.connections[privateToken]
+	return connection, exists
+}
+
+// replayConnection is the connection of a replayed client, identified by the token it was recorded with.
+type replayConnection struct {
+	token Token
+}
+
+func (connection *replayConnection) GetAddr() string {
+	return "replay/" + string(connection.token)
+}
+
+func (connection *replayConnection) ReadMessage() (ClientMessage, error) {
+	return ClientMessage{}, io.EOF
+}
+
+func (connection *replayConnection) WriteMessage(data interface{}) error {
+	if _, isServerMessage := data.(ServerMessage); !isServerMessage {
+		return fmt.Errorf("Replayed clients only receive server messages but got %T", data)
+	}
+
+	return nil
+}
+
+func (connection *replayConnection) GetCodec() Codec {
+	return JSONCodec{}
+}
+
+func (connection *replayConnection) Close() error {
+	return nil
+}
@@ -6,8 +6,11 @@ import (
 )
 
 const DEFAULT_ROOM_SIZE = 10
+const MIN_ROOM_NAME_LENGTH = 3
+const MAX_ROOM_NAME_LENGTH = 50
 
-type RoomID string
+// The amount of deltas a room keeps around for clients that need to resync.
+const ROOM_DELTA_HISTORY_SIZE = 32
 
 type Room struct {
 	RoomID       RoomID
@@ -16,15 +19,35 @@ type Room struct {
 	Viewers      []*Client
 	CreatedAt    Timestamp
 	Settings     RoomSettings
-}
+	Revision     RoomRevision
+
+	deltaHistory []RoomDelta
+
+	createdAt          time.Time
+	emptySince         time.Time          // The last time the room was left without viewers
+	latestReflectionAt time.Time          // The last time the host reflected their player
+	closingWarning     *ServerRoomClosing // The pending closure the members were warned about
+
+	playbackState   int            // The latest state the host reflected besides buffering
+	viewerReadiness map[Token]bool // The readiness of the viewers that reported it, by their private token
+	heldStart       *heldStart     // The start of the playback held until the viewers are ready
+
+	latestReflection  RoomReflection  // The latest playback of the room, played from at a scheduled start
+	playbackUpdatedAt time.Time       // The time the latest playback was reflected at
+	controlledBy      Token           // The private token of the member that last changed the playback
+	controlledAt      time.Time       // The last time the playback was changed, besides it progressing
+	isHostBehind      bool            // The playback was changed for the host, who's reflections are stale until it's player follows
+	schedule          *scheduledStart // The countdown to the scheduled start the room is waiting for
+
+	vote         *roomVote // The vote in progress, if any
+	latestVoteID VoteID
 
-type RoomSettings = struct {
-	Name string `json:"name"`
+	permissions map[Token][]RoomPermission // The permissions of the co-hosts, by their public token
 }
 
 var ErrRoomHasNoHost = errors.New("There's no host for the new room")
 
-func NewRoom(roomID RoomID, host *Client, settings RoomSettings) (*Room, error) {
+func NewRoom(roomID RoomID, host *Client, settings RoomSettings, createdAt time.Time) (*Room, error) {
 	if host == nil {
 		return nil, ErrRoomHasNoHost
 	}
@@ -40,39 +63,114 @@ func NewRoom(roomID RoomID, host *Client, settings RoomSettings) (*Room, error)
 		},
 		Host:      host,
 		Viewers:   make([]*Client, 0, DEFAULT_ROOM_SIZE),
-		CreatedAt: Timestamp(time.Now().Unix()),
+		CreatedAt: Timestamp(createdAt.Unix()),
 		Settings:  settings,
+
+		createdAt:          createdAt,
+		emptySince:         createdAt,
+		latestReflectionAt: createdAt,
+
+		playbackState:   PlayerStateUnstarted,
+		viewerReadiness: make(map[Token]bool),
+
+		permissions: make(map[Token][]RoomPermission),
 	}, nil
 }
 
-func (room *Room) UpdateHost(host *Client) {
+func (room *Room) UpdateHost(host *Client) RoomDelta {
 	room.Host = host
+
+	hostRecord := host.GetFilteredClient()
+	return room.recordDelta(RoomDelta{Type: RoomDeltaTypeHostChanged, Client: &hostRecord})
 }
 
-func (room *Room) AddViewer(viewer *Client) {
+func (room *Room) AddViewer(viewer *Client) RoomDelta {
 	room.Viewers = append(room.Viewers, viewer)
+
+	viewerRecord := room.getClientRecord(viewer)
+	return room.recordDelta(RoomDelta{Type: RoomDeltaTypeViewerJoined, Client: &viewerRecord})
 }
 
-func (room *Room) RemoveViewer(viewer *Client) {
+func (room *Room) RemoveViewer(viewer *Client) (RoomDelta, bool) {
 	roomIndex, recordFound := FindInSlice(room.Viewers, viewer, func(a *Client, b *Client) bool {
-		return a.IPAddress == b.IPAddress
+		return a.PrivateToken == b.PrivateToken
 	})
 
-	if recordFound {
-		room.Viewers = RemoveFromSlice(room.Viewers, roomIndex)
+	if !recordFound {
+		return RoomDelta{}, false
 	}
+
+	viewerRecord := room.getClientRecord(room.Viewers[roomIndex])
+	room.Viewers = RemoveFromSlice(room.Viewers, roomIndex)
+
+	return room.recordDelta(RoomDelta{Type: RoomDeltaTypeViewerLeft, Client: &viewerRecord}), true
 }
 
-func (room *Room) SaveVideoDetails(vidoeDetails VideoDetails) {
-	room.VideoDetails = vidoeDetails
+// UpdateRole records a viewer becoming a co-host, a viewer again, or a co-host with other permissions.
+func (room *Room) UpdateRole(viewer *Client) RoomDelta {
+	viewerRecord := room.getClientRecord(viewer)
+	return room.recordDelta(RoomDelta{Type: RoomDeltaTypeRoleChanged, Client: &viewerRecord})
+}
+
+// Describes a member of the room along with the permissions of co-hosts.
+func (room *Room) getClientRecord(client *Client) ClientRecord {
+	clientRecord := client.GetFilteredClient()
+	if client.Type == ClientTypeCoHost {
+		clientRecord.Role = ClientTypeCoHost
+		clientRecord.Permissions = room.permissions[client.PublicToken]
+	}
+
+	return clientRecord
 }
 
-type RoomRecord struct {
-	RoomID    RoomID         `json:"roomID"`
-	Host      ClientRecord   `json:"host"`
-	Viewers   []ClientRecord `json:"viewers"`
-	Settings  RoomSettings   `json:"settings"`
-	CreatedAt Timestamp      `json:"createdAt"`
+// UpdateWaitingFor records the viewers holding the start of the playback, none once it's released.
+func (room *Room) UpdateWaitingFor(viewers []*Client) RoomDelta {
+	waitingFor := make([]ClientRecord, 0, len(viewers))
+	for _, viewer := range viewers {
+		waitingFor = append(waitingFor, viewer.GetFilteredClient())
+	}
+
+	return room.recordDelta(RoomDelta{Type: RoomDeltaTypeWaitingChanged, WaitingFor: waitingFor})
+}
+
+func (room *Room) UpdateSettings(settings RoomSettings) RoomDelta {
+	room.Settings = settings
+	return room.recordDelta(RoomDelta{Type: RoomDeltaTypeSettingsChanged, Settings: &settings})
+}
+
+// Assigns the next revision to a delta and keeps it in the room's history.
+func (room *Room) recordDelta(delta RoomDelta) RoomDelta {
+	room.Revision++
+	delta.Revision = room.Revision
+
+	room.deltaHistory = append(room.deltaHistory, delta)
+	if len(room.deltaHistory) > ROOM_DELTA_HISTORY_SIZE {
+		room.deltaHistory = room.deltaHistory[len(room.deltaHistory)-ROOM_DELTA_HISTORY_SIZE:]
+	}
+
+	return delta
+}
+
+// GetDeltasSince collects every delta that happened after the given revision.
+// It returns false if some of them are no longer kept, in which case a full snapshot is required.
+func (room *Room) GetDeltasSince(revision RoomRevision) ([]RoomDelta, bool) {
+	if revision > room.Revision {
+		return nil, false
+	}
+
+	missingDeltaCount := int(room.Revision - revision)
+	if missingDeltaCount > len(room.deltaHistory) {
+		return nil, false
+	}
+
+	deltas := make([]RoomDelta, missingDeltaCount)
+	copy(deltas, room.deltaHistory[len(room.deltaHistory)-missingDeltaCount:])
+
+	return deltas, true
+}
+
+func (room *Room) SaveVideoDetails(vidoeDetails VideoDetails) {
+	room.VideoDetails = vidoeDetails
 }
 
 // Calculates only the necessary data to be sent to a request
@@ -83,7 +181,7 @@ func (room *Room) GetFilteredRoom() RoomRecord {
 	filteredViewers := make([]ClientRecord, 0, DEFAULT_ROOM_SIZE)
 
 	for _, viewer := range room.Viewers {
-		filteredViewers = append(filteredViewers, viewer.GetFilteredClient())
+		filteredViewers = append(filteredViewers, room.getClientRecord(viewer))
 	}
 
 	filteredRoom = RoomRecord{
@@ -92,6 +190,13 @@ func (room *Room) GetFilteredRoom() RoomRecord {
 		Viewers:   filteredViewers,
 		Settings:  room.Settings,
 		CreatedAt: room.CreatedAt,
+		Revision:  room.Revision,
+	}
+
+	if room.heldStart != nil {
+		for _, viewer := range room.getWaitingViewers() {
+			filteredRoom.WaitingFor = append(filteredRoom.WaitingFor, viewer.GetFilteredClient())
+		}
 	}
 
 	return filteredRoom
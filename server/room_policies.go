@@ -0,0 +1,132 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/cowatch/logger"
+)
+
+// RoomPolicies decide when the server closes a room on it's own, a zero duration disables a policy.
+//
+// Policies are enforced by the cleanup routine, so rooms close up to a cleanup interval late and
+// the closing warning should be longer than the interval for the members to receive it.
+type RoomPolicies struct {
+	IdleTimeout       time.Duration // Closes rooms that have been left without viewers for this long
+	ReflectionTimeout time.Duration // Closes rooms whose host hasn't reflected their player for this long
+	MaxLifetime       time.Duration // Closes rooms that have been open for this long
+	ClosingWarning    time.Duration // Warns the members of a room this long before closing it
+}
+
+// Every policy is disabled unless it's configured, so rooms stay open as long as they did before policies.
+var DefaultRoomPolicies = RoomPolicies{
+	IdleTimeout:       0,
+	ReflectionTimeout: 0,
+	MaxLifetime:       0,
+	ClosingWarning:    time.Minute,
+}
+
+// SetRoomPolicies replaces the policies the rooms hosted on this node are closed by.
+func (manager *Manager) SetRoomPolicies(policies RoomPolicies) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	manager.roomPolicies = policies
+}
+
+// EnforceRoomPolicies closes the rooms hosted on this node that broke a policy,
+// and warns the members of the rooms that are about to.
+func (manager *Manager) EnforceRoomPolicies() {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	now := manager.clock.Now()
+	for _, room := range manager.activeRooms {
+		reason, closesAt, isClosing := manager.roomPolicies.getRoomClosure(room)
+		if !isClosing || closesAt.Sub(now) > manager.roomPolicies.ClosingWarning {
+			if room.closingWarning != nil {
+				logger.Info("[%s] Cancelling closure of room: %s\n", room.RoomID, room.closingWarning.Reason)
+				cancelledWarning := *room.closingWarning
+				cancelledWarning.SecondsLeft = 0
+				cancelledWarning.Cancelled = true
+
+				room.closingWarning = nil
+				manager.sendDirectedMessages(newRoomClosingMessages(room, cancelledWarning))
+			}
+
+			continue
+		}
+
+		if !now.Before(closesAt) {
+			logger.Info("[%s] Closing room: %s\n", room.RoomID, reason)
+			manager.sendDirectedMessages(manager.disconnectClientFromRoom(room.Host))
+			continue
+		}
+
+		warning := ServerRoomClosing{
+			Reason:      reason,
+			ClosesAt:    Timestamp(closesAt.Unix()),
+			SecondsLeft: int(math.Ceil(closesAt.Sub(now).Seconds())),
+		}
+
+		if room.closingWarning != nil && room.closingWarning.Reason == warning.Reason && room.closingWarning.ClosesAt == warning.ClosesAt {
+			continue
+		}
+
+		logger.Info("[%s] Warning members the room closes in %ds: %s\n", room.RoomID, warning.SecondsLeft, reason)
+		room.closingWarning = &warning
+		manager.sendDirectedMessages(newRoomClosingMessages(room, warning))
+	}
+}
+
+// Collects the earliest time a room will be closed at by the enabled policies, if any.
+func (policies RoomPolicies) getRoomClosure(room *Room) (RoomClosingReason, time.Time, bool) {
+	var reason RoomClosingReason
+	var closesAt time.Time
+
+	considerClosure := func(policyReason RoomClosingReason, policyClosesAt time.Time) {
+		if closesAt.IsZero() || policyClosesAt.Before(closesAt) {
+			reason = policyReason
+			closesAt = policyClosesAt
+		}
+	}
+
+	if policies.IdleTimeout > 0 && len(room.Viewers) == 0 {
+		considerClosure(RoomClosingReasonIdle, room.emptySince.Add(policies.IdleTimeout))
+	}
+
+	if policies.ReflectionTimeout > 0 {
+		considerClosure(RoomClosingReasonNoReflection, room.latestReflectionAt.Add(policies.ReflectionTimeout))
+	}
+
+	if policies.MaxLifetime > 0 {
+		considerClosure(RoomClosingReasonMaxLifetime, room.createdAt.Add(policies.MaxLifetime))
+	}
+
+	return reason, closesAt, !closesAt.IsZero()
+}
+
+func newRoomClosingMessages(room *Room, roomClosing ServerRoomClosing) []DirectedServerMessage {
+	roomClosingDetails, errorMarshaling := json.Marshal(roomClosing)
+	if errorMarshaling != nil {
+		logger.Error("[%s] Failed to marshal the room closing: %s\n", room.RoomID, errorMarshaling)
+		return []DirectedServerMessage{}
+	}
+
+	members := append([]*Client{room.Host}, room.Viewers...)
+	serverMessages := make([]DirectedServerMessage, 0, len(members))
+	for _, member := range members {
+		serverMessages = append(serverMessages, DirectedServerMessage{
+			token: member.PrivateToken,
+			message: ServerMessage{
+				MessageType:    ServerMessageTypeRoomClosing,
+				MessageDetails: roomClosingDetails,
+				Status:         ServerMessageStatusOk,
+				ErrorMessage:   "",
+			},
+		})
+	}
+
+	return serverMessages
+}
@@ -0,0 +1,247 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestEnforceRoomPolicies(t *testing.T) {
+	t.Run("closing rooms left without viewers after a warning", func(t *testing.T) {
+		mockManager, clock := newTestManagerWithFakeClock()
+		mockManager.SetRoomPolicies(RoomPolicies{IdleTimeout: 10 * time.Minute, ClosingWarning: time.Minute})
+		host, hostConnection := newTestRoomMember(t, mockManager, clock, "Host")
+		roomID := hostTestRoom(t, mockManager, host.PrivateToken).RoomID
+
+		clock.Advance(8 * time.Minute)
+		mockManager.EnforceRoomPolicies()
+		assertReceivedMessages(t, hostConnection, "")
+
+		clock.Advance(90 * time.Second)
+		mockManager.EnforceRoomPolicies()
+		mockManager.EnforceRoomPolicies()
+		assertReceivedMessages(t, hostConnection, `RoomClosing {"reason":"IDLE","closesAt":1714594200,"secondsLeft":30}`)
+
+		clock.Advance(30 * time.Second)
+		mockManager.EnforceRoomPolicies()
+		assertReceivedMessages(t, hostConnection, "DisconnectRoom null")
+
+		if _, exists := mockManager.GetRegisteredRoom(roomID); exists {
+			t.Errorf("Expected the idle room to be closed\n")
+		}
+	})
+
+	t.Run("keeping rooms open with the default policies", func(t *testing.T) {
+		mockManager, clock := newTestManagerWithFakeClock()
+		mockManager.SetRoomPolicies(DefaultRoomPolicies)
+		host, hostConnection := newTestRoomMember(t, mockManager, clock, "Host")
+		roomID := hostTestRoom(t, mockManager, host.PrivateToken).RoomID
+
+		clock.Advance(30 * 24 * time.Hour)
+		mockManager.EnforceRoomPolicies()
+		assertReceivedMessages(t, hostConnection, "")
+
+		if _, exists := mockManager.GetRegisteredRoom(roomID); !exists {
+			t.Errorf("Expected the room to stay open without any policy configured\n")
+		}
+	})
+
+	t.Run("cancelling the closure once a viewer joins", func(t *testing.T) {
+		mockManager, clock := newTestManagerWithFakeClock()
+		mockManager.SetRoomPolicies(RoomPolicies{IdleTimeout: 10 * time.Minute, ClosingWarning: time.Minute})
+		host, hostConnection := newTestRoomMember(t, mockManager, clock, "Host")
+		viewer, viewerConnection := newTestRoomMember(t, mockManager, clock, "Viewer")
+		roomID := hostTestRoom(t, mockManager, host.PrivateToken).RoomID
+
+		clock.Advance(9*time.Minute + 30*time.Second)
+		mockManager.EnforceRoomPolicies()
+		hostConnection.getMessages()
+
+		joinRoom, _ := json.Marshal(ClientRequestJoinRoom{RoomID: roomID})
+		mockManager.handleClientMessage(viewer, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeJoinRoom, Message: string(joinRoom)})
+
+		mockManager.EnforceRoomPolicies()
+		cancelled := `RoomClosing {"reason":"IDLE","closesAt":1714594200,"secondsLeft":0,"cancelled":true}`
+		assertReceivedMessages(t, hostConnection, cancelled)
+		assertReceivedMessages(t, viewerConnection, cancelled)
+
+		clock.Advance(time.Hour)
+		mockManager.handleClientMessage(viewer, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeDisconnectRoom})
+
+		clock.Advance(8 * time.Minute)
+		mockManager.EnforceRoomPolicies()
+		assertReceivedMessages(t, hostConnection, "")
+
+		if _, exists := mockManager.GetRegisteredRoom(roomID); !exists {
+			t.Errorf("Expected the room to be idle from the moment the viewer left\n")
+		}
+	})
+
+	t.Run("closing rooms whose host stopped reflecting", func(t *testing.T) {
+		mockManager, clock := newTestManagerWithFakeClock()
+		mockManager.SetRoomPolicies(RoomPolicies{ReflectionTimeout: 5 * time.Minute, ClosingWarning: time.Minute})
+		host, hostConnection := newTestRoomMember(t, mockManager, clock, "Host")
+		roomID := hostTestRoom(t, mockManager, host.PrivateToken).RoomID
+
+		clock.Advance(4 * time.Minute)
+		mockManager.handleClientMessage(host, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeSendReflection, Message: `{"id":"Video","state":1,"time":240}`})
+
+		clock.Advance(3*time.Minute + 30*time.Second)
+		mockManager.EnforceRoomPolicies()
+		assertReceivedMessages(t, hostConnection, "")
+
+		clock.Advance(time.Minute)
+		mockManager.EnforceRoomPolicies()
+		assertReceivedMessages(t, hostConnection, `RoomClosing {"reason":"NO_REFLECTION","closesAt":1714594140,"secondsLeft":30}`)
+
+		clock.Advance(30 * time.Second)
+		mockManager.EnforceRoomPolicies()
+		assertReceivedMessages(t, hostConnection, "DisconnectRoom null")
+
+		if _, exists := mockManager.GetRegisteredRoom(roomID); exists {
+			t.Errorf("Expected the room to be closed\n")
+		}
+	})
+
+	t.Run("closing rooms that reached their max lifetime with every member", func(t *testing.T) {
+		mockManager, clock := newTestManagerWithFakeClock()
+		mockManager.SetRoomPolicies(RoomPolicies{IdleTimeout: time.Hour, MaxLifetime: 2 * time.Hour})
+		host, hostConnection := newTestRoomMember(t, mockManager, clock, "Host")
+		viewer, viewerConnection := newTestRoomMember(t, mockManager, clock, "Viewer")
+		roomID := hostTestRoom(t, mockManager, host.PrivateToken).RoomID
+
+		joinRoom, _ := json.Marshal(ClientRequestJoinRoom{RoomID: roomID})
+		mockManager.handleClientMessage(viewer, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeJoinRoom, Message: string(joinRoom)})
+
+		clock.Advance(2 * time.Hour)
+		mockManager.EnforceRoomPolicies()
+
+		assertReceivedMessages(t, viewerConnection, "DisconnectRoom null")
+		if hostMessages := hostConnection.getMessages(); len(hostMessages) == 0 || hostMessages[len(hostMessages)-1].MessageType != ServerMessageTypeDisconnectRoom {
+			t.Errorf("Expected the host to be disconnected last but got %+v\n", hostMessages)
+		}
+
+		if _, exists := mockManager.GetRegisteredRoom(roomID); exists {
+			t.Errorf("Expected the room to be closed\n")
+		}
+	})
+
+	t.Run("enforcing the policies from the cleanup routine", func(t *testing.T) {
+		mockManager, clock := newTestManagerWithFakeClock()
+		mockManager.SetRoomPolicies(RoomPolicies{MaxLifetime: time.Minute})
+		host, _ := newTestRoomMember(t, mockManager, clock, "Host")
+		roomID := hostTestRoom(t, mockManager, host.PrivateToken).RoomID
+
+		stopCleanup := mockManager.StartCleanup(30*time.Second, time.Hour)
+		clock.Advance(time.Minute)
+		stopCleanup()
+
+		if _, exists := mockManager.GetRegisteredRoom(roomID); exists {
+			t.Errorf("Expected the cleanup to close the room\n")
+		}
+	})
+}
+
+func TestGetRoomClosure(t *testing.T) {
+	createdAt := time.Date(2024, time.May, 1, 20, 0, 0, 0, time.UTC)
+	room, _ := NewRoom("room", NewClient("host"), RoomSettings{Name: "Test"}, createdAt)
+	room.latestReflectionAt = createdAt.Add(time.Hour)
+
+	tests := []struct {
+		name             string
+		policies         RoomPolicies
+		hasViewer        bool
+		expectedReason   RoomClosingReason
+		expectedClosesAt time.Time
+	}{
+		{"no policies", RoomPolicies{}, false, "", time.Time{}},
+		{"idle", RoomPolicies{IdleTimeout: time.Minute}, false, RoomClosingReasonIdle, createdAt.Add(time.Minute)},
+		{"idle with a viewer", RoomPolicies{IdleTimeout: time.Minute}, true, "", time.Time{}},
+		{"earliest policy", RoomPolicies{IdleTimeout: 3 * time.Hour, ReflectionTimeout: time.Minute, MaxLifetime: 2 * time.Hour}, false, RoomClosingReasonNoReflection, createdAt.Add(61 * time.Minute)},
+		{"max lifetime", RoomPolicies{IdleTimeout: 3 * time.Hour, MaxLifetime: 2 * time.Hour}, true, RoomClosingReasonMaxLifetime, createdAt.Add(2 * time.Hour)},
+	}
+
+	for _, test := range tests {
+		room.Viewers = room.Viewers[:0]
+		if test.hasViewer {
+			room.Viewers = append(room.Viewers, NewClient("viewer"))
+		}
+
+		reason, closesAt, isClosing := test.policies.getRoomClosure(room)
+		if reason != test.expectedReason || !closesAt.Equal(test.expectedClosesAt) || isClosing == closesAt.IsZero() {
+			t.Errorf("%s: expected %q at %s but got %q at %s (closing: %t)\n", test.name, test.expectedReason, test.expectedClosesAt, reason, closesAt, isClosing)
+		}
+	}
+}
+
+// Authorizes a client whose messages are kept by a test connection.
+func newTestRoomMember(t *testing.T, manager *Manager, clock *FakeClock, name string) (*Client, *testConnection) {
+	t.Helper()
+
+	client := newTestAuthorizedClient(t, manager, clock, name)
+
+	var connection Connection = &testConnection{}
+	manager.connectionManager.RegisterClientConnection(client.PrivateToken, &connection)
+
+	return client, connection.(*testConnection)
+}
+
+// Expects the messages a connection received since the last check, described by their type and details.
+func assertReceivedMessages(t *testing.T, connection *testConnection, expected string) {
+	t.Helper()
+
+	descriptions := make([]string, 0)
+	for _, message := range connection.getMessages() {
+		descriptions = append(descriptions, fmt.Sprintf("%s %s", message.MessageType, message.MessageDetails))
+	}
+
+	if strings.Join(descriptions, "\n") != expected {
+		t.Errorf("Expected the messages %q but got %q\n", expected, strings.Join(descriptions, "\n"))
+	}
+}
+
+// testConnection keeps every message the server writes to it.
+type testConnection struct {
+	mutex    sync.Mutex
+	messages []ServerMessage
+}
+
+func (connection *testConnection) GetAddr() string {
+	return "test"
+}
+
+func (connection *testConnection) ReadMessage() (ClientMessage, error) {
+	return ClientMessage{}, io.EOF
+}
+
+func (connection *testConnection) WriteMessage(data interface{}) error {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	if message, isServerMessage := data.(ServerMessage); isServerMessage {
+		connection.messages = append(connection.messages, message)
+	}
+
+	return nil
+}
+
+func (connection *testConnection) GetCodec() Codec {
+	return JSONCodec{}
+}
+
+func (connection *testConnection) Close() error {
+	return nil
+}
+
+func (connection *testConnection) getMessages() []ServerMessage {
+	connection.mutex.Lock()
+	defer connection.mutex.Unlock()
+
+	messages := connection.messages
+	connection.messages = nil
+	return messages
+}
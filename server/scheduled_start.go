@@ -0,0 +1,175 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"time"
+
+	"github.com/cowatch/logger"
+)
+
+// MaxScheduleAhead is the furthest in the future the start of a room can be scheduled at.
+const MaxScheduleAhead = 7 * 24 * time.Hour
+
+// The time left to a scheduled start at which the members receive a countdown tick,
+// on top of a tick every hour while more than an hour is left.
+var countdownTicks = []time.Duration{
+	30 * time.Minute, 15 * time.Minute, 10 * time.Minute,
+	5 * time.Minute, 4 * time.Minute, 3 * time.Minute, 2 * time.Minute, time.Minute,
+	30 * time.Second, 10 * time.Second,
+	5 * time.Second, 4 * time.Second, 3 * time.Second, 2 * time.Second, time.Second,
+}
+
+// scheduledStart counts down to the start of a room's playback on it's own goroutine.
+type scheduledStart struct {
+	startsAt time.Time
+	wakeUp   Timer // Sends the next countdown or the start, whichever comes first
+}
+
+// Checks that a newly scheduled start is in the future and no further than it may be scheduled at.
+func validateScheduledStart(scheduledStart Timestamp, now time.Time) bool {
+	startsAt := time.Unix(int64(scheduledStart), 0)
+	return startsAt.After(now) && !startsAt.After(now.Add(MaxScheduleAhead))
+}
+
+// Starts counting down to the start the room's settings are scheduled at, replacing the previous countdown.
+// Expects the manager to be locked.
+func (manager *Manager) scheduleStart(room *Room) {
+	startsAt := time.Unix(int64(room.Settings.ScheduledStart), 0)
+	if room.schedule != nil && room.Settings.ScheduledStart != 0 && room.schedule.startsAt.Equal(startsAt) {
+		return
+	}
+
+	room.stopSchedule()
+	if room.Settings.ScheduledStart == 0 {
+		return
+	}
+
+	logger.Info("[%s] Scheduling the start of the room at %s\n", room.RoomID, startsAt)
+	schedule := &scheduledStart{startsAt: startsAt}
+	room.schedule = schedule
+
+	manager.waitForCountdown(room, schedule)
+}
+
+// Keeps the viewers of a waiting room paused, they only follow the video and time of the host until the start.
+func (room *Room) getWaitingReflection(reflection RoomReflection) RoomReflection {
+	if room.schedule != nil && (reflection.State == PlayerStatePlaying || reflection.State == PlayerStateBuffering) {
+		reflection.State = PlayerStatePaused
+	}
+
+	return reflection
+}
+
+// Waits for the next countdown tick or the start, whichever comes first.
+// Expects the manager to be locked, the timer is created right away so no tick is missed.
+func (manager *Manager) waitForCountdown(room *Room, schedule *scheduledStart) {
+	now := manager.clock.Now()
+	wakeAt := schedule.getPlayTime()
+	if nextTick, isTicking := getNextCountdownTick(schedule.startsAt, now); isTicking && nextTick.Before(wakeAt) {
+		wakeAt = nextTick
+	}
+
+	schedule.wakeUp = manager.clock.AfterFunc(max(wakeAt.Sub(now), time.Millisecond), func() {
+		manager.countDownToStart(room, schedule, wakeAt)
+	})
+}
+
+func (manager *Manager) countDownToStart(room *Room, schedule *scheduledStart, wakeAt time.Time) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if room.schedule != schedule {
+		return
+	}
+
+	if !wakeAt.Before(schedule.getPlayTime()) {
+		manager.sendDirectedMessages(manager.startScheduledPlayback(room))
+		return
+	}
+
+	manager.sendDirectedMessages(newCountdownMessages(room, manager.clock.Now()))
+	manager.waitForCountdown(room, schedule)
+}
+
+// The play is sent ahead of the start so every member receives it before it's time to play.
+func (schedule *scheduledStart) getPlayTime() time.Time {
+	return schedule.startsAt.Add(-SynchronizedStartDelay)
+}
+
+// Collects the time of the next countdown tick after now, if there's any left before the start.
+func getNextCountdownTick(startsAt time.Time, now time.Time) (time.Time, bool) {
+	timeLeft := startsAt.Sub(now)
+	if timeLeft > time.Hour {
+		return startsAt.Add(-(timeLeft - 1).Truncate(time.Hour)), true
+	}
+
+	for _, tick := range countdownTicks {
+		if tick < timeLeft {
+			return startsAt.Add(-tick), true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// Tells every member to start playing from the host's latest reflection at the scheduled start,
+// and clears the schedule from the room's settings. Expects the manager to be locked.
+func (manager *Manager) startScheduledPlayback(room *Room) []DirectedServerMessage {
+	reflection := room.latestReflection
+	reflection.State = PlayerStatePlaying
+	reflection.StartAt = Timestamp(room.schedule.startsAt.UnixMilli())
+
+	room.stopSchedule()
+	room.playbackState = PlayerStatePlaying
+	room.latestReflection = reflection
+	room.latestReflection.StartAt = 0
+	room.playbackUpdatedAt = time.UnixMilli(int64(reflection.StartAt))
+
+	settings := room.Settings
+	settings.ScheduledStart = 0
+
+	logger.Info("[%s] Starting the scheduled playback at %d\n", room.RoomID, reflection.StartAt)
+	members := append([]*Client{room.Host}, room.Viewers...)
+	serverMessages := newReflectionMessages(members, reflection)
+	serverMessages = append(serverMessages, updateRoomClientsWithLatestChanges(*room, room.UpdateSettings(settings))...)
+	return serverMessages
+}
+
+func (room *Room) stopSchedule() {
+	if room.schedule == nil {
+		return
+	}
+
+	room.schedule.wakeUp.Stop()
+	room.schedule = nil
+}
+
+func newCountdownMessages(room *Room, now time.Time) []DirectedServerMessage {
+	countdown := ServerCountdown{
+		StartsAt:    Timestamp(room.schedule.startsAt.Unix()),
+		SecondsLeft: int(math.Ceil(room.schedule.startsAt.Sub(now).Seconds())),
+	}
+
+	countdownDetails, errorMarshaling := json.Marshal(countdown)
+	if errorMarshaling != nil {
+		logger.Error("[%s] Failed to marshal the countdown: %s\n", room.RoomID, errorMarshaling)
+		return []DirectedServerMessage{}
+	}
+
+	members := append([]*Client{room.Host}, room.Viewers...)
+	serverMessages := make([]DirectedServerMessage, 0, len(members))
+	for _, member := range members {
+		serverMessages = append(serverMessages, DirectedServerMessage{
+			token: member.PrivateToken,
+			message: ServerMessage{
+				MessageType:    ServerMessageTypeCountdown,
+				MessageDetails: countdownDetails,
+				Status:         ServerMessageStatusOk,
+				ErrorMessage:   "",
+			},
+		})
+	}
+
+	return serverMessages
+}
@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestScheduledStart(t *testing.T) {
+	t.Run("counting down to the start and playing together", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice")
+		startsAt := room.clock.Now().Add(2 * time.Minute)
+		room.updateSettings(t, RoomSettings{Name: "Test", ScheduledStart: Timestamp(startsAt.Unix())})
+
+		room.reflect(t, PlayerStatePlaying, 5)
+		room.assertMessages(t, "Alice", "Settings changed", "ReflectRoom 2 5")
+
+		room.clock.Advance(time.Minute)
+		room.waitForMessages(t, "Alice", "Countdown 60")
+		room.clock.Advance(30 * time.Second)
+		room.waitForMessages(t, "Alice", "Countdown 30")
+		room.clock.Advance(20 * time.Second)
+		room.waitForMessages(t, "Alice", "Countdown 10")
+
+		for secondsLeft := 5; secondsLeft > 0; secondsLeft-- {
+			room.clock.Advance(startsAt.Add(-time.Duration(secondsLeft) * time.Second).Sub(room.clock.Now()))
+			room.waitForMessages(t, "Alice", fmt.Sprintf("Countdown %d", secondsLeft))
+		}
+
+		room.clock.Advance(time.Second - SynchronizedStartDelay)
+		started := fmt.Sprintf("ReflectRoom 1 5 startAt %d", startsAt.UnixMilli())
+		room.waitForMessages(t, "Alice", started, "Settings changed")
+		room.assertMessages(t, "Host", "Settings changed", "Countdown 60", "Countdown 30", "Countdown 10", "Countdown 5", "Countdown 4", "Countdown 3", "Countdown 2", "Countdown 1", started, "Settings changed")
+
+		if scheduledStart := room.manager.activeRooms[room.members["Host"].RoomID].Settings.ScheduledStart; scheduledStart != 0 {
+			t.Errorf("Expected the schedule to be cleared once started but got %d\n", scheduledStart)
+		}
+
+		room.reflect(t, PlayerStatePlaying, 6)
+		room.assertMessages(t, "Alice", "ReflectRoom 1 6")
+	})
+
+	t.Run("stopping the countdown once the schedule is cleared", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice")
+		startsAt := room.clock.Now().Add(90 * time.Second)
+		room.updateSettings(t, RoomSettings{Name: "Test", ScheduledStart: Timestamp(startsAt.Unix())})
+
+		room.clock.Advance(30 * time.Second)
+		room.waitForMessages(t, "Alice", "Settings changed", "Countdown 60")
+
+		room.updateSettings(t, RoomSettings{Name: "Test"})
+		room.clock.Advance(time.Hour)
+		room.assertMessages(t, "Alice", "Settings changed")
+
+		room.reflect(t, PlayerStatePlaying, 12)
+		room.assertMessages(t, "Alice", "ReflectRoom 1 12")
+	})
+
+	t.Run("counting down to the latest schedule", func(t *testing.T) {
+		room := newTestWaitingRoom(t, "Alice")
+		room.updateSettings(t, RoomSettings{Name: "Test", ScheduledStart: Timestamp(room.clock.Now().Add(time.Hour).Unix())})
+		room.updateSettings(t, RoomSettings{Name: "Test", ScheduledStart: Timestamp(room.clock.Now().Add(2 * time.Minute).Unix())})
+
+		room.clock.Advance(time.Minute)
+		room.waitForMessages(t, "Alice", "Settings changed", "Settings changed", "Countdown 60")
+	})
+
+	t.Run("rejecting schedules in the past or too far ahead", func(t *testing.T) {
+		manager, clock := newTestManagerWithFakeClock()
+		host := newTestAuthorizedClient(t, manager, clock, "Host")
+
+		for _, scheduledStart := range []time.Time{clock.Now().Add(-time.Second), clock.Now().Add(MaxScheduleAhead + time.Second)} {
+			settings, _ := json.Marshal(RoomSettings{Name: "Test", ScheduledStart: Timestamp(scheduledStart.Unix())})
+
+			serverMessages := manager.handleClientMessage(host, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeHostRoom, Message: string(settings)})
+			if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeInvalidSchedule {
+				t.Errorf("Expected hosting a room starting at %s to be rejected but got %+v\n", scheduledStart, serverMessages)
+			}
+
+			hostTestRoom(t, manager, host.PrivateToken)
+			serverMessages = manager.handleClientMessage(host, ClientMessage{ServerVersion: serverVersion, MessageType: ClientMessageTypeUpdateRoomSettings, Message: string(settings)})
+			if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeInvalidSchedule {
+				t.Errorf("Expected scheduling the room at %s to be rejected but got %+v\n", scheduledStart, serverMessages)
+			}
+		}
+	})
+}
+
+func TestGetNextCountdownTick(t *testing.T) {
+	startsAt := time.Date(2024, time.May, 1, 20, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		timeLeft          time.Duration
+		expectedTimeLeft  time.Duration
+		expectedIsTicking bool
+	}{
+		{3 * time.Hour, 2 * time.Hour, true},
+		{2*time.Hour + 30*time.Minute, 2 * time.Hour, true},
+		{61 * time.Minute, time.Hour, true},
+		{time.Hour, 30 * time.Minute, true},
+		{7 * time.Minute, 5 * time.Minute, true},
+		{45 * time.Second, 30 * time.Second, true},
+		{1500 * time.Millisecond, time.Second, true},
+		{time.Second, 0, false},
+	}
+
+	for _, test := range tests {
+		nextTick, isTicking := getNextCountdownTick(startsAt, startsAt.Add(-test.timeLeft))
+		if isTicking != test.expectedIsTicking || (isTicking && startsAt.Sub(nextTick) != test.expectedTimeLeft) {
+			t.Errorf("%s left: expected a tick with %s left (ticking: %t) but got %s (ticking: %t)\n", test.timeLeft, test.expectedTimeLeft, test.expectedIsTicking, startsAt.Sub(nextTick), isTicking)
+		}
+	}
+}
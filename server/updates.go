@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/xml"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+
+	"github.com/cowatch/logger"
+)
+
+const EndpointUpdatesGecko = "/updates/gecko.json"
+const EndpointUpdatesChromium = "/updates/chromium.xml"
+
+const DEFAULT_GECKO_ADDON_ID = "cowatch@gmail.com"
+
+type UpdateManifestOptions struct {
+	PublicURL     string // Base url the browsers download releases from, derived from each request if empty
+	GeckoAddonID  string // The id in the browser_specific_settings of the firefox manifest
+	ChromiumAppID string // The id chrome assigned to the extension when it was packed
+}
+
+// UpdateManifests generates the manifests browsers poll through the extension's update_url
+// to install new releases of the registry on their own.
+type UpdateManifests struct {
+	registry *ReleaseRegistry
+	options  UpdateManifestOptions
+}
+
+func NewUpdateManifests(registry *ReleaseRegistry, options UpdateManifestOptions) *UpdateManifests {
+	return &UpdateManifests{registry: registry, options: options}
+}
+
+// RegisterRoutes adds the update manifests to the router. Chrome ignores the apps of a manifest
+// that don't match the extension's id, so it's manifest is only served once the id is known.
+func (updates *UpdateManifests) RegisterRoutes(router *http.ServeMux) {
+	router.HandleFunc("GET "+EndpointUpdatesGecko, updates.HandleGeckoUpdates)
+
+	if updates.options.ChromiumAppID == "" {
+		logger.Warn("No chromium app id set, the chromium update manifest is disabled\n")
+		return
+	}
+
+	router.HandleFunc("GET "+EndpointUpdatesChromium, updates.HandleChromiumUpdates)
+}
+
+type geckoUpdateManifest struct {
+	Addons map[string]geckoAddonUpdates `json:"addons"`
+}
+
+type geckoAddonUpdates struct {
+	Updates []geckoUpdate `json:"updates"`
+}
+
+type geckoUpdate struct {
+	Version    string `json:"version"`
+	UpdateLink string `json:"update_link"`
+	UpdateHash string `json:"update_hash"`
+}
+
+// HandleGeckoUpdates responds with the firefox update manifest listing every compatible
+// release from the oldest to the newest.
+func (updates *UpdateManifests) HandleGeckoUpdates(w http.ResponseWriter, r *http.Request) {
+	releases := updates.registry.GetCompatibleReleases(BrowserGecko)
+	slices.Reverse(releases)
+
+	addonUpdates := geckoAddonUpdates{Updates: make([]geckoUpdate, 0, len(releases))}
+	for _, release := range releases {
+		addonUpdates.Updates = append(addonUpdates.Updates, geckoUpdate{
+			Version:    release.Version,
+			UpdateLink: updates.getDownloadURL(r, release),
+			UpdateHash: "sha256:" + release.SHA256,
+		})
+	}
+
+	w.Header().Set("Cache-Control", CacheControlLatestRelease)
+	writeJSONResponse(w, geckoUpdateManifest{
+		Addons: map[string]geckoAddonUpdates{updates.options.GeckoAddonID: addonUpdates},
+	})
+}
+
+type chromiumUpdateResponse struct {
+	XMLName  xml.Name            `xml:"gupdate"`
+	XMLNS    string              `xml:"xmlns,attr"`
+	Protocol string              `xml:"protocol,attr"`
+	Apps     []chromiumUpdateApp `xml:"app"`
+}
+
+type chromiumUpdateApp struct {
+	AppID       string              `xml:"appid,attr"`
+	UpdateCheck chromiumUpdateCheck `xml:"updatecheck"`
+}
+
+type chromiumUpdateCheck struct {
+	Status     string `xml:"status,attr,omitempty"`
+	Codebase   string `xml:"codebase,attr,omitempty"`
+	Version    string `xml:"version,attr,omitempty"`
+	HashSHA256 string `xml:"hash_sha256,attr,omitempty"`
+}
+
+// HandleChromiumUpdates responds with the chrome updatecheck manifest pointing to the newest
+// compatible release, as the protocol only allows a single update per extension.
+func (updates *UpdateManifests) HandleChromiumUpdates(w http.ResponseWriter, r *http.Request) {
+	updateCheck := chromiumUpdateCheck{Status: "noupdate"}
+
+	release, exists := updates.registry.GetLatestRelease(BrowserChromium)
+	if exists {
+		updateCheck = chromiumUpdateCheck{
+			Codebase:   updates.getDownloadURL(r, release),
+			Version:    release.Version,
+			HashSHA256: release.SHA256,
+		}
+	}
+
+	rawResponse, errorMarshaling := xml.MarshalIndent(chromiumUpdateResponse{
+		XMLNS:    "http://www.google.com/update2/response",
+		Protocol: "2.0",
+		Apps:     []chromiumUpdateApp{{AppID: updates.options.ChromiumAppID, UpdateCheck: updateCheck}},
+	}, "", "\t")
+
+	if errorMarshaling != nil {
+		logger.Error("Failed to marshal chromium update manifest: %s\n", errorMarshaling)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Add("Content-Type", "application/xml")
+	w.Header().Set("Cache-Control", CacheControlLatestRelease)
+	w.Write([]byte(xml.Header))
+	w.Write(rawResponse)
+}
+
+// Builds the absolute url of a release's download, as browsers resolve it outside of any page.
+func (updates *UpdateManifests) getDownloadURL(r *http.Request, release Release) string {
+	publicURL := updates.options.PublicURL
+	if publicURL == "" {
+		scheme := "http"
+		if r.TLS != nil || r.Header.Get("X-Forwarded-Proto") == "https" {
+			scheme = "https"
+		}
+
+		publicURL = scheme + "://" + r.Host
+	}
+
+	downloadPath := strings.NewReplacer("{browser}", url.PathEscape(string(release.Browser)), "{version}", url.PathEscape(release.Version)).Replace(EndpointDownloadVersion)
+	return strings.TrimSuffix(publicURL, "/") + downloadPath
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+func TestUpdateManifests(t *testing.T) {
+	releases := []Release{
+		newTestRelease(BrowserGecko, "0.0.10", "cowatch-0.0.10.xpi", ""),
+		newTestRelease(BrowserGecko, "0.0.9", "cowatch-0.0.9.xpi", ""),
+		newTestRelease(BrowserGecko, "0.1.0", "cowatch-0.1.0.xpi", "0.1.0"),
+		newTestRelease(BrowserChromium, "0.0.9", "cowatch-0.0.9.crx", ""),
+		newTestRelease(BrowserChromium, "0.0.10", "cowatch-0.0.10.crx", ""),
+	}
+
+	registry, err := LoadReleaseRegistry(writeReleaseDirectory(t, releases, nil), "0.0.10")
+	if err != nil {
+		t.Fatalf("Failed to load registry: %v\n", err)
+	}
+
+	options := UpdateManifestOptions{
+		PublicURL:     "https://cowatch.example.com/",
+		GeckoAddonID:  DEFAULT_GECKO_ADDON_ID,
+		ChromiumAppID: "abcdefghijklmnopabcdefghijklmnop",
+	}
+
+	mockServer, _ := newTestServer(t, testServerOptions{updates: NewUpdateManifests(registry, options)})
+
+	t.Run("listing compatible firefox updates from oldest to newest", func(t *testing.T) {
+		response, body := getTestEndpoint(t, mockServer, EndpointUpdatesGecko)
+
+		var got geckoUpdateManifest
+		json.Unmarshal(body, &got)
+
+		want := geckoUpdateManifest{
+			Addons: map[string]geckoAddonUpdates{
+				DEFAULT_GECKO_ADDON_ID: {
+					Updates: []geckoUpdate{
+						{Version: "0.0.9", UpdateLink: "https://cowatch.example.com/download/gecko/0.0.9", UpdateHash: "sha256:" + releases[1].SHA256},
+						{Version: "0.0.10", UpdateLink: "https://cowatch.example.com/download/gecko/0.0.10", UpdateHash: "sha256:" + releases[0].SHA256},
+					},
+				},
+			},
+		}
+
+		if response.StatusCode != http.StatusOK || !reflect.DeepEqual(got, want) {
+			t.Errorf("Got %d %+v\nWant %+v\n", response.StatusCode, got, want)
+		}
+	})
+
+	t.Run("pointing chrome to the newest release", func(t *testing.T) {
+		response, body := getTestEndpoint(t, mockServer, EndpointUpdatesChromium)
+
+		var got chromiumUpdateResponse
+		if err := xml.Unmarshal(body, &got); err != nil {
+			t.Fatalf("Failed to parse %q: %v\n", body, err)
+		}
+
+		wantApp := chromiumUpdateApp{
+			AppID: options.ChromiumAppID,
+			UpdateCheck: chromiumUpdateCheck{
+				Codebase:   "https://cowatch.example.com/download/chromium/0.0.10",
+				Version:    "0.0.10",
+				HashSHA256: releases[4].SHA256,
+			},
+		}
+
+		if response.Header.Get("Content-Type") != "application/xml" || got.Protocol != "2.0" || len(got.Apps) != 1 || got.Apps[0] != wantApp {
+			t.Errorf("Got %s\n", body)
+		}
+	})
+
+	t.Run("reporting no update without chrome releases", func(t *testing.T) {
+		emptyRegistry, _ := LoadReleaseRegistry(t.TempDir(), serverVersion)
+		emptyServer, _ := newTestServer(t, testServerOptions{updates: NewUpdateManifests(emptyRegistry, UpdateManifestOptions{ChromiumAppID: "app"})})
+
+		_, body := getTestEndpoint(t, emptyServer, EndpointUpdatesChromium)
+
+		var got chromiumUpdateResponse
+		xml.Unmarshal(body, &got)
+		if len(got.Apps) != 1 || got.Apps[0].UpdateCheck.Status != "noupdate" {
+			t.Errorf("Got %s\n", body)
+		}
+	})
+
+	t.Run("not serving the chrome manifest without an app id", func(t *testing.T) {
+		geckoOnlyServer, _ := newTestServer(t, testServerOptions{updates: NewUpdateManifests(registry, UpdateManifestOptions{GeckoAddonID: DEFAULT_GECKO_ADDON_ID})})
+
+		if response, body := getTestEndpoint(t, geckoOnlyServer, EndpointUpdatesChromium); response.StatusCode != http.StatusNotFound {
+			t.Errorf("Expected %d but got %d %s\n", http.StatusNotFound, response.StatusCode, body)
+		}
+
+		if response, _ := getTestEndpoint(t, geckoOnlyServer, EndpointUpdatesGecko); response.StatusCode != http.StatusOK {
+			t.Errorf("Expected the firefox manifest to still be served but got %d\n", response.StatusCode)
+		}
+	})
+
+	t.Run("deriving download links from the request", func(t *testing.T) {
+		derivedServer, _ := newTestServer(t, testServerOptions{updates: NewUpdateManifests(registry, UpdateManifestOptions{GeckoAddonID: DEFAULT_GECKO_ADDON_ID})})
+
+		_, body := getTestEndpoint(t, derivedServer, EndpointUpdatesGecko)
+
+		var got geckoUpdateManifest
+		json.Unmarshal(body, &got)
+
+		updates := got.Addons[DEFAULT_GECKO_ADDON_ID].Updates
+		if len(updates) == 0 || updates[0].UpdateLink != derivedServer.URL+"/download/gecko/0.0.9" {
+			t.Errorf("Got %+v\n", updates)
+		}
+	})
+}
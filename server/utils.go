@@ -1,5 +1,10 @@
 package main
 
+import (
+	"strconv"
+	"strings"
+)
+
 func FindInSlice[T any](slice []T, search T, compare func(T, T) bool) (int, bool) {
 	var found = false
 	var i = 0
@@ -23,3 +28,53 @@ func RemoveFromSlice[T any](slice []T, index int) []T {
 
 	return newSlice
 }
+
+// CompareVersions compares two dot separated versions (e.g. "0.0.10" and "0.0.9") segment by segment.
+// It returns -1, 0 or 1 if a is lower, equal or greater than b and false if either isn't a valid version.
+func CompareVersions(a, b string) (int, bool) {
+	segmentsA, isValidA := parseVersion(a)
+	segmentsB, isValidB := parseVersion(b)
+	if !isValidA || !isValidB {
+		return 0, false
+	}
+
+	for index := 0; index < max(len(segmentsA), len(segmentsB)); index++ {
+		var segmentA, segmentB int
+		if index < len(segmentsA) {
+			segmentA = segmentsA[index]
+		}
+
+		if index < len(segmentsB) {
+			segmentB = segmentsB[index]
+		}
+
+		if segmentA != segmentB {
+			if segmentA < segmentB {
+				return -1, true
+			}
+
+			return 1, true
+		}
+	}
+
+	return 0, true
+}
+
+func parseVersion(version string) ([]int, bool) {
+	if version == "" {
+		return nil, false
+	}
+
+	rawSegments := strings.Split(version, ".")
+	segments := make([]int, len(rawSegments))
+	for index, rawSegment := range rawSegments {
+		segment, errorParsing := strconv.Atoi(rawSegment)
+		if errorParsing != nil || segment < 0 || strings.HasPrefix(rawSegment, "+") {
+			return nil, false
+		}
+
+		segments[index] = segment
+	}
+
+	return segments, true
+}
@@ -0,0 +1,284 @@
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"slices"
+	"time"
+
+	"github.com/cowatch/logger"
+)
+
+// DefaultVoteDuration is how long a vote lasts in rooms that don't set their own duration.
+const DefaultVoteDuration = 30 * time.Second
+
+// MaxVoteDuration is the longest a room may let it's votes last.
+const MaxVoteDuration = 5 * time.Minute
+
+// roomVote is the vote in progress in a room.
+type roomVote struct {
+	tally   ServerVote
+	votes   map[Token]bool // The votes cast by the members, by their private token
+	timeout Timer          // Fails the vote once it runs out of time
+}
+
+// Handles a member starting a vote on an action, counting them in favor of it.
+func StartVoteHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
+	var requestStartVote ClientRequestStartVote
+	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &requestStartVote)
+	isKnownAction := slices.Contains([]VoteAction{VoteActionSkip, VoteActionPause, VoteActionSeek}, requestStartVote.Action)
+	if errorParsingRequest != nil || !isKnownAction {
+		logger.Warn("[%s] [StartVote] Client sent bad json object: %v %q\n", client.PrivateToken, errorParsingRequest, requestStartVote.Action)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeStartVote),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageBadJson,
+					ErrorCode:      ServerErrorCodeBadJson,
+				},
+			},
+		}
+	}
+
+	room, exists := manager.GetRegisteredRoom(client.RoomID)
+	if !exists {
+		logger.Info("[%s] [StartVote] No room found with id: %s\n", client.PrivateToken, client.RoomID)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeStartVote),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageNoRoom,
+					ErrorCode:      ServerErrorCodeNoRoom,
+				},
+			},
+		}
+	}
+
+	if room.vote != nil {
+		logger.Info("[%s] [StartVote] Vote %d is still in progress in room %s\n", client.PrivateToken, room.vote.tally.VoteID, room.RoomID)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeStartVote),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageVoteInProgress,
+					ErrorCode:      ServerErrorCodeVoteInProgress,
+				},
+			},
+		}
+	}
+
+	voteDuration := DefaultVoteDuration
+	if room.Settings.VoteDuration > 0 {
+		voteDuration = time.Duration(room.Settings.VoteDuration) * time.Second
+	}
+
+	room.latestVoteID++
+	vote := &roomVote{
+		tally: ServerVote{
+			VoteID:    room.latestVoteID,
+			Action:    requestStartVote.Action,
+			StartedBy: client.GetFilteredClient(),
+			EndsAt:    Timestamp(manager.clock.Now().Add(voteDuration).Unix()),
+		},
+		votes: map[Token]bool{client.PrivateToken: true},
+	}
+
+	if requestStartVote.Action == VoteActionSeek {
+		vote.tally.Time = requestStartVote.Time
+	}
+
+	vote.timeout = manager.clock.AfterFunc(voteDuration, func() {
+		manager.endVoteOnTimeout(room, vote)
+	})
+	room.vote = vote
+
+	logger.Info("[%s] [StartVote] Started vote %d to %s in room %s\n", client.PrivateToken, vote.tally.VoteID, vote.tally.Action, room.RoomID)
+	return manager.tallyVote(room)
+}
+
+// Handles a member voting for or against the vote in progress, they may change their vote until it ends.
+func CastVoteHandler(client *Client, manager *Manager, clientRequest string) []DirectedServerMessage {
+	var requestCastVote ClientRequestCastVote
+	errorParsingRequest := json.Unmarshal([]byte(clientRequest), &requestCastVote)
+	if errorParsingRequest != nil {
+		logger.Warn("[%s] [CastVote] Client sent bad json object: %s\n", client.PrivateToken, errorParsingRequest)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeCastVote),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageBadJson,
+					ErrorCode:      ServerErrorCodeBadJson,
+				},
+			},
+		}
+	}
+
+	room, exists := manager.GetRegisteredRoom(client.RoomID)
+	if !exists {
+		logger.Info("[%s] [CastVote] No room found with id: %s\n", client.PrivateToken, client.RoomID)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeCastVote),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageNoRoom,
+					ErrorCode:      ServerErrorCodeNoRoom,
+				},
+			},
+		}
+	}
+
+	if room.vote == nil || room.vote.tally.VoteID != requestCastVote.VoteID {
+		logger.Info("[%s] [CastVote] Vote %d isn't in progress in room %s\n", client.PrivateToken, requestCastVote.VoteID, room.RoomID)
+		return []DirectedServerMessage{
+			{
+				token: client.PrivateToken,
+				message: ServerMessage{
+					MessageType:    ServerMessageType(ClientMessageTypeCastVote),
+					MessageDetails: nil,
+					Status:         ServerMessageStatusError,
+					ErrorMessage:   ServerErrorMessageNoVote,
+					ErrorCode:      ServerErrorCodeNoVote,
+				},
+			},
+		}
+	}
+
+	logger.Debug("[%s] [CastVote] Voted in favor of vote %d: %t\n", client.PrivateToken, requestCastVote.VoteID, requestCastVote.InFavor)
+	room.vote.votes[client.PrivateToken] = requestCastVote.InFavor
+	return manager.tallyVote(room)
+}
+
+// Counts the votes of the members still in the room and sends the tally to every member,
+// carrying out the vote's action once it passes. Expects the manager to be locked.
+func (manager *Manager) tallyVote(room *Room) []DirectedServerMessage {
+	vote := room.vote
+	if vote == nil {
+		return []DirectedServerMessage{}
+	}
+
+	members := append([]*Client{room.Host}, room.Viewers...)
+	vote.tally.InFavor, vote.tally.Against = 0, 0
+	for _, member := range members {
+		inFavor, hasVoted := vote.votes[member.PrivateToken]
+		if !hasVoted {
+			continue
+		}
+
+		if inFavor {
+			vote.tally.InFavor++
+		} else {
+			vote.tally.Against++
+		}
+	}
+
+	vote.tally.Required = getRequiredVotes(len(members), room.Settings.VoteThreshold)
+	notVoted := len(members) - vote.tally.InFavor - vote.tally.Against
+	if vote.tally.InFavor >= vote.tally.Required {
+		vote.tally.Result = VoteResultPassed
+	} else if vote.tally.InFavor+notVoted < vote.tally.Required {
+		vote.tally.Result = VoteResultFailed
+	}
+
+	serverMessages := newVoteMessages(room, vote.tally)
+	if vote.tally.Result == "" {
+		return serverMessages
+	}
+
+	logger.Info("[%s] Vote %d to %s ended: %s\n", room.RoomID, vote.tally.VoteID, vote.tally.Action, vote.tally.Result)
+	room.stopVote()
+
+	if vote.tally.Result == VoteResultPassed {
+		serverMessages = append(serverMessages, manager.carryOutVote(room, vote.tally)...)
+	}
+
+	return serverMessages
+}
+
+// Reflects the action of a vote that passed as if the host did it, including to the host.
+func (manager *Manager) carryOutVote(room *Room, tally ServerVote) []DirectedServerMessage {
+	reflection := room.getPlaybackAt(manager.clock.Now())
+	switch tally.Action {
+	case VoteActionSkip:
+		reflection.State = PlayerStateEnded
+	case VoteActionPause:
+		reflection.State = PlayerStatePaused
+	case VoteActionSeek:
+		reflection.CurrentTime = tally.Time
+	}
+
+	serverMessages := manager.reflectPlayback(room, reflection, room.Host)
+	room.isHostBehind = true
+	return append(serverMessages, newReflectionMessages([]*Client{room.Host}, room.getWaitingReflection(reflection))...)
+}
+
+// The votes in favor out of the members a vote needs, more than half of them with no threshold.
+func getRequiredVotes(memberCount int, threshold int) int {
+	if threshold <= 0 {
+		return memberCount/2 + 1
+	}
+
+	return max(int(math.Ceil(float64(memberCount*threshold)/100)), 1)
+}
+
+func (manager *Manager) endVoteOnTimeout(room *Room, vote *roomVote) {
+	manager.mutex.Lock()
+	defer manager.mutex.Unlock()
+
+	if room.vote != vote {
+		return
+	}
+
+	logger.Info("[%s] Vote %d to %s ran out of time\n", room.RoomID, vote.tally.VoteID, vote.tally.Action)
+	room.stopVote()
+
+	vote.tally.Result = VoteResultFailed
+	manager.sendDirectedMessages(newVoteMessages(room, vote.tally))
+}
+
+func (room *Room) stopVote() {
+	if room.vote == nil {
+		return
+	}
+
+	room.vote.timeout.Stop()
+	room.vote = nil
+}
+
+func newVoteMessages(room *Room, tally ServerVote) []DirectedServerMessage {
+	voteDetails, errorMarshaling := json.Marshal(tally)
+	if errorMarshaling != nil {
+		logger.Error("[%s] Failed to marshal the vote: %s\n", room.RoomID, errorMarshaling)
+		return []DirectedServerMessage{}
+	}
+
+	members := append([]*Client{room.Host}, room.Viewers...)
+	serverMessages := make([]DirectedServerMessage, 0, len(members))
+	for _, member := range members {
+		serverMessages = append(serverMessages, DirectedServerMessage{
+			token: member.PrivateToken,
+			message: ServerMessage{
+				MessageType:    ServerMessageTypeVote,
+				MessageDetails: voteDetails,
+				Status:         ServerMessageStatusOk,
+				ErrorMessage:   "",
+			},
+		})
+	}
+
+	return serverMessages
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+func TestVotes(t *testing.T) {
+	t.Run("carrying out a vote once a majority is in favor", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test"}, "Alice", "Bob")
+		room.reflect(t, PlayerStatePlaying, 10)
+		room.clock.Advance(2 * time.Second)
+
+		room.startVote(t, "Alice", VoteActionPause, 0)
+		room.castVote(t, "Bob", 1, true)
+
+		room.assertMessages(t, "Host", "Vote 1 PAUSE 1-0 of 2", "Vote 1 PAUSE 2-0 of 2 PASSED", "ReflectRoom 2 12")
+		room.assertMessages(t, "Alice", "ReflectRoom 1 10", "Vote 1 PAUSE 1-0 of 2", "Vote 1 PAUSE 2-0 of 2 PASSED", "ReflectRoom 2 12")
+		room.assertMessages(t, "Bob", "ReflectRoom 1 10", "Vote 1 PAUSE 1-0 of 2", "Vote 1 PAUSE 2-0 of 2 PASSED", "ReflectRoom 2 12")
+	})
+
+	t.Run("failing a vote once it can no longer pass", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test", VoteThreshold: 100}, "Alice", "Bob")
+		room.startVote(t, "Alice", VoteActionSkip, 0)
+		room.castVote(t, "Bob", 1, true)
+		room.castVote(t, "Bob", 1, false)
+
+		room.assertMessages(t, "Host", "Vote 1 SKIP 1-0 of 3", "Vote 1 SKIP 2-0 of 3", "Vote 1 SKIP 1-1 of 3 FAILED")
+
+		room.startVote(t, "Bob", VoteActionSeek, 60)
+		room.assertMessages(t, "Alice", "Vote 1 SKIP 1-0 of 3", "Vote 1 SKIP 2-0 of 3", "Vote 1 SKIP 1-1 of 3 FAILED", "Vote 2 SEEK 1-0 of 3")
+	})
+
+	t.Run("failing a vote that runs out of time", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test", VoteDuration: 10}, "Alice", "Bob")
+		room.startVote(t, "Alice", VoteActionSeek, 60)
+		room.assertMessages(t, "Alice", "Vote 1 SEEK 1-0 of 2")
+
+		room.clock.Advance(10 * time.Second)
+		room.waitForMessages(t, "Alice", "Vote 1 SEEK 1-0 of 2 FAILED")
+
+		serverMessages := room.handleMessages("Bob", ClientMessageTypeCastVote, ClientRequestCastVote{VoteID: 1, InFavor: true})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeNoVote {
+			t.Errorf("Expected voting on an ended vote to be rejected but got %+v\n", serverMessages)
+		}
+	})
+
+	t.Run("rejecting a vote while another is in progress", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test"}, "Alice", "Bob")
+		room.startVote(t, "Alice", VoteActionPause, 0)
+
+		serverMessages := room.handleMessages("Bob", ClientMessageTypeStartVote, ClientRequestStartVote{Action: VoteActionSkip})
+		if len(serverMessages) != 1 || serverMessages[0].message.ErrorCode != ServerErrorCodeVoteInProgress {
+			t.Errorf("Expected the second vote to be rejected but got %+v\n", serverMessages)
+		}
+	})
+
+	t.Run("recounting the votes once a voter leaves", func(t *testing.T) {
+		room := newTestControlledRoom(t, RoomSettings{Name: "Test", VoteThreshold: 50}, "Alice", "Bob")
+		room.reflect(t, PlayerStatePlaying, 10)
+		room.startVote(t, "Alice", VoteActionSkip, 0)
+		room.castVote(t, "Bob", 1, false)
+		room.assertMessages(t, "Alice", "ReflectRoom 1 10", "Vote 1 SKIP 1-0 of 2", "Vote 1 SKIP 1-1 of 2")
+
+		room.handle(t, "Bob", ClientMessageTypeDisconnectRoom, "")
+		room.assertMessages(t, "Alice", "Bob left", "Vote 1 SKIP 1-0 of 1 PASSED", "ReflectRoom 0 10")
+	})
+}
+
+func TestGetRequiredVotes(t *testing.T) {
+	tests := []struct {
+		memberCount int
+		threshold   int
+		expected    int
+	}{
+		{1, 0, 1},
+		{2, 0, 2},
+		{5, 0, 3},
+		{6, 0, 4},
+		{3, 50, 2},
+		{4, 50, 2},
+		{3, 100, 3},
+		{10, 1, 1},
+	}
+
+	for _, test := range tests {
+		if required := getRequiredVotes(test.memberCount, test.threshold); required != test.expected {
+			t.Errorf("%d members with a %d%% threshold: expected %d votes but got %d\n", test.memberCount, test.threshold, test.expected, required)
+		}
+	}
+}
+
+func (room *testWaitingRoom) startVote(t *testing.T, name string, action VoteAction, playbackTime float32) {
+	t.Helper()
+
+	startVote, _ := json.Marshal(ClientRequestStartVote{Action: action, Time: playbackTime})
+	room.handle(t, name, ClientMessageTypeStartVote, string(startVote))
+}
+
+func (room *testWaitingRoom) castVote(t *testing.T, name string, voteID VoteID, isInFavor bool) {
+	t.Helper()
+
+	castVote, _ := json.Marshal(ClientRequestCastVote{VoteID: voteID, InFavor: isInFavor})
+	room.handle(t, name, ClientMessageTypeCastVote, string(castVote))
+}
@@ -2,39 +2,83 @@
 package main
 
 import (
+	"compress/flate"
 	"errors"
+	"fmt"
 	"net/http"
 
+	"github.com/cowatch/protocol"
 	"github.com/gorilla/websocket"
 )
 
 var ErrConnectionNotExists = errors.New("Connection does not exist")
+var ErrInvalidCompressionLevel = fmt.Errorf("Compression level must be between %d and %d", flate.HuffmanOnly, flate.BestCompression)
+
+// CompressionOptions configures the permessage-deflate extension.
+//
+// Compression is only used for clients that negotiate it during the handshake, every other client
+// keeps receiving uncompressed messages. Messages smaller than the Threshold (e.g. reflections)
+// are always sent uncompressed as the deflate overhead outweighs the savings.
+type CompressionOptions struct {
+	Enabled   bool
+	Level     int
+	Threshold int
+}
+
+var DefaultCompressionOptions = CompressionOptions{
+	Enabled:   true,
+	Level:     flate.BestSpeed,
+	Threshold: 512,
+}
 
 // Encapsulation of websocket connection from the gorilla module.
 type GorillaConnection struct {
-	connection *websocket.Conn
+	connection           *websocket.Conn
+	codec                Codec
+	compressionThreshold int
 }
 
 func (conn GorillaConnection) GetAddr() string {
 	return conn.connection.RemoteAddr().String()
 }
 
+// Get's the codec negotiated during the handshake
+func (conn GorillaConnection) GetCodec() Codec {
+	return conn.codec
+}
+
+// Closes the underlying websocket connection
+func (conn GorillaConnection) Close() error {
+	return conn.connection.Close()
+}
+
 // Read's next websocket message
 func (conn GorillaConnection) ReadMessage() (ClientMessage, error) {
 	var message ClientMessage
-	err := conn.connection.ReadJSON(&message)
+	_, rawMessage, err := conn.connection.ReadMessage()
+	if err != nil {
+		return message, err
+	}
+
+	err = conn.codec.Unmarshal(rawMessage, &message)
 	return message, err
 }
 
-// Sends an abstract json to the client
+// Sends an abstract object to the client encoded with the negotiated codec
 func (conn GorillaConnection) WriteMessage(data interface{}) error {
-	conn.connection.WriteJSON(data)
-	return nil
+	encodedData, err := conn.codec.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	conn.connection.EnableWriteCompression(len(encodedData) >= conn.compressionThreshold)
+	return conn.connection.WriteMessage(conn.codec.GetFrameType(), encodedData)
 }
 
 // Manager for GorillaConnections.
 type GorillaConnectionManager struct {
 	upgrader       websocket.Upgrader
+	compression    CompressionOptions
 	connectionsMap map[Token]*Connection
 }
 
@@ -45,8 +89,14 @@ func (connManager GorillaConnectionManager) NewConnection(w http.ResponseWriter,
 		return nil, err
 	}
 
+	if connManager.compression.Enabled {
+		websocketConnection.SetCompressionLevel(connManager.compression.Level)
+	}
+
 	connection := GorillaConnection{
-		connection: websocketConnection,
+		connection:           websocketConnection,
+		codec:                GetCodec(websocketConnection.Subprotocol()),
+		compressionThreshold: connManager.compression.Threshold,
 	}
 
 	return connection, nil
@@ -75,12 +125,25 @@ func (connManager GorillaConnectionManager) GetConnection(privateToken Token) (*
 }
 
 func NewGorillaConnectionManager() GorillaConnectionManager {
+	connManager, _ := NewGorillaConnectionManagerWithCompression(DefaultCompressionOptions)
+	return connManager
+}
+
+// Creates a connection manager that negotiates compression with the given options.
+func NewGorillaConnectionManagerWithCompression(compression CompressionOptions) (GorillaConnectionManager, error) {
+	if compression.Enabled && (compression.Level < flate.HuffmanOnly || compression.Level > flate.BestCompression) {
+		return GorillaConnectionManager{}, ErrInvalidCompressionLevel
+	}
+
 	return GorillaConnectionManager{
 		upgrader: websocket.Upgrader{
-			ReadBufferSize:  1024,
-			WriteBufferSize: 1024,
-			CheckOrigin:     func(request *http.Request) bool { return true },
+			ReadBufferSize:    1024,
+			WriteBufferSize:   1024,
+			CheckOrigin:       func(request *http.Request) bool { return true },
+			Subprotocols:      protocol.SupportedSubprotocols,
+			EnableCompression: compression.Enabled,
 		},
+		compression:    compression,
 		connectionsMap: make(map[Token]*Connection, 1024),
-	}
+	}, nil
 }
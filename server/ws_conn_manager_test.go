@@ -256,6 +256,88 @@ func TestGorillaConnection(t *testing.T) {
 	})
 }
 
+func TestGorillaConnectionCompression(t *testing.T) {
+	t.Run("compressed and uncompressed clients sharing a room", func(t *testing.T) {
+		mockManager := NewManager(serverVersion, NewGorillaConnectionManager())
+		mockServer := setupServer(mockManager.HandleMessages)
+		defer mockServer.Close()
+
+		wsHost, hostResponse, err := dialServer(mockServer, &websocket.Dialer{EnableCompression: true})
+		if err != nil {
+			t.Fatalf("Failed to open a compressed ws connection: %v\n", err)
+		}
+		defer wsHost.Close()
+
+		wsViewer, viewerResponse, err := dialServer(mockServer, &websocket.Dialer{EnableCompression: false})
+		if err != nil {
+			t.Fatalf("Failed to open an uncompressed ws connection: %v\n", err)
+		}
+		defer wsViewer.Close()
+
+		if !strings.Contains(hostResponse.Header.Get("Sec-Websocket-Extensions"), "permessage-deflate") {
+			t.Errorf("Expected compression to be negotiated for the host\n")
+		}
+
+		if viewerResponse.Header.Get("Sec-Websocket-Extensions") != "" {
+			t.Errorf("Expected no compression to be negotiated for the viewer\n")
+		}
+
+		sendClientMessage(t, wsHost, ClientMessageTypeAuthorize, ClientRequestAuthorizeRoom{Name: "Host"})
+		readServerMessage(t, wsHost, ServerMessageTypeAuthorize, ServerMessageStatusOk)
+
+		sendClientMessage(t, wsHost, ClientMessageTypeHostRoom, RoomSettings{Name: "Compression"})
+		var roomRecord RoomRecord
+		json.Unmarshal(readServerMessage(t, wsHost, ServerMessageTypeHostRoom, ServerMessageStatusOk).MessageDetails, &roomRecord)
+
+		sendClientMessage(t, wsViewer, ClientMessageTypeAuthorize, ClientRequestAuthorizeRoom{Name: "Viewer"})
+		readServerMessage(t, wsViewer, ServerMessageTypeAuthorize, ServerMessageStatusOk)
+
+		sendClientMessage(t, wsViewer, ClientMessageTypeJoinRoom, ClientRequestJoinRoom{RoomID: roomRecord.RoomID})
+		readServerMessage(t, wsViewer, ServerMessageTypeJoinRoom, ServerMessageStatusOk)
+		readServerMessage(t, wsHost, ServerMessageTypeUpdateRoom, ServerMessageStatusOk)
+
+		videoDetails := VideoDetails{
+			Title:           strings.Repeat("A long title that will get compressed ", 50),
+			Author:          "Author",
+			AuthorImage:     "https://example.com/" + strings.Repeat("image", 100),
+			SubscriberCount: "5",
+			LikeCount:       "100",
+		}
+		sendClientMessage(t, wsHost, ClientMessageTypeSendVideoDetails, videoDetails)
+
+		var receivedVideoDetails VideoDetails
+		json.Unmarshal(readServerMessage(t, wsViewer, ServerMessageTypeReflectVideoDetails, ServerMessageStatusOk).MessageDetails, &receivedVideoDetails)
+		if !reflect.DeepEqual(receivedVideoDetails, videoDetails) {
+			t.Errorf("Viewer received different video details\nGot %+v Want %+v\n", receivedVideoDetails, videoDetails)
+		}
+
+		reflection := RoomReflection{ID: "video", State: 1, CurrentTime: 10}
+		sendClientMessage(t, wsHost, ClientMessageTypeSendReflection, reflection)
+
+		var receivedReflection RoomReflection
+		json.Unmarshal(readServerMessage(t, wsViewer, ServerMessageTypeReflectRoom, ServerMessageStatusOk).MessageDetails, &receivedReflection)
+		if receivedReflection != reflection {
+			t.Errorf("Viewer received different reflection\nGot %+v Want %+v\n", receivedReflection, reflection)
+		}
+
+		sendClientMessage(t, wsViewer, ClientMessageTypeDisconnectRoom, nil)
+		readServerMessage(t, wsViewer, ServerMessageTypeDisconnectRoom, ServerMessageStatusOk)
+
+		var roomDelta RoomDelta
+		json.Unmarshal(readServerMessage(t, wsHost, ServerMessageTypeUpdateRoom, ServerMessageStatusOk).MessageDetails, &roomDelta)
+		if roomDelta.Type != RoomDeltaTypeViewerLeft {
+			t.Errorf("Compressed host expected the viewer to leave but got %q\n", roomDelta.Type)
+		}
+	})
+
+	t.Run("creating a connection manager with an invalid compression level", func(t *testing.T) {
+		_, err := NewGorillaConnectionManagerWithCompression(CompressionOptions{Enabled: true, Level: 42})
+		if err != ErrInvalidCompressionLevel {
+			t.Errorf("Expected %v but got %v\n", ErrInvalidCompressionLevel, err)
+		}
+	})
+}
+
 func setupServer(reflectionHandler func(w http.ResponseWriter, r *http.Request)) *httptest.Server {
 	router := http.NewServeMux()
 	router.HandleFunc(EndpointReflect, reflectionHandler)
@@ -271,3 +353,23 @@ func connectToServer(mockServer *httptest.Server) (*websocket.Conn, error) {
 
 	return ws, nil
 }
+
+func dialServer(mockServer *httptest.Server, dialer *websocket.Dialer) (*websocket.Conn, *http.Response, error) {
+	wsURL := "ws" + strings.TrimPrefix(mockServer.URL, "http") + EndpointReflect
+	return dialer.Dial(wsURL, nil)
+}
+
+func sendClientMessage(t *testing.T, ws *websocket.Conn, messageType ClientMessageType, message interface{}) {
+	t.Helper()
+
+	rawMessage := ""
+	if message != nil {
+		jsonMessage, _ := json.Marshal(message)
+		rawMessage = string(jsonMessage)
+	}
+
+	err := ws.WriteJSON(ClientMessage{ServerVersion: serverVersion, MessageType: messageType, Message: rawMessage})
+	if err != nil {
+		t.Fatalf("Failed to write %q message: %v\n", messageType, err)
+	}
+}